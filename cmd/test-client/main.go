@@ -156,7 +156,7 @@ func testRedirect(shortCode string) {
 }
 
 func testListURLs() {
-	resp, err := http.Get(baseURL + "/api/urls?limit=10&offset=0")
+	resp, err := http.Get(baseURL + "/api/urls?limit=10")
 	if err != nil {
 		fmt.Printf("❌ Failed: %v\n", err)
 		return
@@ -169,7 +169,7 @@ func testListURLs() {
 	if resp.StatusCode == 200 {
 		urls := result["urls"].([]interface{})
 		fmt.Printf("✅ Retrieved %d URLs\n", len(urls))
-		fmt.Printf("   Total count: %.0f\n", result["count"].(float64))
+		fmt.Printf("   Total count: %.0f\n", result["total"].(float64))
 	} else {
 		fmt.Printf("❌ Failed with status: %d\n", resp.StatusCode)
 	}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +13,67 @@ type Config struct {
 	DatabasePath string
 	ShortCodeLen int
 	UseInMemory  bool
+
+	// Durability of the in-memory store; an empty data dir keeps it memory-only
+	InMemoryDataDir          string
+	InMemoryFsync            string
+	InMemoryFsyncInterval    time.Duration
+	InMemorySnapshotInterval time.Duration
+
+	// URL normalization
+	AllowedSchemes   []string
+	StripQueryParams []string
+
+	// Destination safety checks
+	BlocklistPath        string
+	UnsafeHashPrefixPath string
+	SafetyReloadInterval time.Duration
+	MaxSubdomains        int
+	ProtectedBrands      []string
+
+	// Self-shortening and third-party shortener chains
+	ShortDomains           []string
+	SelfLinkPolicy         string
+	ResolveShortenerChains bool
+	KnownShorteners        []string
+	MaxChainHops           int
+
+	// Server-side fetching of destinations
+	FetchTimeout      time.Duration
+	FetchMaxRedirects int
+	FetchMaxBodyBytes int64
+	FetchAllowedPorts []int
+	FetchAllowedCIDRs []string
+
+	LinkPreviews bool
+
+	// Redirect defaults for links that do not choose their own
+	DefaultRedirectType int
+	DefaultCacheControl string
+
+	MaxBatchSize int
+
+	// Go-links mode: codes with slashes, longest-prefix lookup and templates
+	GoLinks bool
+
+	// Branding of the HTML pages shown to browsers; empty values use the defaults
+	PageBrand           string
+	PageLogoURL         string
+	PageAccentColor     string
+	PageBackgroundColor string
+	PageTextColor       string
+	PageStylesheetURL   string
+	PageFooter          string
+	// PageTemplatesDir holds templates replacing the embedded ones by file name
+	PageTemplatesDir string
+
+	// QR codes: an optional logo for their centre and the images kept in memory
+	QRLogoPath  string
+	QRCacheSize int
+
+	// Soft-deleted links
+	TrashRetention time.Duration
+	PurgeInterval  time.Duration
 }
 
 func Load() *Config {
@@ -25,6 +87,57 @@ func Load() *Config {
 		DatabasePath: getEnv("DATABASE_PATH", "./urlshortener.db"),
 		ShortCodeLen: getEnvAsInt("SHORT_CODE_LEN", 6),
 		UseInMemory:  getEnvAsBool("USE_IN_MEMORY", true), // Changed default to true
+
+		InMemoryDataDir:          getEnv("IN_MEMORY_DATA_DIR", ""),
+		InMemoryFsync:            getEnv("IN_MEMORY_FSYNC", "interval"),
+		InMemoryFsyncInterval:    getEnvAsDuration("IN_MEMORY_FSYNC_INTERVAL", time.Second),
+		InMemorySnapshotInterval: getEnvAsDuration("IN_MEMORY_SNAPSHOT_INTERVAL", 5*time.Minute),
+
+		// Empty lists fall back to the service defaults
+		AllowedSchemes:   getEnvAsList("ALLOWED_SCHEMES", nil),
+		StripQueryParams: getEnvAsList("STRIP_QUERY_PARAMS", nil),
+
+		BlocklistPath:        getEnv("BLOCKLIST_PATH", ""),
+		UnsafeHashPrefixPath: getEnv("UNSAFE_HASH_PREFIX_PATH", ""),
+		SafetyReloadInterval: getEnvAsDuration("SAFETY_RELOAD_INTERVAL", 30*time.Second),
+		MaxSubdomains:        getEnvAsInt("MAX_SUBDOMAINS", 5),
+		ProtectedBrands:      getEnvAsList("PROTECTED_BRANDS", nil),
+
+		ShortDomains:           getEnvAsList("SHORT_DOMAINS", nil),
+		SelfLinkPolicy:         getEnv("SELF_LINK_POLICY", "collapse"),
+		ResolveShortenerChains: getEnvAsBool("RESOLVE_SHORTENER_CHAINS", false),
+		KnownShorteners:        getEnvAsList("KNOWN_SHORTENERS", nil),
+		MaxChainHops:           getEnvAsInt("MAX_CHAIN_HOPS", 3),
+
+		FetchTimeout:      getEnvAsDuration("FETCH_TIMEOUT", 5*time.Second),
+		FetchMaxRedirects: getEnvAsInt("FETCH_MAX_REDIRECTS", 5),
+		FetchMaxBodyBytes: int64(getEnvAsInt("FETCH_MAX_BODY_BYTES", 1<<20)),
+		FetchAllowedPorts: getEnvAsIntList("FETCH_ALLOWED_PORTS", []int{80, 443}),
+		FetchAllowedCIDRs: getEnvAsList("FETCH_ALLOWED_CIDRS", nil),
+
+		LinkPreviews: getEnvAsBool("LINK_PREVIEWS", true),
+
+		DefaultRedirectType: getEnvAsInt("DEFAULT_REDIRECT_TYPE", 302),
+		DefaultCacheControl: getEnv("DEFAULT_CACHE_CONTROL", "private, max-age=90"),
+
+		MaxBatchSize: getEnvAsInt("MAX_BATCH_SIZE", 1000),
+
+		GoLinks: getEnvAsBool("GO_LINKS", false),
+
+		PageBrand:           getEnv("PAGE_BRAND", ""),
+		PageLogoURL:         getEnv("PAGE_LOGO_URL", ""),
+		PageAccentColor:     getEnv("PAGE_ACCENT_COLOR", ""),
+		PageBackgroundColor: getEnv("PAGE_BACKGROUND_COLOR", ""),
+		PageTextColor:       getEnv("PAGE_TEXT_COLOR", ""),
+		PageStylesheetURL:   getEnv("PAGE_STYLESHEET_URL", ""),
+		PageFooter:          getEnv("PAGE_FOOTER", ""),
+		PageTemplatesDir:    getEnv("PAGE_TEMPLATES_DIR", ""),
+
+		QRLogoPath:  getEnv("QR_LOGO_PATH", ""),
+		QRCacheSize: getEnvAsInt("QR_CACHE_SIZE", 1000),
+
+		TrashRetention: getEnvAsDuration("TRASH_RETENTION", 30*24*time.Hour),
+		PurgeInterval:  getEnvAsDuration("PURGE_INTERVAL", time.Hour),
 	}
 }
 
@@ -52,3 +165,43 @@ func getEnvAsBool(key string, defaultVal bool) bool {
 	}
 	return defaultVal
 }
+
+func getEnvAsDuration(key string, defaultVal time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultVal
+}
+
+// getEnvAsList reads a comma separated list, ignoring empty entries
+func getEnvAsList(key string, defaultVal []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultVal
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvAsIntList(key string, defaultVal []int) []int {
+	var list []int
+	for _, item := range getEnvAsList(key, nil) {
+		intVal, err := strconv.Atoi(item)
+		if err != nil {
+			return defaultVal
+		}
+		list = append(list, intVal)
+	}
+	if len(list) == 0 {
+		return defaultVal
+	}
+	return list
+}
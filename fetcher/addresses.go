@@ -0,0 +1,52 @@
+package fetcher
+
+import "net"
+
+// blockedNetworks are special purpose ranges not covered by the net.IP helpers
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",          // "this" network
+	"100.64.0.0/10",      // carrier-grade NAT, also used for cloud metadata
+	"192.0.0.0/24",       // IETF protocol assignments
+	"192.0.2.0/24",       // TEST-NET-1
+	"198.18.0.0/15",      // benchmarking
+	"198.51.100.0/24",    // TEST-NET-2
+	"203.0.113.0/24",     // TEST-NET-3
+	"240.0.0.0/4",        // reserved
+	"255.255.255.255/32", // broadcast
+	"64:ff9b::/96",       // NAT64, may map onto internal IPv4 addresses
+	"64:ff9b:1::/48",     // local-use NAT64
+	"2001:db8::/32",      // documentation
+)
+
+// IsInternal reports whether ip is loopback, private, link-local (including
+// the 169.254.169.254 cloud metadata address) or otherwise not publicly routable
+func IsInternal(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
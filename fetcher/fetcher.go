@@ -0,0 +1,246 @@
+// Package fetcher performs server-side HTTP requests to user supplied URLs
+// without letting them reach internal addresses. DNS is resolved once per
+// connection and every resolved address is checked before dialing, so a host
+// cannot be re-pointed at a private address between the check and the request.
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrBlockedAddress    = errors.New("destination address is not allowed")
+	ErrBlockedPort       = errors.New("destination port is not allowed")
+	ErrUnsupportedScheme = errors.New("only http and https URLs can be fetched")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+)
+
+// Config limits what a Fetcher may request
+type Config struct {
+	// Timeout bounds the whole request, including redirects and body
+	Timeout time.Duration
+	// MaxRedirects is the number of redirects followed by Get
+	MaxRedirects int
+	// MaxBodyBytes caps how much of a response body is read
+	MaxBodyBytes int64
+	// AllowedPorts lists the destination ports that may be dialed
+	AllowedPorts []int
+	// AllowedCIDRs exempts networks from the internal address blocklist,
+	// e.g. "127.0.0.0/8" to fetch from local test servers
+	AllowedCIDRs []string
+	// UserAgent is sent with every request
+	UserAgent string
+}
+
+// DefaultConfig returns conservative limits for fetching public web pages
+func DefaultConfig() Config {
+	return Config{
+		Timeout:      5 * time.Second,
+		MaxRedirects: 5,
+		MaxBodyBytes: 1 << 20,
+		AllowedPorts: []int{80, 443},
+		UserAgent:    "url-shortener/1.0 (+link-preview)",
+	}
+}
+
+// Response is a fully read, size-capped HTTP response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Truncated is set when the body was cut off at MaxBodyBytes
+	Truncated bool
+	// URL is the final URL after any redirects
+	URL *url.URL
+}
+
+// Fetcher issues SSRF-safe HTTP requests
+type Fetcher struct {
+	config   Config
+	client   *http.Client
+	ports    map[int]bool
+	allowed  []*net.IPNet
+	resolver *net.Resolver
+}
+
+func New(config Config) (*Fetcher, error) {
+	defaults := DefaultConfig()
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.MaxRedirects < 0 {
+		config.MaxRedirects = 0
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = defaults.MaxBodyBytes
+	}
+	if len(config.AllowedPorts) == 0 {
+		config.AllowedPorts = defaults.AllowedPorts
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = defaults.UserAgent
+	}
+
+	f := &Fetcher{
+		config:   config,
+		ports:    make(map[int]bool, len(config.AllowedPorts)),
+		resolver: net.DefaultResolver,
+	}
+	for _, port := range config.AllowedPorts {
+		f.ports[port] = true
+	}
+	for _, cidr := range config.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed CIDR %q: %w", cidr, err)
+		}
+		f.allowed = append(f.allowed, network)
+	}
+
+	transport := &http.Transport{
+		// Never use environment proxies: the proxy would dial on our behalf
+		// and bypass the address checks below.
+		Proxy:                 nil,
+		DialContext:           f.dialContext,
+		TLSHandshakeTimeout:   config.Timeout,
+		ResponseHeaderTimeout: config.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	f.client = &http.Client{
+		Transport: transport,
+		Timeout:   config.Timeout,
+	}
+
+	return f, nil
+}
+
+// Get fetches rawURL, following up to MaxRedirects redirects
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*Response, error) {
+	return f.do(ctx, http.MethodGet, rawURL, true)
+}
+
+// Peek issues a single request without following redirects or reading the
+// body, which is enough to inspect status codes and Location headers
+func (f *Fetcher) Peek(ctx context.Context, method, rawURL string) (*Response, error) {
+	return f.do(ctx, method, rawURL, false)
+}
+
+func (f *Fetcher) do(ctx context.Context, method, rawURL string, follow bool) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.config.UserAgent)
+
+	client := *f.client
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if !follow {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > f.config.MaxRedirects {
+			return ErrTooManyRedirects
+		}
+		return checkScheme(next.URL)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		URL:        resp.Request.URL,
+	}
+
+	if follow && method != http.MethodHead {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, f.config.MaxBodyBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > f.config.MaxBodyBytes {
+			body = body[:f.config.MaxBodyBytes]
+			result.Truncated = true
+		}
+		result.Body = body
+	}
+
+	return result, nil
+}
+
+// dialContext resolves the host once and only dials addresses that pass the checks
+func (f *Fetcher) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || !f.ports[port] {
+		return nil, fmt.Errorf("%w: %s", ErrBlockedPort, portStr)
+	}
+
+	addrs, err := f.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	// Refuse the host outright if any of its addresses is internal, so that
+	// round-robin records cannot smuggle an internal address through.
+	for _, addr := range addrs {
+		if !f.isAllowed(addr.IP) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrBlockedAddress, host, addr.IP)
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: f.config.Timeout}
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.IP.String(), portStr))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// isAllowed reports whether ip may be dialed
+func (f *Fetcher) isAllowed(ip net.IP) bool {
+	for _, network := range f.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return !IsInternal(ip)
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupportedScheme
+	}
+	return nil
+}
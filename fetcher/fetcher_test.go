@@ -0,0 +1,180 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsInternal(t *testing.T) {
+	internal := []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.100.100.200", "0.0.0.0", "::1", "fd00:ec2::254", "fe80::1",
+		"::ffff:127.0.0.1", "64:ff9b::a00:1", "224.0.0.1",
+	}
+	for _, addr := range internal {
+		if !IsInternal(net.ParseIP(addr)) {
+			t.Errorf("Expected %s to be internal", addr)
+		}
+	}
+
+	for _, addr := range []string{"93.184.216.34", "8.8.8.8", "2606:4700:4700::1111"} {
+		if IsInternal(net.ParseIP(addr)) {
+			t.Errorf("Expected %s to be public", addr)
+		}
+	}
+}
+
+// localConfig allows fetching from a loopback test server
+func localConfig(serverURL string) Config {
+	u, _ := url.Parse(serverURL)
+	port, _ := strconv.Atoi(u.Port())
+
+	config := DefaultConfig()
+	config.AllowedPorts = []int{port}
+	config.AllowedCIDRs = []string{"127.0.0.0/8", "::1/128"}
+	return config
+}
+
+func TestFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Write([]byte("<title>hello</title>"))
+		case "/large":
+			w.Write([]byte(strings.Repeat("a", 4096)))
+		case "/redirect":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/internal":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+		case "/scheme":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	t.Run("Block loopback without override", func(t *testing.T) {
+		config := localConfig(server.URL)
+		config.AllowedCIDRs = nil
+		f, _ := New(config)
+
+		_, err := f.Get(ctx, server.URL+"/page")
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Expected ErrBlockedAddress, got %v", err)
+		}
+	})
+
+	t.Run("Block ports outside the allowlist", func(t *testing.T) {
+		config := localConfig(server.URL)
+		config.AllowedPorts = []int{443}
+		f, _ := New(config)
+
+		_, err := f.Get(ctx, server.URL+"/page")
+		if !errors.Is(err, ErrBlockedPort) {
+			t.Errorf("Expected ErrBlockedPort, got %v", err)
+		}
+	})
+
+	f, err := New(localConfig(server.URL))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Fetch allowed page", func(t *testing.T) {
+		resp, err := f.Get(ctx, server.URL+"/page")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if string(resp.Body) != "<title>hello</title>" {
+			t.Errorf("Unexpected body %q", resp.Body)
+		}
+	})
+
+	t.Run("Follow redirects", func(t *testing.T) {
+		resp, err := f.Get(ctx, server.URL+"/redirect")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if resp.URL.Path != "/page" {
+			t.Errorf("Expected final URL /page, got %s", resp.URL)
+		}
+	})
+
+	t.Run("Cap redirects", func(t *testing.T) {
+		_, err := f.Get(ctx, server.URL+"/loop")
+		if !errors.Is(err, ErrTooManyRedirects) {
+			t.Errorf("Expected ErrTooManyRedirects, got %v", err)
+		}
+	})
+
+	t.Run("Block redirects to internal addresses", func(t *testing.T) {
+		config := localConfig(server.URL)
+		config.AllowedPorts = append(config.AllowedPorts, 80)
+		f, _ := New(config)
+
+		_, err := f.Get(ctx, server.URL+"/internal")
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Expected ErrBlockedAddress, got %v", err)
+		}
+	})
+
+	t.Run("Block redirects to other schemes", func(t *testing.T) {
+		_, err := f.Get(ctx, server.URL+"/scheme")
+		if !errors.Is(err, ErrUnsupportedScheme) {
+			t.Errorf("Expected ErrUnsupportedScheme, got %v", err)
+		}
+	})
+
+	t.Run("Peek does not follow redirects", func(t *testing.T) {
+		resp, err := f.Peek(ctx, http.MethodHead, server.URL+"/redirect")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/page" {
+			t.Errorf("Expected 302 to /page, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+		}
+	})
+
+	t.Run("Truncate large bodies", func(t *testing.T) {
+		config := localConfig(server.URL)
+		config.MaxBodyBytes = 1024
+		f, _ := New(config)
+
+		resp, err := f.Get(ctx, server.URL+"/large")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(resp.Body) != 1024 || !resp.Truncated {
+			t.Errorf("Expected 1024 truncated bytes, got %d (truncated=%v)", len(resp.Body), resp.Truncated)
+		}
+	})
+
+	t.Run("Enforce timeout", func(t *testing.T) {
+		config := localConfig(server.URL)
+		config.Timeout = 50 * time.Millisecond
+		f, _ := New(config)
+
+		if _, err := f.Get(ctx, server.URL+"/slow"); err == nil {
+			t.Error("Expected timeout error")
+		}
+	})
+
+	t.Run("Reject unsupported schemes", func(t *testing.T) {
+		if _, err := f.Get(ctx, "gopher://example.com/"); !errors.Is(err, ErrUnsupportedScheme) {
+			t.Errorf("Expected ErrUnsupportedScheme, got %v", err)
+		}
+	})
+}
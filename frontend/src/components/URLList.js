@@ -14,28 +14,43 @@ function URLList({ refresh, onViewStats }) {
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
   const [deletingId, setDeletingId] = useState(null);
+  const [query, setQuery] = useState('');
+  const [highlights, setHighlights] = useState({});
 
   useEffect(() => {
     fetchURLs();
   }, [refresh]);
 
-  const fetchURLs = async () => {
+  const fetchURLs = async (search = query) => {
     setLoading(true);
     setError('');
     
     try {
-      // Get all URLs from backend
-      const data = await api.listURLs(1000, 0); // Get a large number to filter client-side
+      let found;
+      const matches = {};
+      if (search.trim()) {
+        // Search ranks the best matches first and marks the matching words
+        const data = await api.searchURLs(search, 100);
+        found = (data.results || []).map(result => {
+          matches[result.url.short_code] = result.highlights || {};
+          return result.url;
+        });
+      } else {
+        // Get all URLs from backend
+        const data = await api.listURLs(1000); // Get a large number to filter client-side
+        found = data.urls || [];
+      }
       
       // Get user's URLs from localStorage
       const myShortCodes = JSON.parse(localStorage.getItem('myUrls') || '[]');
       
       // Filter to only show URLs created by this user
-      const myUrls = (data.urls || []).filter(url => 
+      const myUrls = found.filter(url => 
         myShortCodes.includes(url.short_code)
       );
       
       setUrls(myUrls);
+      setHighlights(matches);
     } catch (err) {
       setError(err.message);
     } finally {
@@ -44,7 +59,7 @@ function URLList({ refresh, onViewStats }) {
   };
 
   const handleDelete = async (shortCode) => {
-    if (!window.confirm('Are you sure you want to delete this URL?')) {
+    if (!window.confirm('Move this URL to the trash? It can be restored until the trash is purged.')) {
       return;
     }
 
@@ -66,6 +81,38 @@ function URLList({ refresh, onViewStats }) {
     }
   };
 
+  const handleSearch = (e) => {
+    e.preventDefault();
+    fetchURLs();
+  };
+
+  const clearSearch = () => {
+    setQuery('');
+    fetchURLs('');
+  };
+
+  // The most telling highlighted field, already HTML-escaped by the server
+  const matchSnippet = (shortCode) => {
+    const fields = highlights[shortCode] || {};
+    return fields.title || fields.notes || fields.destination;
+  };
+
+  const searchForm = (
+    <form onSubmit={handleSearch} className="search-form">
+      <input
+        type="search"
+        value={query}
+        onChange={(e) => setQuery(e.target.value)}
+        placeholder="Search code, destination, title or notes"
+        className="search-input"
+      />
+      <button type="submit" className="refresh-button">🔍 Search</button>
+      {query && (
+        <button type="button" onClick={clearSearch} className="refresh-button">✖ Clear</button>
+      )}
+    </form>
+  );
+
   const copyToClipboard = (text) => {
     navigator.clipboard.writeText(text);
     alert('Copied to clipboard!');
@@ -100,13 +147,27 @@ function URLList({ refresh, onViewStats }) {
         <div className="error-message">
           ❌ {error}
         </div>
-        <button onClick={fetchURLs} className="retry-button">
+        <button onClick={() => fetchURLs()} className="retry-button">
           🔄 Retry
         </button>
       </div>
     );
   }
 
+  if (urls.length === 0 && query.trim()) {
+    return (
+      <div className="url-list">
+        <h2>📋 My URLs</h2>
+        {searchForm}
+        <div className="empty-state">
+          <div className="empty-icon">🔍</div>
+          <h3>No matches</h3>
+          <p>None of your URLs match “{query}”.</p>
+        </div>
+      </div>
+    );
+  }
+
   if (urls.length === 0) {
     const myShortCodes = JSON.parse(localStorage.getItem('myUrls') || '[]');
     const hasUrlsInStorage = myShortCodes.length > 0;
@@ -131,10 +192,11 @@ function URLList({ refresh, onViewStats }) {
     <div className="url-list">
       <div className="list-header">
         <h2>📋 My URLs</h2>
-        <button onClick={fetchURLs} className="refresh-button">
+        <button onClick={() => fetchURLs()} className="refresh-button">
           🔄 Refresh
         </button>
       </div>
+      {searchForm}
 
       <div className="urls-grid">
         {urls.map((url) => (
@@ -145,6 +207,27 @@ function URLList({ refresh, onViewStats }) {
             </div>
 
             <div className="url-card-body">
+              {url.title && <div className="url-custom-title">{url.title}</div>}
+
+              {url.tags && url.tags.length > 0 && (
+                <div className="url-tags">
+                  {url.tags.map(tag => (
+                    <span key={tag} className="url-tag">#{tag}</span>
+                  ))}
+                </div>
+              )}
+
+              {url.preview && url.preview.title && (
+                <div className="url-preview">
+                  {url.preview.favicon_url && (
+                    <img src={url.preview.favicon_url} alt="" className="url-favicon" />
+                  )}
+                  <span className="url-title" title={url.preview.description || url.preview.title}>
+                    {url.preview.title}
+                  </span>
+                </div>
+              )}
+
               <div className="url-info">
                 <label>Short URL:</label>
                 <div className="url-value">
@@ -183,6 +266,13 @@ function URLList({ refresh, onViewStats }) {
                 </div>
               </div>
 
+              {matchSnippet(url.short_code) && (
+                <div
+                  className="url-match"
+                  dangerouslySetInnerHTML={{ __html: matchSnippet(url.short_code) }}
+                />
+              )}
+
               <div className="url-meta">
                 <span>📅 {formatDate(url.created_at)}</span>
               </div>
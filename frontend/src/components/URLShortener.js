@@ -12,6 +12,8 @@ const getBaseURL = () => {
 function URLShortener({ onURLCreated }) {
   const [longUrl, setLongUrl] = useState('');
   const [customCode, setCustomCode] = useState('');
+  const [title, setTitle] = useState('');
+  const [tags, setTags] = useState('');
   const [shortUrl, setShortUrl] = useState('');
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
@@ -25,13 +27,18 @@ function URLShortener({ onURLCreated }) {
     setCopied(false);
 
     try {
-      const data = await api.shortenURL(longUrl, customCode);
+      const data = await api.shortenURL(longUrl, customCode, {
+        title,
+        tags: tags.split(/[\s,]+/).filter(Boolean),
+      });
       // Construct URL using same logic as URLList to ensure consistency
       // This also fixes any double-slash issues from backend
       const shortUrlToDisplay = `${getBaseURL()}/${data.short_code}`;
       setShortUrl(shortUrlToDisplay);
       setLongUrl('');
       setCustomCode('');
+      setTitle('');
+      setTags('');
       
       // Save to localStorage for "My URLs" tracking
       const myUrls = JSON.parse(localStorage.getItem('myUrls') || '[]');
@@ -88,6 +95,30 @@ function URLShortener({ onURLCreated }) {
           <small>Leave empty for a random code</small>
         </div>
 
+        <div className="input-group">
+          <label>Title (optional)</label>
+          <input
+            type="text"
+            value={title}
+            onChange={(e) => setTitle(e.target.value)}
+            placeholder="Spring launch page"
+            className="input"
+            maxLength={200}
+          />
+        </div>
+
+        <div className="input-group">
+          <label>Tags (optional)</label>
+          <input
+            type="text"
+            value={tags}
+            onChange={(e) => setTags(e.target.value)}
+            placeholder="marketing, q2"
+            className="input"
+          />
+          <small>Separate tags with commas or spaces</small>
+        </div>
+
         <button
           type="submit"
           disabled={loading}
@@ -2,7 +2,7 @@ const API_BASE = process.env.REACT_APP_API_URL || 'http://localhost:8080/api';
 
 export const api = {
   // Shorten a URL
-  shortenURL: async (url, customCode = '') => {
+  shortenURL: async (url, customCode = '', { title = '', tags = [] } = {}) => {
     const response = await fetch(`${API_BASE}/shorten`, {
       method: 'POST',
       headers: {
@@ -11,6 +11,8 @@ export const api = {
       body: JSON.stringify({
         url,
         custom_code: customCode || undefined,
+        title: title || undefined,
+        tags: tags.length ? tags : undefined,
       }),
     });
 
@@ -36,8 +38,12 @@ export const api = {
   },
 
   // List all URLs
-  listURLs: async (limit = 50, offset = 0) => {
-    const response = await fetch(`${API_BASE}/urls?limit=${limit}&offset=${offset}`);
+  listURLs: async (limit = 50, cursor = '') => {
+    const params = new URLSearchParams({ limit });
+    if (cursor) {
+      params.set('cursor', cursor);
+    }
+    const response = await fetch(`${API_BASE}/urls?${params}`);
     const data = await response.json();
 
     if (!response.ok) {
@@ -47,6 +53,31 @@ export const api = {
     return data;
   },
 
+  // List tags with the number of links carrying them
+  listTags: async () => {
+    const response = await fetch(`${API_BASE}/tags`);
+    const data = await response.json();
+
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to fetch tags');
+    }
+
+    return data;
+  },
+
+  // Search URLs by short code, destination, title or notes
+  searchURLs: async (query, limit = 20) => {
+    const params = new URLSearchParams({ q: query, limit });
+    const response = await fetch(`${API_BASE}/search?${params}`);
+    const data = await response.json();
+
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to search URLs');
+    }
+
+    return data;
+  },
+
   // Delete a URL
   deleteURL: async (shortCode) => {
     const response = await fetch(`${API_BASE}/urls/${shortCode}`, {
@@ -61,6 +92,33 @@ export const api = {
     return true;
   },
 
+  // Restore a URL from the trash
+  restoreURL: async (shortCode) => {
+    const response = await fetch(`${API_BASE}/urls/${shortCode}/restore`, {
+      method: 'POST',
+    });
+
+    const data = await response.json();
+
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to restore URL');
+    }
+
+    return data;
+  },
+
+  // Get deleted URLs
+  getTrash: async (limit = 10, offset = 0) => {
+    const response = await fetch(`${API_BASE}/trash?limit=${limit}&offset=${offset}`);
+    const data = await response.json();
+
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to fetch trash');
+    }
+
+    return data;
+  },
+
   // Check API health
   checkHealth: async () => {
     const response = await fetch(`${API_BASE}/health`);
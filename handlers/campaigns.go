@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"url-shortener/models"
+	"url-shortener/service"
+	"url-shortener/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// campaignID reads the :id path parameter, answering 400 when it is not a number
+func campaignID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// writeCampaignError maps errors from campaign requests to a status and body
+func writeCampaignError(c *gin.Context, err error, fallback string) {
+	switch {
+	case err == storage.ErrCampaignNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+	case err == storage.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+	case errors.Is(err, service.ErrNotInCampaign):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCampaign), errors.Is(err, service.ErrInvalidUTM), errors.Is(err, service.ErrInvalidStatsRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// CreateCampaign handles POST /api/campaigns
+func (h *URLHandler) CreateCampaign(c *gin.Context) {
+	var req models.CampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	campaign, err := h.service.CreateCampaign(&req)
+	if err != nil {
+		writeCampaignError(c, err, "Failed to create campaign")
+		return
+	}
+
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// ListCampaigns handles GET /api/campaigns
+func (h *URLHandler) ListCampaigns(c *gin.Context) {
+	campaigns, err := h.service.Campaigns()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve campaigns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"campaigns": campaigns,
+		"count":     len(campaigns),
+	})
+}
+
+// GetCampaign handles GET /api/campaigns/:id
+func (h *URLHandler) GetCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := h.service.Campaign(id)
+	if err != nil {
+		writeCampaignError(c, err, "Failed to retrieve campaign")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// UpdateCampaign handles PATCH /api/campaigns/:id
+func (h *URLHandler) UpdateCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CampaignUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	campaign, err := h.service.UpdateCampaign(id, &req)
+	if err != nil {
+		writeCampaignError(c, err, "Failed to update campaign")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// DeleteCampaign handles DELETE /api/campaigns/:id
+func (h *URLHandler) DeleteCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteCampaign(id); err != nil {
+		writeCampaignError(c, err, "Failed to delete campaign")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Campaign deleted"})
+}
+
+// AddCampaignLinks handles POST /api/campaigns/:id/links
+func (h *URLHandler) AddCampaignLinks(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CampaignLinksRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	campaign, err := h.service.AddCampaignLinks(id, req.ShortCodes)
+	if err != nil {
+		writeCampaignError(c, err, "Failed to add links to campaign")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// RemoveCampaignLink handles DELETE /api/campaigns/:id/links/:shortCode
+func (h *URLHandler) RemoveCampaignLink(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveCampaignLink(id, c.Param("shortCode")); err != nil {
+		writeCampaignError(c, err, "Failed to remove link from campaign")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Link removed from campaign"})
+}
+
+// CampaignStats handles GET /api/campaigns/:id/stats?from=&to=&interval=hour|day
+func (h *URLHandler) CampaignStats(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	var from, to time.Time
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + " parameter, expected an RFC 3339 time"})
+				return
+			}
+			*target = t
+		}
+	}
+
+	stats, err := h.service.CampaignStats(id, from, to, c.Query("interval"))
+	if err != nil {
+		writeCampaignError(c, err, "Failed to retrieve campaign stats")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"url-shortener/models"
+	"url-shortener/pages"
+	"url-shortener/safety"
+	"url-shortener/service"
+	"url-shortener/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wantsHTML reports whether the Accept header prefers HTML to JSON, as the
+// ones of browsers following a short link do. Clients accepting anything get JSON.
+func wantsHTML(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+}
+
+// renderPage answers with one of the HTML pages
+func (h *URLHandler) renderPage(c *gin.Context, status int, page string, data any) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	if err := h.pages.Render(c.Writer, page, data); err != nil {
+		log.Printf("%s page: %v", page, err)
+	}
+}
+
+// redirectError answers a redirect to path that failed, with a page for
+// browsers and JSON otherwise
+func (h *URLHandler) redirectError(c *gin.Context, path string, err error) {
+	html := wantsHTML(c)
+	var rejection *safety.Rejection
+	switch {
+	case err == storage.ErrNotFound:
+		h.linkNotFound(c, path, html)
+	case errors.Is(err, service.ErrLinkExpired), errors.Is(err, service.ErrLinkDeleted):
+		expired := errors.Is(err, service.ErrLinkExpired)
+		if html {
+			h.renderPage(c, http.StatusGone, pages.Gone, pages.GoneData{Path: path, Expired: expired})
+		} else if expired {
+			c.JSON(http.StatusGone, gin.H{"error": "Link has expired"})
+		} else {
+			c.JSON(http.StatusGone, gin.H{"error": "Link has been deleted"})
+		}
+	case errors.Is(err, service.ErrLinkDisabled) && errors.As(err, &rejection):
+		if html {
+			h.renderPage(c, http.StatusUnavailableForLegalReasons, pages.Unavailable, pages.UnavailableData{Path: path, Reason: rejection.Reason})
+		} else {
+			c.JSON(http.StatusUnavailableForLegalReasons, gin.H{"error": "Link has been disabled", "reason": rejection.Reason})
+		}
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve URL"})
+	}
+}
+
+// linkNotFound answers a redirect to an unknown link with the closest existing
+// codes: an HTML page for browsers, JSON with a suggestions array otherwise
+func (h *URLHandler) linkNotFound(c *gin.Context, path string, html bool) {
+	codes := h.service.Suggest(path)
+	suggestions := make([]models.Suggestion, len(codes))
+	for i, code := range codes {
+		suggestions[i] = models.Suggestion{ShortCode: code, ShortURL: h.shortURL(code)}
+	}
+
+	if !html {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found", "suggestions": suggestions})
+		return
+	}
+	h.renderPage(c, http.StatusNotFound, pages.NotFound, pages.NotFoundData{Path: path, Suggestions: suggestions})
+}
+
+// previewURL shows where the link behind path leads without following it or
+// counting a visit
+func (h *URLHandler) previewURL(c *gin.Context, path string, visit service.Visit) {
+	url, suffix, err := h.service.Preview(path)
+	if err != nil {
+		h.redirectError(c, path, err)
+		return
+	}
+	visit.Path = suffix
+	h.showInterstitial(c, url, h.service.FinalURL(url, &visit))
+}
+
+// showInterstitial answers with where a link leads instead of redirecting:
+// the interstitial page for browsers, JSON otherwise
+func (h *URLHandler) showInterstitial(c *gin.Context, url *models.URL, destination string) {
+	response := models.PreviewResponse{
+		ShortCode:    url.ShortCode,
+		ShortURL:     h.shortURL(url.ShortCode),
+		Destination:  destination,
+		Title:        url.Title,
+		Interstitial: url.Interstitial,
+		Clicks:       url.Clicks,
+		CreatedAt:    url.CreatedAt,
+		Preview:      url.Preview,
+	}
+	var description string
+	if url.Preview != nil {
+		if response.Title == "" {
+			response.Title = url.Preview.Title
+		}
+		description = url.Preview.Description
+	}
+
+	if !wantsHTML(c) {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	h.renderPage(c, http.StatusOK, pages.Interstitial, pages.InterstitialData{PreviewResponse: response, Description: description})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/models"
+	"url-shortener/service"
+	"url-shortener/storage"
+)
+
+func TestRedirectErrorPages(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	svc := service.NewURLService(store, 6)
+	router := newTestRouter(t, svc)
+	svc.Shorten(&models.ShortenRequest{URL: "https://example.com/promo", CustomCode: "promo"}, "alice")
+	svc.Shorten(&models.ShortenRequest{URL: "https://example.com/old", CustomCode: "old"}, "alice")
+	if err := svc.DeleteURL("old", "alice"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := store.Save(&models.URL{ShortCode: "gone", OriginalURL: "https://example.com/gone", ExpiresAt: &past, CreatedAt: past}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	browser := http.Header{"Accept": {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}}
+	cases := []struct {
+		name   string
+		path   string
+		header http.Header
+		status int
+		html   bool
+		body   string
+	}{
+		{"Not found for browsers", "/promp", browser, http.StatusNotFound, true, "http://localhost:8080/promo"},
+		{"Not found for API clients", "/promp", http.Header{"Accept": {"application/json"}}, http.StatusNotFound, false, `"suggestions"`},
+		{"Not found for any client", "/promp", http.Header{"Accept": {"*/*"}}, http.StatusNotFound, false, `"suggestions"`},
+		{"Not found without Accept", "/promp", nil, http.StatusNotFound, false, `"suggestions"`},
+		{"Deleted for browsers", "/old", browser, http.StatusGone, true, "has been deleted"},
+		{"Deleted for API clients", "/old", nil, http.StatusGone, false, "Link has been deleted"},
+		{"Expired for browsers", "/gone", browser, http.StatusGone, true, "has expired"},
+		{"Expired for API clients", "/gone", nil, http.StatusGone, false, "Link has expired"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(router, http.MethodGet, tc.path, nil, tc.header)
+			if w.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, w.Code)
+			}
+			contentType := w.Header().Get("Content-Type")
+			if tc.html && !strings.HasPrefix(contentType, "text/html") {
+				t.Errorf("Expected an HTML page, got '%s'", contentType)
+			}
+			if !tc.html && !json.Valid(w.Body.Bytes()) {
+				t.Errorf("Expected JSON, got '%s': %s", contentType, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("Expected the body to contain '%s', got %s", tc.body, w.Body)
+			}
+		})
+	}
+
+	t.Run("Suggest close codes", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/promp", nil, nil)
+		var response struct {
+			Suggestions []models.Suggestion `json:"suggestions"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if len(response.Suggestions) != 1 || response.Suggestions[0].ShortCode != "promo" {
+			t.Errorf("Expected promo to be suggested, got %v", response.Suggestions)
+		}
+	})
+}
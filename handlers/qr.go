@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"url-shortener/models"
+	"url-shortener/qrcode"
+	"url-shortener/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults of the QR code query parameters
+const (
+	defaultQRSize       = 256
+	defaultQRMargin     = 4
+	defaultQRLevel      = "M"
+	defaultQRForeground = "000000"
+	defaultQRBackground = "ffffff"
+)
+
+// qrContentTypes maps the QR code formats to their content types
+var qrContentTypes = map[string]string{
+	qrcode.FormatPNG: "image/png",
+	qrcode.FormatSVG: "image/svg+xml",
+}
+
+// qrLinks returns the URLs of the QR code images of a short code
+func (h *URLHandler) qrLinks(shortCode string) models.QRLinks {
+	base := strings.TrimSuffix(h.baseURL, "/") + "/api/urls/" + url.PathEscape(shortCode) + "/qr"
+	return models.QRLinks{
+		PNG: base + "?format=" + qrcode.FormatPNG,
+		SVG: base + "?format=" + qrcode.FormatSVG,
+	}
+}
+
+// qrRequest reads the QR code query parameters of c for text
+func qrRequest(c *gin.Context, text string) (qrcode.Request, error) {
+	req := qrcode.Request{Text: text, Format: c.DefaultQuery("format", qrcode.FormatPNG)}
+	var err error
+	if req.Size, err = strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(defaultQRSize))); err != nil {
+		return req, errors.New("size must be a number")
+	}
+	if req.Margin, err = strconv.Atoi(c.DefaultQuery("margin", strconv.Itoa(defaultQRMargin))); err != nil {
+		return req, errors.New("margin must be a number")
+	}
+	if req.Level, err = qrcode.ParseLevel(c.DefaultQuery("ecc", defaultQRLevel)); err != nil {
+		return req, err
+	}
+	if req.Foreground, err = qrcode.ParseColor(c.DefaultQuery("fg", defaultQRForeground)); err != nil {
+		return req, err
+	}
+	if req.Background, err = qrcode.ParseColor(c.DefaultQuery("bg", defaultQRBackground)); err != nil {
+		return req, err
+	}
+	if req.Logo, err = strconv.ParseBool(c.DefaultQuery("logo", "false")); err != nil {
+		return req, errors.New("logo must be true or false")
+	}
+	return req, nil
+}
+
+// GetQRCode handles GET /api/urls/:shortCode/qr
+func (h *URLHandler) GetQRCode(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	if _, err := h.service.GetStats(shortCode); err != nil {
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve URL"})
+		return
+	}
+
+	req, err := qrRequest(c, h.shortURL(shortCode))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	img, err := h.qr.Render(req)
+	if err != nil {
+		if errors.Is(err, qrcode.ErrInvalidOptions) || err == qrcode.ErrNoLogo {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+		return
+	}
+
+	// The short URL of a code never changes, so neither does its image
+	sum := sha256.Sum256(img)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=86400")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, qrContentTypes[req.Format], img)
+}
@@ -1,24 +1,101 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 	"url-shortener/models"
+	"url-shortener/pages"
+	"url-shortener/qrcode"
+	"url-shortener/safety"
 	"url-shortener/service"
 	"url-shortener/storage"
+	"url-shortener/transfer"
 
 	"github.com/gin-gonic/gin"
 )
 
+// validationErrors are service errors caused by bad client input
+var validationErrors = []error{
+	service.ErrInvalidURL,
+	service.ErrSelfReference,
+	service.ErrRedirectLoop,
+	service.ErrInvalidRedirectType,
+	service.ErrInvalidCacheControl,
+	service.ErrInvalidExpiry,
+	service.ErrInvalidTag,
+	service.ErrTooManyTags,
+	service.ErrTitleTooLong,
+	service.ErrInvalidCampaign,
+	service.ErrInvalidUTM,
+	service.ErrReservedCode,
+	service.ErrInvalidCode,
+	service.ErrInvalidVariants,
+}
+
+func isValidationError(err error) bool {
+	for _, target := range validationErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// actor identifies who made a change, taken from the X-User header. Nothing
+// verifies the header, so any client can claim any name: the value labels
+// changes and owners for bookkeeping only and is no proof of identity until
+// requests are authenticated.
+func actor(c *gin.Context) string {
+	if user := c.GetHeader("X-User"); user != "" {
+		return user
+	}
+	return service.AnonymousActor
+}
+
+// changeError maps errors from creating or editing a link to a status and body
+func changeError(err error, fallback string) (int, gin.H) {
+	var rejection *safety.Rejection
+	switch {
+	case err == storage.ErrNotFound:
+		return http.StatusNotFound, gin.H{"error": "URL not found"}
+	case err == storage.ErrAlreadyExists:
+		return http.StatusConflict, gin.H{"error": "Custom code already exists"}
+	case err == storage.ErrConflict:
+		return http.StatusConflict, gin.H{"error": "URL was changed by another request, reload it and try again"}
+	case errors.Is(err, service.ErrLinkDeleted):
+		return http.StatusGone, gin.H{"error": "URL is in the trash"}
+	case errors.Is(err, service.ErrBatchAborted):
+		return http.StatusFailedDependency, gin.H{"error": err.Error()}
+	case isValidationError(err):
+		return http.StatusBadRequest, gin.H{"error": err.Error()}
+	case errors.As(err, &rejection):
+		return http.StatusUnprocessableEntity, gin.H{"error": "Destination rejected", "reason": rejection.Reason, "detail": rejection.Detail}
+	default:
+		return http.StatusInternalServerError, gin.H{"error": fallback}
+	}
+}
+
+func writeChangeError(c *gin.Context, err error, fallback string) {
+	c.JSON(changeError(err, fallback))
+}
+
 type URLHandler struct {
 	service *service.URLService
 	baseURL string
+	pages   *pages.Renderer
+	qr      *qrcode.Renderer
 }
 
-func NewURLHandler(service *service.URLService, baseURL string) *URLHandler {
+func NewURLHandler(service *service.URLService, baseURL string, pages *pages.Renderer, qr *qrcode.Renderer) *URLHandler {
 	return &URLHandler{
 		service: service,
 		baseURL: baseURL,
+		pages:   pages,
+		qr:      qr,
 	}
 }
 
@@ -30,46 +107,118 @@ func (h *URLHandler) ShortenURL(c *gin.Context) {
 		return
 	}
 
-	url, err := h.service.ShortenURL(req.URL, req.CustomCode)
+	url, err := h.service.Shorten(&req, actor(c))
+	if err != nil {
+		writeChangeError(c, err, "Failed to shorten URL")
+		return
+	}
+
+	c.JSON(http.StatusCreated, h.shortenResponse(url))
+}
+
+// ShortenBatch handles POST /api/shorten/batch
+func (h *URLHandler) ShortenBatch(c *gin.Context) {
+	var req models.BatchShortenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	results, err := h.service.ShortenBatch(req.Items, req.AllOrNothing, actor(c))
 	if err != nil {
-		if err == storage.ErrAlreadyExists {
-			c.JSON(http.StatusConflict, gin.H{"error": "Custom code already exists"})
+		if errors.Is(err, service.ErrBatchTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to shorten URL"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to shorten URLs"})
 		return
 	}
 
+	response := models.BatchShortenResponse{Results: make([]models.BatchItemResult, len(results))}
+	for i, result := range results {
+		item := models.BatchItemResult{Index: i, Status: http.StatusCreated}
+		if result.Err != nil {
+			status, body := changeError(result.Err, "Failed to shorten URL")
+			item.Status = status
+			item.Error, _ = body["error"].(string)
+			item.Reason, _ = body["reason"].(string)
+			item.Detail, _ = body["detail"].(string)
+			response.Failed++
+		} else {
+			created := h.shortenResponse(result.URL)
+			item.ShortenResponse = &created
+			response.Created++
+		}
+		response.Results[i] = item
+	}
+
+	status := http.StatusCreated
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, response)
+}
+
+// shortURL returns the public URL of a short code
+func (h *URLHandler) shortURL(shortCode string) string {
 	// Ensure baseURL doesn't end with slash to avoid double slashes
 	baseURL := h.baseURL
 	if len(baseURL) > 0 && baseURL[len(baseURL)-1] == '/' {
 		baseURL = baseURL[:len(baseURL)-1]
 	}
+	return baseURL + "/" + shortCode
+}
 
-	response := models.ShortenResponse{
-		ShortCode:   url.ShortCode,
-		ShortURL:    baseURL + "/" + url.ShortCode,
-		OriginalURL: url.OriginalURL,
+// shortenResponse describes a newly created link
+func (h *URLHandler) shortenResponse(url *models.URL) models.ShortenResponse {
+	return models.ShortenResponse{
+		ShortCode:    url.ShortCode,
+		ShortURL:     h.shortURL(url.ShortCode),
+		OriginalURL:  url.OriginalURL,
+		CanonicalURL: url.Destination(),
+		QR:           h.qrLinks(url.ShortCode),
 	}
-
-	c.JSON(http.StatusCreated, response)
 }
 
-// RedirectURL handles GET /:shortCode
+// RedirectURL handles GET /:shortCode and GET /:shortCode/*path, including
+// the previews asked for with /:shortCode+ and /:shortCode/preview
 func (h *URLHandler) RedirectURL(c *gin.Context) {
 	shortCode := c.Param("shortCode")
+	// Unknown API paths fall through to this route but never name a link
+	if shortCode == service.ReservedCode {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
 
-	url, err := h.service.GetURL(shortCode)
+	visit := service.Visit{
+		Referrer:  c.GetHeader("Referer"),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Query:     c.Request.URL.RawQuery,
+	}
+	path := shortCode + c.Param("path")
+	if code, preview := h.service.PreviewCode(path); preview {
+		h.previewURL(c, code, visit)
+		return
+	}
+
+	url, suffix, err := h.service.ResolvePath(path, visit)
 	if err != nil {
-		if err == storage.ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve URL"})
+		h.redirectError(c, path, err)
+		return
+	}
+	visit.Path = suffix
+	// The visit is counted, but the visitor has to choose to go on
+	if url.Interstitial {
+		h.showInterstitial(c, url, h.service.FinalURL(url, &visit))
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, url.OriginalURL)
+	status, cacheControl := h.service.RedirectPolicy(url)
+	if cacheControl != "" {
+		c.Header("Cache-Control", cacheControl)
+	}
+	c.Redirect(status, h.service.FinalURL(url, &visit))
 }
 
 // GetStats handles GET /api/stats/:shortCode
@@ -86,65 +235,371 @@ func (h *URLHandler) GetStats(c *gin.Context) {
 		return
 	}
 
+	variants, err := h.service.VariantStats(url)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve stats"})
+		return
+	}
+
+	redirectType, cacheControl := h.service.RedirectPolicy(url)
 	response := models.StatsResponse{
 		ShortCode:    url.ShortCode,
 		OriginalURL:  url.OriginalURL,
+		CanonicalURL: url.Destination(),
+		RedirectType: redirectType,
+		CacheControl: cacheControl,
+		ExpiresAt:    url.ExpiresAt,
+		Title:        url.Title,
+		Notes:        url.Notes,
+		Tags:         url.Tags,
+		CampaignID:   url.CampaignID,
+		UTM:          url.UTM,
+		UTMOverride:  url.UTMOverride,
+		Passthrough:  url.Passthrough,
+		Interstitial: url.Interstitial,
+		Variants:     variants,
+		Rotation:     url.Rotation,
+		FinalURL:     h.service.FinalURL(url, nil),
+		Owner:        url.Owner,
 		Clicks:       url.Clicks,
 		CreatedAt:    url.CreatedAt,
 		LastAccessed: url.LastAccessed,
+		DeletedAt:    url.DeletedAt,
+		Preview:      url.Preview,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// UpdateURL handles PATCH /api/urls/:shortCode
+func (h *URLHandler) UpdateURL(c *gin.Context) {
+	var req models.UpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	url, err := h.service.UpdateURL(c.Param("shortCode"), &req, actor(c))
+	if err != nil {
+		writeChangeError(c, err, "Failed to update URL")
+		return
+	}
+
+	c.JSON(http.StatusOK, url)
+}
+
+// GetHistory handles GET /api/urls/:shortCode/history
+func (h *URLHandler) GetHistory(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	revisions, err := h.service.History(shortCode)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"short_code": shortCode,
+		"revisions":  revisions,
+		"count":      len(revisions),
+	})
+}
+
+// RollbackURL handles POST /api/urls/:shortCode/rollback
+func (h *URLHandler) RollbackURL(c *gin.Context) {
+	var req models.RollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	url, err := h.service.Rollback(c.Param("shortCode"), req.Revision, actor(c))
+	if err != nil {
+		if errors.Is(err, service.ErrRevisionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		writeChangeError(c, err, "Failed to roll back URL")
+		return
+	}
+
+	c.JSON(http.StatusOK, url)
+}
+
+// RefreshPreview handles POST /api/urls/:shortCode/preview
+func (h *URLHandler) RefreshPreview(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	preview, err := h.service.RefreshPreview(shortCode)
+	if err != nil {
+		switch {
+		case err == storage.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		case errors.Is(err, service.ErrPreviewsDisabled):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "Link previews are disabled"})
+		case errors.Is(err, service.ErrPreviewFetch):
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh preview"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
 // DeleteURL handles DELETE /api/urls/:shortCode
 func (h *URLHandler) DeleteURL(c *gin.Context) {
 	shortCode := c.Param("shortCode")
 
-	err := h.service.DeleteURL(shortCode)
+	err := h.service.DeleteURL(shortCode, actor(c))
 	if err != nil {
 		if err == storage.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
 			return
 		}
+		if errors.Is(err, service.ErrLinkDeleted) {
+			c.JSON(http.StatusGone, gin.H{"error": "URL is already in the trash"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete URL"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "URL deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "URL moved to trash"})
 }
 
-// ListURLs handles GET /api/urls
-func (h *URLHandler) ListURLs(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "10")
-	offsetStr := c.DefaultQuery("offset", "0")
+// RestoreURL handles POST /api/urls/:shortCode/restore
+func (h *URLHandler) RestoreURL(c *gin.Context) {
+	url, err := h.service.RestoreURL(c.Param("shortCode"), actor(c))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		if errors.Is(err, service.ErrNotDeleted) {
+			c.JSON(http.StatusConflict, gin.H{"error": "URL is not in the trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore URL"})
+		return
+	}
+
+	c.JSON(http.StatusOK, url)
+}
 
-	limit, err := strconv.Atoi(limitStr)
+// ListTrash handles GET /api/trash
+func (h *URLHandler) ListTrash(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
 		return
 	}
 
-	offset, err := strconv.Atoi(offsetStr)
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset parameter"})
 		return
 	}
 
-	urls, err := h.service.ListURLs(limit, offset)
+	urls, err := h.service.ListTrash(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve trash"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"urls":      urls,
+		"limit":     limit,
+		"offset":    offset,
+		"count":     len(urls),
+		"retention": h.service.TrashRetention().String(),
+	})
+}
+
+// ListURLs handles GET /api/urls?limit=&cursor=&sort=&order=&created_after=&created_before=&min_clicks=&max_clicks=&owner=&tags=&campaign=
+func (h *URLHandler) ListURLs(c *gin.Context) {
+	opts, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.service.QueryURLs(opts)
+	if errors.Is(err, storage.ErrInvalidSort) || errors.Is(err, storage.ErrInvalidCursor) || isValidationError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve URLs"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"urls":   urls,
-		"limit":  limit,
-		"offset": offset,
-		"count":  len(urls),
+		"urls":        page.URLs,
+		"count":       len(page.URLs),
+		"total":       page.Total,
+		"limit":       opts.Limit,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// Search handles GET /api/search?q=&limit=
+func (h *URLHandler) Search(c *gin.Context) {
+	query := c.Query("q")
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(service.DefaultSearchLimit)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	results, err := h.service.Search(query, limit)
+	if errors.Is(err, service.ErrEmptySearch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search URLs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   query,
+		"results": results,
+		"count":   len(results),
+	})
+}
+
+// ListTags handles GET /api/tags
+func (h *URLHandler) ListTags(c *gin.Context) {
+	tags, err := h.service.Tags()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tags":  tags,
+		"count": len(tags),
 	})
 }
 
+// listOptions reads the paging, sort and filter query parameters of ListURLs
+func listOptions(c *gin.Context) (storage.ListOptions, error) {
+	opts := storage.ListOptions{
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+		Owner:  c.Query("owner"),
+	}
+	if tags := c.Query("tags"); tags != "" {
+		opts.Tags = strings.Split(tags, ",")
+	}
+
+	var err error
+	if opts.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "10")); err != nil {
+		return opts, errors.New("Invalid limit parameter")
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		opts.Ascending = true
+	case "desc":
+	default:
+		return opts, errors.New("Invalid order parameter, expected asc or desc")
+	}
+
+	for name, target := range map[string]**time.Time{
+		"created_after":  &opts.CreatedAfter,
+		"created_before": &opts.CreatedBefore,
+	} {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return opts, fmt.Errorf("Invalid %s parameter, expected an RFC 3339 time", name)
+			}
+			*target = &t
+		}
+	}
+
+	if campaign := c.Query("campaign"); campaign != "" {
+		if opts.CampaignID, err = strconv.ParseInt(campaign, 10, 64); err != nil {
+			return opts, errors.New("Invalid campaign parameter")
+		}
+	}
+
+	for name, target := range map[string]**int64{
+		"min_clicks": &opts.MinClicks,
+		"max_clicks": &opts.MaxClicks,
+	} {
+		if value := c.Query(name); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return opts, fmt.Errorf("Invalid %s parameter", name)
+			}
+			*target = &n
+		}
+	}
+
+	return opts, nil
+}
+
+// Export handles GET /api/export?format=csv|ndjson
+func (h *URLHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", transfer.FormatNDJSON)
+
+	encoder, err := transfer.NewEncoder(c.Writer, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", transfer.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="links.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure can only cut the stream short
+	err = h.service.Export(func(url *models.URL) error {
+		return encoder.Encode(transfer.FromURL(url))
+	})
+	if err != nil {
+		c.Error(err)
+	}
+	encoder.Flush()
+}
+
+// Import handles POST /api/import?format=csv|ndjson&on_conflict=skip|overwrite|rename
+func (h *URLHandler) Import(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = transfer.FormatNDJSON
+		if strings.HasPrefix(c.ContentType(), "text/csv") {
+			format = transfer.FormatCSV
+		}
+	}
+
+	decoder, err := transfer.NewDecoder(c.Request.Body, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.service.Import(decoder, c.DefaultQuery("on_conflict", service.ConflictSkip), actor(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidConflictPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read import: " + err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
 // HealthCheck handles GET /api/health
 func (h *URLHandler) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"url-shortener/models"
+	"url-shortener/pages"
+	"url-shortener/qrcode"
+	"url-shortener/safety"
+	"url-shortener/service"
+	"url-shortener/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter serves a handler over the service like setupRouter does, with
+// the routes under test
+func newTestRouter(t *testing.T, svc *service.URLService) *gin.Engine {
+	t.Helper()
+	renderer, err := pages.New(pages.Theme{}, "")
+	if err != nil {
+		t.Fatalf("Expected page templates to load, got %v", err)
+	}
+	handler := NewURLHandler(svc, "http://localhost:8080", renderer, qrcode.NewRenderer(nil, 8))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.UseRawPath = true
+	api := router.Group("/api")
+	api.POST("/shorten", handler.ShortenURL)
+	api.POST("/shorten/batch", handler.ShortenBatch)
+	api.PATCH("/urls/:shortCode", handler.UpdateURL)
+	api.GET("/urls/:shortCode/history", handler.GetHistory)
+	api.POST("/urls/:shortCode/rollback", handler.RollbackURL)
+	router.GET("/:shortCode", handler.RedirectURL)
+	router.GET("/:shortCode/*path", handler.RedirectURL)
+	return router
+}
+
+// serve sends a request with an optional JSON body and returns the recorded response
+func serve(router *gin.Engine, method, path string, body any, header http.Header) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRedirect(t *testing.T) {
+	svc := service.NewURLService(storage.NewInMemoryStorage(), 6)
+	router := newTestRouter(t, svc)
+
+	t.Run("Use the server defaults", func(t *testing.T) {
+		w := serve(router, http.MethodPost, "/api/shorten", models.ShortenRequest{URL: "https://example.com/docs", CustomCode: "docs"}, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body)
+		}
+
+		w = serve(router, http.MethodGet, "/docs", nil, nil)
+		if w.Code != http.StatusFound {
+			t.Errorf("Expected status 302, got %d", w.Code)
+		}
+		if location := w.Header().Get("Location"); location != "https://example.com/docs" {
+			t.Errorf("Expected redirect to the destination, got '%s'", location)
+		}
+		if cacheControl := w.Header().Get("Cache-Control"); cacheControl != service.DefaultCacheControl {
+			t.Errorf("Expected default Cache-Control, got '%s'", cacheControl)
+		}
+	})
+
+	t.Run("Use the link's own policy", func(t *testing.T) {
+		req := models.ShortenRequest{URL: "https://example.com/blog", CustomCode: "blog", RedirectType: http.StatusMovedPermanently, CacheControl: "public, max-age=86400"}
+		if w := serve(router, http.MethodPost, "/api/shorten", req, nil); w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body)
+		}
+
+		w := serve(router, http.MethodGet, "/blog", nil, nil)
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("Expected status 301, got %d", w.Code)
+		}
+		if cacheControl := w.Header().Get("Cache-Control"); cacheControl != "public, max-age=86400" {
+			t.Errorf("Expected the link's Cache-Control, got '%s'", cacheControl)
+		}
+	})
+
+	t.Run("Reject an invalid policy", func(t *testing.T) {
+		req := models.ShortenRequest{URL: "https://example.com/news", RedirectType: http.StatusSeeOther}
+		if w := serve(router, http.MethodPost, "/api/shorten", req, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+
+		req = models.ShortenRequest{URL: "https://example.com/news", CacheControl: "no-cache\r\nSet-Cookie: a=b"}
+		if w := serve(router, http.MethodPost, "/api/shorten", req, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+// racingStorage runs race once, right after the next Get, to stand in for a
+// request changing the link at the same time
+type racingStorage struct {
+	storage.Storage
+	race func()
+}
+
+func (r *racingStorage) Get(shortCode string) (*models.URL, error) {
+	url, err := r.Storage.Get(shortCode)
+	if race := r.race; race != nil {
+		r.race = nil
+		race()
+	}
+	return url, err
+}
+
+func TestEditEndpoints(t *testing.T) {
+	store := &racingStorage{Storage: storage.NewInMemoryStorage()}
+	svc := service.NewURLService(store, 6)
+	router := newTestRouter(t, svc)
+	if w := serve(router, http.MethodPost, "/api/shorten", models.ShortenRequest{URL: "https://example.com/v1", CustomCode: "docs"}, nil); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body)
+	}
+
+	t.Run("Update a link", func(t *testing.T) {
+		w := serve(router, http.MethodPatch, "/api/urls/docs", map[string]any{"url": "https://example.com/v2"}, http.Header{"X-User": {"bob"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+		}
+		var url models.URL
+		json.Unmarshal(w.Body.Bytes(), &url)
+		if url.Destination() != "https://example.com/v2" {
+			t.Errorf("Expected the new destination, got '%s'", url.Destination())
+		}
+	})
+
+	t.Run("Reject bad updates", func(t *testing.T) {
+		cases := []struct {
+			path   string
+			body   any
+			status int
+		}{
+			{"/api/urls/docs", map[string]any{"redirect_type": 303}, http.StatusBadRequest},
+			{"/api/urls/docs", map[string]any{"url": "ftp://example.com"}, http.StatusBadRequest},
+			{"/api/urls/docs", "not an object", http.StatusBadRequest},
+			{"/api/urls/missing", map[string]any{"title": "Missing"}, http.StatusNotFound},
+		}
+		for _, tc := range cases {
+			if w := serve(router, http.MethodPatch, tc.path, tc.body, nil); w.Code != tc.status {
+				t.Errorf("Expected status %d for %v, got %d: %s", tc.status, tc.body, w.Code, w.Body)
+			}
+		}
+	})
+
+	t.Run("Refuse an update that raced another", func(t *testing.T) {
+		store.race = func() {
+			if w := serve(router, http.MethodPatch, "/api/urls/docs", map[string]any{"notes": "first"}, nil); w.Code != http.StatusOK {
+				t.Errorf("Expected the first update to succeed, got %d", w.Code)
+			}
+		}
+		w := serve(router, http.MethodPatch, "/api/urls/docs", map[string]any{"notes": "second"}, nil)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("List the history", func(t *testing.T) {
+		w := serve(router, http.MethodGet, "/api/urls/docs/history", nil, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var history struct {
+			Count int `json:"count"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &history)
+		if history.Count != 3 {
+			t.Errorf("Expected 3 revisions, got %d", history.Count)
+		}
+
+		if w := serve(router, http.MethodGet, "/api/urls/missing/history", nil, nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("Roll back", func(t *testing.T) {
+		w := serve(router, http.MethodPost, "/api/urls/docs/rollback", models.RollbackRequest{Revision: 1}, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+		}
+		var url models.URL
+		json.Unmarshal(w.Body.Bytes(), &url)
+		if url.Destination() != "https://example.com/v1" {
+			t.Errorf("Expected the first destination, got '%s'", url.Destination())
+		}
+
+		cases := []struct {
+			path   string
+			body   any
+			status int
+		}{
+			{"/api/urls/docs/rollback", models.RollbackRequest{Revision: 99}, http.StatusNotFound},
+			{"/api/urls/docs/rollback", map[string]any{}, http.StatusBadRequest},
+			{"/api/urls/missing/rollback", models.RollbackRequest{Revision: 1}, http.StatusNotFound},
+		}
+		for _, tc := range cases {
+			if w := serve(router, http.MethodPost, tc.path, tc.body, nil); w.Code != tc.status {
+				t.Errorf("Expected status %d for %s %v, got %d: %s", tc.status, tc.path, tc.body, w.Code, w.Body)
+			}
+		}
+	})
+}
+
+func TestChangeError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{storage.ErrNotFound, http.StatusNotFound},
+		{storage.ErrAlreadyExists, http.StatusConflict},
+		{storage.ErrConflict, http.StatusConflict},
+		{fmt.Errorf("%w: docs", service.ErrLinkDeleted), http.StatusGone},
+		{service.ErrBatchAborted, http.StatusFailedDependency},
+		{fmt.Errorf("%w: too long", service.ErrTitleTooLong), http.StatusBadRequest},
+		{service.ErrInvalidCode, http.StatusBadRequest},
+		{&safety.Rejection{Reason: "blocklisted", Detail: "evil.example"}, http.StatusUnprocessableEntity},
+		{errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		status, body := changeError(tc.err, "Failed")
+		if status != tc.status {
+			t.Errorf("Expected status %d for %v, got %d", tc.status, tc.err, status)
+		}
+		if body["error"] == "" {
+			t.Errorf("Expected an error message for %v", tc.err)
+		}
+	}
+
+	_, body := changeError(errors.New("disk full"), "Failed to shorten URL")
+	if body["error"] != "Failed to shorten URL" {
+		t.Errorf("Expected the fallback message for unknown errors, got '%v'", body["error"])
+	}
+	_, body = changeError(&safety.Rejection{Reason: "blocklisted", Detail: "evil.example"}, "Failed")
+	if body["reason"] != "blocklisted" || body["detail"] != "evil.example" {
+		t.Errorf("Expected the rejection reason and detail, got %v", body)
+	}
+}
+
+func TestShortenBatch(t *testing.T) {
+	svc := service.NewURLService(storage.NewInMemoryStorage(), 6, service.WithMaxBatchSize(3))
+	router := newTestRouter(t, svc)
+
+	t.Run("Create every item", func(t *testing.T) {
+		req := models.BatchShortenRequest{Items: []models.ShortenRequest{
+			{URL: "https://example.com/a", CustomCode: "a"},
+			{URL: "https://example.com/b"},
+		}}
+		w := serve(router, http.MethodPost, "/api/shorten/batch", req, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body)
+		}
+		var response models.BatchShortenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Created != 2 || response.Failed != 0 {
+			t.Errorf("Expected 2 created and 0 failed, got %d and %d", response.Created, response.Failed)
+		}
+	})
+
+	t.Run("Report failed items", func(t *testing.T) {
+		req := models.BatchShortenRequest{Items: []models.ShortenRequest{
+			{URL: "https://example.com/c", CustomCode: "c"},
+			{URL: "https://example.com/a", CustomCode: "a"},
+			{URL: "https://example.com/d", RedirectType: http.StatusSeeOther},
+		}}
+		w := serve(router, http.MethodPost, "/api/shorten/batch", req, nil)
+		if w.Code != http.StatusMultiStatus {
+			t.Fatalf("Expected status 207, got %d: %s", w.Code, w.Body)
+		}
+		var response models.BatchShortenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Created != 1 || response.Failed != 2 {
+			t.Errorf("Expected 1 created and 2 failed, got %d and %d", response.Created, response.Failed)
+		}
+		statuses := []int{http.StatusCreated, http.StatusConflict, http.StatusBadRequest}
+		for i, result := range response.Results {
+			if result.Index != i || result.Status != statuses[i] {
+				t.Errorf("Expected item %d to have status %d, got item %d with %d", i, statuses[i], result.Index, result.Status)
+			}
+		}
+		if response.Results[0].ShortenResponse == nil || response.Results[0].ShortCode != "c" {
+			t.Errorf("Expected the created link in the first result, got %+v", response.Results[0])
+		}
+	})
+
+	t.Run("Abort every item", func(t *testing.T) {
+		req := models.BatchShortenRequest{AllOrNothing: true, Items: []models.ShortenRequest{
+			{URL: "https://example.com/e", CustomCode: "e"},
+			{URL: "https://example.com/a", CustomCode: "a"},
+		}}
+		w := serve(router, http.MethodPost, "/api/shorten/batch", req, nil)
+		if w.Code != http.StatusMultiStatus {
+			t.Fatalf("Expected status 207, got %d: %s", w.Code, w.Body)
+		}
+		var response models.BatchShortenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Results[0].Status != http.StatusFailedDependency || response.Results[1].Status != http.StatusConflict {
+			t.Errorf("Expected statuses 424 and 409, got %d and %d", response.Results[0].Status, response.Results[1].Status)
+		}
+	})
+
+	t.Run("Reject bad batches", func(t *testing.T) {
+		items := make([]models.ShortenRequest, 4)
+		for i := range items {
+			items[i] = models.ShortenRequest{URL: "https://example.com/many"}
+		}
+		if w := serve(router, http.MethodPost, "/api/shorten/batch", models.BatchShortenRequest{Items: items}, nil); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status 413, got %d", w.Code)
+		}
+		if w := serve(router, http.MethodPost, "/api/shorten/batch", models.BatchShortenRequest{}, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"fmt"
+	"image"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"url-shortener/config"
+	"url-shortener/fetcher"
 	"url-shortener/handlers"
 	"url-shortener/middleware"
+	"url-shortener/pages"
+	"url-shortener/qrcode"
+	"url-shortener/safety"
 	"url-shortener/service"
 	"url-shortener/storage"
 
@@ -16,6 +21,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate-data" {
+		os.Exit(runMigrateData(os.Args[2:]))
+	}
+
 	// Load configuration
 	cfg := config.Load()
 
@@ -30,6 +39,16 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to initialize PostgreSQL: %v", err)
 		}
+	} else if cfg.UseInMemory && cfg.InMemoryDataDir != "" {
+		fmt.Printf("🚀 Using in-memory storage persisted to %s\n", cfg.InMemoryDataDir)
+		store, err = storage.NewDurableInMemoryStorage(cfg.InMemoryDataDir, storage.DurabilityOptions{
+			Fsync:         cfg.InMemoryFsync,
+			FsyncEvery:    cfg.InMemoryFsyncInterval,
+			SnapshotEvery: cfg.InMemorySnapshotInterval,
+		})
+		if err != nil {
+			log.Fatalf("Failed to recover in-memory storage: %v", err)
+		}
 	} else if cfg.UseInMemory {
 		fmt.Println("🚀 Using in-memory storage")
 		store = storage.NewInMemoryStorage()
@@ -41,11 +60,83 @@ func main() {
 		}
 	}
 
-	// Initialize service
-	urlService := service.NewURLService(store, cfg.ShortCodeLen)
+	// Initialize destination safety checks
+	checker, stopWatching, err := setupDestinationChecker(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load safety lists: %v", err)
+	}
+
+	// Initialize the SSRF-safe fetcher shared by everything that requests destinations
+	destFetcher, err := fetcher.New(fetcher.Config{
+		Timeout:      cfg.FetchTimeout,
+		MaxRedirects: cfg.FetchMaxRedirects,
+		MaxBodyBytes: cfg.FetchMaxBodyBytes,
+		AllowedPorts: cfg.FetchAllowedPorts,
+		AllowedCIDRs: cfg.FetchAllowedCIDRs,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize fetcher: %v", err)
+	}
+
+	if err := service.ValidateRedirectPolicy(cfg.DefaultRedirectType, cfg.DefaultCacheControl); err != nil || cfg.DefaultRedirectType == 0 {
+		log.Fatalf("Invalid redirect defaults: DEFAULT_REDIRECT_TYPE=%d DEFAULT_CACHE_CONTROL=%q", cfg.DefaultRedirectType, cfg.DefaultCacheControl)
+	}
+
+	serviceOpts := []service.Option{
+		service.WithNormalizer(service.NewNormalizer(cfg.AllowedSchemes, cfg.StripQueryParams)),
+		service.WithDestinationChecker(checker),
+		service.WithOwnDomains(cfg.SelfLinkPolicy, append([]string{cfg.BaseURL}, cfg.ShortDomains...)...),
+		service.WithRedirectDefaults(cfg.DefaultRedirectType, cfg.DefaultCacheControl),
+		service.WithTrashRetention(cfg.TrashRetention),
+		service.WithMaxBatchSize(cfg.MaxBatchSize),
+	}
+	if cfg.LinkPreviews {
+		serviceOpts = append(serviceOpts, service.WithPreviews(destFetcher))
+	}
+	if cfg.GoLinks {
+		serviceOpts = append(serviceOpts, service.WithGoLinks())
+	}
+	if cfg.ResolveShortenerChains {
+		serviceOpts = append(serviceOpts, service.WithChainResolver(service.NewChainResolver(cfg.KnownShorteners, cfg.MaxChainHops, destFetcher)))
+	}
+
+	urlService := service.NewURLService(store, cfg.ShortCodeLen, serviceOpts...)
+
+	// Index existing short codes for "did you mean" suggestions without delaying startup
+	go func() {
+		if err := urlService.IndexCodes(); err != nil {
+			log.Printf("Failed to index short codes for suggestions: %v", err)
+		}
+	}()
+
+	// Permanently delete links that have been in the trash past the retention window
+	stopPurging := func() {}
+	if cfg.PurgeInterval > 0 {
+		stopPurging = urlService.StartPurger(cfg.PurgeInterval)
+	}
+
+	renderer, err := pages.New(pages.Theme{
+		Brand:           cfg.PageBrand,
+		LogoURL:         cfg.PageLogoURL,
+		AccentColor:     cfg.PageAccentColor,
+		BackgroundColor: cfg.PageBackgroundColor,
+		TextColor:       cfg.PageTextColor,
+		StylesheetURL:   cfg.PageStylesheetURL,
+		Footer:          cfg.PageFooter,
+	}, cfg.PageTemplatesDir)
+	if err != nil {
+		log.Fatalf("Failed to load page templates: %v", err)
+	}
+
+	var logo image.Image
+	if cfg.QRLogoPath != "" {
+		if logo, err = qrcode.LoadLogo(cfg.QRLogoPath); err != nil {
+			log.Fatalf("Failed to load QR code logo: %v", err)
+		}
+	}
 
 	// Initialize handlers
-	urlHandler := handlers.NewURLHandler(urlService, cfg.BaseURL)
+	urlHandler := handlers.NewURLHandler(urlService, cfg.BaseURL, renderer, qrcode.NewRenderer(logo, cfg.QRCacheSize))
 
 	// Setup Gin router
 	router := setupRouter(urlHandler)
@@ -57,6 +148,9 @@ func main() {
 		<-sigint
 
 		fmt.Println("\n🛑 Shutting down server...")
+		// os.Exit skips deferred calls, so background work is stopped here
+		stopPurging()
+		stopWatching()
 		urlService.Close()
 		os.Exit(0)
 	}()
@@ -71,11 +165,43 @@ func main() {
 	}
 }
 
+// setupDestinationChecker builds the safety chain and starts hot-reloading its lists
+func setupDestinationChecker(cfg *config.Config) (safety.Chain, func(), error) {
+	chain := safety.Chain{safety.NewHeuristics(cfg.MaxSubdomains, cfg.ProtectedBrands)}
+	var lists []safety.Reloader
+
+	if cfg.BlocklistPath != "" {
+		blocklist, err := safety.NewBlocklist(cfg.BlocklistPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, blocklist)
+		lists = append(lists, blocklist)
+	}
+
+	if cfg.UnsafeHashPrefixPath != "" {
+		hashList, err := safety.NewHashPrefixList(cfg.UnsafeHashPrefixPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, hashList)
+		lists = append(lists, hashList)
+	}
+
+	if len(lists) == 0 || cfg.SafetyReloadInterval <= 0 {
+		return chain, func() {}, nil
+	}
+	return chain, safety.Watch(cfg.SafetyReloadInterval, lists...), nil
+}
+
 func setupRouter(handler *handlers.URLHandler) *gin.Engine {
 	// Set to release mode for production
 	// gin.SetMode(gin.ReleaseMode)
 
 	router := gin.Default()
+	// Route on the raw path so go-link codes can be passed to the API with
+	// their slashes encoded, as in /api/stats/team%2Foncall
+	router.UseRawPath = true
 
 	// Middleware
 	router.Use(middleware.Logger())
@@ -86,13 +212,37 @@ func setupRouter(handler *handlers.URLHandler) *gin.Engine {
 	{
 		api.GET("/health", handler.HealthCheck)
 		api.POST("/shorten", handler.ShortenURL)
+		api.POST("/shorten/batch", handler.ShortenBatch)
 		api.GET("/stats/:shortCode", handler.GetStats)
 		api.GET("/urls", handler.ListURLs)
+		api.GET("/search", handler.Search)
+		api.GET("/tags", handler.ListTags)
+		api.PATCH("/urls/:shortCode", handler.UpdateURL)
 		api.DELETE("/urls/:shortCode", handler.DeleteURL)
+		api.GET("/urls/:shortCode/history", handler.GetHistory)
+		api.POST("/urls/:shortCode/rollback", handler.RollbackURL)
+		api.POST("/urls/:shortCode/restore", handler.RestoreURL)
+		api.GET("/trash", handler.ListTrash)
+		api.GET("/export", handler.Export)
+		api.POST("/import", handler.Import)
+		api.POST("/urls/:shortCode/preview", handler.RefreshPreview)
+		api.GET("/urls/:shortCode/qr", handler.GetQRCode)
+		api.POST("/campaigns", handler.CreateCampaign)
+		api.GET("/campaigns", handler.ListCampaigns)
+		api.GET("/campaigns/:id", handler.GetCampaign)
+		api.PATCH("/campaigns/:id", handler.UpdateCampaign)
+		api.DELETE("/campaigns/:id", handler.DeleteCampaign)
+		api.POST("/campaigns/:id/links", handler.AddCampaignLinks)
+		api.DELETE("/campaigns/:id/links/:shortCode", handler.RemoveCampaignLink)
+		api.GET("/campaigns/:id/stats", handler.CampaignStats)
 	}
 
-	// Redirect route (must be last to avoid conflicts)
+	// Redirect routes (must be last to avoid conflicts). Static /api routes
+	// take precedence; links with passthrough forward the rest of the path.
+	// Previews, /:shortCode+ and /:shortCode/preview, are told apart by
+	// RedirectURL as gin cannot route them next to the catch-all.
 	router.GET("/:shortCode", handler.RedirectURL)
+	router.GET("/:shortCode/*path", handler.RedirectURL)
 
 	return router
 }
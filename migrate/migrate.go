@@ -0,0 +1,386 @@
+// Package migrate copies every link, with its stats, trash state, preview,
+// revision history, campaign and click events, from one storage backend into
+// another. Campaigns are copied first and get new IDs in the destination.
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+var ErrCheckpointMismatch = errors.New("checkpoint belongs to a different migration")
+
+// Options configures a migration
+type Options struct {
+	// BatchSize is the number of links, or clicks of one link, read and
+	// written at a time
+	BatchSize int
+	// CheckpointPath, when set, records progress after every batch so an
+	// interrupted migration resumes where it stopped
+	CheckpointPath string
+	// Fingerprint identifies the source and destination pair; a checkpoint
+	// written for another pair is rejected
+	Fingerprint string
+	// DryRun reads the source and reports what would be copied without writing
+	DryRun bool
+	// Logf receives progress messages
+	Logf func(format string, args ...any)
+}
+
+// Report summarizes a migration
+type Report struct {
+	Campaigns int `json:"campaigns"`
+	Links     int `json:"links"`
+	Revisions int `json:"revisions"`
+	Clicks    int `json:"clicks"`
+	// Conflicts are links whose short code already exists in the destination
+	// with different contents; they are left untouched
+	Conflicts []string `json:"conflicts,omitempty"`
+	ResumedAt int64    `json:"resumed_at,omitempty"`
+}
+
+// Checkpoint is the progress of a migration, stored as JSON
+type Checkpoint struct {
+	Fingerprint string `json:"fingerprint"`
+	LastID      int64  `json:"last_id"`
+	Links       int    `json:"links"`
+	Revisions   int    `json:"revisions"`
+	Clicks      int    `json:"clicks"`
+}
+
+// Run copies the campaigns of src into dst, then every link of src with an
+// ID after the checkpoint. Links that already exist in dst with the same
+// contents are completed (missing revisions and clicks are added), so a
+// batch interrupted half way is safe to run again.
+func Run(src, dst storage.Storage, opts Options) (*Report, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.Logf == nil {
+		opts.Logf = func(string, ...any) {}
+	}
+
+	checkpoint := &Checkpoint{Fingerprint: opts.Fingerprint}
+	if opts.CheckpointPath != "" && !opts.DryRun {
+		loaded, err := loadCheckpoint(opts.CheckpointPath)
+		if err != nil {
+			return nil, err
+		}
+		if loaded != nil {
+			if loaded.Fingerprint != opts.Fingerprint {
+				return nil, ErrCheckpointMismatch
+			}
+			checkpoint = loaded
+			opts.Logf("resuming after link id %d (%d links copied)", checkpoint.LastID, checkpoint.Links)
+		}
+	}
+
+	report := &Report{Links: checkpoint.Links, Revisions: checkpoint.Revisions, Clicks: checkpoint.Clicks, ResumedAt: checkpoint.LastID}
+	campaigns, err := copyCampaigns(src, dst, report, opts.DryRun)
+	if err != nil {
+		return report, err
+	}
+	opts.Logf("copied %d campaigns", report.Campaigns)
+
+	for {
+		urls, err := src.ListAfterID(checkpoint.LastID, opts.BatchSize, true)
+		if err != nil {
+			return report, err
+		}
+		if len(urls) == 0 {
+			break
+		}
+
+		if err := copyBatch(src, dst, urls, campaigns, report, opts); err != nil {
+			return report, err
+		}
+
+		checkpoint.LastID = urls[len(urls)-1].ID
+		checkpoint.Links = report.Links
+		checkpoint.Revisions = report.Revisions
+		checkpoint.Clicks = report.Clicks
+		if opts.CheckpointPath != "" && !opts.DryRun {
+			if err := saveCheckpoint(opts.CheckpointPath, checkpoint); err != nil {
+				return report, err
+			}
+		}
+		opts.Logf("copied %d links, %d revisions, %d clicks", report.Links, report.Revisions, report.Clicks)
+	}
+
+	return report, nil
+}
+
+// copyCampaigns copies every campaign of src into dst and returns their IDs
+// in dst by their IDs in src. A campaign of dst with the same name and
+// creation time is taken to be a copy made by an earlier run and reused.
+func copyCampaigns(src, dst storage.Storage, report *Report, dryRun bool) (map[int64]int64, error) {
+	campaigns, err := src.ListCampaigns()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := dst.ListCampaigns()
+	if err != nil {
+		return nil, err
+	}
+
+	copied := make(map[string]int64, len(existing))
+	for _, campaign := range existing {
+		copied[campaignKey(campaign)] = campaign.ID
+	}
+
+	// Campaigns are listed newest first and copied oldest first, so their IDs
+	// keep their order
+	ids := make(map[int64]int64, len(campaigns))
+	for i := len(campaigns) - 1; i >= 0; i-- {
+		campaign := campaigns[i]
+		report.Campaigns++
+		if id, ok := copied[campaignKey(campaign)]; ok {
+			ids[campaign.ID] = id
+			continue
+		}
+		if dryRun {
+			continue
+		}
+
+		c := *campaign
+		c.ID, c.Links = 0, 0
+		if err := dst.SaveCampaign(&c); err != nil {
+			return nil, err
+		}
+		ids[campaign.ID] = c.ID
+	}
+	return ids, nil
+}
+
+// campaignKey identifies a campaign across stores, which number them differently
+func campaignKey(campaign *models.Campaign) string {
+	return campaign.Name + "\x00" + strconv.FormatInt(campaign.CreatedAt.Unix(), 10)
+}
+
+// copyBatch writes one page of links, their history and their clicks into
+// dst. campaigns maps the campaign IDs of src to those of dst.
+func copyBatch(src, dst storage.Storage, urls []*models.URL, campaigns map[int64]int64, report *Report, opts Options) error {
+	history := make([][]*models.URLRevision, len(urls))
+	for i, url := range urls {
+		revisions, err := src.ListRevisions(url.ShortCode)
+		if err != nil {
+			return err
+		}
+		history[i] = revisions
+	}
+
+	if opts.DryRun {
+		for i, url := range urls {
+			existing, err := dst.Get(url.ShortCode)
+			if err == nil && !sameLink(existing, url) {
+				report.Conflicts = append(report.Conflicts, url.ShortCode)
+				continue
+			}
+			clicks := 0
+			if err := src.ScanClicks(url.ShortCode, func(models.Click) error { clicks++; return nil }); err != nil {
+				return err
+			}
+			report.Links++
+			report.Revisions += len(history[i])
+			report.Clicks += clicks
+		}
+		return nil
+	}
+
+	// Copies are saved so the source values survive the destination assigning
+	// IDs, and join the copies of their campaigns
+	copies := make([]*models.URL, len(urls))
+	for i, url := range urls {
+		c := *url
+		c.CampaignID = campaigns[url.CampaignID]
+		copies[i] = &c
+	}
+
+	errs, err := dst.SaveBatch(copies, make([]*models.URLRevision, len(copies)), false)
+	if err != nil {
+		return err
+	}
+
+	for i, url := range urls {
+		if errs[i] == storage.ErrAlreadyExists {
+			// Either copied by an interrupted run or a genuine conflict
+			existing, err := dst.Get(url.ShortCode)
+			if err != nil {
+				return err
+			}
+			if !sameLink(existing, url) {
+				report.Conflicts = append(report.Conflicts, url.ShortCode)
+				continue
+			}
+			if campaignID := copies[i].CampaignID; existing.CampaignID != campaignID {
+				if err := dst.SetCampaign([]string{url.ShortCode}, campaignID); err != nil {
+					return err
+				}
+			}
+		} else if errs[i] != nil {
+			return fmt.Errorf("%s: %w", url.ShortCode, errs[i])
+		}
+
+		if url.Preview != nil {
+			if err := dst.SavePreview(url.ShortCode, url.Preview); err != nil {
+				return err
+			}
+		}
+		if url.DeletedAt != nil {
+			if err := dst.SoftDelete(url.ShortCode, *url.DeletedAt); err != nil && err != storage.ErrNotFound {
+				return err
+			}
+		}
+
+		copied, err := dst.ListRevisions(url.ShortCode)
+		if err != nil {
+			return err
+		}
+		for _, revision := range history[i][min(len(copied), len(history[i])):] {
+			c := *revision
+			if err := dst.AddRevision(&c); err != nil {
+				return err
+			}
+		}
+
+		clicks, err := copyClicks(src, dst, url.ShortCode, opts.BatchSize)
+		if err != nil {
+			return fmt.Errorf("%s: %w", url.ShortCode, err)
+		}
+
+		report.Links++
+		report.Revisions += len(history[i])
+		report.Clicks += clicks
+	}
+
+	return nil
+}
+
+// copyClicks streams the clicks of a link that dst does not hold yet from src
+// in batches and returns the number of clicks the link has in src. Clicks are
+// only ever appended, so the ones dst already holds are the first ones of
+// src, saved by an earlier run that was interrupted.
+func copyClicks(src, dst storage.Storage, shortCode string, batchSize int) (int, error) {
+	copied := 0
+	if err := dst.ScanClicks(shortCode, func(models.Click) error { copied++; return nil }); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	batch := make([]models.Click, 0, batchSize)
+	err := src.ScanClicks(shortCode, func(click models.Click) error {
+		total++
+		if total <= copied {
+			return nil
+		}
+		batch = append(batch, click)
+		if len(batch) < batchSize {
+			return nil
+		}
+		err := dst.SaveClicks(shortCode, batch)
+		batch = batch[:0]
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(batch) > 0 {
+		if err := dst.SaveClicks(shortCode, batch); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// Fingerprint hashes the migrated contents of a link. Times are compared at
+// second precision because backends store them with different precision.
+func Fingerprint(url *models.URL) [32]byte {
+	unix := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+
+	var utm string
+	if url.UTM != nil {
+		utm = url.UTM.Encode()
+	}
+	variants, _ := json.Marshal(url.Variants)
+
+	fields := []string{
+		url.ShortCode, url.OriginalURL, url.CanonicalURL, strconv.Itoa(url.RedirectType), url.CacheControl,
+		unix(url.ExpiresAt), url.Notes, strconv.FormatInt(url.Clicks, 10), unix(&url.CreatedAt), unix(url.DeletedAt),
+		url.Owner, url.Title, strings.Join(url.Tags, " "), utm, strconv.FormatBool(url.UTMOverride),
+		strconv.FormatBool(url.Passthrough),
+		strconv.FormatBool(url.Interstitial),
+		string(variants), url.Rotation,
+	}
+	return sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+}
+
+// campaignFingerprint hashes the migrated contents of a campaign
+func campaignFingerprint(campaign *models.Campaign) [32]byte {
+	fields := []string{campaignKey(campaign), campaign.Description, campaign.UTM.Encode()}
+	return sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+}
+
+// clickFingerprint hashes a click event, at second precision like Fingerprint
+func clickFingerprint(click models.Click) [32]byte {
+	fields := []string{click.ShortCode, strconv.FormatInt(click.At.Unix(), 10), click.Referrer, click.Visitor, click.Variant}
+	return sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+}
+
+// sameLink reports whether dst already holds a copy of src. The trash state
+// is ignored because it is applied after the link is saved.
+func sameLink(dst, src *models.URL) bool {
+	a, b := *dst, *src
+	a.DeletedAt, b.DeletedAt = nil, nil
+	return Fingerprint(&a) == Fingerprint(&b)
+}
+
+func loadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("reading checkpoint %s: %w", path, err)
+	}
+	return checkpoint, nil
+}
+
+// saveCheckpoint replaces the checkpoint file atomically
+func saveCheckpoint(path string, checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// PairFingerprint identifies a source and destination pair without storing
+// their connection strings, which may contain credentials
+func PairFingerprint(from, to string) string {
+	sum := sha256.Sum256([]byte(from + "\x00" + to))
+	return fmt.Sprintf("%x", sum[:8])
+}
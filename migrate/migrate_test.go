@@ -0,0 +1,201 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+// seed fills a store with links covering everything a migration copies
+func seed(t *testing.T, store storage.Storage, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		code := fmt.Sprintf("link%d", i)
+		url := &models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code, Clicks: int64(i), Notes: "seeded"}
+		if err := store.Save(url); err != nil {
+			t.Fatalf("Failed to seed: %v", err)
+		}
+		store.AddRevision(&models.URLRevision{ShortCode: code, Action: models.RevisionCreate, Actor: "seed", CreatedAt: time.Now(), New: url.State()})
+	}
+
+	store.SavePreview("link0", &models.LinkPreview{Title: "Zero", FetchedAt: time.Now()})
+	store.SoftDelete("link1", time.Now().Add(-time.Hour))
+	url, _ := store.Get("link2")
+	old := url.State()
+	url.OriginalURL = "https://example.com/moved"
+	store.UpdateWithRevision(url, &models.URLRevision{ShortCode: "link2", Action: models.RevisionUpdate, Actor: "seed", CreatedAt: time.Now(), Old: &old, New: url.State()})
+
+	campaign := &models.Campaign{Name: "Spring", UTM: models.UTMParams{Source: "mail"}}
+	store.SaveCampaign(campaign)
+	store.SetCampaign([]string{"link3", "link4"}, campaign.ID)
+	for i, variant := range []string{"a", "b", "a"} {
+		store.RecordClick(&models.Click{ShortCode: "link3", At: time.Now().Add(time.Duration(i) * time.Second), Referrer: "news.example", Variant: variant})
+	}
+	store.RecordClick(&models.Click{ShortCode: "link0", At: time.Now(), Visitor: "v1"})
+}
+
+func openSQLite(t *testing.T) storage.Storage {
+	t.Helper()
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "dst.db"))
+	if err != nil {
+		t.Fatalf("Failed to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestMigrate(t *testing.T) {
+	src := storage.NewInMemoryStorage()
+	seed(t, src, 5)
+
+	t.Run("Copy everything and verify", func(t *testing.T) {
+		dst := openSQLite(t)
+		report, err := Run(src, dst, Options{BatchSize: 2})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if report.Campaigns != 1 || report.Links != 5 || report.Revisions != 6 || report.Clicks != 4 {
+			t.Errorf("Expected 1 campaign, 5 links, 6 revisions and 4 clicks, got %+v", report)
+		}
+
+		v, err := Verify(src, dst, 2)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !v.OK() {
+			t.Errorf("Expected verification to pass, got %+v", v)
+		}
+
+		deleted, _ := dst.Get("link1")
+		if deleted.DeletedAt == nil {
+			t.Error("Expected trash state to be copied")
+		}
+		withPreview, _ := dst.Get("link0")
+		if withPreview.Preview == nil || withPreview.Preview.Title != "Zero" {
+			t.Error("Expected preview to be copied")
+		}
+		revisions, _ := dst.ListRevisions("link2")
+		if len(revisions) != 2 || revisions[1].Old.OriginalURL != "https://example.com/link2" {
+			t.Errorf("Expected history to be copied, got %d revisions", len(revisions))
+		}
+
+		campaigns, _ := dst.ListCampaigns()
+		if len(campaigns) != 1 || campaigns[0].Name != "Spring" || campaigns[0].Links != 2 {
+			t.Fatalf("Expected campaign Spring with 2 links, got %+v", campaigns)
+		}
+		if member, _ := dst.Get("link4"); member.CampaignID != campaigns[0].ID {
+			t.Errorf("Expected link4 in campaign %d, got %d", campaigns[0].ID, member.CampaignID)
+		}
+		if counts, _ := dst.CountVariantClicks("link3"); counts["a"] != 2 || counts["b"] != 1 {
+			t.Errorf("Expected clicks per variant to be copied, got %v", counts)
+		}
+		if copied, _ := dst.Get("link3"); copied.Clicks != 6 {
+			t.Errorf("Expected 6 clicks on link3, got %d", copied.Clicks)
+		}
+	})
+
+	t.Run("Resume from checkpoint", func(t *testing.T) {
+		dst := openSQLite(t)
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+		opts := Options{BatchSize: 2, CheckpointPath: checkpoint, Fingerprint: PairFingerprint("memory", "dst.db")}
+
+		if _, err := Run(src, dst, opts); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// Pretend the run stopped after the first batch had been written
+		// but before its checkpoint was saved
+		os.WriteFile(checkpoint, []byte(`{"fingerprint":"`+opts.Fingerprint+`","last_id":0}`), 0o600)
+		report, err := Run(src, dst, opts)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(report.Conflicts) != 0 {
+			t.Errorf("Expected no conflicts when resuming, got %v", report.Conflicts)
+		}
+		if v, _ := Verify(src, dst, 2); !v.OK() {
+			t.Errorf("Expected verification to pass after resume, got %+v", v)
+		}
+		if campaigns, _ := dst.ListCampaigns(); len(campaigns) != 1 {
+			t.Errorf("Expected the campaign to be copied once, got %d", len(campaigns))
+		}
+
+		other := opts
+		other.Fingerprint = PairFingerprint("memory", "other.db")
+		if _, err := Run(src, dst, other); err != ErrCheckpointMismatch {
+			t.Errorf("Expected ErrCheckpointMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Report conflicts", func(t *testing.T) {
+		dst := openSQLite(t)
+		dst.Save(&models.URL{ShortCode: "link3", OriginalURL: "https://elsewhere.example"})
+
+		report, err := Run(src, dst, Options{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(report.Conflicts) != 1 || report.Conflicts[0] != "link3" {
+			t.Errorf("Expected link3 to conflict, got %v", report.Conflicts)
+		}
+
+		v, _ := Verify(src, dst, 0)
+		if v.OK() || len(v.Mismatched) != 1 {
+			t.Errorf("Expected verification to flag link3, got %+v", v)
+		}
+	})
+
+	t.Run("Dry run writes nothing", func(t *testing.T) {
+		dst := openSQLite(t)
+		report, err := Run(src, dst, Options{DryRun: true})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if report.Links != 5 || report.Campaigns != 1 || report.Clicks != 4 {
+			t.Errorf("Expected 5 links, 1 campaign and 4 clicks to be reported, got %+v", report)
+		}
+		if urls, _ := dst.ListAfterID(0, 10, true); len(urls) != 0 {
+			t.Errorf("Expected no links to be written, got %d", len(urls))
+		}
+		if campaigns, _ := dst.ListCampaigns(); len(campaigns) != 0 {
+			t.Errorf("Expected no campaigns to be written, got %d", len(campaigns))
+		}
+	})
+}
+
+func TestMigrateResumesClicks(t *testing.T) {
+	src := storage.NewInMemoryStorage()
+	src.Save(&models.URL{ShortCode: "busy", OriginalURL: "https://example.com"})
+	for i := 0; i < 5; i++ {
+		src.RecordClick(&models.Click{ShortCode: "busy", At: time.Now().Add(time.Duration(i) * time.Second), Visitor: fmt.Sprint("v", i)})
+	}
+
+	// A run interrupted after the link and its first clicks were written
+	dst := openSQLite(t)
+	url, _ := src.Get("busy")
+	copied := *url
+	dst.Save(&copied)
+	var first []models.Click
+	src.ScanClicks("busy", func(click models.Click) error {
+		if len(first) < 2 {
+			first = append(first, click)
+		}
+		return nil
+	})
+	dst.SaveClicks("busy", first)
+
+	report, err := Run(src, dst, Options{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Clicks != 5 {
+		t.Errorf("Expected 5 clicks, got %d", report.Clicks)
+	}
+	if v, _ := Verify(src, dst, 2); !v.OK() || v.DestinationClicks != 5 {
+		t.Errorf("Expected the remaining clicks to be copied once, got %+v", v)
+	}
+}
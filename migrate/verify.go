@@ -0,0 +1,185 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+// maxReportedMismatches caps the short codes listed in a verification
+const maxReportedMismatches = 20
+
+// Verification compares the campaigns and links of the source with their copies
+type Verification struct {
+	SourceCampaigns      int      `json:"source_campaigns"`
+	DestinationCampaigns int      `json:"destination_campaigns"`
+	SourceLinks          int      `json:"source_links"`
+	DestinationLinks     int      `json:"destination_links"`
+	SourceRevisions      int      `json:"source_revisions"`
+	DestinationRevisions int      `json:"destination_revisions"`
+	SourceClicks         int      `json:"source_clicks"`
+	DestinationClicks    int      `json:"destination_clicks"`
+	SourceChecksum       string   `json:"source_checksum"`
+	DestinationChecksum  string   `json:"destination_checksum"`
+	MissingCampaigns     []string `json:"missing_campaigns,omitempty"`
+	Missing              []string `json:"missing,omitempty"`
+	Mismatched           []string `json:"mismatched,omitempty"`
+}
+
+// OK reports whether every source campaign and link was found unchanged in
+// the destination
+func (v *Verification) OK() bool {
+	return v.SourceCampaigns == v.DestinationCampaigns &&
+		v.SourceLinks == v.DestinationLinks &&
+		v.SourceRevisions == v.DestinationRevisions &&
+		v.SourceClicks == v.DestinationClicks &&
+		v.SourceChecksum == v.DestinationChecksum
+}
+
+// Verify walks every campaign and link of src and compares it with its copy
+// in dst: campaigns are matched by name and creation time, links by short
+// code. Checksums XOR the fingerprints of campaigns, links with the campaign
+// they belong to, and clicks, so they do not depend on the order things are
+// stored in. Campaigns and links that exist only in dst are not considered.
+func Verify(src, dst storage.Storage, batchSize int) (*Verification, error) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	v := &Verification{}
+	var srcSum, dstSum [32]byte
+
+	srcCampaigns, err := src.ListCampaigns()
+	if err != nil {
+		return nil, err
+	}
+	dstCampaigns, err := dst.ListCampaigns()
+	if err != nil {
+		return nil, err
+	}
+
+	// Campaign keys by ID, for checking which campaign links belong to
+	srcKeys := make(map[int64]string, len(srcCampaigns))
+	dstKeys := make(map[int64]string, len(dstCampaigns))
+	copies := make(map[string]*models.Campaign, len(dstCampaigns))
+	for _, campaign := range dstCampaigns {
+		dstKeys[campaign.ID] = campaignKey(campaign)
+		copies[campaignKey(campaign)] = campaign
+	}
+	for _, campaign := range srcCampaigns {
+		key := campaignKey(campaign)
+		srcKeys[campaign.ID] = key
+		v.SourceCampaigns++
+		xorInto(&srcSum, campaignFingerprint(campaign))
+
+		copied, ok := copies[key]
+		if !ok {
+			v.MissingCampaigns = appendCapped(v.MissingCampaigns, campaign.Name)
+			continue
+		}
+		v.DestinationCampaigns++
+		xorInto(&dstSum, campaignFingerprint(copied))
+	}
+
+	var afterID int64
+	for {
+		urls, err := src.ListAfterID(afterID, batchSize, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(urls) == 0 {
+			break
+		}
+
+		for _, url := range urls {
+			afterID = url.ID
+			v.SourceLinks++
+			fingerprint := memberFingerprint(url, srcKeys)
+			xorInto(&srcSum, fingerprint)
+
+			revisions, err := src.ListRevisions(url.ShortCode)
+			if err != nil {
+				return nil, err
+			}
+			v.SourceRevisions += len(revisions)
+
+			clicks, clickSum, err := clickChecksum(src, url.ShortCode)
+			if err != nil {
+				return nil, err
+			}
+			v.SourceClicks += clicks
+			xorInto(&srcSum, clickSum)
+
+			copied, err := dst.Get(url.ShortCode)
+			if err == storage.ErrNotFound {
+				v.Missing = appendCapped(v.Missing, url.ShortCode)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			v.DestinationLinks++
+
+			copiedFingerprint := memberFingerprint(copied, dstKeys)
+			xorInto(&dstSum, copiedFingerprint)
+
+			copiedRevisions, err := dst.ListRevisions(url.ShortCode)
+			if err != nil {
+				return nil, err
+			}
+			v.DestinationRevisions += len(copiedRevisions)
+
+			copiedClicks, copiedClickSum, err := clickChecksum(dst, url.ShortCode)
+			if err != nil {
+				return nil, err
+			}
+			v.DestinationClicks += copiedClicks
+			xorInto(&dstSum, copiedClickSum)
+
+			if copiedFingerprint != fingerprint || len(copiedRevisions) != len(revisions) || copiedClickSum != clickSum {
+				v.Mismatched = appendCapped(v.Mismatched, url.ShortCode)
+			}
+		}
+	}
+
+	v.SourceChecksum = hex.EncodeToString(srcSum[:])
+	v.DestinationChecksum = hex.EncodeToString(dstSum[:])
+	return v, nil
+}
+
+// memberFingerprint extends the fingerprint of a link with the key of its
+// campaign, looked up in keys by campaign ID
+func memberFingerprint(url *models.URL, keys map[int64]string) [32]byte {
+	fingerprint := Fingerprint(url)
+	return sha256.Sum256(append(fingerprint[:], keys[url.CampaignID]...))
+}
+
+// clickChecksum counts the clicks of a link in store and folds their
+// fingerprints into an order independent checksum
+func clickChecksum(store storage.Storage, shortCode string) (int, [32]byte, error) {
+	var count int
+	var sum [32]byte
+	err := store.ScanClicks(shortCode, func(click models.Click) error {
+		count++
+		xorInto(&sum, clickFingerprint(click))
+		return nil
+	})
+	return count, sum, err
+}
+
+func appendCapped(codes []string, code string) []string {
+	if len(codes) < maxReportedMismatches {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// xorInto folds a fingerprint into an order independent checksum
+func xorInto(sum *[32]byte, fingerprint [32]byte) {
+	for i := 0; i < len(sum); i += 8 {
+		v := binary.LittleEndian.Uint64(sum[i:]) ^ binary.LittleEndian.Uint64(fingerprint[i:])
+		binary.LittleEndian.PutUint64(sum[i:], v)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"url-shortener/migrate"
+	"url-shortener/storage"
+)
+
+// runMigrateData implements the migrate-data subcommand and returns the exit code
+func runMigrateData(args []string) int {
+	flags := flag.NewFlagSet("migrate-data", flag.ContinueOnError)
+	from := flags.String("from", "", "source storage: memory, sqlite:<path> or postgres://...")
+	to := flags.String("to", "", "destination storage, same forms as -from")
+	batchSize := flags.Int("batch-size", 500, "links, or clicks of one link, copied per batch")
+	checkpoint := flags.String("checkpoint", "", "file recording progress so an interrupted run can resume")
+	dryRun := flags.Bool("dry-run", false, "report what would be copied without writing")
+	verify := flags.Bool("verify", true, "compare counts and checksums after copying")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: url-shortener migrate-data -from <storage> -to <storage> [options]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *from == "" || *to == "" || *from == *to {
+		flags.Usage()
+		return 2
+	}
+
+	src, err := storage.Open(*from)
+	if err != nil {
+		log.Printf("Failed to open source: %v", err)
+		return 1
+	}
+	defer src.Close()
+
+	dst, err := storage.Open(*to)
+	if err != nil {
+		log.Printf("Failed to open destination: %v", err)
+		return 1
+	}
+	defer dst.Close()
+
+	report, err := migrate.Run(src, dst, migrate.Options{
+		BatchSize:      *batchSize,
+		CheckpointPath: *checkpoint,
+		Fingerprint:    migrate.PairFingerprint(*from, *to),
+		DryRun:         *dryRun,
+		Logf:           log.Printf,
+	})
+	if report != nil {
+		printJSON("migration", report)
+	}
+	if err != nil {
+		log.Printf("Migration failed: %v", err)
+		return 1
+	}
+	if *dryRun || !*verify {
+		return 0
+	}
+
+	verification, err := migrate.Verify(src, dst, *batchSize)
+	if err != nil {
+		log.Printf("Verification failed: %v", err)
+		return 1
+	}
+	printJSON("verification", verification)
+	if !verification.OK() {
+		log.Printf("Verification found differences between source and destination")
+		return 1
+	}
+
+	fmt.Println("✅ Migration verified")
+	return 0
+}
+
+func printJSON(label string, value any) {
+	data, _ := json.MarshalIndent(value, "", "  ")
+	fmt.Printf("%s: %s\n", label, data)
+}
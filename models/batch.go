@@ -0,0 +1,46 @@
+package models
+
+// BatchShortenRequest represents a request to shorten many URLs at once.
+// With AllOrNothing set, no link is created unless every item succeeds.
+type BatchShortenRequest struct {
+	Items        []ShortenRequest `json:"items" binding:"required,min=1"`
+	AllOrNothing bool             `json:"all_or_nothing"`
+}
+
+// BatchItemResult reports the outcome of one item of a batch, in request order
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	*ShortenResponse
+}
+
+// BatchShortenResponse represents the response after shortening a batch
+type BatchShortenResponse struct {
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []BatchItemResult `json:"results"`
+}
+
+// ImportRowResult reports what happened to one imported row. Rows that were
+// created unchanged are only counted.
+type ImportRowResult struct {
+	Line      int    `json:"line"`
+	ShortCode string `json:"short_code,omitempty"`
+	Action    string `json:"action"`
+	NewCode   string `json:"new_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportReport summarizes an import
+type ImportReport struct {
+	Total       int               `json:"total"`
+	Created     int               `json:"created"`
+	Overwritten int               `json:"overwritten"`
+	Renamed     int               `json:"renamed"`
+	Skipped     int               `json:"skipped"`
+	Failed      int               `json:"failed"`
+	Rows        []ImportRowResult `json:"rows"`
+}
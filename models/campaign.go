@@ -0,0 +1,182 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// UTMParams are the utm_* query parameters used to attribute visits in web
+// analytics tools
+type UTMParams struct {
+	Source   string `json:"utm_source,omitempty"`
+	Medium   string `json:"utm_medium,omitempty"`
+	Campaign string `json:"utm_campaign,omitempty"`
+	Term     string `json:"utm_term,omitempty"`
+	Content  string `json:"utm_content,omitempty"`
+}
+
+// UTMParam is a query parameter name with its value
+type UTMParam struct {
+	Name  string
+	Value string
+}
+
+// IsZero reports whether no parameter is set
+func (p UTMParams) IsZero() bool {
+	return p == UTMParams{}
+}
+
+// Merge returns p with the parameters it leaves empty taken from defaults
+func (p UTMParams) Merge(defaults UTMParams) UTMParams {
+	for _, field := range []struct{ value, fallback *string }{
+		{&p.Source, &defaults.Source},
+		{&p.Medium, &defaults.Medium},
+		{&p.Campaign, &defaults.Campaign},
+		{&p.Term, &defaults.Term},
+		{&p.Content, &defaults.Content},
+	} {
+		if *field.value == "" {
+			*field.value = *field.fallback
+		}
+	}
+	return p
+}
+
+// Params lists the parameters that are set, in the order utm_source,
+// utm_medium, utm_campaign, utm_term, utm_content
+func (p UTMParams) Params() []UTMParam {
+	all := []UTMParam{
+		{"utm_source", p.Source},
+		{"utm_medium", p.Medium},
+		{"utm_campaign", p.Campaign},
+		{"utm_term", p.Term},
+		{"utm_content", p.Content},
+	}
+	params := all[:0]
+	for _, param := range all {
+		if param.Value != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// Encode writes the parameters that are set as a query string, in Params order
+func (p UTMParams) Encode() string {
+	var parts []string
+	for _, param := range p.Params() {
+		parts = append(parts, param.Name+"="+url.QueryEscape(param.Value))
+	}
+	return strings.Join(parts, "&")
+}
+
+// ParseUTM reads a query string written by Encode. Parameters other than the
+// five UTM ones are rejected.
+func ParseUTM(query string) (UTMParams, error) {
+	var p UTMParams
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return p, err
+	}
+	for name := range values {
+		value := values.Get(name)
+		switch name {
+		case "utm_source":
+			p.Source = value
+		case "utm_medium":
+			p.Medium = value
+		case "utm_campaign":
+			p.Campaign = value
+		case "utm_term":
+			p.Term = value
+		case "utm_content":
+			p.Content = value
+		default:
+			return p, fmt.Errorf("unknown UTM parameter %q", name)
+		}
+	}
+	return p, nil
+}
+
+// Campaign groups links run together, such as the links of one marketing
+// push, and holds the UTM parameters its links default to. Links counts every
+// member link, including those in the trash.
+type Campaign struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	UTM         UTMParams `json:"utm"`
+	Links       int64     `json:"links"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CampaignRequest represents the request to create a campaign
+type CampaignRequest struct {
+	Name        string    `json:"name" binding:"required"`
+	Description string    `json:"description,omitempty"`
+	UTM         UTMParams `json:"utm"`
+}
+
+// CampaignUpdateRequest represents a partial update of a campaign. Omitted
+// fields are left unchanged; utm replaces every UTM parameter.
+type CampaignUpdateRequest struct {
+	Name        *string    `json:"name,omitempty"`
+	Description *string    `json:"description,omitempty"`
+	UTM         *UTMParams `json:"utm,omitempty"`
+}
+
+// CampaignLinksRequest lists the links to add to a campaign
+type CampaignLinksRequest struct {
+	ShortCodes []string `json:"short_codes" binding:"required,min=1"`
+}
+
+// Click is one recorded visit of a link. Referrer is the host of the
+// referring page, empty for direct visits; Visitor is an opaque hash that is
+// the same for repeat visits from one browser and empty when unknown.
+// Variant names the variant the visit went to, empty for links without.
+type Click struct {
+	ShortCode string    `json:"short_code"`
+	At        time.Time `json:"at"`
+	Referrer  string    `json:"referrer,omitempty"`
+	Visitor   string    `json:"visitor,omitempty"`
+	Variant   string    `json:"variant,omitempty"`
+}
+
+// CampaignStats aggregates the clicks on every link of a campaign between
+// From and To. Only clicks recorded since click events were introduced are
+// counted, so totals may be below the sum of the links' click counters.
+type CampaignStats struct {
+	Campaign       *Campaign       `json:"campaign"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	Interval       string          `json:"interval"`
+	Clicks         int64           `json:"clicks"`
+	UniqueVisitors int64           `json:"unique_visitors"`
+	TopReferrers   []ReferrerCount `json:"top_referrers"`
+	Links          []LinkClicks    `json:"links"`
+	Timeline       []ClickBucket   `json:"timeline"`
+}
+
+// ReferrerCount is the number of clicks from one referring host; an empty
+// Referrer counts direct visits
+type ReferrerCount struct {
+	Referrer string `json:"referrer"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// LinkClicks is the share of a campaign's clicks that went to one link
+type LinkClicks struct {
+	ShortCode      string `json:"short_code"`
+	Clicks         int64  `json:"clicks"`
+	UniqueVisitors int64  `json:"unique_visitors"`
+}
+
+// ClickBucket counts the clicks of one interval of a timeline
+type ClickBucket struct {
+	Start          time.Time `json:"start"`
+	Clicks         int64     `json:"clicks"`
+	UniqueVisitors int64     `json:"unique_visitors"`
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// Revision actions
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionRollback = "rollback"
+	RevisionDelete   = "delete"
+	RevisionRestore  = "restore"
+	RevisionImport   = "import"
+)
+
+// LinkState is the editable part of a URL, recorded in its revision history
+type LinkState struct {
+	OriginalURL  string     `json:"original_url"`
+	CanonicalURL string     `json:"canonical_url"`
+	RedirectType int        `json:"redirect_type"`
+	CacheControl string     `json:"cache_control"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	Title        string     `json:"title"`
+	Notes        string     `json:"notes"`
+	Tags         []string   `json:"tags"`
+	UTM          *UTMParams `json:"utm,omitempty"`
+	UTMOverride  bool       `json:"utm_override,omitempty"`
+	Passthrough  bool       `json:"passthrough,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	Variants     []Variant  `json:"variants,omitempty"`
+	Rotation     string     `json:"rotation,omitempty"`
+}
+
+// State returns the editable fields of the URL
+func (u *URL) State() LinkState {
+	return LinkState{
+		OriginalURL:  u.OriginalURL,
+		CanonicalURL: u.CanonicalURL,
+		RedirectType: u.RedirectType,
+		CacheControl: u.CacheControl,
+		ExpiresAt:    u.ExpiresAt,
+		Title:        u.Title,
+		Notes:        u.Notes,
+		Tags:         u.Tags,
+		UTM:          u.UTM,
+		UTMOverride:  u.UTMOverride,
+		Passthrough:  u.Passthrough,
+		Interstitial: u.Interstitial,
+		Variants:     u.Variants,
+		Rotation:     u.Rotation,
+	}
+}
+
+// Equal reports whether two states hold the same values. Expiry times are
+// compared as instants and empty lists equal missing ones.
+func (s LinkState) Equal(other LinkState) bool {
+	if (s.ExpiresAt == nil) != (other.ExpiresAt == nil) ||
+		(s.ExpiresAt != nil && !s.ExpiresAt.Equal(*other.ExpiresAt)) {
+		return false
+	}
+	return reflect.DeepEqual(s.comparable(), other.comparable())
+}
+
+// comparable clears the parts of a state that Equal compares itself
+func (s LinkState) comparable() LinkState {
+	s.ExpiresAt = nil
+	if len(s.Tags) == 0 {
+		s.Tags = nil
+	}
+	if len(s.Variants) == 0 {
+		s.Variants = nil
+	}
+	return s
+}
+
+// ApplyState overwrites the editable fields of the URL
+func (u *URL) ApplyState(state LinkState) {
+	u.OriginalURL = state.OriginalURL
+	u.CanonicalURL = state.CanonicalURL
+	u.RedirectType = state.RedirectType
+	u.CacheControl = state.CacheControl
+	u.ExpiresAt = state.ExpiresAt
+	u.Title = state.Title
+	u.Notes = state.Notes
+	u.Tags = state.Tags
+	u.UTM = state.UTM
+	u.UTMOverride = state.UTMOverride
+	u.Passthrough = state.Passthrough
+	u.Interstitial = state.Interstitial
+	u.Variants = state.Variants
+	u.Rotation = state.Rotation
+}
+
+// URLRevision records a change to a URL: who made it, when, and the values
+// before and after. Revisions are numbered per short code starting at 1.
+// Actor is whatever the client sent in the X-User header; it is not
+// authenticated and must not be trusted for access decisions.
+type URLRevision struct {
+	ID        int64      `json:"-"`
+	ShortCode string     `json:"short_code"`
+	Revision  int        `json:"revision"`
+	Action    string     `json:"action"`
+	Actor     string     `json:"actor"`
+	CreatedAt time.Time  `json:"created_at"`
+	Old       *LinkState `json:"old,omitempty"`
+	New       LinkState  `json:"new"`
+}
+
+// UpdateRequest represents a partial update of a URL. Omitted fields are left
+// unchanged; expires_at may be set to null to remove the expiry. tags, utm
+// and variants replace every tag, UTM parameter and variant of the link; send
+// an empty list or object to remove them all.
+type UpdateRequest struct {
+	URL          *string    `json:"url,omitempty"`
+	RedirectType *int       `json:"redirect_type,omitempty"`
+	CacheControl *string    `json:"cache_control,omitempty"`
+	ExpiresAt    NullTime   `json:"expires_at"`
+	Title        *string    `json:"title,omitempty"`
+	Notes        *string    `json:"notes,omitempty"`
+	Tags         *[]string  `json:"tags,omitempty"`
+	UTM          *UTMParams `json:"utm,omitempty"`
+	UTMOverride  *bool      `json:"utm_override,omitempty"`
+	Passthrough  *bool      `json:"passthrough,omitempty"`
+	Interstitial *bool      `json:"interstitial,omitempty"`
+	Variants     *[]Variant `json:"variants,omitempty"`
+	Rotation     *string    `json:"rotation,omitempty"`
+}
+
+// RollbackRequest selects the revision to restore
+type RollbackRequest struct {
+	Revision int `json:"revision" binding:"required,min=1"`
+}
+
+// NullTime distinguishes an absent JSON field from an explicit null
+type NullTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+func (t *NullTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	if string(data) == "null" {
+		t.Time = nil
+		return nil
+	}
+
+	var value time.Time
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	t.Time = &value
+	return nil
+}
@@ -2,34 +2,181 @@ package models
 
 import "time"
 
-// URL represents a shortened URL entry
+// URL represents a shortened URL entry. Owner is the X-User header sent when
+// the link was created, which is not authenticated.
 type URL struct {
-	ID           int64      `json:"id"`
-	ShortCode    string     `json:"short_code"`
-	OriginalURL  string     `json:"original_url"`
-	Clicks       int64      `json:"clicks"`
-	CreatedAt    time.Time  `json:"created_at"`
-	LastAccessed *time.Time `json:"last_accessed,omitempty"`
+	ID           int64        `json:"id"`
+	ShortCode    string       `json:"short_code"`
+	OriginalURL  string       `json:"original_url"`
+	CanonicalURL string       `json:"canonical_url,omitempty"`
+	RedirectType int          `json:"redirect_type,omitempty"`
+	CacheControl string       `json:"cache_control,omitempty"`
+	ExpiresAt    *time.Time   `json:"expires_at,omitempty"`
+	Title        string       `json:"title,omitempty"`
+	Notes        string       `json:"notes,omitempty"`
+	Tags         []string     `json:"tags,omitempty"`
+	UTM          *UTMParams   `json:"utm,omitempty"`
+	UTMOverride  bool         `json:"utm_override,omitempty"`
+	Passthrough  bool         `json:"passthrough,omitempty"`
+	Interstitial bool         `json:"interstitial,omitempty"`
+	Variants     []Variant    `json:"variants,omitempty"`
+	Rotation     string       `json:"rotation,omitempty"`
+	CampaignID   int64        `json:"campaign_id,omitempty"`
+	Owner        string       `json:"owner,omitempty"`
+	Clicks       int64        `json:"clicks"`
+	CreatedAt    time.Time    `json:"created_at"`
+	LastAccessed *time.Time   `json:"last_accessed,omitempty"`
+	DeletedAt    *time.Time   `json:"deleted_at,omitempty"`
+	Preview      *LinkPreview `json:"preview,omitempty"`
+}
+
+// LinkPreview holds metadata extracted from the destination page
+type LinkPreview struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ImageURL    string    `json:"image_url,omitempty"`
+	SiteName    string    `json:"site_name,omitempty"`
+	TwitterCard string    `json:"twitter_card,omitempty"`
+	FaviconURL  string    `json:"favicon_url,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// Destination returns the URL visitors are sent to, preferring the canonical form
+func (u *URL) Destination() string {
+	if u.CanonicalURL != "" {
+		return u.CanonicalURL
+	}
+	return u.OriginalURL
+}
+
+// Variant is one of the destinations a link rotates between. Visits are
+// spread over the variants in proportion to their weights; a weight of 0
+// pauses a variant.
+type Variant struct {
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	CanonicalURL string `json:"canonical_url,omitempty"`
+	Weight       int    `json:"weight"`
+}
+
+// Destination returns the URL of the variant, preferring the canonical form
+func (v *Variant) Destination() string {
+	if v.CanonicalURL != "" {
+		return v.CanonicalURL
+	}
+	return v.URL
+}
+
+// VariantStats is a variant with the clicks that went to it
+type VariantStats struct {
+	Variant
+	Clicks int64 `json:"clicks"`
+}
+
+// Deleted reports whether the link has been moved to the trash
+func (u *URL) Deleted() bool {
+	return u.DeletedAt != nil
+}
+
+// Expired reports whether the link's expiry time has passed
+func (u *URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
 }
 
 // ShortenRequest represents the request to shorten a URL
 type ShortenRequest struct {
-	URL        string `json:"url" binding:"required,url"`
-	CustomCode string `json:"custom_code,omitempty"`
+	URL          string     `json:"url" binding:"required,url"`
+	CustomCode   string     `json:"custom_code,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+	CacheControl string     `json:"cache_control,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	Notes        string     `json:"notes,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	UTM          *UTMParams `json:"utm,omitempty"`
+	UTMOverride  bool       `json:"utm_override,omitempty"`
+	Passthrough  bool       `json:"passthrough,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	Variants     []Variant  `json:"variants,omitempty"`
+	Rotation     string     `json:"rotation,omitempty"`
+	CampaignID   int64      `json:"campaign_id,omitempty"`
+}
+
+// Suggestion is an existing link offered in place of an unknown short code
+type Suggestion struct {
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+}
+
+// QRLinks are the API URLs of the QR code images of a link
+type QRLinks struct {
+	PNG string `json:"png"`
+	SVG string `json:"svg"`
 }
 
 // ShortenResponse represents the response after shortening a URL
 type ShortenResponse struct {
-	ShortCode   string `json:"short_code"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortCode    string  `json:"short_code"`
+	ShortURL     string  `json:"short_url"`
+	OriginalURL  string  `json:"original_url"`
+	CanonicalURL string  `json:"canonical_url"`
+	QR           QRLinks `json:"qr"`
 }
 
 // StatsResponse represents URL statistics
 type StatsResponse struct {
 	ShortCode    string     `json:"short_code"`
 	OriginalURL  string     `json:"original_url"`
-	Clicks       int64      `json:"clicks"`
-	CreatedAt    time.Time  `json:"created_at"`
-	LastAccessed *time.Time `json:"last_accessed,omitempty"`
+	CanonicalURL string     `json:"canonical_url"`
+	RedirectType int        `json:"redirect_type"`
+	CacheControl string     `json:"cache_control"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	Notes        string     `json:"notes,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	UTM          *UTMParams `json:"utm,omitempty"`
+	UTMOverride  bool       `json:"utm_override,omitempty"`
+	Passthrough  bool       `json:"passthrough,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	// Variants carry the clicks recorded for each since they were introduced
+	Variants   []VariantStats `json:"variants,omitempty"`
+	Rotation   string         `json:"rotation,omitempty"`
+	CampaignID int64          `json:"campaign_id,omitempty"`
+	// FinalURL is the destination with the UTM parameters of the link and its
+	// campaign applied, as visitors are redirected to it
+	FinalURL     string       `json:"final_url"`
+	Owner        string       `json:"owner,omitempty"`
+	Clicks       int64        `json:"clicks"`
+	CreatedAt    time.Time    `json:"created_at"`
+	LastAccessed *time.Time   `json:"last_accessed,omitempty"`
+	DeletedAt    *time.Time   `json:"deleted_at,omitempty"`
+	Preview      *LinkPreview `json:"preview,omitempty"`
+}
+
+// PreviewResponse describes where a short link leads without following it,
+// as shown by its preview and interstitial pages
+type PreviewResponse struct {
+	ShortCode    string       `json:"short_code"`
+	ShortURL     string       `json:"short_url"`
+	Destination  string       `json:"destination"`
+	Title        string       `json:"title,omitempty"`
+	Interstitial bool         `json:"interstitial,omitempty"`
+	Clicks       int64        `json:"clicks"`
+	CreatedAt    time.Time    `json:"created_at"`
+	Preview      *LinkPreview `json:"preview,omitempty"`
+}
+
+// TagCount is a tag with the number of links outside the trash carrying it
+type TagCount struct {
+	Name  string `json:"name"`
+	Links int64  `json:"links"`
+}
+
+// SearchResult is a link matching a search. Highlights holds the matching
+// fields (short_code, title, tags, notes, destination) as HTML-escaped text with
+// the matched words wrapped in <mark>.
+type SearchResult struct {
+	URL        *URL              `json:"url"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
 }
@@ -0,0 +1,164 @@
+// Package pages renders the HTML pages shown to browsers instead of JSON when
+// a short link cannot be followed directly: unknown, gone, disabled or
+// protected links and the interstitial before a redirect. The templates are
+// embedded in the binary and can be replaced file by file from a directory.
+package pages
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"url-shortener/models"
+)
+
+// Page names, which are also the names of their template files without .html
+const (
+	NotFound     = "notfound"
+	Gone         = "gone"
+	Unavailable  = "unavailable"
+	Password     = "password"
+	Interstitial = "interstitial"
+)
+
+var names = []string{NotFound, Gone, Unavailable, Password, Interstitial}
+
+//go:embed templates/*.html
+var embedded embed.FS
+
+// Theme brands every page
+type Theme struct {
+	Brand           string
+	LogoURL         string
+	AccentColor     string
+	BackgroundColor string
+	TextColor       string
+	// StylesheetURL is an extra stylesheet loaded after the built-in styles
+	StylesheetURL string
+	Footer        string
+}
+
+// DefaultTheme is used for the fields a configuration leaves empty
+var DefaultTheme = Theme{
+	Brand:           "URL Shortener",
+	AccentColor:     "#2563eb",
+	BackgroundColor: "#ffffff",
+	TextColor:       "#1f2937",
+}
+
+// color accepts hex colors and CSS color names, the values that can be put
+// into a stylesheet without escaping
+var color = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+var ErrInvalidColor = errors.New("theme colors must be hex values or CSS color names")
+
+// NotFoundData fills the page for an unknown short link
+type NotFoundData struct {
+	Path        string
+	Suggestions []models.Suggestion
+}
+
+// GoneData fills the page for an expired or deleted link
+type GoneData struct {
+	Path    string
+	Expired bool
+}
+
+// UnavailableData fills the page for a link that has been disabled
+type UnavailableData struct {
+	Path string
+	// Reason is the code of the safety check that rejected the destination
+	Reason string
+}
+
+// PasswordData fills the form asking for the password of a protected link
+type PasswordData struct {
+	ShortCode string
+	// Action is the URL the form posts the password to
+	Action string
+	Failed bool
+}
+
+// InterstitialData fills the page showing where a link leads instead of
+// redirecting to it
+type InterstitialData struct {
+	models.PreviewResponse
+	// Description is taken from the link preview of the destination
+	Description string
+}
+
+// Renderer executes the page templates with a theme
+type Renderer struct {
+	theme     Theme
+	templates map[string]*template.Template
+}
+
+// New parses the page templates. Files in dir, when it is not empty, replace
+// the embedded ones of the same name: layout.html and one file per page.
+func New(theme Theme, dir string) (*Renderer, error) {
+	theme = theme.withDefaults()
+	for _, c := range []string{theme.AccentColor, theme.BackgroundColor, theme.TextColor} {
+		if !color.MatchString(c) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidColor, c)
+		}
+	}
+
+	source, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		source = overlay{os.DirFS(dir), source}
+	}
+
+	r := &Renderer{theme: theme, templates: make(map[string]*template.Template, len(names))}
+	for _, name := range names {
+		t, err := template.ParseFS(source, "layout.html", name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("page %s: %w", name, err)
+		}
+		r.templates[name] = t
+	}
+	return r, nil
+}
+
+// Render writes a page filled with data, which must be the page's *Data type
+func (r *Renderer) Render(w io.Writer, page string, data any) error {
+	t, exists := r.templates[page]
+	if !exists {
+		return fmt.Errorf("unknown page %q", page)
+	}
+	return t.ExecuteTemplate(w, "layout", struct {
+		Theme Theme
+		Page  any
+	}{r.theme, data})
+}
+
+func (t Theme) withDefaults() Theme {
+	for _, field := range []struct{ value, fallback *string }{
+		{&t.Brand, &DefaultTheme.Brand},
+		{&t.AccentColor, &DefaultTheme.AccentColor},
+		{&t.BackgroundColor, &DefaultTheme.BackgroundColor},
+		{&t.TextColor, &DefaultTheme.TextColor},
+	} {
+		if *field.value == "" {
+			*field.value = *field.fallback
+		}
+	}
+	return t
+}
+
+// overlay reads files from its first file system and falls back to the second
+type overlay [2]fs.FS
+
+func (o overlay) Open(name string) (fs.File, error) {
+	f, err := o[0].Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o[1].Open(name)
+	}
+	return f, err
+}
@@ -0,0 +1,94 @@
+package pages
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"url-shortener/models"
+)
+
+func render(t *testing.T, r *Renderer, page string, data any) string {
+	t.Helper()
+	var b strings.Builder
+	if err := r.Render(&b, page, data); err != nil {
+		t.Fatalf("Expected no error rendering %s, got %v", page, err)
+	}
+	return b.String()
+}
+
+func TestRender(t *testing.T) {
+	r, err := New(Theme{Brand: "Acme Links", AccentColor: "#ff6600", Footer: "Run by Acme"}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Apply theme", func(t *testing.T) {
+		html := render(t, r, Gone, GoneData{Path: "promo", Expired: true})
+		for _, want := range []string{"Acme Links", "--accent: #ff6600", "--background: #ffffff", "Run by Acme", "has expired"} {
+			if !strings.Contains(html, want) {
+				t.Errorf("Expected page to contain %q", want)
+			}
+		}
+	})
+
+	t.Run("Escape data", func(t *testing.T) {
+		html := render(t, r, NotFound, NotFoundData{
+			Path:        "<script>",
+			Suggestions: []models.Suggestion{{ShortCode: "promo", ShortURL: "http://localhost:8080/promo"}},
+		})
+		if strings.Contains(html, "<script>") {
+			t.Error("Expected path to be escaped")
+		}
+		if !strings.Contains(html, `href="http://localhost:8080/promo"`) {
+			t.Error("Expected suggestion link")
+		}
+	})
+
+	t.Run("Render every page", func(t *testing.T) {
+		pages := map[string]any{
+			Unavailable:  UnavailableData{Path: "bad", Reason: "blocklisted"},
+			Password:     PasswordData{ShortCode: "secret", Action: "/secret", Failed: true},
+			Interstitial: InterstitialData{PreviewResponse: models.PreviewResponse{ShortCode: "docs", Destination: "https://example.com/docs"}},
+		}
+		for page, data := range pages {
+			if html := render(t, r, page, data); !strings.Contains(html, "</html>") {
+				t.Errorf("Expected complete %s page", page)
+			}
+		}
+	})
+
+	t.Run("Reject unknown page", func(t *testing.T) {
+		if err := r.Render(&strings.Builder{}, "missing", nil); err == nil {
+			t.Error("Expected error for unknown page")
+		}
+	})
+}
+
+func TestInvalidColor(t *testing.T) {
+	_, err := New(Theme{TextColor: "red; } body { display: none"}, "")
+	if !errors.Is(err, ErrInvalidColor) {
+		t.Errorf("Expected ErrInvalidColor, got %v", err)
+	}
+}
+
+func TestTemplatesDir(t *testing.T) {
+	dir := t.TempDir()
+	custom := `{{define "title"}}Gone{{end}}{{define "content"}}Custom gone page for {{.Path}}{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "gone.html"), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(Theme{}, dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if html := render(t, r, Gone, GoneData{Path: "promo"}); !strings.Contains(html, "Custom gone page for promo") {
+		t.Errorf("Expected the template from the directory, got %s", html)
+	}
+	// Pages without a replacement keep the embedded template
+	if html := render(t, r, NotFound, NotFoundData{Path: "promo"}); !strings.Contains(html, "Link not found") {
+		t.Error("Expected the embedded not found page")
+	}
+}
@@ -0,0 +1,164 @@
+// Package preview extracts link metadata (title, OpenGraph and Twitter card
+// tags, favicon) from an HTML document.
+package preview
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"time"
+	"url-shortener/models"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxFieldLen caps extracted values so hostile pages cannot bloat storage
+const maxFieldLen = 512
+
+// Extract parses the <head> of an HTML document served from pageURL.
+// Relative image and icon references are resolved against pageURL.
+func Extract(body []byte, pageURL *url.URL) *models.LinkPreview {
+	meta := map[string]string{}
+	var title, favicon string
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	inTitle := false
+
+loop:
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			break loop
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = title == ""
+			case atom.Meta:
+				if hasAttr {
+					key, content := metaAttrs(tokenizer)
+					if key != "" && meta[key] == "" {
+						meta[key] = content
+					}
+				}
+			case atom.Link:
+				if hasAttr {
+					if href, priority := iconAttrs(tokenizer); href != "" && (favicon == "" || priority) {
+						favicon = href
+					}
+				}
+			case atom.Body:
+				break loop
+			}
+
+		case html.TextToken:
+			if inTitle {
+				title += string(tokenizer.Text())
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				break loop
+			}
+		}
+	}
+
+	if favicon == "" {
+		favicon = "/favicon.ico"
+	}
+
+	return &models.LinkPreview{
+		Title:       clean(first(meta["og:title"], meta["twitter:title"], title)),
+		Description: clean(first(meta["og:description"], meta["twitter:description"], meta["description"])),
+		ImageURL:    resolve(pageURL, first(meta["og:image"], meta["og:image:url"], meta["twitter:image"], meta["twitter:image:src"])),
+		SiteName:    clean(meta["og:site_name"]),
+		TwitterCard: clean(meta["twitter:card"]),
+		FaviconURL:  resolve(pageURL, favicon),
+		FetchedAt:   time.Now(),
+	}
+}
+
+// metaAttrs returns the property/name and content of a <meta> tag
+func metaAttrs(tokenizer *html.Tokenizer) (string, string) {
+	var key, content string
+	for {
+		name, value, more := tokenizer.TagAttr()
+		switch string(name) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(value)))
+			}
+		case "content":
+			content = string(value)
+		}
+		if !more {
+			return key, content
+		}
+	}
+}
+
+// iconAttrs returns the href of an icon <link> tag and whether it is a
+// preferred icon that should replace one found earlier
+func iconAttrs(tokenizer *html.Tokenizer) (string, bool) {
+	var rel, href string
+	for {
+		name, value, more := tokenizer.TagAttr()
+		switch string(name) {
+		case "rel":
+			rel = strings.ToLower(string(value))
+		case "href":
+			href = strings.TrimSpace(string(value))
+		}
+		if !more {
+			break
+		}
+	}
+
+	for _, token := range strings.Fields(rel) {
+		if token == "icon" {
+			return href, true
+		}
+		if token == "apple-touch-icon" {
+			return href, false
+		}
+	}
+	return "", false
+}
+
+func first(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// clean collapses whitespace and truncates long values
+func clean(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if len(value) > maxFieldLen {
+		value = strings.ToValidUTF8(value[:maxFieldLen], "")
+	}
+	return value
+}
+
+// resolve makes ref absolute and keeps only http(s) URLs
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return clean(u.String())
+}
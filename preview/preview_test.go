@@ -0,0 +1,73 @@
+package preview
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	page, _ := url.Parse("https://example.com/blog/post")
+
+	t.Run("Prefer OpenGraph tags", func(t *testing.T) {
+		body := []byte(`<!doctype html><html><head>
+			<title>Fallback &amp; title</title>
+			<meta property="og:title" content="OpenGraph  title">
+			<meta property="og:description" content="A description">
+			<meta property="og:image" content="/images/cover.png">
+			<meta property="og:site_name" content="Example Blog">
+			<meta name="twitter:card" content="summary_large_image">
+			<link rel="apple-touch-icon" href="/apple.png">
+			<link rel="shortcut icon" href="https://cdn.example.com/favicon.png">
+		</head><body><title>ignored</title></body></html>`)
+
+		preview := Extract(body, page)
+
+		if preview.Title != "OpenGraph title" {
+			t.Errorf("Expected OpenGraph title, got '%s'", preview.Title)
+		}
+		if preview.Description != "A description" {
+			t.Errorf("Expected description, got '%s'", preview.Description)
+		}
+		if preview.ImageURL != "https://example.com/images/cover.png" {
+			t.Errorf("Expected absolute image URL, got '%s'", preview.ImageURL)
+		}
+		if preview.SiteName != "Example Blog" {
+			t.Errorf("Expected site name, got '%s'", preview.SiteName)
+		}
+		if preview.TwitterCard != "summary_large_image" {
+			t.Errorf("Expected twitter card, got '%s'", preview.TwitterCard)
+		}
+		if preview.FaviconURL != "https://cdn.example.com/favicon.png" {
+			t.Errorf("Expected icon link, got '%s'", preview.FaviconURL)
+		}
+	})
+
+	t.Run("Fall back to title and Twitter tags", func(t *testing.T) {
+		body := []byte(`<html><head><title>
+			Plain &amp; simple
+		</title><meta name="twitter:description" content="From twitter">
+		<meta name="twitter:image" content="javascript:alert(1)"></head></html>`)
+
+		preview := Extract(body, page)
+
+		if preview.Title != "Plain & simple" {
+			t.Errorf("Expected page title, got '%s'", preview.Title)
+		}
+		if preview.Description != "From twitter" {
+			t.Errorf("Expected twitter description, got '%s'", preview.Description)
+		}
+		if preview.ImageURL != "" {
+			t.Errorf("Expected non-http image to be dropped, got '%s'", preview.ImageURL)
+		}
+		if preview.FaviconURL != "https://example.com/favicon.ico" {
+			t.Errorf("Expected default favicon, got '%s'", preview.FaviconURL)
+		}
+	})
+
+	t.Run("Handle empty documents", func(t *testing.T) {
+		preview := Extract(nil, page)
+		if preview.Title != "" || preview.FaviconURL != "https://example.com/favicon.ico" {
+			t.Errorf("Unexpected preview %+v", preview)
+		}
+	})
+}
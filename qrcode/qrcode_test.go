@@ -0,0 +1,304 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// HELLO WORLD at version 1-Q, the worked example of the standard's tutorials
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236}
+	expected := []byte{168, 72, 22, 82, 217, 54, 156, 0, 46, 15, 180, 122, 16}
+	if got := rsRemainder(data, rsGenerator(13)); !bytes.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestInformationBits(t *testing.T) {
+	if got := formatBits(Low, 4); got != 0b110011000101111 {
+		t.Errorf("Expected format bits 110011000101111 for L and mask 4, got %015b", got)
+	}
+	if got := formatBits(Medium, 0); got != 0b101010000010010 {
+		t.Errorf("Expected format bits 101010000010010 for M and mask 0, got %015b", got)
+	}
+	if got := versionBits(7); got != 0b000111110010010100 {
+		t.Errorf("Expected version bits 000111110010010100 for version 7, got %018b", got)
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	tests := map[int]string{
+		1:  "[]",
+		2:  "[6 18]",
+		7:  "[6 22 38]",
+		15: "[6 26 48 70]",
+		32: "[6 34 60 86 112 138]",
+		40: "[6 30 58 86 114 142 170]",
+	}
+	for version, expected := range tests {
+		if got := fmt.Sprint(alignmentPositions(version)); got != expected {
+			t.Errorf("Expected %s for version %d, got %s", expected, version, got)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	// Data codewords of the largest version at each level
+	for level, expected := range map[Level]int{Low: 2956, Medium: 2334, Quartile: 1666, High: 1276} {
+		if got := dataCodewords(40, level); got != expected {
+			t.Errorf("Expected %d data codewords at 40-%s, got %d", expected, level, got)
+		}
+	}
+
+	if _, err := Encode(strings.Repeat("a", 2953), Low); err != nil {
+		t.Errorf("Expected the largest text to fit, got %v", err)
+	}
+	if _, err := Encode(strings.Repeat("a", 2954), Low); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		text    string
+		level   Level
+		version int
+	}{
+		{"https://sho.rt", Medium, 1},
+		{"http://localhost:8080/promo", Medium, 3},
+		{"https://sho.rt/abc", High, 3},
+		{"https://example.com/" + strings.Repeat("go/", 40), Quartile, 10},
+		{strings.Repeat("x", 500), Medium, 17},
+	}
+
+	for _, tt := range tests {
+		code, err := Encode(tt.text, tt.level)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if code.Version != tt.version || code.Size != 4*tt.version+17 {
+			t.Errorf("Expected version %d for %d bytes at %s, got %d (size %d)", tt.version, len(tt.text), tt.level, code.Version, code.Size)
+		}
+		if got := decode(t, code); got != tt.text {
+			t.Errorf("Expected %q to read back, got %q", tt.text, got)
+		}
+	}
+}
+
+// decode reads the text back from a code, checking its format information
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+
+	format := 0
+	for i := 14; i >= 0; i-- {
+		var dark bool
+		switch {
+		case i <= 5:
+			dark = c.Dark(8, i)
+		case i == 6:
+			dark = c.Dark(8, 7)
+		case i == 7:
+			dark = c.Dark(8, 8)
+		case i == 8:
+			dark = c.Dark(7, 8)
+		default:
+			dark = c.Dark(14-i, 8)
+		}
+		format <<= 1
+		if dark {
+			format |= 1
+		}
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if formatBits(c.Level, m) == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("Format bits %015b do not match level %s", format, c.Level)
+	}
+
+	c.applyMask(mask)
+	defer c.applyMask(mask)
+	var bits bitBuffer
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if (right+1)&2 == 0 {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				if !c.function[y*c.Size+right-j] {
+					bits = append(bits, c.Dark(right-j, y))
+				}
+			}
+		}
+	}
+	codewords := bits.bytes()
+
+	// Undo the interleaving of the data codewords
+	numBlocks := eccBlocks[c.Level][c.Version]
+	total := rawModules(c.Version) / 8
+	numShort := numBlocks - total%numBlocks
+	shortLen := total/numBlocks - eccPerBlock[c.Level][c.Version]
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for b := range blocks {
+			if i < shortLen || b >= numShort {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	data := bytes.Join(blocks, nil)
+
+	if data[0]>>4 != 0x4 {
+		t.Fatalf("Expected byte mode, got mode %x", data[0]>>4)
+	}
+	var length, start int
+	if countBits(c.Version) == 8 {
+		length = int(data[0]&0xF)<<4 | int(data[1]>>4)
+		start = 1
+	} else {
+		length = int(data[0]&0xF)<<12 | int(data[1])<<4 | int(data[2]>>4)
+		start = 2
+	}
+	text := make([]byte, length)
+	for i := range text {
+		text[i] = data[start+i]<<4 | data[start+i+1]>>4
+	}
+	return string(text)
+}
+
+func TestParseColor(t *testing.T) {
+	tests := map[string]color.RGBA{
+		"1f2937":  {0x1f, 0x29, 0x37, 0xff},
+		"#FFFFFF": {0xff, 0xff, 0xff, 0xff},
+		"f60":     {0xff, 0x66, 0x00, 0xff},
+	}
+	for s, expected := range tests {
+		if got, err := ParseColor(s); err != nil || got != expected {
+			t.Errorf("Expected %v for %q, got %v (%v)", expected, s, got, err)
+		}
+	}
+	for _, s := range []string{"", "red", "12345", "#gggggg"} {
+		if _, err := ParseColor(s); !errors.Is(err, ErrInvalidColor) {
+			t.Errorf("Expected ErrInvalidColor for %q, got %v", s, err)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	black := color.RGBA{A: 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	red := color.RGBA{R: 0xff, A: 0xff}
+	logo := image.NewUniform(red)
+	renderer := NewRenderer(image.NewRGBA(image.Rect(0, 0, 10, 10)), 2)
+	base := Request{Text: "http://localhost:8080/promo", Format: FormatPNG, Size: 256, Margin: 4, Level: Medium, Foreground: black, Background: white}
+
+	t.Run("Draw PNG modules", func(t *testing.T) {
+		data, err := renderer.Render(base)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Expected a PNG, got %v", err)
+		}
+		if img.Bounds().Dx() != 256 || img.Bounds().Dy() != 256 {
+			t.Errorf("Expected 256x256, got %v", img.Bounds())
+		}
+
+		// Version 3 is 29 modules, 37 with the margin: 6 pixels each and 17 left over on each side
+		code, _ := Encode(base.Text, Medium)
+		for _, m := range [][2]int{{0, 0}, {7, 7}, {8, 0}, {10, 10}} {
+			x, y := 17+(4+m[0])*6+3, 17+(4+m[1])*6+3
+			r, _, _, _ := img.At(x, y).RGBA()
+			if dark := r == 0; dark != code.Dark(m[0], m[1]) {
+				t.Errorf("Expected module %v dark %t, got %t", m, code.Dark(m[0], m[1]), dark)
+			}
+		}
+		if r, _, _, _ := img.At(5, 5).RGBA(); r == 0 {
+			t.Error("Expected a light margin")
+		}
+	})
+
+	t.Run("Draw SVG", func(t *testing.T) {
+		req := base
+		req.Format = FormatSVG
+		req.Foreground = red
+		data, err := renderer.Render(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		svg := string(data)
+		for _, want := range []string{`width="256"`, `viewBox="0 0 37 37"`, `<path fill="#ff0000" d="M4 4h7v1h-7z`} {
+			if !strings.Contains(svg, want) {
+				t.Errorf("Expected SVG to contain %q", want)
+			}
+		}
+	})
+
+	t.Run("Draw the logo at level H", func(t *testing.T) {
+		logoRenderer := NewRenderer(logo, 0)
+		req := base
+		req.Logo = true
+		data, err := logoRenderer.Render(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		img, _ := png.Decode(bytes.NewReader(data))
+		if r, g, _, _ := img.At(128, 128).RGBA(); r != 0xffff || g != 0 {
+			t.Errorf("Expected the logo in the centre, got %v", img.At(128, 128))
+		}
+
+		if _, err := NewRenderer(nil, 0).Render(req); err != ErrNoLogo {
+			t.Errorf("Expected ErrNoLogo, got %v", err)
+		}
+	})
+
+	t.Run("Reject invalid options", func(t *testing.T) {
+		for _, change := range []func(*Request){
+			func(r *Request) { r.Format = "gif" },
+			func(r *Request) { r.Size = MaxSize + 1 },
+			func(r *Request) { r.Margin = -1 },
+		} {
+			req := base
+			change(&req)
+			if _, err := renderer.Render(req); !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("Expected ErrInvalidOptions, got %v", err)
+			}
+		}
+	})
+
+	t.Run("Cache the most recent images", func(t *testing.T) {
+		first, _ := renderer.Render(base)
+		again, _ := renderer.Render(base)
+		if &first[0] != &again[0] {
+			t.Error("Expected the cached image")
+		}
+
+		for _, size := range []int{100, 200} {
+			req := base
+			req.Size = size
+			renderer.Render(req)
+		}
+		if renderer.order.Len() != 2 {
+			t.Errorf("Expected 2 cached images, got %d", renderer.order.Len())
+		}
+		if evicted, _ := renderer.Render(base); &evicted[0] == &first[0] {
+			t.Error("Expected the least recently used image to be evicted")
+		}
+	})
+}
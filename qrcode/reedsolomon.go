@@ -0,0 +1,62 @@
+package qrcode
+
+// Reed-Solomon error correction over GF(2^8) with the QR code polynomial
+// x^8 + x^4 + x^3 + x^2 + 1
+
+var expTable, logTable = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	// Doubled so products need no modulo
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+// rsGenerator returns the coefficients, highest degree first and without the
+// leading 1, of the generator polynomial (x - a^0)(x - a^1)...(x - a^(degree-1))
+func rsGenerator(degree int) []byte {
+	generator := make([]byte, degree)
+	generator[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range generator {
+			generator[j] = gfMul(generator[j], root)
+			if j+1 < degree {
+				generator[j] ^= generator[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return generator
+}
+
+// rsRemainder returns the error correction codewords of data
+func rsRemainder(data, generator []byte) []byte {
+	remainder := make([]byte, len(generator))
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[len(remainder)-1] = 0
+		for i, coefficient := range generator {
+			remainder[i] ^= gfMul(coefficient, factor)
+		}
+	}
+	return remainder
+}
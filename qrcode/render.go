@@ -0,0 +1,177 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// logoShare is the largest part of the code's width a logo may cover. At
+// level H this stays well within what error correction restores.
+const logoShare = 0.2
+
+var ErrInvalidColor = errors.New("colors must be hex values such as 1f2937 or #1f2937")
+
+// Options control how a code is drawn
+type Options struct {
+	// Size is the width and height of the image in pixels. PNG images are
+	// never smaller than one pixel per module.
+	Size int
+	// Margin is the quiet zone around the code, in modules
+	Margin     int
+	Foreground color.RGBA
+	Background color.RGBA
+	// Logo, when set, is drawn over the centre of the code on a background
+	// colored pad
+	Logo image.Image
+}
+
+// ParseColor reads a color written as 3 or 6 hex digits, with or without a
+// leading #
+func ParseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("%w: %q", ErrInvalidColor, s)
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("%w: %q", ErrInvalidColor, s)
+	}
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xFF}, nil
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// logoBox returns the side and offset, in modules of the full image, of the
+// square a logo is drawn in
+func (c *Code) logoBox(margin int) (side, offset int) {
+	side = int(float64(c.Size) * logoShare)
+	// Keep the box centred on the middle module
+	if side%2 == 0 {
+		side--
+	}
+	return side, margin + (c.Size-side)/2
+}
+
+// PNG draws the code as a PNG image. Modules are whole pixels; the pixels
+// left over when Size is not a multiple of the modules widen the margin.
+func (c *Code) PNG(opts Options) ([]byte, error) {
+	modules := c.Size + 2*opts.Margin
+	size := max(opts.Size, modules)
+	scale := size / modules
+	offset := (size - scale*modules) / 2
+
+	bounds := image.Rect(0, 0, size, size)
+	var img draw.Image
+	if opts.Logo == nil {
+		img = image.NewPaletted(bounds, color.Palette{opts.Background, opts.Foreground})
+	} else {
+		img = image.NewRGBA(bounds)
+	}
+	draw.Draw(img, bounds, image.NewUniform(opts.Background), image.Point{}, draw.Src)
+
+	foreground := image.NewUniform(opts.Foreground)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+			px := offset + (opts.Margin+x)*scale
+			py := offset + (opts.Margin+y)*scale
+			draw.Draw(img, image.Rect(px, py, px+scale, py+scale), foreground, image.Point{}, draw.Src)
+		}
+	}
+
+	if opts.Logo != nil {
+		side, start := c.logoBox(opts.Margin)
+		pad := image.Rect(offset+start*scale, offset+start*scale, offset+(start+side)*scale, offset+(start+side)*scale)
+		draw.Draw(img, pad, image.NewUniform(opts.Background), image.Point{}, draw.Src)
+		// Leave half a module of the pad around the logo
+		inset := scale / 2
+		target := image.Rect(pad.Min.X+inset, pad.Min.Y+inset, pad.Max.X-inset, pad.Max.Y-inset)
+		drawScaled(img, target, opts.Logo)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawScaled draws src into target with nearest neighbour scaling, keeping
+// its aspect ratio and centring it
+func drawScaled(dst draw.Image, target image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	if sb.Empty() || target.Empty() {
+		return
+	}
+	w, h := target.Dx(), target.Dy()
+	if sb.Dx()*h > sb.Dy()*w {
+		h = sb.Dy() * w / sb.Dx()
+	} else {
+		w = sb.Dx() * h / sb.Dy()
+	}
+	x0 := target.Min.X + (target.Dx()-w)/2
+	y0 := target.Min.Y + (target.Dy()-h)/2
+
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			scaled.Set(x, y, src.At(sb.Min.X+x*sb.Dx()/w, sb.Min.Y+y*sb.Dy()/h))
+		}
+	}
+	draw.Draw(dst, image.Rect(x0, y0, x0+w, y0+h), scaled, image.Point{}, draw.Over)
+}
+
+// SVG draws the code as an SVG image, one path holding every dark module
+func (c *Code) SVG(opts Options) ([]byte, error) {
+	modules := c.Size + 2*opts.Margin
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/>`, modules, modules, hexColor(opts.Background))
+
+	fmt.Fprintf(&b, `<path fill="%s" d="`, hexColor(opts.Foreground))
+	for y := 0; y < c.Size; y++ {
+		// One rectangle per horizontal run of dark modules
+		for x := 0; x < c.Size; {
+			if !c.Dark(x, y) {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < c.Size && c.Dark(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", opts.Margin+x, opts.Margin+y, run, run)
+			x += run
+		}
+	}
+	b.WriteString(`"/>`)
+
+	if opts.Logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, opts.Logo); err != nil {
+			return nil, err
+		}
+		side, start := c.logoBox(opts.Margin)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`, start, start, side, side, hexColor(opts.Background))
+		fmt.Fprintf(&b, `<image x="%g" y="%g" width="%d" height="%d" href="data:image/png;base64,%s"/>`,
+			float64(start)+0.5, float64(start)+0.5, side-1, side-1, base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+	b.WriteString("</svg>\n")
+	return []byte(b.String()), nil
+}
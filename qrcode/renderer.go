@@ -0,0 +1,166 @@
+package qrcode
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"sync"
+)
+
+// Image formats
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// Limits of the drawing options
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+var (
+	ErrInvalidOptions = errors.New("invalid QR code options")
+	ErrNoLogo         = errors.New("no logo is configured")
+)
+
+// Request describes a QR code image. It is comparable, and the images drawn
+// are cached by it.
+type Request struct {
+	Text       string
+	Format     string
+	Size       int
+	Margin     int
+	Level      Level
+	Foreground color.RGBA
+	Background color.RGBA
+	// Logo asks for the configured logo in the centre of the code
+	Logo bool
+}
+
+// Renderer draws QR code images and keeps the most recently used ones, as
+// the same codes are asked for over and over
+type Renderer struct {
+	logo     image.Image
+	capacity int
+
+	mutex   sync.Mutex
+	entries map[Request]*list.Element
+	// order holds the cached images, most recently used first
+	order *list.List
+}
+
+type cacheEntry struct {
+	request Request
+	image   []byte
+}
+
+// NewRenderer returns a renderer drawing logo, which may be nil, on request
+// and caching up to cacheSize images; 0 disables the cache
+func NewRenderer(logo image.Image, cacheSize int) *Renderer {
+	return &Renderer{
+		logo:     logo,
+		capacity: cacheSize,
+		entries:  make(map[Request]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// LoadLogo reads a PNG, JPEG or GIF image to draw in the centre of codes
+func LoadLogo(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	logo, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return logo, nil
+}
+
+// HasLogo reports whether a logo is configured
+func (r *Renderer) HasLogo() bool {
+	return r.logo != nil
+}
+
+// Render returns the image described by req. Codes with a logo always use
+// level H so the modules it covers can be restored.
+func (r *Renderer) Render(req Request) ([]byte, error) {
+	if req.Format != FormatPNG && req.Format != FormatSVG {
+		return nil, fmt.Errorf("%w: format must be %s or %s", ErrInvalidOptions, FormatPNG, FormatSVG)
+	}
+	if req.Size < MinSize || req.Size > MaxSize {
+		return nil, fmt.Errorf("%w: size must be between %d and %d", ErrInvalidOptions, MinSize, MaxSize)
+	}
+	if req.Margin < 0 || req.Margin > MaxMargin {
+		return nil, fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidOptions, MaxMargin)
+	}
+	if req.Logo {
+		if r.logo == nil {
+			return nil, ErrNoLogo
+		}
+		req.Level = High
+	}
+
+	if img, cached := r.cached(req); cached {
+		return img, nil
+	}
+
+	code, err := Encode(req.Text, req.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := Options{Size: req.Size, Margin: req.Margin, Foreground: req.Foreground, Background: req.Background}
+	if req.Logo {
+		opts.Logo = r.logo
+	}
+	var img []byte
+	if req.Format == FormatSVG {
+		img, err = code.SVG(opts)
+	} else {
+		img, err = code.PNG(opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.store(req, img)
+	return img, nil
+}
+
+func (r *Renderer) cached(req Request) ([]byte, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	element, exists := r.entries[req]
+	if !exists {
+		return nil, false
+	}
+	r.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).image, true
+}
+
+func (r *Renderer) store(req Request, img []byte) {
+	if r.capacity <= 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.entries[req]; exists {
+		return
+	}
+	r.entries[req] = r.order.PushFront(&cacheEntry{request: req, image: img})
+	if r.order.Len() > r.capacity {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cacheEntry).request)
+	}
+}
@@ -0,0 +1,97 @@
+package safety
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Blocklist rejects destinations on a blocked domain or under a blocked URL prefix.
+// Each line of the file is either a domain, which also blocks its subdomains,
+// or an absolute URL that blocks every destination starting with it.
+type Blocklist struct {
+	source   fileSource
+	mutex    sync.RWMutex
+	domains  map[string]bool
+	prefixes []string
+}
+
+func NewBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{source: fileSource{path: path}}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload re-reads the blocklist file
+func (b *Blocklist) Reload() error {
+	modTime, err := b.source.stat()
+	if err != nil {
+		return err
+	}
+
+	lines, err := readLines(b.source.path)
+	if err != nil {
+		return err
+	}
+
+	domains := make(map[string]bool)
+	var prefixes []string
+	for _, line := range lines {
+		if strings.Contains(line, "://") {
+			prefixes = append(prefixes, strings.ToLower(line))
+			continue
+		}
+		domains[strings.TrimSuffix(strings.ToLower(line), ".")] = true
+	}
+
+	b.mutex.Lock()
+	b.domains = domains
+	b.prefixes = prefixes
+	b.source.modTime = modTime
+	b.mutex.Unlock()
+
+	return nil
+}
+
+func (b *Blocklist) ReloadIfChanged() error {
+	modTime, err := b.source.stat()
+	if err != nil {
+		return err
+	}
+
+	b.mutex.RLock()
+	changed := !modTime.Equal(b.source.modTime)
+	b.mutex.RUnlock()
+	if !changed {
+		return nil
+	}
+	return b.Reload()
+}
+
+func (b *Blocklist) Check(u *url.URL) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	host := strings.ToLower(u.Hostname())
+	for domain := host; domain != ""; {
+		if b.domains[domain] {
+			return reject(ReasonBlocklisted, "domain "+domain+" is blocked")
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+
+	destination := strings.ToLower(u.String())
+	for _, prefix := range b.prefixes {
+		if strings.HasPrefix(destination, prefix) {
+			return reject(ReasonBlocklisted, "URL matches blocked prefix "+prefix)
+		}
+	}
+
+	return nil
+}
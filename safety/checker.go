@@ -0,0 +1,46 @@
+package safety
+
+import (
+	"net/url"
+)
+
+// Reason codes reported when a destination is rejected
+const (
+	ReasonBlocklisted         = "blocklisted"
+	ReasonUnsafeHashMatch     = "unsafe_hash_match"
+	ReasonIPLiteral           = "ip_literal_host"
+	ReasonExcessiveSubdomains = "excessive_subdomains"
+	ReasonLookalikeDomain     = "lookalike_domain"
+)
+
+// Rejection explains why a destination was refused
+type Rejection struct {
+	Reason string
+	Detail string
+}
+
+func (r *Rejection) Error() string {
+	return "destination rejected (" + r.Reason + "): " + r.Detail
+}
+
+func reject(reason, detail string) *Rejection {
+	return &Rejection{Reason: reason, Detail: detail}
+}
+
+// DestinationChecker inspects a canonical destination before it is shortened.
+// Check returns a *Rejection when the destination must not be accepted.
+type DestinationChecker interface {
+	Check(u *url.URL) error
+}
+
+// Chain runs checkers in order and stops at the first rejection
+type Chain []DestinationChecker
+
+func (c Chain) Check(u *url.URL) error {
+	for _, checker := range c {
+		if err := checker.Check(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
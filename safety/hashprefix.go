@@ -0,0 +1,142 @@
+package safety
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// HashPrefixList matches destinations against SHA-256 hash prefixes in the
+// style of the Safe Browsing update API. The file holds one hex encoded
+// prefix (4 to 32 bytes) per line; full hashes are simply 32 byte prefixes.
+type HashPrefixList struct {
+	source   fileSource
+	mutex    sync.RWMutex
+	prefixes map[int]map[string]bool
+}
+
+func NewHashPrefixList(path string) (*HashPrefixList, error) {
+	l := &HashPrefixList{source: fileSource{path: path}}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload re-reads the prefix file
+func (l *HashPrefixList) Reload() error {
+	modTime, err := l.source.stat()
+	if err != nil {
+		return err
+	}
+
+	lines, err := readLines(l.source.path)
+	if err != nil {
+		return err
+	}
+
+	prefixes := make(map[int]map[string]bool)
+	for i, line := range lines {
+		prefix, err := hex.DecodeString(line)
+		if err != nil || len(prefix) < 4 || len(prefix) > sha256.Size {
+			return fmt.Errorf("%s: invalid hash prefix on entry %d", l.source.path, i+1)
+		}
+		if prefixes[len(prefix)] == nil {
+			prefixes[len(prefix)] = make(map[string]bool)
+		}
+		prefixes[len(prefix)][string(prefix)] = true
+	}
+
+	l.mutex.Lock()
+	l.prefixes = prefixes
+	l.source.modTime = modTime
+	l.mutex.Unlock()
+
+	return nil
+}
+
+func (l *HashPrefixList) ReloadIfChanged() error {
+	modTime, err := l.source.stat()
+	if err != nil {
+		return err
+	}
+
+	l.mutex.RLock()
+	changed := !modTime.Equal(l.source.modTime)
+	l.mutex.RUnlock()
+	if !changed {
+		return nil
+	}
+	return l.Reload()
+}
+
+func (l *HashPrefixList) Check(u *url.URL) error {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	for _, expression := range urlExpressions(u) {
+		hash := sha256.Sum256([]byte(expression))
+		for length, set := range l.prefixes {
+			if set[string(hash[:length])] {
+				return reject(ReasonUnsafeHashMatch, "destination matches the unsafe URL list")
+			}
+		}
+	}
+
+	return nil
+}
+
+// urlExpressions returns the host suffix / path prefix combinations that are
+// hashed for a lookup, following the Safe Browsing canonicalization rules:
+// the exact host plus up to four suffixes built from the last five components,
+// combined with the exact path and query, the exact path, and up to four
+// leading path prefixes.
+func urlExpressions(u *url.URL) []string {
+	host := strings.ToLower(u.Hostname())
+
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		components := strings.Split(host, ".")
+		if len(components) > 5 {
+			components = components[len(components)-5:]
+		}
+		for i := 1; i < len(components)-1 && len(hosts) < 5; i++ {
+			hosts = append(hosts, strings.Join(components[i:], "."))
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	paths := []string{}
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	prefix := "/"
+	for i := 0; i < len(segments) && i < 4; i++ {
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		if segments[i] == "" {
+			break
+		}
+		prefix += segments[i] + "/"
+	}
+
+	expressions := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			expressions = append(expressions, h+p)
+		}
+	}
+	return expressions
+}
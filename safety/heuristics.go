@@ -0,0 +1,212 @@
+package safety
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// DefaultBrands are the domains protected from lookalikes when none are configured
+var DefaultBrands = []string{
+	"paypal.com", "google.com", "apple.com", "microsoft.com", "amazon.com",
+	"facebook.com", "instagram.com", "netflix.com", "github.com",
+}
+
+// lureWords are the words phishing domains put next to a brand name, as in
+// paypal-login.com or secure-paypal.net. Other words make a different name,
+// such as apple-pie.com, and are left alone.
+var lureWords = map[string]bool{
+	"login": true, "logon": true, "signin": true, "secure": true, "security": true,
+	"account": true, "accounts": true, "verify": true, "verification": true, "confirm": true,
+	"update": true, "support": true, "help": true, "service": true, "services": true,
+	"billing": true, "payment": true, "wallet": true, "auth": true, "id": true,
+	"recovery": true, "unlock": true, "alert": true, "official": true,
+}
+
+// Heuristics rejects destinations with suspicious hosts: IP literals, deeply
+// nested subdomains and domains impersonating a protected brand.
+type Heuristics struct {
+	// MaxSubdomains is the number of labels allowed in front of the
+	// registrable domain; zero disables the check
+	MaxSubdomains int
+
+	brands map[string]string // brand label -> registrable domain
+}
+
+func NewHeuristics(maxSubdomains int, brands []string) *Heuristics {
+	if len(brands) == 0 {
+		brands = DefaultBrands
+	}
+
+	h := &Heuristics{
+		MaxSubdomains: maxSubdomains,
+		brands:        make(map[string]string, len(brands)),
+	}
+	for _, brand := range brands {
+		brand = strings.ToLower(strings.TrimSpace(brand))
+		if domain, err := publicsuffix.EffectiveTLDPlusOne(brand); err == nil {
+			h.brands[registrableLabel(domain)] = domain
+		}
+	}
+	return h
+}
+
+func (h *Heuristics) Check(u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+
+	if isIPLiteral(host) {
+		return reject(ReasonIPLiteral, "IP address hosts are not allowed")
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// Single label hosts and bare public suffixes have no registrable domain
+		return nil
+	}
+
+	if h.MaxSubdomains > 0 && host != domain {
+		subdomains := strings.Count(strings.TrimSuffix(host, "."+domain), ".") + 1
+		if subdomains > h.MaxSubdomains {
+			return reject(ReasonExcessiveSubdomains, fmt.Sprintf("%d subdomain levels exceed the limit of %d", subdomains, h.MaxSubdomains))
+		}
+	}
+
+	if brand, ok := h.impersonates(host, domain); ok {
+		return reject(ReasonLookalikeDomain, host+" looks like "+brand)
+	}
+
+	return nil
+}
+
+// impersonates reports which protected brand, if any, host is imitating.
+// Country variants such as google.co.uk share the brand label verbatim and
+// are not treated as lookalikes.
+func (h *Heuristics) impersonates(host, domain string) (string, bool) {
+	label := registrableLabel(domain)
+	if _, ok := h.brands[label]; ok {
+		return "", false
+	}
+
+	subdomains := ""
+	if host != domain {
+		subdomains = strings.TrimSuffix(host, "."+domain)
+	}
+
+	folded := skeleton(label)
+	for brandLabel, brandDomain := range h.brands {
+		// paypa1.com, xn--pypal-4ve.com
+		if folded == brandLabel {
+			return brandDomain, true
+		}
+
+		// paypal-login.com, secure-paypal.net
+		if lures(folded, brandLabel) {
+			return brandDomain, true
+		}
+
+		// paypal.com.account-verify.net
+		if subdomains == brandDomain || strings.HasSuffix(subdomains, "."+brandDomain) || strings.Contains(subdomains, brandDomain+".") {
+			return brandDomain, true
+		}
+	}
+
+	return "", false
+}
+
+// lures reports whether a hyphenated label is the brand label joined only
+// with lure words
+func lures(label, brandLabel string) bool {
+	tokens := strings.Split(label, "-")
+	if len(tokens) < 2 {
+		return false
+	}
+
+	brand := false
+	for _, token := range tokens {
+		switch {
+		case token == brandLabel:
+			brand = true
+		case !lureWords[token]:
+			return false
+		}
+	}
+	return brand
+}
+
+// isIPLiteral detects dotted and bracketed IP hosts, and the shorthand IPv4
+// forms resolvers accept: one to four decimal, octal (0300) or hexadecimal
+// (0xc0) numbers, such as 3232235521 or 0xc0.0250.1
+func isIPLiteral(host string) bool {
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return true
+	}
+
+	parts := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if len(parts) > 4 {
+		return false
+	}
+	for _, part := range parts {
+		if !isIPv4Number(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// isIPv4Number reports whether part is a decimal, octal or hexadecimal number
+// that fits an IPv4 address
+func isIPv4Number(part string) bool {
+	base, digits := 10, part
+	switch {
+	case strings.HasPrefix(part, "0x"):
+		base, digits = 16, part[2:]
+	case len(part) > 1 && part[0] == '0':
+		base, digits = 8, part[1:]
+	}
+	if digits == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(digits, base, 32)
+	return err == nil
+}
+
+// registrableLabel returns the leftmost label of a registrable domain
+func registrableLabel(domain string) string {
+	if dot := strings.IndexByte(domain, '.'); dot >= 0 {
+		return domain[:dot]
+	}
+	return domain
+}
+
+// confusables maps characters commonly used to imitate ASCII letters
+var confusables = map[rune]string{
+	'0': "o", '1': "l", '3': "e", '4': "a", '5': "s", '7': "t", '@': "a",
+	'а': "a", 'е': "e", 'о': "o", 'р': "p", 'с': "c", 'у': "y", 'х': "x",
+	'і': "i", 'ј': "j", 'ѕ': "s", 'ԁ': "d", 'ɡ': "g", 'ո': "n", 'ı': "i",
+}
+
+// skeleton decodes punycode and folds confusable characters to ASCII
+func skeleton(label string) string {
+	if unicode, err := idna.ToUnicode(label); err == nil {
+		label = unicode
+	}
+
+	var b strings.Builder
+	for _, r := range label {
+		if replacement, ok := confusables[r]; ok {
+			b.WriteString(replacement)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	folded := b.String()
+	folded = strings.ReplaceAll(folded, "rn", "m")
+	folded = strings.ReplaceAll(folded, "vv", "w")
+	return folded
+}
@@ -0,0 +1,77 @@
+package safety
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reloader is implemented by lists that are backed by a file on disk
+type Reloader interface {
+	// ReloadIfChanged re-reads the file when its modification time changed
+	ReloadIfChanged() error
+}
+
+// Watch polls the given lists and reloads them when their files change.
+// Calling the returned function stops the watcher.
+func Watch(interval time.Duration, lists ...Reloader) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, list := range lists {
+					if err := list.ReloadIfChanged(); err != nil {
+						log.Printf("safety: reload failed: %v", err)
+					}
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// fileSource tracks the modification time of a list file
+type fileSource struct {
+	path    string
+	modTime time.Time
+}
+
+// stat returns the current modification time of the file
+func (f *fileSource) stat() (time.Time, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// readLines returns the non-empty, non-comment lines of a file
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
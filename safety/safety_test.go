@@ -0,0 +1,166 @@
+package safety
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", raw, err)
+	}
+	return u
+}
+
+func expectReason(t *testing.T, err error, reason string) {
+	t.Helper()
+	var rejection *Rejection
+	if !errors.As(err, &rejection) {
+		t.Fatalf("Expected rejection %q, got %v", reason, err)
+	}
+	if rejection.Reason != reason {
+		t.Errorf("Expected reason %q, got %q", reason, rejection.Reason)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeFile(t, path, "# phishing\nevil.example\nhttps://files.example.com/malware/\n")
+
+	blocklist, err := NewBlocklist(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Block domain and subdomains", func(t *testing.T) {
+		expectReason(t, blocklist.Check(mustParse(t, "https://evil.example/")), ReasonBlocklisted)
+		expectReason(t, blocklist.Check(mustParse(t, "https://login.evil.example/x")), ReasonBlocklisted)
+	})
+
+	t.Run("Block URL prefix", func(t *testing.T) {
+		expectReason(t, blocklist.Check(mustParse(t, "https://files.example.com/malware/payload.exe")), ReasonBlocklisted)
+		if err := blocklist.Check(mustParse(t, "https://files.example.com/docs/")); err != nil {
+			t.Errorf("Expected other paths to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("Allow unrelated domains", func(t *testing.T) {
+		if err := blocklist.Check(mustParse(t, "https://notevil.example/")); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("Hot reload", func(t *testing.T) {
+		writeFile(t, path, "other.example\n")
+		// Make sure the modification time moves even on coarse filesystems
+		future := time.Now().Add(time.Minute)
+		os.Chtimes(path, future, future)
+
+		if err := blocklist.ReloadIfChanged(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := blocklist.Check(mustParse(t, "https://evil.example/")); err != nil {
+			t.Errorf("Expected removed entry to be allowed, got %v", err)
+		}
+		expectReason(t, blocklist.Check(mustParse(t, "https://other.example/")), ReasonBlocklisted)
+	})
+}
+
+func TestHashPrefixList(t *testing.T) {
+	hash := sha256.Sum256([]byte("malware.example/downloads/"))
+	path := filepath.Join(t.TempDir(), "prefixes.txt")
+	writeFile(t, path, hex.EncodeToString(hash[:4])+"\n")
+
+	list, err := NewHashPrefixList(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Match path prefix expression", func(t *testing.T) {
+		expectReason(t, list.Check(mustParse(t, "https://cdn.malware.example/downloads/setup.exe?v=2")), ReasonUnsafeHashMatch)
+	})
+
+	t.Run("Allow other paths", func(t *testing.T) {
+		if err := list.Check(mustParse(t, "https://malware.example/about")); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("Reject malformed prefixes", func(t *testing.T) {
+		writeFile(t, path, "not-hex\n")
+		if err := list.Reload(); err == nil {
+			t.Error("Expected error for malformed prefix")
+		}
+	})
+}
+
+func TestHeuristics(t *testing.T) {
+	heuristics := NewHeuristics(3, nil)
+
+	rejected := map[string]string{
+		"http://192.168.0.1/admin":               ReasonIPLiteral,
+		"http://[::1]/":                          ReasonIPLiteral,
+		"http://3232235521/":                     ReasonIPLiteral,
+		"http://0xc0a80001/":                     ReasonIPLiteral,
+		"http://0300.0250.0.1/":                  ReasonIPLiteral,
+		"https://a.b.c.d.example.com/":           ReasonExcessiveSubdomains,
+		"https://paypa1.com/login":               ReasonLookalikeDomain,
+		"https://xn--pypal-4ve.com/":             ReasonLookalikeDomain,
+		"https://secure-paypal.net/":             ReasonLookalikeDomain,
+		"https://paypal-login-verify.com/":       ReasonLookalikeDomain,
+		"https://paypal.com.account-verify.net/": ReasonLookalikeDomain,
+	}
+	for raw, reason := range rejected {
+		t.Run(raw, func(t *testing.T) {
+			expectReason(t, heuristics.Check(mustParse(t, raw)), reason)
+		})
+	}
+
+	for _, raw := range []string{
+		"https://www.paypal.com/",
+		"https://google.co.uk/",
+		"https://a.b.c.example.com/",
+		"https://example.com/",
+		"http://localhost:8080/",
+		"https://0x.org/",
+		"https://0xproject.com/",
+		"https://123.example.com/",
+		"https://apple-pie.com/",
+		"https://paypal-pal-club.com/",
+	} {
+		t.Run(raw, func(t *testing.T) {
+			if err := heuristics.Check(mustParse(t, raw)); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeFile(t, path, "blocked.example\n")
+	blocklist, _ := NewBlocklist(path)
+
+	chain := Chain{NewHeuristics(5, nil), blocklist}
+
+	expectReason(t, chain.Check(mustParse(t, "https://10.0.0.1/")), ReasonIPLiteral)
+	expectReason(t, chain.Check(mustParse(t, "https://blocked.example/")), ReasonBlocklisted)
+	if err := chain.Check(mustParse(t, "https://example.org/")); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
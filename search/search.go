@@ -0,0 +1,212 @@
+// Package search tokenizes links for full-text search and scores and
+// highlights matches the same way for every storage backend.
+package search
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"url-shortener/models"
+)
+
+// Searchable fields of a link
+const (
+	FieldShortCode   = "short_code"
+	FieldTitle       = "title"
+	FieldTags        = "tags"
+	FieldNotes       = "notes"
+	FieldDestination = "destination"
+)
+
+// Fields lists the searchable fields from most to least significant
+var Fields = []string{FieldShortCode, FieldTitle, FieldTags, FieldNotes, FieldDestination}
+
+// Weights rank a match by the field it is found in
+var Weights = map[string]float64{
+	FieldShortCode:   4,
+	FieldTitle:       3,
+	FieldTags:        3,
+	FieldNotes:       2,
+	FieldDestination: 1,
+}
+
+// maxTerms bounds the work a single query can cause
+const maxTerms = 8
+
+// Document is the searchable text of a link, by field
+type Document map[string]string
+
+// DocumentOf returns the searchable text of url
+func DocumentOf(url *models.URL) Document {
+	destination := url.OriginalURL
+	if url.CanonicalURL != "" && url.CanonicalURL != url.OriginalURL {
+		destination += " " + url.CanonicalURL
+	}
+
+	// A title set on the link replaces the one found on the destination page
+	title := url.Title
+	if title == "" && url.Preview != nil {
+		title = url.Preview.Title
+	}
+
+	return Document{
+		FieldShortCode:   url.ShortCode,
+		FieldTitle:       title,
+		FieldTags:        strings.Join(url.Tags, " "),
+		FieldNotes:       url.Notes,
+		FieldDestination: destination,
+	}
+}
+
+// Tokenize splits text into lowercase runs of letters and digits, so URLs
+// break into their host labels and path segments
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Terms turns a query into distinct search terms. Every term must match, and
+// a term matches any word it is a prefix of, so results narrow while typing.
+func Terms(query string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, token := range Tokenize(query) {
+		if !seen[token] && len(terms) < maxTerms {
+			seen[token] = true
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
+
+// matchTerm returns the first term token starts with
+func matchTerm(token string, terms []string) (string, bool) {
+	for _, term := range terms {
+		if strings.HasPrefix(token, term) {
+			return term, true
+		}
+	}
+	return "", false
+}
+
+// Score ranks doc against terms, for backends that find candidates without
+// ranking them. A term counts once, in the most significant field it occurs
+// in, and whole words outrank prefixes. ok is false unless every term matches.
+func Score(doc Document, terms []string) (score float64, ok bool) {
+	best := make(map[string]float64, len(terms))
+	for field, text := range doc {
+		for _, token := range Tokenize(text) {
+			term, matched := matchTerm(token, terms)
+			if !matched {
+				continue
+			}
+			weight := Weights[field]
+			if token != term {
+				weight /= 2
+			}
+			best[term] = max(best[term], weight)
+		}
+	}
+
+	if len(best) < len(terms) {
+		return 0, false
+	}
+	for _, weight := range best {
+		score += weight
+	}
+	return score, true
+}
+
+// snippetRunes is the length of text kept around the first match of a long field
+const snippetRunes = 120
+
+// Highlight HTML-escapes text and wraps every word matching a term in
+// <mark>. Long text is cut to a snippet around the first match. ok is false
+// when nothing in text matches.
+func Highlight(text string, terms []string) (string, bool) {
+	type span struct{ start, end int }
+	var spans []span
+
+	// Walk the same word boundaries as Tokenize, keeping byte offsets
+	start := -1
+	for i, r := range text + " " {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			if _, matched := matchTerm(strings.ToLower(text[start:i]), terms); matched {
+				spans = append(spans, span{start, i})
+			}
+			start = -1
+		}
+	}
+	if len(spans) == 0 {
+		return "", false
+	}
+
+	from, to := 0, len(text)
+	if utf8.RuneCountInString(text) > snippetRunes {
+		from = backRunes(text, spans[0].start, snippetRunes/4)
+		to = min(len(text), forwardRunes(text, from, snippetRunes))
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	position := from
+	for _, s := range spans {
+		if s.start < from || s.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[position:s.start]))
+		b.WriteString("<mark>" + html.EscapeString(text[s.start:s.end]) + "</mark>")
+		position = s.end
+	}
+	b.WriteString(html.EscapeString(text[position:to]))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// backRunes moves n runes back from the byte offset i
+func backRunes(text string, i, n int) int {
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(text[:i])
+		i -= size
+	}
+	return i
+}
+
+// forwardRunes moves n runes forward from the byte offset i
+func forwardRunes(text string, i, n int) int {
+	for ; n > 0 && i < len(text); n-- {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return i
+}
+
+// Highlights returns the highlighted text of every field of doc that matches
+func Highlights(doc Document, terms []string) map[string]string {
+	highlights := map[string]string{}
+	fields := make([]string, 0, len(doc))
+	for field := range doc {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if highlighted, ok := Highlight(doc[field], terms); ok {
+			highlights[field] = highlighted
+		}
+	}
+	return highlights
+}
@@ -0,0 +1,80 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"url-shortener/models"
+)
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"Go Docs", "[go docs]"},
+		{"https://golang.org/doc", "[https golang org doc]"},
+		{"go go GO", "[go]"},
+		{"  --  ", "[]"},
+		{"a b c d e f g h i j", "[a b c d e f g h]"},
+	}
+	for _, test := range tests {
+		if terms := fmt.Sprint(Terms(test.query)); terms != test.expected {
+			t.Errorf("Expected %s for %q, got %s", test.expected, test.query, terms)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	doc := DocumentOf(&models.URL{
+		ShortCode:   "gofmt",
+		OriginalURL: "https://pkg.go.dev/cmd/gofmt",
+		Notes:       "Formatting tool",
+		Preview:     &models.LinkPreview{Title: "gofmt command"},
+	})
+
+	t.Run("Require every term", func(t *testing.T) {
+		if _, ok := Score(doc, []string{"gofmt", "rust"}); ok {
+			t.Error("Expected no match when a term is missing")
+		}
+		if _, ok := Score(doc, []string{"mat"}); ok {
+			t.Error("Expected no match inside a word")
+		}
+	})
+
+	t.Run("Weigh fields and whole words", func(t *testing.T) {
+		code, _ := Score(doc, []string{"gofmt"})
+		notes, _ := Score(doc, []string{"tool"})
+		prefix, _ := Score(doc, []string{"form"})
+		if code != 4 || notes != 2 || prefix != 1 {
+			t.Errorf("Expected scores 4, 2 and 1, got %v, %v and %v", code, notes, prefix)
+		}
+	})
+}
+
+func TestHighlight(t *testing.T) {
+	t.Run("Mark matches and escape HTML", func(t *testing.T) {
+		highlighted, ok := Highlight("Go <b>docs</b> & Golang", []string{"go"})
+		expected := "<mark>Go</mark> &lt;b&gt;docs&lt;/b&gt; &amp; <mark>Golang</mark>"
+		if !ok || highlighted != expected {
+			t.Errorf("Expected %q, got %q", expected, highlighted)
+		}
+	})
+
+	t.Run("Report no match", func(t *testing.T) {
+		if _, ok := Highlight("nothing here", []string{"go"}); ok {
+			t.Error("Expected no match")
+		}
+	})
+
+	t.Run("Cut long text around the first match", func(t *testing.T) {
+		text := strings.Repeat("word ", 100) + "needle " + strings.Repeat("word ", 100)
+		highlighted, _ := Highlight(text, []string{"needle"})
+		if !strings.HasPrefix(highlighted, "…") || !strings.HasSuffix(highlighted, "…") || !strings.Contains(highlighted, "<mark>needle</mark>") {
+			t.Errorf("Expected a snippet around the match, got %q", highlighted)
+		}
+		if len([]rune(highlighted)) > snippetRunes+len("<mark></mark>")+2 {
+			t.Errorf("Expected at most %d runes of text, got %q", snippetRunes, highlighted)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+var (
+	ErrBatchTooLarge = errors.New("batch is too large")
+	ErrBatchAborted  = errors.New("not created because another item in the batch failed")
+)
+
+// DefaultMaxBatchSize is the number of items accepted by ShortenBatch
+const DefaultMaxBatchSize = 1000
+
+// WithMaxBatchSize limits the number of items accepted by ShortenBatch
+func WithMaxBatchSize(size int) Option {
+	return func(s *URLService) {
+		s.maxBatchSize = size
+	}
+}
+
+// BatchResult is the outcome of one item of a batch: the created link or the
+// reason it was not created
+type BatchResult struct {
+	URL *models.URL
+	Err error
+}
+
+// ShortenBatch validates and stores many links in a single storage call.
+// Items fail independently unless allOrNothing is set, in which case any
+// failure leaves every item uncreated.
+func (s *URLService) ShortenBatch(reqs []models.ShortenRequest, allOrNothing bool, actor string) ([]BatchResult, error) {
+	if len(reqs) > s.maxBatchSize {
+		return nil, fmt.Errorf("%w: %d items, at most %d allowed", ErrBatchTooLarge, len(reqs), s.maxBatchSize)
+	}
+
+	results := make([]BatchResult, len(reqs))
+	for i := range reqs {
+		results[i].URL, results[i].Err = s.prepare(&reqs[i], actor)
+	}
+	if allOrNothing && abortOnFailure(results) {
+		return results, nil
+	}
+
+	// Save the valid items, regenerating codes that collide with existing links
+	pending := make([]int, 0, len(reqs))
+	for i := range results {
+		if results[i].Err == nil {
+			pending = append(pending, i)
+		}
+	}
+
+	var retry []int
+	maxRetries := 5
+	for attempt := 0; attempt < maxRetries && len(pending) > 0; attempt++ {
+		urls := make([]*models.URL, len(pending))
+		revisions := make([]*models.URLRevision, len(pending))
+		now := time.Now()
+		for j, i := range pending {
+			urls[j] = results[i].URL
+			revisions[j] = &models.URLRevision{
+				Action:    models.RevisionCreate,
+				Actor:     actorOrAnonymous(actor),
+				CreatedAt: now,
+				New:       urls[j].State(),
+			}
+		}
+
+		errs, err := s.storage.SaveBatch(urls, revisions, allOrNothing)
+		if err != nil {
+			return nil, err
+		}
+
+		retry = nil
+		for j, i := range pending {
+			if errs[j] == storage.ErrAlreadyExists && reqs[i].CustomCode == "" {
+				if urls[j].ShortCode, err = s.generateShortCode(); err != nil {
+					return nil, err
+				}
+				retry = append(retry, i)
+				continue
+			}
+			if results[i].Err = errs[j]; errs[j] != nil {
+				results[i].URL = nil
+			}
+		}
+
+		if allOrNothing {
+			if len(retry) > 0 {
+				// Nothing was committed; try the whole batch again with new codes
+				continue
+			}
+			if abortOnFailure(results) {
+				return results, nil
+			}
+		}
+		pending = retry
+	}
+	for _, i := range retry {
+		results[i].Err = storage.ErrAlreadyExists
+	}
+
+	if allOrNothing && abortOnFailure(results) {
+		return results, nil
+	}
+	for _, result := range results {
+		if result.URL != nil {
+			s.codes.Add(result.URL.ShortCode)
+		}
+	}
+	s.refreshBatchPreviews(results)
+	return results, nil
+}
+
+// abortOnFailure marks every item of a failed all-or-nothing batch as not
+// created and reports whether any item failed
+func abortOnFailure(results []BatchResult) bool {
+	failed := false
+	for _, result := range results {
+		if result.Err != nil {
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		return false
+	}
+
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = ErrBatchAborted
+		}
+		results[i].URL = nil
+	}
+	return true
+}
+
+// refreshBatchPreviews populates the previews of the links created by a batch
+func (s *URLService) refreshBatchPreviews(results []BatchResult) {
+	var codes []string
+	for _, result := range results {
+		if result.Err == nil {
+			codes = append(codes, result.URL.ShortCode)
+		}
+	}
+	s.refreshPreviewsAsync(codes)
+}
+
+// refreshPreviewsAsync populates the previews of many links one at a time
+func (s *URLService) refreshPreviewsAsync(codes []string) {
+	if s.previewFetcher == nil || len(codes) == 0 {
+		return
+	}
+
+	go func() {
+		for _, code := range codes {
+			s.refreshPreviewAsync(code)
+		}
+	}()
+}
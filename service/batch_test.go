@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestShortenBatch(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6, WithMaxBatchSize(5))
+	service.ShortenURL("https://example.com", "taken")
+
+	items := []models.ShortenRequest{
+		{URL: "https://example.com/one", CustomCode: "one"},
+		{URL: "https://example.com/two", RedirectType: 301},
+		{URL: "not a url"},
+		{URL: "https://example.com/taken", CustomCode: "taken"},
+	}
+
+	t.Run("Report per-item results", func(t *testing.T) {
+		results, err := service.ShortenBatch(items, false, "tool")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if results[0].Err != nil || results[0].URL.ShortCode != "one" {
+			t.Errorf("Expected item 0 to be created, got %v", results[0].Err)
+		}
+		if results[1].Err != nil || len(results[1].URL.ShortCode) != 6 || results[1].URL.RedirectType != 301 {
+			t.Errorf("Expected item 1 to be created with a generated code, got %v", results[1].Err)
+		}
+		if !errors.Is(results[2].Err, ErrInvalidURL) {
+			t.Errorf("Expected ErrInvalidURL, got %v", results[2].Err)
+		}
+		if results[3].Err != storage.ErrAlreadyExists {
+			t.Errorf("Expected ErrAlreadyExists, got %v", results[3].Err)
+		}
+
+		revisions, _ := service.History("one")
+		if len(revisions) != 1 || revisions[0].Actor != "tool" {
+			t.Errorf("Expected a create revision by tool, got %d revisions", len(revisions))
+		}
+	})
+
+	t.Run("All or nothing", func(t *testing.T) {
+		batch := []models.ShortenRequest{
+			{URL: "https://example.com/three", CustomCode: "three"},
+			{URL: "https://example.com/taken", CustomCode: "taken"},
+		}
+		results, err := service.ShortenBatch(batch, true, "tool")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !errors.Is(results[0].Err, ErrBatchAborted) || results[1].Err != storage.ErrAlreadyExists {
+			t.Errorf("Expected aborted batch, got %v and %v", results[0].Err, results[1].Err)
+		}
+		if _, err := service.GetStats("three"); err != storage.ErrNotFound {
+			t.Errorf("Expected no link to be created, got %v", err)
+		}
+
+		// Validation failures abort before anything is stored
+		results, _ = service.ShortenBatch(items[:3], true, "tool")
+		if !errors.Is(results[0].Err, ErrBatchAborted) || !errors.Is(results[2].Err, ErrInvalidURL) {
+			t.Errorf("Expected aborted batch, got %v and %v", results[0].Err, results[2].Err)
+		}
+	})
+
+	t.Run("Reject oversized batches", func(t *testing.T) {
+		_, err := service.ShortenBatch(make([]models.ShortenRequest, 6), false, "tool")
+		if !errors.Is(err, ErrBatchTooLarge) {
+			t.Errorf("Expected ErrBatchTooLarge, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+const (
+	// MaxCampaignNameLength is the longest campaign name, in characters
+	MaxCampaignNameLength = 100
+	// MaxUTMLength is the longest value of a UTM parameter, in characters
+	MaxUTMLength = 200
+
+	// DefaultStatsWindow is how far back campaign stats reach when no start is given
+	DefaultStatsWindow = 30 * 24 * time.Hour
+	// MaxStatsBuckets caps the length of a campaign stats timeline
+	MaxStatsBuckets = 1000
+	// TopReferrerCount is the number of referrers listed in campaign stats
+	TopReferrerCount = 10
+)
+
+// Campaign stats intervals
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+var (
+	ErrInvalidCampaign   = errors.New("invalid campaign")
+	ErrInvalidStatsRange = errors.New("invalid stats range")
+	ErrNotInCampaign     = errors.New("link is not in the campaign")
+)
+
+// normalizeCampaign trims the name, description and UTM parameters of a
+// campaign and checks their lengths
+func normalizeCampaign(campaign *models.Campaign) error {
+	campaign.Name = strings.TrimSpace(campaign.Name)
+	campaign.Description = strings.TrimSpace(campaign.Description)
+	if campaign.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCampaign)
+	}
+	if utf8.RuneCountInString(campaign.Name) > MaxCampaignNameLength {
+		return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidCampaign, MaxCampaignNameLength)
+	}
+
+	utm, err := normalizeUTM(campaign.UTM)
+	if err != nil {
+		return err
+	}
+	campaign.UTM = utm
+	return nil
+}
+
+// checkCampaign makes sure a link being created joins an existing campaign
+func (s *URLService) checkCampaign(id int64) error {
+	if id == 0 {
+		return nil
+	}
+	if _, err := s.storage.GetCampaign(id); err != nil {
+		if err == storage.ErrCampaignNotFound {
+			return fmt.Errorf("%w: campaign %d does not exist", ErrInvalidCampaign, id)
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateCampaign validates and stores a new campaign
+func (s *URLService) CreateCampaign(req *models.CampaignRequest) (*models.Campaign, error) {
+	campaign := &models.Campaign{Name: req.Name, Description: req.Description, UTM: req.UTM}
+	if err := normalizeCampaign(campaign); err != nil {
+		return nil, err
+	}
+	if err := s.storage.SaveCampaign(campaign); err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+// Campaign retrieves a campaign with its link count
+func (s *URLService) Campaign(id int64) (*models.Campaign, error) {
+	return s.storage.GetCampaign(id)
+}
+
+// Campaigns lists every campaign, newest first
+func (s *URLService) Campaigns() ([]*models.Campaign, error) {
+	return s.storage.ListCampaigns()
+}
+
+// UpdateCampaign applies the fields present in req to a campaign
+func (s *URLService) UpdateCampaign(id int64, req *models.CampaignUpdateRequest) (*models.Campaign, error) {
+	campaign, err := s.storage.GetCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		campaign.Name = *req.Name
+	}
+	if req.Description != nil {
+		campaign.Description = *req.Description
+	}
+	if req.UTM != nil {
+		campaign.UTM = *req.UTM
+	}
+	if err := normalizeCampaign(campaign); err != nil {
+		return nil, err
+	}
+
+	campaign.UpdatedAt = time.Now()
+	if err := s.storage.UpdateCampaign(campaign); err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+// DeleteCampaign removes a campaign; its links and their clicks are kept
+func (s *URLService) DeleteCampaign(id int64) error {
+	return s.storage.DeleteCampaign(id)
+}
+
+// AddCampaignLinks moves links into a campaign, taking them out of any other.
+// No link moves if one of the short codes does not exist.
+func (s *URLService) AddCampaignLinks(id int64, shortCodes []string) (*models.Campaign, error) {
+	if err := s.storage.SetCampaign(shortCodes, id); err != nil {
+		return nil, err
+	}
+	return s.storage.GetCampaign(id)
+}
+
+// RemoveCampaignLink takes a link out of a campaign
+func (s *URLService) RemoveCampaignLink(id int64, shortCode string) error {
+	if _, err := s.storage.GetCampaign(id); err != nil {
+		return err
+	}
+	url, err := s.storage.Get(shortCode)
+	if err != nil {
+		return err
+	}
+	if url.CampaignID != id {
+		return ErrNotInCampaign
+	}
+	return s.storage.SetCampaign([]string{shortCode}, 0)
+}
+
+// CampaignStats aggregates the clicks on the links of a campaign from from
+// (inclusive) to to (exclusive) into totals, unique visitors, top referrers,
+// per-link counts and a timeline of hourly or daily buckets in UTC. A zero to
+// means now and a zero from DefaultStatsWindow before to. Clicks without a
+// visitor are counted but never as unique visitors.
+func (s *URLService) CampaignStats(id int64, from, to time.Time, interval string) (*models.CampaignStats, error) {
+	var step time.Duration
+	switch interval {
+	case "", IntervalDay:
+		interval, step = IntervalDay, 24*time.Hour
+	case IntervalHour:
+		step = time.Hour
+	default:
+		return nil, fmt.Errorf("%w: interval must be %s or %s", ErrInvalidStatsRange, IntervalHour, IntervalDay)
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-DefaultStatsWindow)
+	}
+	from, to = from.UTC(), to.UTC()
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidStatsRange)
+	}
+
+	start := from.Truncate(step)
+	buckets := int((to.Sub(start) + step - 1) / step)
+	if buckets > MaxStatsBuckets {
+		return nil, fmt.Errorf("%w: more than %d %s intervals", ErrInvalidStatsRange, MaxStatsBuckets, interval)
+	}
+
+	campaign, err := s.storage.GetCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.CampaignStats{
+		Campaign: campaign,
+		From:     from,
+		To:       to,
+		Interval: interval,
+		Timeline: make([]models.ClickBucket, buckets),
+	}
+	for i := range stats.Timeline {
+		stats.Timeline[i].Start = start.Add(time.Duration(i) * step)
+	}
+
+	visitors := newVisitorSet()
+	bucketVisitors := make([]visitorSet, buckets)
+	links := make(map[string]*models.LinkClicks)
+	linkVisitors := make(map[string]visitorSet)
+	referrers := make(map[string]int64)
+
+	err = s.storage.ScanCampaignClicks(id, from, to, func(click models.Click) error {
+		stats.Clicks++
+		if visitors.add(click.Visitor) {
+			stats.UniqueVisitors++
+		}
+
+		i := int(click.At.Sub(start) / step)
+		bucket := &stats.Timeline[i]
+		bucket.Clicks++
+		if bucketVisitors[i] == nil {
+			bucketVisitors[i] = newVisitorSet()
+		}
+		if bucketVisitors[i].add(click.Visitor) {
+			bucket.UniqueVisitors++
+		}
+
+		link := links[click.ShortCode]
+		if link == nil {
+			link = &models.LinkClicks{ShortCode: click.ShortCode}
+			links[click.ShortCode] = link
+			linkVisitors[click.ShortCode] = newVisitorSet()
+		}
+		link.Clicks++
+		if linkVisitors[click.ShortCode].add(click.Visitor) {
+			link.UniqueVisitors++
+		}
+
+		referrers[click.Referrer]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Links = make([]models.LinkClicks, 0, len(links))
+	for _, link := range links {
+		stats.Links = append(stats.Links, *link)
+	}
+	sort.Slice(stats.Links, func(i, j int) bool {
+		if stats.Links[i].Clicks != stats.Links[j].Clicks {
+			return stats.Links[i].Clicks > stats.Links[j].Clicks
+		}
+		return stats.Links[i].ShortCode < stats.Links[j].ShortCode
+	})
+
+	stats.TopReferrers = make([]models.ReferrerCount, 0, len(referrers))
+	for referrer, clicks := range referrers {
+		stats.TopReferrers = append(stats.TopReferrers, models.ReferrerCount{Referrer: referrer, Clicks: clicks})
+	}
+	sort.Slice(stats.TopReferrers, func(i, j int) bool {
+		if stats.TopReferrers[i].Clicks != stats.TopReferrers[j].Clicks {
+			return stats.TopReferrers[i].Clicks > stats.TopReferrers[j].Clicks
+		}
+		return stats.TopReferrers[i].Referrer < stats.TopReferrers[j].Referrer
+	})
+	stats.TopReferrers = stats.TopReferrers[:min(len(stats.TopReferrers), TopReferrerCount)]
+
+	return stats, nil
+}
+
+// visitorSet collects the distinct visitors of a group of clicks
+type visitorSet map[string]struct{}
+
+func newVisitorSet() visitorSet {
+	return make(visitorSet)
+}
+
+// add reports whether visitor is known and seen for the first time
+func (v visitorSet) add(visitor string) bool {
+	if visitor == "" {
+		return false
+	}
+	if _, seen := v[visitor]; seen {
+		return false
+	}
+	v[visitor] = struct{}{}
+	return true
+}
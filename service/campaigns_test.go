@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestCampaigns(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+
+	campaign, err := service.CreateCampaign(&models.CampaignRequest{
+		Name: " Spring ", UTM: models.UTMParams{Source: " newsletter "},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if campaign.Name != "Spring" || campaign.UTM.Source != "newsletter" {
+		t.Errorf("Expected trimmed name and UTM parameters, got %+v", campaign)
+	}
+
+	t.Run("Reject invalid campaigns", func(t *testing.T) {
+		if _, err := service.CreateCampaign(&models.CampaignRequest{Name: "  "}); !errors.Is(err, ErrInvalidCampaign) {
+			t.Errorf("Expected ErrInvalidCampaign for a blank name, got %v", err)
+		}
+		long := fmt.Sprintf("%0*d", MaxUTMLength+1, 0)
+		if _, err := service.CreateCampaign(&models.CampaignRequest{Name: "x", UTM: models.UTMParams{Term: long}}); !errors.Is(err, ErrInvalidUTM) {
+			t.Errorf("Expected ErrInvalidUTM for a long utm_term, got %v", err)
+		}
+	})
+
+	t.Run("Create links in a campaign", func(t *testing.T) {
+		url, err := service.Shorten(&models.ShortenRequest{URL: "https://example.com/a", CustomCode: "a", CampaignID: campaign.ID}, "alice")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.CampaignID != campaign.ID {
+			t.Errorf("Expected link in campaign %d, got %d", campaign.ID, url.CampaignID)
+		}
+
+		_, err = service.Shorten(&models.ShortenRequest{URL: "https://example.com/x", CampaignID: 999}, "alice")
+		if !errors.Is(err, ErrInvalidCampaign) {
+			t.Errorf("Expected ErrInvalidCampaign for an unknown campaign, got %v", err)
+		}
+	})
+
+	t.Run("Add and remove links", func(t *testing.T) {
+		service.ShortenURL("https://example.com/b", "b")
+		service.ShortenURL("https://example.com/c", "c")
+
+		updated, err := service.AddCampaignLinks(campaign.ID, []string{"b", "c"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if updated.Links != 3 {
+			t.Errorf("Expected 3 links, got %d", updated.Links)
+		}
+
+		if err := service.RemoveCampaignLink(campaign.ID, "c"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := service.RemoveCampaignLink(campaign.ID, "c"); err != ErrNotInCampaign {
+			t.Errorf("Expected ErrNotInCampaign, got %v", err)
+		}
+	})
+
+	t.Run("Update campaign", func(t *testing.T) {
+		name := "Spring launch"
+		updated, err := service.UpdateCampaign(campaign.ID, &models.CampaignUpdateRequest{Name: &name})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if updated.Name != name || updated.UTM.Source != "newsletter" {
+			t.Errorf("Expected only the name to change, got %+v", updated)
+		}
+		if _, err := service.UpdateCampaign(999, &models.CampaignUpdateRequest{Name: &name}); err != storage.ErrCampaignNotFound {
+			t.Errorf("Expected ErrCampaignNotFound, got %v", err)
+		}
+	})
+}
+
+func TestCampaignStats(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+
+	campaign, _ := service.CreateCampaign(&models.CampaignRequest{Name: "Launch"})
+	for _, code := range []string{"a", "b", "c"} {
+		service.ShortenURL("https://example.com/"+code, code)
+	}
+	service.AddCampaignLinks(campaign.ID, []string{"a", "b"})
+
+	alice := Visit{IP: "192.0.2.1", UserAgent: "Firefox", Referrer: "https://www.News.example.com/story?id=1"}
+	bob := Visit{IP: "192.0.2.2", UserAgent: "Safari"}
+	visits := []struct {
+		code  string
+		visit Visit
+	}{
+		{"a", alice}, {"a", alice}, {"b", alice}, {"b", bob}, {"a", Visit{}}, {"c", bob},
+	}
+	for _, v := range visits {
+		if _, err := service.Resolve(v.code, v.visit); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	stats, err := service.CampaignStats(campaign.ID, time.Time{}, time.Now().Add(time.Second), "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Totals", func(t *testing.T) {
+		if stats.Clicks != 5 || stats.UniqueVisitors != 2 {
+			t.Errorf("Expected 5 clicks from 2 visitors, got %d from %d", stats.Clicks, stats.UniqueVisitors)
+		}
+		if stats.Interval != IntervalDay || len(stats.Timeline) != 31 {
+			t.Errorf("Expected 31 daily buckets, got %d %s buckets", len(stats.Timeline), stats.Interval)
+		}
+		last := stats.Timeline[len(stats.Timeline)-1]
+		if last.Clicks != 5 || last.UniqueVisitors != 2 {
+			t.Errorf("Expected today's bucket to hold every click, got %+v", last)
+		}
+	})
+
+	t.Run("Top referrers and links", func(t *testing.T) {
+		if fmt.Sprint(stats.TopReferrers) != "[{news.example.com 3} { 2}]" {
+			t.Errorf("Expected referrer hosts with direct visits last, got %v", stats.TopReferrers)
+		}
+		if fmt.Sprint(stats.Links) != "[{a 3 1} {b 2 2}]" {
+			t.Errorf("Expected clicks per link, got %v", stats.Links)
+		}
+	})
+
+	t.Run("Reject bad ranges", func(t *testing.T) {
+		now := time.Now()
+		ranges := []struct {
+			from, to time.Time
+			interval string
+		}{
+			{now, now.Add(-time.Hour), ""},
+			{now.Add(-time.Hour), now, "week"},
+			{now.Add(-365 * 24 * time.Hour), now, IntervalHour},
+		}
+		for _, r := range ranges {
+			if _, err := service.CampaignStats(campaign.ID, r.from, r.to, r.interval); !errors.Is(err, ErrInvalidStatsRange) {
+				t.Errorf("Expected ErrInvalidStatsRange for %v to %v by %q, got %v", r.from, r.to, r.interval, err)
+			}
+		}
+		if _, err := service.CampaignStats(999, time.Time{}, time.Time{}, ""); err != storage.ErrCampaignNotFound {
+			t.Errorf("Expected ErrCampaignNotFound, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"url-shortener/fetcher"
+)
+
+var (
+	ErrSelfReference = errors.New("destination points back at this shortener")
+	ErrRedirectLoop  = errors.New("destination redirects in a loop")
+)
+
+// Self link policies decide what happens to destinations on our own domains
+const (
+	SelfLinkCollapse = "collapse"
+	SelfLinkReject   = "reject"
+)
+
+// DefaultShorteners are the third-party shortener hosts resolved when none are configured
+var DefaultShorteners = []string{
+	"bit.ly", "t.co", "tinyurl.com", "goo.gl", "ow.ly", "is.gd",
+	"buff.ly", "rebrand.ly", "cutt.ly", "shorturl.at", "t.ly", "rb.gy",
+}
+
+// ChainResolver follows redirects of known third-party shorteners one hop at a time
+type ChainResolver struct {
+	fetcher    *fetcher.Fetcher
+	shorteners map[string]bool
+	maxHops    int
+}
+
+// NewChainResolver builds a resolver for the given shortener hosts.
+// Entries may include a port to match a specific host:port.
+func NewChainResolver(shorteners []string, maxHops int, f *fetcher.Fetcher) *ChainResolver {
+	if len(shorteners) == 0 {
+		shorteners = DefaultShorteners
+	}
+
+	hosts := make(map[string]bool, len(shorteners))
+	for _, host := range shorteners {
+		hosts[strings.ToLower(host)] = true
+	}
+
+	return &ChainResolver{
+		fetcher:    f,
+		shorteners: hosts,
+		maxHops:    maxHops,
+	}
+}
+
+// IsShortener reports whether u is hosted by a known shortener
+func (r *ChainResolver) IsShortener(u *url.URL) bool {
+	return r.shorteners[strings.ToLower(u.Host)] || r.shorteners[strings.ToLower(u.Hostname())]
+}
+
+// Next returns the redirect target of u, or "" when u does not redirect
+func (r *ChainResolver) Next(ctx context.Context, u *url.URL) (string, error) {
+	resp, err := r.fetcher.Peek(ctx, http.MethodHead, u.String())
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		if resp, err = r.fetcher.Peek(ctx, http.MethodGet, u.String()); err != nil {
+			return "", err
+		}
+	}
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return "", nil
+	}
+
+	location, err := u.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return "", nil
+	}
+	return location.String(), nil
+}
+
+// resolveDestination collapses links to our own short codes and, when enabled,
+// follows known third-party shorteners until the underlying destination.
+func (s *URLService) resolveDestination(canonicalURL string) (string, error) {
+	maxHops := 5
+	if s.chainResolver != nil {
+		maxHops = s.chainResolver.maxHops
+	}
+
+	visited := map[string]bool{}
+	current := canonicalURL
+	for hops := 0; ; hops++ {
+		if visited[current] {
+			return "", ErrRedirectLoop
+		}
+		visited[current] = true
+
+		u, err := url.Parse(current)
+		if err != nil {
+			return "", err
+		}
+
+		var next string
+		switch {
+		case s.isOwnHost(u):
+			if s.selfLinkPolicy == SelfLinkReject {
+				return "", ErrSelfReference
+			}
+			target, err := s.storage.Get(strings.TrimPrefix(u.Path, "/"))
+			if err != nil || target.Deleted() {
+				return "", ErrSelfReference
+			}
+			next = target.Destination()
+
+		case s.chainResolver != nil && s.chainResolver.IsShortener(u):
+			if hops >= maxHops {
+				return current, nil
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			next, err = s.chainResolver.Next(ctx, u)
+			cancel()
+			if err != nil || next == "" {
+				// Resolution is best effort; keep the last destination we reached
+				return current, nil
+			}
+
+		default:
+			return current, nil
+		}
+
+		if next, err = s.normalizer.Normalize(next); err != nil {
+			return "", err
+		}
+		current = next
+	}
+}
+
+// isOwnHost reports whether u points at one of the domains serving our short links
+func (s *URLService) isOwnHost(u *url.URL) bool {
+	return s.ownHosts[strings.ToLower(u.Host)] || s.ownHosts[strings.ToLower(u.Hostname())]
+}
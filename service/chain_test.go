@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"url-shortener/fetcher"
+	"url-shortener/storage"
+)
+
+func TestSelfLinks(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6, WithOwnDomains(SelfLinkCollapse, "http://sho.rt", "go.example"))
+	service.ShortenURL("https://example.com/landing", "target")
+
+	t.Run("Collapse link to our own code", func(t *testing.T) {
+		url, err := service.ShortenURL("http://SHO.RT:80/target", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.CanonicalURL != "https://example.com/landing" {
+			t.Errorf("Expected collapsed destination, got '%s'", url.CanonicalURL)
+		}
+	})
+
+	t.Run("Collapse link on additional domain", func(t *testing.T) {
+		url, err := service.ShortenURL("https://go.example/target", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.CanonicalURL != "https://example.com/landing" {
+			t.Errorf("Expected collapsed destination, got '%s'", url.CanonicalURL)
+		}
+	})
+
+	t.Run("Reject link to unknown code", func(t *testing.T) {
+		_, err := service.ShortenURL("http://sho.rt/missing", "")
+		if !errors.Is(err, ErrSelfReference) {
+			t.Errorf("Expected ErrSelfReference, got %v", err)
+		}
+	})
+
+	t.Run("Reject policy", func(t *testing.T) {
+		strict := NewURLService(store, 6, WithOwnDomains(SelfLinkReject, "http://sho.rt"))
+		_, err := strict.ShortenURL("http://sho.rt/target", "")
+		if !errors.Is(err, ErrSelfReference) {
+			t.Errorf("Expected ErrSelfReference, got %v", err)
+		}
+	})
+}
+
+// testFetcher returns a fetcher allowed to reach the local test server
+func testFetcher(t *testing.T, serverURL string) *fetcher.Fetcher {
+	t.Helper()
+	u, _ := url.Parse(serverURL)
+	port, _ := strconv.Atoi(u.Port())
+
+	config := fetcher.DefaultConfig()
+	config.AllowedPorts = []int{port}
+	config.AllowedCIDRs = []string{"127.0.0.0/8", "::1/128"}
+
+	f, err := fetcher.New(config)
+	if err != nil {
+		t.Fatalf("Failed to create fetcher: %v", err)
+	}
+	return f
+}
+
+func TestShortenerChains(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/first":
+			http.Redirect(w, r, "/second", http.StatusMovedPermanently)
+		case "/second":
+			http.Redirect(w, r, "https://example.com/final?utm_source=chain", http.StatusFound)
+		case "/loop-a":
+			http.Redirect(w, r, "/loop-b", http.StatusFound)
+		case "/loop-b":
+			http.Redirect(w, r, "/loop-a", http.StatusFound)
+		case "/deep":
+			http.Redirect(w, r, "/deep?n="+r.URL.Query().Get("n")+"x", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6, WithChainResolver(NewChainResolver([]string{host.Host}, 3, testFetcher(t, server.URL))))
+
+	t.Run("Resolve chain to final destination", func(t *testing.T) {
+		url, err := service.ShortenURL(server.URL+"/first", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.CanonicalURL != "https://example.com/final" {
+			t.Errorf("Expected resolved destination, got '%s'", url.CanonicalURL)
+		}
+		if url.OriginalURL != server.URL+"/first" {
+			t.Errorf("Expected original URL to be kept, got '%s'", url.OriginalURL)
+		}
+	})
+
+	t.Run("Detect redirect loops", func(t *testing.T) {
+		_, err := service.ShortenURL(server.URL+"/loop-a", "")
+		if !errors.Is(err, ErrRedirectLoop) {
+			t.Errorf("Expected ErrRedirectLoop, got %v", err)
+		}
+	})
+
+	t.Run("Stop after max hops", func(t *testing.T) {
+		url, err := service.ShortenURL(server.URL+"/deep?n=", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.CanonicalURL != server.URL+"/deep?n=xxx" {
+			t.Errorf("Expected chain to stop after 3 hops, got '%s'", url.CanonicalURL)
+		}
+	})
+
+	t.Run("Keep destinations that do not redirect", func(t *testing.T) {
+		url, err := service.ShortenURL(server.URL+"/page", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.CanonicalURL != server.URL+"/page" {
+			t.Errorf("Expected unchanged destination, got '%s'", url.CanonicalURL)
+		}
+	})
+}
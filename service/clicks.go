@@ -0,0 +1,42 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// Visit describes the request behind a redirect, as far as analytics and
+// passthrough need it
+type Visit struct {
+	// Referrer is the Referer header, empty for direct visits
+	Referrer  string
+	IP        string
+	UserAgent string
+	// Path is the decoded path after the short code, empty or starting with "/"
+	Path string
+	// Query is the raw query string of the request
+	Query string
+}
+
+// referrerHost reduces a Referer header to its lowercased host, so clicks
+// from different pages of one site count together and paths, which may carry
+// personal data, are never stored
+func referrerHost(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// visitorID hashes the IP address and user agent of a visit into an opaque
+// identifier for counting unique visitors. It is empty when the IP is unknown.
+func visitorID(visit Visit) string {
+	if visit.IP == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(visit.IP + "\x00" + visit.UserAgent))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"url-shortener/models"
+)
+
+var ErrInvalidCode = errors.New("invalid short code")
+
+// placeholder matches the {1} to {9} arguments of a go-link destination, also
+// in the percent-encoded form the normalizer stores them in
+var placeholder = regexp.MustCompile(`\{([1-9])\}|%7[Bb]([1-9])%7[Dd]`)
+
+// WithGoLinks enables go-links mode: short codes may hold slashes, such as
+// team/oncall, visits resolve to the link with the longest matching code and
+// destinations may be templates taking the remaining path segments
+func WithGoLinks() Option {
+	return func(s *URLService) {
+		s.goLinks = true
+	}
+}
+
+// codeSegment matches a short code, or one segment of a go-link code. These
+// characters need no escaping in a path, so every code stays reachable.
+var codeSegment = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// validateCode checks a custom short code, if one was given. Codes hold
+// letters, digits, '-' and '_'; slashes separate the segments of go-link
+// codes and are only accepted in go-links mode. Codes may not end in a
+// preview marker, as visits to them would show the preview of another link.
+func (s *URLService) validateCode(code string) error {
+	if code == "" {
+		return nil
+	}
+	if code == ReservedCode || strings.HasPrefix(code, ReservedCode+"/") {
+		return ErrReservedCode
+	}
+	if _, preview := PreviewPath(code); preview {
+		return fmt.Errorf("%w: %q ends in a preview marker", ErrInvalidCode, code)
+	}
+	segments := strings.Split(code, "/")
+	if len(segments) > 1 && !s.goLinks {
+		return fmt.Errorf("%w: slashes are only allowed in go-links mode", ErrInvalidCode)
+	}
+	for _, segment := range segments {
+		if !codeSegment.MatchString(segment) && s.goLinks {
+			return fmt.Errorf("%w: every segment of %q must hold letters, digits, '-' or '_'", ErrInvalidCode, code)
+		}
+		if !codeSegment.MatchString(segment) {
+			return fmt.Errorf("%w: %q may only hold letters, digits, '-' and '_'", ErrInvalidCode, code)
+		}
+	}
+	return nil
+}
+
+// templateArity returns the highest placeholder in a destination, 0 when it
+// is not a template
+func templateArity(destination string) int {
+	arity := 0
+	for _, match := range placeholder.FindAllStringSubmatch(destination, -1) {
+		n, _ := strconv.Atoi(match[1] + match[2])
+		arity = max(arity, n)
+	}
+	return arity
+}
+
+// pathSegments splits the path after a short code into its segments
+func pathSegments(suffix string) []string {
+	suffix = strings.Trim(suffix, "/")
+	if suffix == "" {
+		return nil
+	}
+	return strings.Split(suffix, "/")
+}
+
+// expandTemplate replaces the placeholders of destination with the path
+// segments they name, escaped for the part of the URL they appear in.
+// Placeholders without a segment expand to nothing.
+func expandTemplate(destination string, args []string) string {
+	queryStart := strings.IndexAny(destination, "?#")
+	if queryStart < 0 {
+		queryStart = len(destination)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range placeholder.FindAllStringSubmatchIndex(destination, -1) {
+		b.WriteString(destination[last:match[0]])
+		last = match[1]
+
+		// The digit is in the first group for {n}, in the second when encoded
+		digit := match[2]
+		if digit < 0 {
+			digit = match[4]
+		}
+		n := int(destination[digit] - '0')
+		if n > len(args) {
+			continue
+		}
+		if match[0] < queryStart {
+			b.WriteString(url.PathEscape(args[n-1]))
+		} else {
+			b.WriteString(url.QueryEscape(args[n-1]))
+		}
+	}
+	b.WriteString(destination[last:])
+	return b.String()
+}
+
+// acceptsSuffix reports whether a visit may carry the path after a link's
+// short code. In go-links mode the segments of that path are the arguments of
+// template destinations, so a template takes up to as many as it has
+// placeholders; other links follow the passthrough rules.
+func (s *URLService) acceptsSuffix(link *models.URL, suffix string) bool {
+	arity := 0
+	if s.goLinks {
+		arity = templateArity(link.Destination())
+	}
+	if arity == 0 {
+		return suffixAllowed(suffix, link.Passthrough)
+	}
+
+	segments := pathSegments(suffix)
+	if len(segments) > arity {
+		return false
+	}
+	for _, segment := range segments {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolvePath retrieves the link behind a redirect to path, the request path
+// without its leading slash, and records the visit. It also returns the rest
+// of path after the link's short code. In go-links mode the link with the
+// longest matching code wins; otherwise the code is the first segment.
+func (s *URLService) ResolvePath(path string, visit Visit) (*models.URL, string, error) {
+	link, err := s.lookupPath(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	visit.Path = path[len(link.ShortCode):]
+	if err := s.recordVisit(link, visit); err != nil {
+		return nil, "", err
+	}
+	return link, visit.Path, nil
+}
+
+// lookupPath retrieves the link whose short code starts path
+func (s *URLService) lookupPath(path string) (*models.URL, error) {
+	if s.goLinks {
+		return s.storage.GetLongestPrefix(path)
+	}
+	code, _, _ := strings.Cut(path, "/")
+	return s.storage.Get(code)
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		args        []string
+		expected    string
+	}{
+		{"Path argument", "https://jira.example.com/browse/%7B1%7D", []string{"PROJ-12"}, "https://jira.example.com/browse/PROJ-12"},
+		{"Query argument", "https://example.com/search?q=%7B1%7D", []string{"a&b c"}, "https://example.com/search?q=a%26b+c"},
+		{"Arguments in any order", "https://example.com/{2}/{1}", []string{"a", "b"}, "https://example.com/b/a"},
+		{"Missing argument", "https://example.com/{1}/{2}", []string{"a"}, "https://example.com/a/"},
+		{"Path argument is escaped", "https://example.com/{1}", []string{"a b?"}, "https://example.com/a%20b%3F"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandTemplate(tt.destination, tt.args); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGoLinks(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6, WithGoLinks())
+
+	links := []struct{ code, url string }{
+		{"team", "https://wiki.example.com/team"},
+		{"team/oncall", "https://pager.example.com/schedules/oncall"},
+		{"jira", "https://jira.example.com/browse/{1}"},
+	}
+	for _, link := range links {
+		if _, err := service.ShortenURL(link.url, link.code); err != nil {
+			t.Fatalf("Expected no error for %s, got %v", link.code, err)
+		}
+	}
+
+	t.Run("Resolve the longest code", func(t *testing.T) {
+		visits := []struct {
+			path, code, suffix string
+		}{
+			{"team/oncall", "team/oncall", ""},
+			{"team", "team", ""},
+			{"jira/PROJ-12", "jira", "/PROJ-12"},
+		}
+		for _, v := range visits {
+			url, suffix, err := service.ResolvePath(v.path, Visit{})
+			if err != nil {
+				t.Fatalf("Expected no error for %s, got %v", v.path, err)
+			}
+			if url.ShortCode != v.code || suffix != v.suffix {
+				t.Errorf("Expected %s with suffix %q for %s, got %s with %q", v.code, v.suffix, v.path, url.ShortCode, suffix)
+			}
+		}
+	})
+
+	t.Run("Expand templates", func(t *testing.T) {
+		url, suffix, _ := service.ResolvePath("jira/PROJ-12", Visit{})
+		expected := "https://jira.example.com/browse/PROJ-12"
+		if got := service.FinalURL(url, &Visit{Path: suffix}); got != expected {
+			t.Errorf("Expected %s, got %s", expected, got)
+		}
+		if got := service.FinalURL(url, nil); got != url.Destination() {
+			t.Errorf("Expected stats to show the template, got %s", got)
+		}
+	})
+
+	t.Run("Reject extra segments", func(t *testing.T) {
+		for _, path := range []string{"jira/PROJ-12/extra", "team/docs", "jira/.."} {
+			if _, _, err := service.ResolvePath(path, Visit{}); err != storage.ErrNotFound {
+				t.Errorf("Expected ErrNotFound for %s, got %v", path, err)
+			}
+		}
+	})
+
+	t.Run("Validate codes", func(t *testing.T) {
+		for _, code := range []string{"team//x", "/team", "team/", "a/../b", "team/on call", "faq?x", "faq#top", "100%", "tab\tkey", "café/menu"} {
+			if _, err := service.ShortenURL("https://example.com", code); !errors.Is(err, ErrInvalidCode) {
+				t.Errorf("Expected ErrInvalidCode for %q, got %v", code, err)
+			}
+		}
+		if _, err := service.ShortenURL("https://example.com", "api/docs"); err != ErrReservedCode {
+			t.Errorf("Expected ErrReservedCode, got %v", err)
+		}
+
+		plain := NewURLService(store, 6)
+		if _, err := plain.Shorten(&models.ShortenRequest{URL: "https://example.com", CustomCode: "a/b"}, ""); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("Expected ErrInvalidCode outside go-links mode, got %v", err)
+		}
+		if _, err := plain.ShortenURL("https://example.com", "my.link"); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("Expected ErrInvalidCode for a dot, got %v", err)
+		}
+		if _, err := plain.ShortenURL("https://example.com", "Spring_Sale-2026"); err != nil {
+			t.Errorf("Expected letters, digits, '-' and '_' to be accepted, got %v", err)
+		}
+	})
+}
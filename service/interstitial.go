@@ -0,0 +1,64 @@
+package service
+
+import (
+	"strings"
+	"time"
+	"url-shortener/models"
+)
+
+// Markers that ask for the preview of a link instead of a redirect: a "+"
+// right after the short code, as in /promo+, or a last "preview" segment, as
+// in /promo/preview
+const (
+	previewMark    = "+"
+	previewSegment = "/preview"
+)
+
+// PreviewPath reports whether path, the request path without its leading
+// slash, ends in a preview marker, and returns path without the marker. Use
+// PreviewCode to learn whether the marker asks for a preview.
+func PreviewPath(path string) (string, bool) {
+	if trimmed, found := strings.CutSuffix(path, previewMark); found && trimmed != "" {
+		return trimmed, true
+	}
+	if trimmed, found := strings.CutSuffix(path, previewSegment); found && trimmed != "" {
+		return trimmed, true
+	}
+	return path, false
+}
+
+// PreviewCode reports whether a redirect to path asks for the preview of a
+// link and returns the link's short code. The marker has to follow a short
+// code exactly, so paths that passthrough or go-link templates forward, such
+// as /wiki/C++ or /wiki/Go/preview, still redirect, and a link whose own code
+// ends in a marker is redirected to rather than taken for another's preview.
+func (s *URLService) PreviewCode(path string) (string, bool) {
+	code, marked := PreviewPath(path)
+	if !marked {
+		return path, false
+	}
+	if _, err := s.storage.Get(path); err == nil {
+		return path, false
+	}
+
+	link, err := s.lookupPath(code)
+	if err != nil || link.ShortCode != code {
+		return path, false
+	}
+	return code, true
+}
+
+// Preview retrieves the link behind a redirect to path, without its preview
+// marker, like ResolvePath does but without recording a visit
+func (s *URLService) Preview(path string) (*models.URL, string, error) {
+	link, err := s.lookupPath(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	suffix := path[len(link.ShortCode):]
+	if err := s.checkVisit(link, suffix, time.Now()); err != nil {
+		return nil, "", err
+	}
+	return link, suffix, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestPreviewPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+		preview  bool
+	}{
+		{"promo+", "promo", true},
+		{"promo/preview", "promo", true},
+		{"docs/getting-started+", "docs/getting-started", true},
+		{"promo", "promo", false},
+		{"preview", "preview", false},
+		{"+", "+", false},
+		{"promo/previews", "promo/previews", false},
+	}
+
+	for _, tt := range tests {
+		got, preview := PreviewPath(tt.path)
+		if got != tt.expected || preview != tt.preview {
+			t.Errorf("Expected %q (preview %t) for %q, got %q (preview %t)", tt.expected, tt.preview, tt.path, got, preview)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+
+	service.Shorten(&models.ShortenRequest{URL: "https://example.com/docs", CustomCode: "docs", Passthrough: true}, "alice")
+	service.ShortenURL("https://example.com/plain", "plain")
+
+	t.Run("Do not count the visit", func(t *testing.T) {
+		url, suffix, err := service.Preview("docs/intro")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.ShortCode != "docs" || suffix != "/intro" {
+			t.Errorf("Expected docs with suffix /intro, got %s with %q", url.ShortCode, suffix)
+		}
+		if stored, _ := service.GetStats("docs"); stored.Clicks != 0 {
+			t.Errorf("Expected no clicks, got %d", stored.Clicks)
+		}
+	})
+
+	t.Run("Apply the redirect checks", func(t *testing.T) {
+		if _, _, err := service.Preview("plain/intro"); err != storage.ErrNotFound {
+			t.Errorf("Expected ErrNotFound for a suffix on a plain link, got %v", err)
+		}
+		service.DeleteURL("plain", "alice")
+		if _, _, err := service.Preview("plain"); !errors.Is(err, ErrLinkDeleted) {
+			t.Errorf("Expected ErrLinkDeleted, got %v", err)
+		}
+	})
+
+	t.Run("Reject codes ending in a preview marker", func(t *testing.T) {
+		for _, code := range []string{"sale+", "sale++"} {
+			if _, err := service.ShortenURL("https://example.com", code); !errors.Is(err, ErrInvalidCode) {
+				t.Errorf("Expected ErrInvalidCode for %q, got %v", code, err)
+			}
+		}
+	})
+}
+
+func TestPreviewCode(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6, WithGoLinks())
+
+	service.Shorten(&models.ShortenRequest{URL: "https://wiki.example.com", CustomCode: "wiki", Passthrough: true}, "alice")
+	service.ShortenURL("https://example.com/sale", "sale")
+	// Created before codes ending in a marker were refused
+	store.Save(&models.URL{ShortCode: "c++", OriginalURL: "https://isocpp.org"})
+
+	tests := []struct {
+		path     string
+		expected string
+		preview  bool
+	}{
+		{"sale+", "sale", true},
+		{"sale/preview", "sale", true},
+		{"wiki+", "wiki", true},
+		{"wiki/C++", "wiki/C++", false},
+		{"wiki/Go/preview", "wiki/Go/preview", false},
+		{"c++", "c++", false},
+		{"missing+", "missing+", false},
+		{"sale", "sale", false},
+	}
+
+	for _, tt := range tests {
+		got, preview := service.PreviewCode(tt.path)
+		if got != tt.expected || preview != tt.preview {
+			t.Errorf("Expected %q (preview %t) for %q, got %q (preview %t)", tt.expected, tt.preview, tt.path, got, preview)
+		}
+	}
+
+	url, suffix, err := service.ResolvePath("wiki/C++", Visit{})
+	if err != nil || url.ShortCode != "wiki" || suffix != "/C++" {
+		t.Errorf("Expected wiki to forward /C++, got %v %q %v", url, suffix, err)
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidURL is returned when a destination cannot be normalized
+var ErrInvalidURL = errors.New("invalid URL")
+
+// DefaultAllowedSchemes are the schemes accepted when none are configured
+var DefaultAllowedSchemes = []string{"http", "https"}
+
+// DefaultStripParams are the tracking parameters removed when none are configured.
+// A trailing "*" matches any parameter with that prefix.
+var DefaultStripParams = []string{"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_eid", "igshid"}
+
+// defaultPorts maps schemes to the port that is implied when none is given
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// Normalizer turns user supplied destinations into a canonical form
+type Normalizer struct {
+	allowedSchemes map[string]bool
+	stripParams    []string
+}
+
+// NewNormalizer builds a Normalizer, using the defaults for empty lists
+func NewNormalizer(allowedSchemes, stripParams []string) *Normalizer {
+	if len(allowedSchemes) == 0 {
+		allowedSchemes = DefaultAllowedSchemes
+	}
+	if len(stripParams) == 0 {
+		stripParams = DefaultStripParams
+	}
+
+	schemes := make(map[string]bool, len(allowedSchemes))
+	for _, scheme := range allowedSchemes {
+		schemes[strings.ToLower(scheme)] = true
+	}
+
+	params := make([]string, 0, len(stripParams))
+	for _, param := range stripParams {
+		params = append(params, strings.ToLower(param))
+	}
+
+	return &Normalizer{
+		allowedSchemes: schemes,
+		stripParams:    params,
+	}
+}
+
+// Normalize validates rawURL and returns its canonical form
+func (n *Normalizer) Normalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "" {
+		return "", fmt.Errorf("%w: missing scheme", ErrInvalidURL)
+	}
+	if !n.allowedSchemes[u.Scheme] {
+		return "", fmt.Errorf("%w: scheme %q is not allowed", ErrInvalidURL, u.Scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	// Drop the port when it is the scheme's default
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host = host + ":" + port
+	}
+	u.Host = host
+
+	// Dot segments are resolved on the escaped path, so encoded characters such
+	// as %2F or %2E stay encoded and keep naming the same resource
+	path := removeDotSegments(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	if u.Path, err = url.PathUnescape(path); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	u.RawPath = path
+
+	u.RawQuery = n.stripQuery(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// stripQuery removes tracking parameters from a raw query. The remaining
+// parameters keep their order and encoding, as servers may depend on both.
+func (n *Normalizer) stripQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if !n.isStripped(key) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+func (n *Normalizer) isStripped(key string) bool {
+	key = strings.ToLower(key)
+	for _, param := range n.stripParams {
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == param {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost lowercases the host and converts IDNs to punycode
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid host %q", ErrInvalidURL, host)
+	}
+	return ascii, nil
+}
+
+// removeDotSegments resolves "." and ".." segments as described in RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	segments := strings.Split(path, "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+
+	result := strings.Join(output, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	normalizer := NewNormalizer(nil, nil)
+
+	cases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Lowercase scheme and host", "HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"Strip default port", "http://example.com:80/a", "http://example.com/a"},
+		{"Keep non-default port", "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"Add root path", "https://example.com", "https://example.com/"},
+		{"Resolve dot segments", "https://example.com/a/./b/../c", "https://example.com/a/c"},
+		{"Keep trailing slash after dot segment", "https://example.com/a/b/..", "https://example.com/a/"},
+		{"Strip tracking parameters", "https://example.com/?utm_source=x&id=1&fbclid=abc", "https://example.com/?id=1"},
+		{"Drop empty query", "https://example.com/?utm_medium=email", "https://example.com/"},
+		{"Convert IDN to punycode", "https://bücher.example/", "https://xn--bcher-kva.example/"},
+		{"Keep fragment", "https://example.com/page#section", "https://example.com/page#section"},
+		{"Normalize IPv6 host", "http://[::1]:80/", "http://[::1]/"},
+		{"Keep encoded slashes", "https://example.com/a%2Fb", "https://example.com/a%2Fb"},
+		{"Keep encoded dot segments", "https://example.com/%2e%2e/x", "https://example.com/%2e%2e/x"},
+		{"Keep query order", "https://example.com/?b=1&a=2", "https://example.com/?b=1&a=2"},
+		{"Keep parameters without value", "https://example.com/?q&utm_source=x", "https://example.com/?q"},
+		{"Keep query encoding", "https://example.com/?q=a+b%2Fc&gclid=1", "https://example.com/?q=a+b%2Fc"},
+		{"Strip encoded tracking keys", "https://example.com/?utm%5Fsource=x&id=1", "https://example.com/?id=1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := normalizer.Normalize(tc.input)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestNormalizeRejects(t *testing.T) {
+	normalizer := NewNormalizer(nil, nil)
+
+	for _, input := range []string{
+		"javascript:alert(1)",
+		"data:text/html,hello",
+		"ftp://example.com/file",
+		"https://",
+		"example.com/no-scheme",
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := normalizer.Normalize(input)
+			if !errors.Is(err, ErrInvalidURL) {
+				t.Errorf("Expected ErrInvalidURL, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNormalizeCustomLists(t *testing.T) {
+	normalizer := NewNormalizer([]string{"https", "ftp"}, []string{"ref", "mkt_*"})
+
+	result, err := normalizer.Normalize("ftp://files.example.com:21/pub?ref=a&mkt_tok=b&utm_source=c")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result != "ftp://files.example.com/pub?utm_source=c" {
+		t.Errorf("Unexpected canonical URL '%s'", result)
+	}
+
+	if _, err := normalizer.Normalize("http://example.com"); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("Expected http to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ReservedCode is the short code taken by the API routes. /api and everything
+// below it are always served by the API, so no link may use it or, in
+// go-links mode, start with it.
+const ReservedCode = "api"
+
+var ErrReservedCode = errors.New("short code is reserved for the API")
+
+// suffixAllowed reports whether the path after a short code may be forwarded.
+// Only links with passthrough accept one, and "." and ".." segments are
+// refused so the suffix cannot climb out of the destination path. A lone "/"
+// is no suffix at all.
+func suffixAllowed(suffix string, passthrough bool) bool {
+	if strings.Trim(suffix, "/") == "" {
+		return true
+	}
+	if !passthrough {
+		return false
+	}
+	for _, segment := range strings.Split(suffix, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// passThrough appends the path suffix and query of a visit to destination.
+// The suffix is joined to the destination path with a single slash; query
+// parameters are added after the destination's own, except those the
+// destination already sets, which keep its value.
+func passThrough(destination, suffix, query string) string {
+	if suffix != "" {
+		rest, fragment, hasFragment := strings.Cut(destination, "#")
+		base, existing, hasQuery := strings.Cut(rest, "?")
+
+		base = strings.TrimSuffix(base, "/") + (&url.URL{Path: suffix}).EscapedPath()
+		if hasQuery {
+			base += "?" + existing
+		}
+		if hasFragment {
+			base += "#" + fragment
+		}
+		destination = base
+	}
+
+	var params []string
+	for _, part := range strings.Split(query, "&") {
+		if part != "" {
+			params = append(params, part)
+		}
+	}
+	return mergeQuery(destination, params, false)
+}
+
+// mergeQuery adds params, encoded as name=value, to the query string of
+// destination, leaving its other parameters and their order untouched. A
+// parameter the destination already has is kept, or replaced when override is
+// set.
+func mergeQuery(destination string, params []string, override bool) string {
+	if len(params) == 0 {
+		return destination
+	}
+
+	names := make(map[string]bool, len(params))
+	for _, param := range params {
+		names[queryName(param)] = true
+	}
+
+	rest, fragment, hasFragment := strings.Cut(destination, "#")
+	base, query, _ := strings.Cut(rest, "?")
+
+	present := make(map[string]bool)
+	var kept []string
+	for _, part := range strings.Split(query, "&") {
+		if part == "" {
+			continue
+		}
+		name := queryName(part)
+		if override && names[name] {
+			continue
+		}
+		present[name] = true
+		kept = append(kept, part)
+	}
+
+	for _, param := range params {
+		if !present[queryName(param)] {
+			kept = append(kept, param)
+		}
+	}
+
+	final := base + "?" + strings.Join(kept, "&")
+	if hasFragment {
+		final += "#" + fragment
+	}
+	return final
+}
+
+// queryName returns the decoded name of a name=value query parameter
+func queryName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if decoded, err := url.QueryUnescape(name); err == nil {
+		return decoded
+	}
+	return name
+}
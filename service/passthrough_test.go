@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestPassThrough(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		suffix      string
+		query       string
+		expected    string
+	}{
+		{"Path and query", "https://example.com/docs", "/getting-started", "lang=de", "https://example.com/docs/getting-started?lang=de"},
+		{"Single slash at the join", "https://example.com/docs/", "/api", "", "https://example.com/docs/api"},
+		{"Path is escaped", "https://example.com", "/a b", "", "https://example.com/a%20b"},
+		{"Destination query comes first", "https://example.com/?v=2#top", "/x", "lang=de&tag=a&tag=b", "https://example.com/x?v=2&lang=de&tag=a&tag=b#top"},
+		{"Destination parameters win", "https://example.com/?lang=en", "", "lang=de&page=2", "https://example.com/?lang=en&page=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := passThrough(tt.destination, tt.suffix, tt.query); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestResolvePassthrough(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+
+	docs, _ := service.Shorten(&models.ShortenRequest{URL: "https://example.com/docs", CustomCode: "docs", Passthrough: true}, "alice")
+	service.ShortenURL("https://example.com/plain", "plain")
+
+	t.Run("Forward the suffix of passthrough links", func(t *testing.T) {
+		visit := Visit{Path: "/guide", Query: "lang=de"}
+		if _, err := service.Resolve("docs", visit); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := "https://example.com/docs/guide?lang=de"
+		if got := service.FinalURL(docs, &visit); got != expected {
+			t.Errorf("Expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("Reject suffixes that cannot be forwarded", func(t *testing.T) {
+		visits := []struct {
+			code string
+			path string
+		}{
+			{"plain", "/extra"},
+			{"docs", "/../admin"},
+			{"docs", "/a/./b"},
+		}
+		for _, v := range visits {
+			if _, err := service.Resolve(v.code, Visit{Path: v.path}); err != storage.ErrNotFound {
+				t.Errorf("Expected ErrNotFound for %s%s, got %v", v.code, v.path, err)
+			}
+		}
+		if _, err := service.Resolve("plain", Visit{Path: "/"}); err != nil {
+			t.Errorf("Expected a trailing slash to be ignored, got %v", err)
+		}
+	})
+
+	t.Run("Reserve the API prefix", func(t *testing.T) {
+		if _, err := service.ShortenURL("https://example.com", ReservedCode); err != ErrReservedCode {
+			t.Errorf("Expected ErrReservedCode, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"url-shortener/fetcher"
+	"url-shortener/models"
+	"url-shortener/preview"
+)
+
+var (
+	ErrPreviewsDisabled = errors.New("link previews are disabled")
+	ErrPreviewFetch     = errors.New("failed to fetch destination")
+)
+
+// WithPreviews fetches destination metadata through f after links are created
+func WithPreviews(f *fetcher.Fetcher) Option {
+	return func(s *URLService) {
+		s.previewFetcher = f
+	}
+}
+
+// RefreshPreview fetches the destination of a link and stores its metadata
+func (s *URLService) RefreshPreview(shortCode string) (*models.LinkPreview, error) {
+	if s.previewFetcher == nil {
+		return nil, ErrPreviewsDisabled
+	}
+
+	url, err := s.storage.Get(shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	resp, err := s.previewFetcher.Get(ctx, url.Destination())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPreviewFetch, err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%w: status %d", ErrPreviewFetch, resp.StatusCode)
+	}
+
+	// Non-HTML destinations (PDFs, images) still get a favicon
+	var body []byte
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || strings.Contains(contentType, "html") {
+		body = resp.Body
+	}
+
+	linkPreview := preview.Extract(body, resp.URL)
+	if err := s.storage.SavePreview(shortCode, linkPreview); err != nil {
+		return nil, err
+	}
+
+	return linkPreview, nil
+}
+
+// refreshPreviewAsync populates the preview of a new link in the background
+func (s *URLService) refreshPreviewAsync(shortCode string) {
+	if _, err := s.RefreshPreview(shortCode); err != nil {
+		log.Printf("preview for %s: %v", shortCode, err)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"url-shortener/storage"
+)
+
+func TestLinkPreviews(t *testing.T) {
+	title := "First title"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>` + title + `</title><link rel="icon" href="/icon.png"></head></html>`))
+	}))
+	defer server.Close()
+
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6, WithPreviews(testFetcher(t, server.URL)))
+
+	t.Run("Fetch preview after shortening", func(t *testing.T) {
+		_, err := service.ShortenURL(server.URL+"/page", "preview")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if url, _ := service.GetStats("preview"); url.Preview != nil {
+				if url.Preview.Title != "First title" {
+					t.Errorf("Expected 'First title', got '%s'", url.Preview.Title)
+				}
+				if url.Preview.FaviconURL != server.URL+"/icon.png" {
+					t.Errorf("Expected favicon URL, got '%s'", url.Preview.FaviconURL)
+				}
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("Preview was not fetched")
+	})
+
+	t.Run("Refresh preview on demand", func(t *testing.T) {
+		title = "Second title"
+		preview, err := service.RefreshPreview("preview")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if preview.Title != "Second title" {
+			t.Errorf("Expected 'Second title', got '%s'", preview.Title)
+		}
+
+		stats, _ := service.GetStats("preview")
+		if stats.Preview == nil || stats.Preview.Title != "Second title" {
+			t.Errorf("Expected stored preview to be refreshed, got %+v", stats.Preview)
+		}
+	})
+
+	t.Run("Report fetch failures", func(t *testing.T) {
+		service.ShortenURL(server.URL+"/missing", "missing")
+		if _, err := service.RefreshPreview("missing"); !errors.Is(err, ErrPreviewFetch) {
+			t.Errorf("Expected ErrPreviewFetch, got %v", err)
+		}
+	})
+
+	t.Run("Disabled without a fetcher", func(t *testing.T) {
+		plain := NewURLService(store, 6)
+		if _, err := plain.RefreshPreview("preview"); !errors.Is(err, ErrPreviewsDisabled) {
+			t.Errorf("Expected ErrPreviewsDisabled, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestQueryURLs(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+
+	service.Shorten(&models.ShortenRequest{URL: "https://example.com/a", CustomCode: "alice1"}, "alice")
+	service.ShortenBatch([]models.ShortenRequest{
+		{URL: "https://example.com/b", CustomCode: "alice2"},
+	}, false, "alice")
+	service.Shorten(&models.ShortenRequest{URL: "https://example.com/c", CustomCode: "bob1"}, "bob")
+
+	t.Run("Record the creator as owner", func(t *testing.T) {
+		url, _ := service.GetStats("alice2")
+		if url.Owner != "alice" {
+			t.Errorf("Expected owner 'alice', got '%s'", url.Owner)
+		}
+	})
+
+	t.Run("Filter by owner", func(t *testing.T) {
+		page, err := service.QueryURLs(storage.ListOptions{Owner: "alice"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if page.Total != 2 || len(page.URLs) != 2 || page.NextCursor != "" {
+			t.Errorf("Expected one page of 2 links, got %d of %d", len(page.URLs), page.Total)
+		}
+	})
+
+	t.Run("Page with a cursor", func(t *testing.T) {
+		first, _ := service.QueryURLs(storage.ListOptions{Limit: 2})
+		second, _ := service.QueryURLs(storage.ListOptions{Limit: 2, Cursor: first.NextCursor})
+		if len(first.URLs) != 2 || len(second.URLs) != 1 || second.NextCursor != "" {
+			t.Errorf("Expected pages of 2 and 1, got %d and %d", len(first.URLs), len(second.URLs))
+		}
+		if first.Total != 3 || second.Total != 3 {
+			t.Errorf("Expected total 3 on every page, got %d and %d", first.Total, second.Total)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"url-shortener/models"
+)
+
+var (
+	ErrInvalidRedirectType = errors.New("redirect type must be one of 301, 302, 307 or 308")
+	ErrInvalidCacheControl = errors.New("invalid Cache-Control value")
+)
+
+// Server-wide redirect defaults used when no configuration is given
+const (
+	DefaultRedirectType = http.StatusFound
+	DefaultCacheControl = "private, max-age=90"
+)
+
+// maxCacheControlLen keeps per-link header values reasonable
+const maxCacheControlLen = 256
+
+// WithRedirectDefaults sets the status code and Cache-Control header used by
+// links that do not choose their own
+func WithRedirectDefaults(redirectType int, cacheControl string) Option {
+	return func(s *URLService) {
+		s.defaultRedirectType = redirectType
+		s.defaultCacheControl = cacheControl
+	}
+}
+
+// ValidateRedirectPolicy checks a redirect type and Cache-Control value.
+// Zero and empty values mean "use the server default" and are accepted.
+func ValidateRedirectPolicy(redirectType int, cacheControl string) error {
+	switch redirectType {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return ErrInvalidRedirectType
+	}
+
+	if len(cacheControl) > maxCacheControlLen || strings.ContainsAny(cacheControl, "\r\n\x00") {
+		return ErrInvalidCacheControl
+	}
+	return nil
+}
+
+// RedirectPolicy returns the status code and Cache-Control header for a link
+func (s *URLService) RedirectPolicy(url *models.URL) (int, string) {
+	redirectType := url.RedirectType
+	if redirectType == 0 {
+		redirectType = s.defaultRedirectType
+	}
+
+	cacheControl := url.CacheControl
+	if cacheControl == "" {
+		cacheControl = s.defaultCacheControl
+	}
+
+	return redirectType, cacheControl
+}
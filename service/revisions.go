@@ -0,0 +1,213 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"url-shortener/models"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrLinkExpired      = errors.New("link has expired")
+	ErrLinkDisabled     = errors.New("link has been disabled")
+	ErrInvalidExpiry    = errors.New("expiry must be in the future")
+)
+
+// AnonymousActor is recorded for changes made without an identified user
+const AnonymousActor = "anonymous"
+
+func actorOrAnonymous(actor string) string {
+	if actor == "" {
+		return AnonymousActor
+	}
+	return actor
+}
+
+// validateExpiry rejects expiry times that have already passed
+func validateExpiry(expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return ErrInvalidExpiry
+	}
+	return nil
+}
+
+// recordRevision stores a revision for a change that did not alter the link's
+// state (create, delete, restore). The change has already been made at this
+// point, so a failure is logged rather than returned.
+func (s *URLService) recordRevision(url *models.URL, action, actor string, at time.Time) {
+	revision := &models.URLRevision{
+		ShortCode: url.ShortCode,
+		Action:    action,
+		Actor:     actorOrAnonymous(actor),
+		CreatedAt: at,
+		New:       url.State(),
+	}
+	if err := s.storage.AddRevision(revision); err != nil {
+		log.Printf("revision for %s: %v", url.ShortCode, err)
+	}
+}
+
+// UpdateURL applies a partial update to a link and records it in the link's history.
+// A new destination, like new variants, goes through the same normalization and
+// checks as on creation. An update that changes nothing records no revision, and
+// one that races with another change of the link fails with storage.ErrConflict.
+func (s *URLService) UpdateURL(shortCode string, req *models.UpdateRequest, actor string) (*models.URL, error) {
+	// Read the history first, so any change after it is seen as a conflict
+	revisions, err := s.storage.ListRevisions(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	url, err := s.getLive(shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	state := url.State()
+	if req.URL != nil {
+		canonicalURL, err := s.canonicalDestination(*req.URL)
+		if err != nil {
+			return nil, err
+		}
+		state.OriginalURL = *req.URL
+		state.CanonicalURL = canonicalURL
+	}
+	if req.RedirectType != nil {
+		state.RedirectType = *req.RedirectType
+	}
+	if req.CacheControl != nil {
+		state.CacheControl = *req.CacheControl
+	}
+	if req.ExpiresAt.Set {
+		if err := validateExpiry(req.ExpiresAt.Time); err != nil {
+			return nil, err
+		}
+		state.ExpiresAt = req.ExpiresAt.Time
+	}
+	if req.Title != nil {
+		if state.Title, err = normalizeTitle(*req.Title); err != nil {
+			return nil, err
+		}
+	}
+	if req.Notes != nil {
+		state.Notes = *req.Notes
+	}
+	if req.Tags != nil {
+		if state.Tags, err = NormalizeTags(*req.Tags); err != nil {
+			return nil, err
+		}
+	}
+	if req.UTM != nil {
+		if state.UTM, err = linkUTM(req.UTM); err != nil {
+			return nil, err
+		}
+	}
+	if req.UTMOverride != nil {
+		state.UTMOverride = *req.UTMOverride
+	}
+	if req.Passthrough != nil {
+		state.Passthrough = *req.Passthrough
+	}
+	if req.Interstitial != nil {
+		state.Interstitial = *req.Interstitial
+	}
+	if req.Variants != nil || req.Rotation != nil {
+		variants, rotation := state.Variants, state.Rotation
+		if req.Variants != nil {
+			variants = *req.Variants
+		}
+		if req.Rotation != nil {
+			rotation = *req.Rotation
+		}
+		if state.Variants, state.Rotation, err = s.normalizeVariants(variants, rotation); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ValidateRedirectPolicy(state.RedirectType, state.CacheControl); err != nil {
+		return nil, err
+	}
+
+	if state.Equal(url.State()) {
+		return url, nil
+	}
+	return s.changeState(url, state, models.RevisionUpdate, actor, revisions)
+}
+
+// History returns the revisions of a link, oldest first
+func (s *URLService) History(shortCode string) ([]*models.URLRevision, error) {
+	if _, err := s.storage.Get(shortCode); err != nil {
+		return nil, err
+	}
+	return s.storage.ListRevisions(shortCode)
+}
+
+// Rollback restores the state a link had after the given revision. The
+// rollback is itself recorded as a new revision. Revisions whose expiry has
+// passed since are refused, as restoring them would expire the link at once.
+func (s *URLService) Rollback(shortCode string, revision int, actor string) (*models.URL, error) {
+	revisions, err := s.storage.ListRevisions(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	url, err := s.getLive(shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rev := range revisions {
+		if rev.Revision != revision {
+			continue
+		}
+
+		// The destination may have been blocklisted since it was last live
+		target := &models.URL{}
+		target.ApplyState(rev.New)
+		if err := s.checkDestination(target.Destination()); err != nil {
+			return nil, err
+		}
+		for i := range target.Variants {
+			if err := s.checkDestination(target.Variants[i].Destination()); err != nil {
+				return nil, err
+			}
+		}
+		if err := validateExpiry(target.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("%w: revision %d expired at %s", err, revision, target.ExpiresAt.Format(time.RFC3339))
+		}
+		return s.changeState(url, rev.New, models.RevisionRollback, actor, revisions)
+	}
+
+	return nil, ErrRevisionNotFound
+}
+
+// changeState stores the new state of url together with a revision. The
+// change is based on the given history, which was read before url, and is
+// refused with storage.ErrConflict if the link gained a revision since.
+func (s *URLService) changeState(url *models.URL, state models.LinkState, action, actor string, history []*models.URLRevision) (*models.URL, error) {
+	old := url.State()
+	destinationChanged := state.OriginalURL != old.OriginalURL || state.CanonicalURL != old.CanonicalURL
+
+	url.ApplyState(state)
+	revision := &models.URLRevision{
+		ShortCode: url.ShortCode,
+		Action:    action,
+		Actor:     actorOrAnonymous(actor),
+		CreatedAt: time.Now(),
+		Old:       &old,
+		New:       state,
+	}
+	// Links created before history was kept may have no revisions yet
+	revision.Revision = 1
+	if len(history) > 0 {
+		revision.Revision = history[len(history)-1].Revision + 1
+	}
+	if err := s.storage.UpdateWithRevision(url, revision); err != nil {
+		return nil, err
+	}
+
+	if destinationChanged && s.previewFetcher != nil {
+		go s.refreshPreviewAsync(url.ShortCode)
+	}
+	return url, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestEditHistory(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+	service.Shorten(&models.ShortenRequest{URL: "https://example.com/v1", CustomCode: "docs"}, "alice")
+
+	t.Run("Update destination and notes", func(t *testing.T) {
+		destination := "https://EXAMPLE.com/v2?utm_source=mail"
+		notes := "points at v2"
+		url, err := service.UpdateURL("docs", &models.UpdateRequest{URL: &destination, Notes: &notes}, "bob")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.Destination() != "https://example.com/v2" {
+			t.Errorf("Expected normalized destination, got '%s'", url.Destination())
+		}
+		if url.Notes != notes {
+			t.Errorf("Expected notes to be set, got '%s'", url.Notes)
+		}
+	})
+
+	t.Run("Reject invalid updates", func(t *testing.T) {
+		redirectType := 303
+		if _, err := service.UpdateURL("docs", &models.UpdateRequest{RedirectType: &redirectType}, "bob"); !errors.Is(err, ErrInvalidRedirectType) {
+			t.Errorf("Expected ErrInvalidRedirectType, got %v", err)
+		}
+
+		past := time.Now().Add(-time.Hour)
+		req := &models.UpdateRequest{ExpiresAt: models.NullTime{Set: true, Time: &past}}
+		if _, err := service.UpdateURL("docs", req, "bob"); !errors.Is(err, ErrInvalidExpiry) {
+			t.Errorf("Expected ErrInvalidExpiry, got %v", err)
+		}
+
+		if _, err := service.UpdateURL("missing", &models.UpdateRequest{}, "bob"); err != storage.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Record who changed what", func(t *testing.T) {
+		revisions, err := service.History("docs")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(revisions) != 2 {
+			t.Fatalf("Expected 2 revisions, got %d", len(revisions))
+		}
+		if revisions[0].Action != models.RevisionCreate || revisions[0].Actor != "alice" {
+			t.Errorf("Expected create by alice, got %s by %s", revisions[0].Action, revisions[0].Actor)
+		}
+		update := revisions[1]
+		if update.Actor != "bob" || update.Old.CanonicalURL != "https://example.com/v1" || update.New.CanonicalURL != "https://example.com/v2" {
+			t.Errorf("Unexpected update revision %+v", update)
+		}
+	})
+
+	t.Run("Roll back to a prior revision", func(t *testing.T) {
+		url, err := service.Rollback("docs", 1, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.Destination() != "https://example.com/v1" || url.Notes != "" {
+			t.Errorf("Expected original state, got '%s' %q", url.Destination(), url.Notes)
+		}
+
+		revisions, _ := service.History("docs")
+		last := revisions[len(revisions)-1]
+		if last.Action != models.RevisionRollback || last.Revision != 3 || last.Actor != AnonymousActor {
+			t.Errorf("Expected rollback revision 3 by anonymous, got %+v", last)
+		}
+
+		if _, err := service.Rollback("docs", 42, "bob"); !errors.Is(err, ErrRevisionNotFound) {
+			t.Errorf("Expected ErrRevisionNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Expired links stop redirecting", func(t *testing.T) {
+		soon := time.Now().Add(50 * time.Millisecond)
+		service.UpdateURL("docs", &models.UpdateRequest{ExpiresAt: models.NullTime{Set: true, Time: &soon}}, "bob")
+		if _, err := service.GetURL("docs"); err != nil {
+			t.Fatalf("Expected no error before expiry, got %v", err)
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		if _, err := service.GetURL("docs"); !errors.Is(err, ErrLinkExpired) {
+			t.Errorf("Expected ErrLinkExpired, got %v", err)
+		}
+
+		// Clearing the expiry revives the link
+		service.UpdateURL("docs", &models.UpdateRequest{ExpiresAt: models.NullTime{Set: true}}, "bob")
+		if _, err := service.GetURL("docs"); err != nil {
+			t.Errorf("Expected no error after clearing expiry, got %v", err)
+		}
+	})
+
+	t.Run("Refuse rolling back to an expired revision", func(t *testing.T) {
+		if _, err := service.Rollback("docs", 4, "bob"); !errors.Is(err, ErrInvalidExpiry) {
+			t.Errorf("Expected ErrInvalidExpiry, got %v", err)
+		}
+		if _, err := service.GetURL("docs"); err != nil {
+			t.Errorf("Expected the link to keep working, got %v", err)
+		}
+	})
+
+	t.Run("Skip revisions for updates that change nothing", func(t *testing.T) {
+		before, _ := service.History("docs")
+		url, _ := service.GetStats("docs")
+		notes := url.Notes
+		if _, err := service.UpdateURL("docs", &models.UpdateRequest{Notes: &notes, Tags: &[]string{}}, "bob"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		service.UpdateURL("docs", &models.UpdateRequest{}, "bob")
+
+		if after, _ := service.History("docs"); len(after) != len(before) {
+			t.Errorf("Expected %d revisions, got %d", len(before), len(after))
+		}
+	})
+}
+
+// racingStorage runs race once, right after the next Get, to stand in for a
+// request changing the link at the same time
+type racingStorage struct {
+	storage.Storage
+	race func()
+}
+
+func (r *racingStorage) Get(shortCode string) (*models.URL, error) {
+	url, err := r.Storage.Get(shortCode)
+	if race := r.race; race != nil {
+		r.race = nil
+		race()
+	}
+	return url, err
+}
+
+func TestConcurrentEdits(t *testing.T) {
+	store := &racingStorage{Storage: storage.NewInMemoryStorage()}
+	service := NewURLService(store, 6)
+	service.Shorten(&models.ShortenRequest{URL: "https://example.com", CustomCode: "docs"}, "alice")
+
+	first, second := "first", "second"
+	store.race = func() {
+		if _, err := service.UpdateURL("docs", &models.UpdateRequest{Notes: &first}, "alice"); err != nil {
+			t.Errorf("Expected the first update to succeed, got %v", err)
+		}
+	}
+	if _, err := service.UpdateURL("docs", &models.UpdateRequest{Notes: &second}, "bob"); err != storage.ErrConflict {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+
+	url, _ := service.GetStats("docs")
+	if url.Notes != first {
+		t.Errorf("Expected the first update to be kept, got %q", url.Notes)
+	}
+	if history, _ := service.History("docs"); len(history) != 2 {
+		t.Errorf("Expected 2 revisions, got %d", len(history))
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"url-shortener/models"
+	"url-shortener/search"
+)
+
+var ErrEmptySearch = errors.New("search query has no words to look for")
+
+const (
+	// DefaultSearchLimit is the number of results when none is requested
+	DefaultSearchLimit = 20
+	// MaxSearchLimit caps the results of a single search
+	MaxSearchLimit = 100
+)
+
+// Search finds live links by short code, destination, title, tags and notes.
+// Every word of query must match the start of a word in one of those fields.
+func (s *URLService) Search(query string, limit int) ([]models.SearchResult, error) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	hits, err := s.storage.Search(query, min(limit, MaxSearchLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.SearchResult, len(hits))
+	for i, hit := range hits {
+		results[i] = models.SearchResult{
+			URL:        hit.URL,
+			Score:      hit.Score,
+			Highlights: search.Highlights(search.DocumentOf(hit.URL), terms),
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestSearch(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+
+	service.Shorten(&models.ShortenRequest{URL: "https://golang.org/doc", CustomCode: "godocs", Notes: "Docs for <Go>"}, "alice")
+	service.Shorten(&models.ShortenRequest{URL: "https://www.rust-lang.org", CustomCode: "rust"}, "alice")
+
+	t.Run("Highlight matching fields", func(t *testing.T) {
+		results, err := service.Search("go", 0)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(results) != 1 || results[0].URL.ShortCode != "godocs" {
+			t.Fatalf("Expected only godocs, got %v", results)
+		}
+
+		highlights := results[0].Highlights
+		if highlights["notes"] != "Docs for &lt;<mark>Go</mark>&gt;" {
+			t.Errorf("Expected highlighted notes, got %q", highlights["notes"])
+		}
+		if highlights["short_code"] != "<mark>godocs</mark>" {
+			t.Errorf("Expected highlighted short code, got %q", highlights["short_code"])
+		}
+		if _, exists := highlights["title"]; exists {
+			t.Error("Expected no highlight for a field without a match")
+		}
+	})
+
+	t.Run("Reject a query without words", func(t *testing.T) {
+		if _, err := service.Search(" ?! ", 10); err != ErrEmptySearch {
+			t.Errorf("Expected ErrEmptySearch, got %v", err)
+		}
+	})
+}
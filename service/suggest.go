@@ -0,0 +1,59 @@
+package service
+
+import (
+	"strings"
+	"time"
+	"url-shortener/models"
+)
+
+const (
+	// MaxSuggestions is the number of codes offered for an unknown one
+	MaxSuggestions = 5
+	// maxSuggestionDistance caps the edits between an unknown code and a suggestion
+	maxSuggestionDistance = 3
+	// maxSuggestionChecks bounds the candidates looked up in storage per request
+	maxSuggestionChecks = 20
+)
+
+// IndexCodes fills the "did you mean" index with the short codes of every
+// live link. It is meant to run once in the background at startup; until it
+// finishes, only links created or restored since are suggested. The index
+// then follows the links created, restored and deleted through this service,
+// so purged links left it when they were deleted. Links changed elsewhere,
+// such as by another instance sharing the database, are picked up on
+// restart, and candidates are looked up again before they are suggested.
+func (s *URLService) IndexCodes() error {
+	return s.Export(func(url *models.URL) error {
+		s.codes.Add(url.ShortCode)
+		return nil
+	})
+}
+
+// Suggest returns up to MaxSuggestions codes of live links close to the code
+// a redirect to path asked for, closest first. path is the request path
+// without its leading slash, as given to ResolvePath; outside go-links mode
+// only its first segment is the code. Longer codes tolerate more typos: one
+// edit per three characters, at least one and at most three.
+func (s *URLService) Suggest(path string) []string {
+	code := path
+	if !s.goLinks {
+		code, _, _ = strings.Cut(path, "/")
+	}
+
+	maxDistance := min(max(len([]rune(code))/3, 1), maxSuggestionDistance)
+	matches := s.codes.Search(code, maxDistance)
+
+	suggestions := []string{}
+	now := time.Now()
+	for i, match := range matches {
+		if i == maxSuggestionChecks || len(suggestions) == MaxSuggestions {
+			break
+		}
+		url, err := s.storage.Get(match.Word)
+		if err != nil || url.Deleted() || url.Expired(now) {
+			continue
+		}
+		suggestions = append(suggestions, match.Word)
+	}
+	return suggestions
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestSuggest(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	// Links stored before the service starts are found by IndexCodes
+	store.Save(&models.URL{ShortCode: "launch", OriginalURL: "https://example.com/launch"})
+	service := NewURLService(store, 6)
+	if err := service.IndexCodes(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	service.ShortenURL("https://example.com/promo", "promo")
+	if got := fmt.Sprint(service.Suggest("prmo")); got != "[promo]" {
+		t.Errorf("Expected [promo], got %s", got)
+	}
+
+	t.Run("Follow new and restored links", func(t *testing.T) {
+		service.ShortenURL("https://example.com/promo2", "promo2")
+		service.ShortenBatch([]models.ShortenRequest{{URL: "https://example.com/p", CustomCode: "promos"}}, false, "")
+		if got := fmt.Sprint(service.Suggest("promo-")); got != "[promo promo2 promos]" {
+			t.Errorf("Expected every promo link, got %s", got)
+		}
+
+		service.DeleteURL("promo2", "")
+		if got := fmt.Sprint(service.Suggest("promo-")); got != "[promo promos]" {
+			t.Errorf("Expected deleted links to be skipped, got %s", got)
+		}
+		if matches := service.codes.Search("promo2", 0); len(matches) != 0 {
+			t.Errorf("Expected deleted links to leave the index, got %v", matches)
+		}
+		service.RestoreURL("promo2", "")
+		if got := fmt.Sprint(service.Suggest("promo-")); got != "[promo promo2 promos]" {
+			t.Errorf("Expected restored links to be suggested again, got %s", got)
+		}
+	})
+
+	t.Run("Scale distance with length", func(t *testing.T) {
+		if got := fmt.Sprint(service.Suggest("lnch")); got != "[]" {
+			t.Errorf("Expected no suggestion two edits from a short code, got %s", got)
+		}
+		if got := fmt.Sprint(service.Suggest("lanuch")); got != "[launch]" {
+			t.Errorf("Expected [launch], got %s", got)
+		}
+		if got := fmt.Sprint(service.Suggest("launch/extra")); got != "[launch]" {
+			t.Errorf("Expected only the first segment to count, got %s", got)
+		}
+	})
+
+	t.Run("Skip expired links", func(t *testing.T) {
+		service.ShortenURL("https://example.com/gone", "gone")
+		service.ShortenURL("https://example.com/gone2", "gone2")
+		gone, _ := store.Get("gone")
+		past := time.Now().Add(-time.Hour)
+		gone.ExpiresAt = &past
+		store.Update(gone)
+
+		if got := fmt.Sprint(service.Suggest("gone1")); got != "[gone2]" {
+			t.Errorf("Expected [gone2], got %s", got)
+		}
+	})
+}
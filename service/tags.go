@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"url-shortener/models"
+)
+
+const (
+	// MaxTags is the number of tags a link can carry
+	MaxTags = 20
+	// MaxTagLength is the longest tag name, in characters
+	MaxTagLength = 32
+	// MaxTitleLength is the longest title, in characters
+	MaxTitleLength = 200
+)
+
+var (
+	ErrInvalidTag   = errors.New("invalid tag")
+	ErrTooManyTags  = fmt.Errorf("a link can have at most %d tags", MaxTags)
+	ErrTitleTooLong = fmt.Errorf("title is longer than %d characters", MaxTitleLength)
+)
+
+// NormalizeTags lowercases and trims tags, drops empty and duplicate ones and
+// sorts the rest. Tags hold letters, digits, '-', '_' and '.', so they can be
+// written in a query string or a CSV cell without quoting.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > MaxTagLength {
+			return nil, fmt.Errorf("%w %q: longer than %d characters", ErrInvalidTag, tag, MaxTagLength)
+		}
+		for _, r := range tag {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+				return nil, fmt.Errorf("%w %q: only letters, digits, '-', '_' and '.' are allowed", ErrInvalidTag, tag)
+			}
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > MaxTags {
+		return nil, ErrTooManyTags
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// normalizeTitle trims a title and checks its length
+func normalizeTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) > MaxTitleLength {
+		return "", ErrTitleTooLong
+	}
+	return title, nil
+}
+
+// Tags lists the tags in use on links outside the trash with their link
+// counts, most used first
+func (s *URLService) Tags() ([]models.TagCount, error) {
+	return s.storage.ListTags()
+}
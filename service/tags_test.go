@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags([]string{" Marketing", "q2", "marketing", "", "launch.v2"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fmt.Sprint(tags) != "[launch.v2 marketing q2]" {
+		t.Errorf("Expected lowercase, sorted, distinct tags, got %v", tags)
+	}
+
+	invalid := [][]string{
+		{"two words"},
+		{"a,b"},
+		{strings.Repeat("x", MaxTagLength+1)},
+	}
+	for _, tags := range invalid {
+		if _, err := NormalizeTags(tags); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("Expected ErrInvalidTag for %q, got %v", tags, err)
+		}
+	}
+
+	many := make([]string, MaxTags+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("t%d", i)
+	}
+	if _, err := NormalizeTags(many); err != ErrTooManyTags {
+		t.Errorf("Expected ErrTooManyTags, got %v", err)
+	}
+}
+
+func TestTitleAndTags(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+
+	url, err := service.Shorten(&models.ShortenRequest{
+		URL: "https://example.com/spring", CustomCode: "spring", Title: "  Spring launch ", Tags: []string{"Marketing", "q2"},
+	}, "alice")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if url.Title != "Spring launch" || fmt.Sprint(url.Tags) != "[marketing q2]" {
+		t.Errorf("Expected trimmed title and normalized tags, got %q and %v", url.Title, url.Tags)
+	}
+
+	t.Run("Edit and roll back tags", func(t *testing.T) {
+		title, tags := "Spring sale", []string{"sale"}
+		if _, err := service.UpdateURL("spring", &models.UpdateRequest{Title: &title, Tags: &tags}, "bob"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		counts, _ := service.Tags()
+		if fmt.Sprint(counts) != "[{sale 1}]" {
+			t.Errorf("Expected only the sale tag, got %v", counts)
+		}
+
+		restored, err := service.Rollback("spring", 1, "bob")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if restored.Title != "Spring launch" || fmt.Sprint(restored.Tags) != "[marketing q2]" {
+			t.Errorf("Expected the original title and tags, got %q and %v", restored.Title, restored.Tags)
+		}
+	})
+
+	t.Run("Reject invalid input", func(t *testing.T) {
+		long := strings.Repeat("x", MaxTitleLength+1)
+		if _, err := service.UpdateURL("spring", &models.UpdateRequest{Title: &long}, "bob"); err != ErrTitleTooLong {
+			t.Errorf("Expected ErrTitleTooLong, got %v", err)
+		}
+		if _, err := service.QueryURLs(storage.ListOptions{Tags: []string{"no spaces"}}); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("Expected ErrInvalidTag for a bad filter, got %v", err)
+		}
+	})
+
+	t.Run("Filter by tag case-insensitively", func(t *testing.T) {
+		page, err := service.QueryURLs(storage.ListOptions{Tags: []string{"Marketing"}})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(page.URLs) != 1 {
+			t.Errorf("Expected 1 link, got %d", len(page.URLs))
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"time"
+	"url-shortener/models"
+	"url-shortener/storage"
+	"url-shortener/transfer"
+)
+
+// Conflict policies for imported short codes that already exist
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+)
+
+// Outcomes of an imported row
+const (
+	ImportCreated     = "created"
+	ImportOverwritten = "overwritten"
+	ImportRenamed     = "renamed"
+	ImportSkipped     = "skipped"
+	ImportFailed      = "failed"
+)
+
+var ErrInvalidConflictPolicy = errors.New("conflict policy must be skip, overwrite or rename")
+
+// exportPageSize is the number of links read from storage at a time
+const exportPageSize = 500
+
+// Export walks every link that is not in the trash, in creation order. Pages
+// may come back short when links are trashed while they are read, so only an
+// empty page ends the walk.
+func (s *URLService) Export(fn func(*models.URL) error) error {
+	var afterID int64
+	for {
+		urls, err := s.storage.ListAfterID(afterID, exportPageSize, false)
+		if err != nil {
+			return err
+		}
+		if len(urls) == 0 {
+			return nil
+		}
+
+		for _, url := range urls {
+			if err := fn(url); err != nil {
+				return err
+			}
+			afterID = url.ID
+		}
+	}
+}
+
+// Import creates a link for every record read from dec. Each record goes
+// through the same validation as ShortenURL, except that links which had
+// already expired are kept as expired links; stats are kept for new links.
+// Existing short codes are handled according to policy. A non-nil error
+// means the input could not be read any further; the report covers the rows
+// read until then.
+func (s *URLService) Import(dec transfer.Decoder, policy, actor string) (*models.ImportReport, error) {
+	switch policy {
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+	default:
+		return nil, ErrInvalidConflictPolicy
+	}
+
+	report := &models.ImportReport{Rows: []models.ImportRowResult{}}
+	var created []string
+	defer func() { s.refreshPreviewsAsync(created) }()
+
+	for {
+		record, line, err := dec.Decode()
+		if err == io.EOF {
+			return report, nil
+		}
+
+		report.Total++
+		var rowErr *transfer.RowError
+		if errors.As(err, &rowErr) {
+			report.Failed++
+			report.Rows = append(report.Rows, models.ImportRowResult{Line: line, Action: ImportFailed, Error: rowErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			report.Total--
+			return report, err
+		}
+
+		result := s.importRecord(record, policy, actor)
+		result.Line = line
+		switch result.Action {
+		case ImportCreated:
+			report.Created++
+			created = append(created, result.ShortCode)
+			continue
+		case ImportOverwritten:
+			report.Overwritten++
+		case ImportRenamed:
+			report.Renamed++
+			created = append(created, result.NewCode)
+		case ImportSkipped:
+			report.Skipped++
+		case ImportFailed:
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, result)
+	}
+}
+
+// importRecord stores one imported link and reports what happened to it
+func (s *URLService) importRecord(record transfer.Record, policy, actor string) models.ImportRowResult {
+	result := models.ImportRowResult{ShortCode: record.ShortCode}
+	fail := func(err error) models.ImportRowResult {
+		result.Action = ImportFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	// The expiry is set after validation, which only accepts future ones, so
+	// links that had expired when they were exported survive the round trip
+	req := record.Request()
+	req.ExpiresAt = nil
+	url, err := s.prepare(req, actor)
+	if err != nil {
+		return fail(err)
+	}
+	url.ExpiresAt = record.ExpiresAt
+	url.Clicks = record.Clicks
+	url.CreatedAt = record.CreatedAt
+	url.LastAccessed = record.LastAccessed
+
+	renamed := false
+	maxRetries := 5
+	for i := 0; i < maxRetries; i++ {
+		err = s.storage.Save(url)
+		if err != storage.ErrAlreadyExists {
+			break
+		}
+
+		if req.CustomCode != "" && policy != ConflictRename {
+			break
+		}
+		renamed = req.CustomCode != ""
+		if url.ShortCode, err = s.generateShortCode(); err != nil {
+			return fail(err)
+		}
+	}
+
+	switch {
+	case err == nil:
+		s.recordRevision(url, models.RevisionImport, actor, time.Now())
+		s.codes.Add(url.ShortCode)
+		result.ShortCode = url.ShortCode
+		result.Action = ImportCreated
+		if renamed {
+			result.ShortCode = record.ShortCode
+			result.NewCode = url.ShortCode
+			result.Action = ImportRenamed
+		}
+		return result
+
+	case err == storage.ErrAlreadyExists && req.CustomCode == "":
+		return fail(err)
+
+	case err == storage.ErrAlreadyExists && policy == ConflictSkip:
+		result.Action = ImportSkipped
+		return result
+
+	case err == storage.ErrAlreadyExists && policy == ConflictOverwrite:
+		// The existing link keeps its stats; only its settings are replaced
+		revisions, err := s.storage.ListRevisions(url.ShortCode)
+		if err != nil {
+			return fail(err)
+		}
+		existing, err := s.getLive(url.ShortCode)
+		if err != nil {
+			return fail(err)
+		}
+		if _, err := s.changeState(existing, url.State(), models.RevisionImport, actor, revisions); err != nil {
+			return fail(err)
+		}
+		result.Action = ImportOverwritten
+		return result
+
+	default:
+		return fail(err)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+	"url-shortener/transfer"
+)
+
+func TestExportImport(t *testing.T) {
+	source := NewURLService(storage.NewInMemoryStorage(), 6)
+	source.ShortenURL("https://example.com/one", "one")
+	source.Shorten(&models.ShortenRequest{URL: "https://example.com/two", CustomCode: "two", RedirectType: 301, Notes: "keep"}, "")
+	source.ShortenURL("https://example.com/gone", "gone")
+	source.DeleteURL("gone", "")
+	source.GetURL("one")
+	source.GetURL("one")
+
+	var buf bytes.Buffer
+	encoder, _ := transfer.NewEncoder(&buf, transfer.FormatCSV)
+	err := source.Export(func(url *models.URL) error {
+		return encoder.Encode(transfer.FromURL(url))
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	encoder.Flush()
+	exported := buf.String()
+
+	t.Run("Export skips the trash", func(t *testing.T) {
+		if lines := strings.Count(exported, "\n"); lines != 3 {
+			t.Errorf("Expected header and 2 rows, got %d lines", lines)
+		}
+	})
+
+	t.Run("Import keeps settings and stats", func(t *testing.T) {
+		target := NewURLService(storage.NewInMemoryStorage(), 6)
+		decoder, _ := transfer.NewDecoder(strings.NewReader(exported), transfer.FormatCSV)
+
+		report, err := target.Import(decoder, ConflictSkip, "migrator")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if report.Total != 2 || report.Created != 2 || len(report.Rows) != 0 {
+			t.Errorf("Expected 2 created rows, got %+v", report)
+		}
+
+		one, _ := target.GetStats("one")
+		if one.Clicks != 2 {
+			t.Errorf("Expected 2 clicks to be kept, got %d", one.Clicks)
+		}
+		two, _ := target.GetStats("two")
+		if two.RedirectType != 301 || two.Notes != "keep" {
+			t.Errorf("Expected settings to be kept, got %d %q", two.RedirectType, two.Notes)
+		}
+	})
+
+	t.Run("Import keeps expired links", func(t *testing.T) {
+		target := NewURLService(storage.NewInMemoryStorage(), 6)
+		input := "short_code,original_url,expires_at\nold,https://example.com/old,2020-01-01T00:00:00Z\n"
+		decoder, _ := transfer.NewDecoder(strings.NewReader(input), transfer.FormatCSV)
+
+		report, err := target.Import(decoder, ConflictSkip, "migrator")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if report.Created != 1 {
+			t.Fatalf("Expected 1 created row, got %+v", report)
+		}
+		old, _ := target.GetStats("old")
+		if old.ExpiresAt == nil || old.ExpiresAt.Year() != 2020 {
+			t.Errorf("Expected the expiry to be kept, got %v", old.ExpiresAt)
+		}
+		if _, err := target.GetURL("old"); err != ErrLinkExpired {
+			t.Errorf("Expected ErrLinkExpired, got %v", err)
+		}
+	})
+
+	t.Run("Conflict policies", func(t *testing.T) {
+		input := "short_code,original_url\none,https://example.com/new\nbad,not a url\n"
+		run := func(policy string) *models.ImportReport {
+			decoder, _ := transfer.NewDecoder(strings.NewReader(input), transfer.FormatCSV)
+			report, err := source.Import(decoder, policy, "migrator")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			return report
+		}
+
+		report := run(ConflictSkip)
+		if report.Skipped != 1 || report.Failed != 1 || report.Rows[1].Line != 3 {
+			t.Errorf("Expected one skipped and one failed row, got %+v", report)
+		}
+
+		report = run(ConflictRename)
+		if report.Renamed != 1 || report.Rows[0].NewCode == "" || report.Rows[0].NewCode == "one" {
+			t.Errorf("Expected row to be renamed, got %+v", report)
+		}
+		if renamed, _ := source.GetStats(report.Rows[0].NewCode); renamed == nil || renamed.Destination() != "https://example.com/new" {
+			t.Error("Expected renamed link to be stored")
+		}
+
+		report = run(ConflictOverwrite)
+		if report.Overwritten != 1 {
+			t.Errorf("Expected row to be overwritten, got %+v", report)
+		}
+		one, _ := source.GetStats("one")
+		if one.Destination() != "https://example.com/new" || one.Clicks != 2 {
+			t.Errorf("Expected new destination with existing stats, got %s %d", one.Destination(), one.Clicks)
+		}
+
+		if _, err := source.Import(nil, "merge", "migrator"); err != ErrInvalidConflictPolicy {
+			t.Errorf("Expected ErrInvalidConflictPolicy, got %v", err)
+		}
+	})
+}
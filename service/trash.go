@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+	"url-shortener/models"
+)
+
+var (
+	ErrLinkDeleted = errors.New("link has been deleted")
+	ErrNotDeleted  = errors.New("link is not in the trash")
+)
+
+// DefaultTrashRetention is how long deleted links are kept before they are purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// WithTrashRetention sets how long deleted links stay restorable. Their short
+// codes cannot be reused until they are purged.
+func WithTrashRetention(retention time.Duration) Option {
+	return func(s *URLService) {
+		s.trashRetention = retention
+	}
+}
+
+// TrashRetention returns how long deleted links are kept
+func (s *URLService) TrashRetention() time.Duration {
+	return s.trashRetention
+}
+
+// getLive returns a link that has not been moved to the trash
+func (s *URLService) getLive(shortCode string) (*models.URL, error) {
+	url, err := s.storage.Get(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if url.Deleted() {
+		return nil, ErrLinkDeleted
+	}
+	return url, nil
+}
+
+// DeleteURL moves a shortened URL to the trash
+func (s *URLService) DeleteURL(shortCode, actor string) error {
+	url, err := s.getLive(shortCode)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := s.storage.SoftDelete(shortCode, now); err != nil {
+		return err
+	}
+
+	s.recordRevision(url, models.RevisionDelete, actor, now)
+	s.codes.Remove(shortCode)
+	return nil
+}
+
+// RestoreURL takes a shortened URL out of the trash
+func (s *URLService) RestoreURL(shortCode, actor string) (*models.URL, error) {
+	url, err := s.storage.Get(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if !url.Deleted() {
+		return nil, ErrNotDeleted
+	}
+
+	if err := s.storage.Restore(shortCode); err != nil {
+		return nil, err
+	}
+	url.DeletedAt = nil
+
+	s.recordRevision(url, models.RevisionRestore, actor, time.Now())
+	s.codes.Add(shortCode)
+	return url, nil
+}
+
+// ListTrash retrieves deleted URLs with pagination
+func (s *URLService) ListTrash(limit, offset int) ([]*models.URL, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.storage.ListDeleted(min(limit, MaxPageSize), offset)
+}
+
+// PurgeTrash permanently removes links deleted longer than the retention window ago
+func (s *URLService) PurgeTrash() (int64, error) {
+	return s.storage.PurgeDeleted(time.Now().Add(-s.trashRetention))
+}
+
+// StartPurger runs PurgeTrash every interval until the returned function is called
+func (s *URLService) StartPurger(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				purged, err := s.PurgeTrash()
+				if err != nil {
+					log.Printf("trash: purge failed: %v", err)
+				} else if purged > 0 {
+					log.Printf("trash: purged %d links", purged)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestTrash(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6, WithTrashRetention(time.Hour))
+	service.ShortenURL("https://example.com/campaign", "campaign")
+
+	t.Run("Deleted links answer gone", func(t *testing.T) {
+		if err := service.DeleteURL("campaign", "alice"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := service.GetURL("campaign"); !errors.Is(err, ErrLinkDeleted) {
+			t.Errorf("Expected ErrLinkDeleted, got %v", err)
+		}
+		if err := service.DeleteURL("campaign", "alice"); !errors.Is(err, ErrLinkDeleted) {
+			t.Errorf("Expected ErrLinkDeleted, got %v", err)
+		}
+		notes := "edit"
+		if _, err := service.UpdateURL("campaign", &models.UpdateRequest{Notes: &notes}, "alice"); !errors.Is(err, ErrLinkDeleted) {
+			t.Errorf("Expected ErrLinkDeleted, got %v", err)
+		}
+	})
+
+	t.Run("Deleted codes cannot be reclaimed", func(t *testing.T) {
+		if _, err := service.ShortenURL("https://example.org", "campaign"); err != storage.ErrAlreadyExists {
+			t.Errorf("Expected ErrAlreadyExists, got %v", err)
+		}
+	})
+
+	t.Run("List trash", func(t *testing.T) {
+		trash, err := service.ListTrash(10, 0)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(trash) != 1 || trash[0].ShortCode != "campaign" {
+			t.Errorf("Expected campaign in the trash, got %d URLs", len(trash))
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		if _, err := service.RestoreURL("campaign", "bob"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := service.GetURL("campaign"); err != nil {
+			t.Errorf("Expected restored link to redirect, got %v", err)
+		}
+		if _, err := service.RestoreURL("campaign", "bob"); !errors.Is(err, ErrNotDeleted) {
+			t.Errorf("Expected ErrNotDeleted, got %v", err)
+		}
+
+		revisions, _ := service.History("campaign")
+		actions := []string{}
+		for _, revision := range revisions {
+			actions = append(actions, revision.Action)
+		}
+		if len(actions) != 3 || actions[1] != models.RevisionDelete || actions[2] != models.RevisionRestore {
+			t.Errorf("Expected create, delete, restore history, got %v", actions)
+		}
+	})
+
+	t.Run("Purge after retention", func(t *testing.T) {
+		service.DeleteURL("campaign", "alice")
+		if purged, _ := service.PurgeTrash(); purged != 0 {
+			t.Errorf("Expected nothing purged within retention, got %d", purged)
+		}
+
+		// Backdate the deletion past the retention window
+		store.Restore("campaign")
+		store.SoftDelete("campaign", time.Now().Add(-2*time.Hour))
+		if purged, _ := service.PurgeTrash(); purged != 1 {
+			t.Errorf("Expected 1 purged link, got %d", purged)
+		}
+		if _, err := service.ShortenURL("https://example.org", "campaign"); err != nil {
+			t.Errorf("Expected purged code to be reusable, got %v", err)
+		}
+	})
+}
@@ -3,44 +3,117 @@ package service
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
 	"strings"
 	"time"
+	"url-shortener/fetcher"
 	"url-shortener/models"
+	"url-shortener/safety"
 	"url-shortener/storage"
+	"url-shortener/suggest"
 )
 
 // URLService handles business logic for URL shortening
 type URLService struct {
 	storage      storage.Storage
 	shortCodeLen int
+	normalizer   *Normalizer
+	checker      safety.DestinationChecker
+
+	ownHosts       map[string]bool
+	selfLinkPolicy string
+	chainResolver  *ChainResolver
+	previewFetcher *fetcher.Fetcher
+
+	defaultRedirectType int
+	defaultCacheControl string
+
+	trashRetention time.Duration
+	maxBatchSize   int
+
+	goLinks bool
+	// codes indexes short codes for Suggest, see IndexCodes
+	codes *suggest.BKTree
+}
+
+// Option configures optional URLService behaviour
+type Option func(*URLService)
+
+// WithNormalizer replaces the default destination normalizer
+func WithNormalizer(normalizer *Normalizer) Option {
+	return func(s *URLService) {
+		s.normalizer = normalizer
+	}
+}
+
+// WithDestinationChecker rejects destinations that fail the given checks
+func WithDestinationChecker(checker safety.DestinationChecker) Option {
+	return func(s *URLService) {
+		s.checker = checker
+	}
+}
+
+// WithOwnDomains marks the hosts serving our short links. Entries may be
+// bare hosts or base URLs; destinations on them are handled per policy.
+func WithOwnDomains(policy string, domains ...string) Option {
+	return func(s *URLService) {
+		s.selfLinkPolicy = policy
+		for _, domain := range domains {
+			if strings.Contains(domain, "://") {
+				canonical, err := s.normalizer.Normalize(domain)
+				if err != nil {
+					continue
+				}
+				u, _ := url.Parse(canonical)
+				domain = u.Host
+			}
+			s.ownHosts[strings.ToLower(domain)] = true
+		}
+	}
 }
 
-func NewURLService(storage storage.Storage, shortCodeLen int) *URLService {
-	return &URLService{
+// WithChainResolver resolves third-party shortener chains at creation time
+func WithChainResolver(resolver *ChainResolver) Option {
+	return func(s *URLService) {
+		s.chainResolver = resolver
+	}
+}
+
+func NewURLService(storage storage.Storage, shortCodeLen int, opts ...Option) *URLService {
+	s := &URLService{
 		storage:      storage,
 		shortCodeLen: shortCodeLen,
+		normalizer:   NewNormalizer(nil, nil),
+
+		ownHosts:       make(map[string]bool),
+		selfLinkPolicy: SelfLinkCollapse,
+
+		defaultRedirectType: DefaultRedirectType,
+		defaultCacheControl: DefaultCacheControl,
+
+		trashRetention: DefaultTrashRetention,
+		maxBatchSize:   DefaultMaxBatchSize,
+
+		codes: suggest.New(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // ShortenURL creates a short code for the given URL
 func (s *URLService) ShortenURL(originalURL, customCode string) (*models.URL, error) {
-	var shortCode string
-	var err error
-
-	if customCode != "" {
-		// Use custom code if provided
-		shortCode = customCode
-	} else {
-		// Generate random short code
-		shortCode, err = s.generateShortCode()
-		if err != nil {
-			return nil, err
-		}
-	}
+	return s.Shorten(&models.ShortenRequest{URL: originalURL, CustomCode: customCode}, "")
+}
 
-	url := &models.URL{
-		ShortCode:   shortCode,
-		OriginalURL: originalURL,
+// Shorten validates the request and stores a new short link on behalf of actor
+func (s *URLService) Shorten(req *models.ShortenRequest, actor string) (*models.URL, error) {
+	url, err := s.prepare(req, actor)
+	if err != nil {
+		return nil, err
 	}
 
 	// Try to save, if collision occurs, try again (only for generated codes)
@@ -48,16 +121,20 @@ func (s *URLService) ShortenURL(originalURL, customCode string) (*models.URL, er
 	for i := 0; i < maxRetries; i++ {
 		err = s.storage.Save(url)
 		if err == nil {
+			s.recordRevision(url, models.RevisionCreate, actor, url.CreatedAt)
+			s.codes.Add(url.ShortCode)
+			if s.previewFetcher != nil {
+				go s.refreshPreviewAsync(url.ShortCode)
+			}
 			return url, nil
 		}
 
-		if err == storage.ErrAlreadyExists && customCode == "" {
+		if err == storage.ErrAlreadyExists && req.CustomCode == "" {
 			// Generate new code and retry
-			shortCode, err = s.generateShortCode()
+			url.ShortCode, err = s.generateShortCode()
 			if err != nil {
 				return nil, err
 			}
-			url.ShortCode = shortCode
 			continue
 		}
 
@@ -67,22 +144,155 @@ func (s *URLService) ShortenURL(originalURL, customCode string) (*models.URL, er
 	return nil, err
 }
 
-// GetURL retrieves the original URL and increments click count
+// prepare validates a shorten request and builds the link to store, owned by actor
+func (s *URLService) prepare(req *models.ShortenRequest, actor string) (*models.URL, error) {
+	if err := ValidateRedirectPolicy(req.RedirectType, req.CacheControl); err != nil {
+		return nil, err
+	}
+
+	if err := validateExpiry(req.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	title, err := normalizeTitle(req.Title)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := NormalizeTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	utm, err := linkUTM(req.UTM)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCampaign(req.CampaignID); err != nil {
+		return nil, err
+	}
+
+	canonicalURL, err := s.canonicalDestination(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	variants, rotation, err := s.normalizeVariants(req.Variants, req.Rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	var shortCode string
+	if err := s.validateCode(req.CustomCode); err != nil {
+		return nil, err
+	}
+	if req.CustomCode != "" {
+		// Use custom code if provided
+		shortCode = req.CustomCode
+	} else {
+		// Generate random short code
+		shortCode, err = s.generateShortCode()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.URL{
+		ShortCode:    shortCode,
+		OriginalURL:  req.URL,
+		CanonicalURL: canonicalURL,
+		RedirectType: req.RedirectType,
+		CacheControl: req.CacheControl,
+		ExpiresAt:    req.ExpiresAt,
+		Title:        title,
+		Notes:        req.Notes,
+		Tags:         tags,
+		CampaignID:   req.CampaignID,
+		UTM:          utm,
+		UTMOverride:  req.UTMOverride,
+		Passthrough:  req.Passthrough,
+		Interstitial: req.Interstitial,
+		Variants:     variants,
+		Rotation:     rotation,
+		Owner:        actor,
+	}, nil
+}
+
+// GetURL retrieves the original URL and increments click count. For links
+// with variants the destination is that of the variant the visit went to.
 func (s *URLService) GetURL(shortCode string) (*models.URL, error) {
+	return s.Resolve(shortCode, Visit{})
+}
+
+// Resolve retrieves the link behind a redirect and records the visit
+func (s *URLService) Resolve(shortCode string, visit Visit) (*models.URL, error) {
 	url, err := s.storage.Get(shortCode)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.recordVisit(url, visit); err != nil {
+		return nil, err
+	}
+	return url, nil
+}
 
-	// Increment click count
-	url.Clicks++
+// recordVisit checks that url can be visited and records the visit, updating
+// its counters in place
+func (s *URLService) recordVisit(url *models.URL, visit Visit) error {
 	now := time.Now()
+	visitor := visitorID(visit)
+	variant := chooseVariant(url, visitor)
+	if variant != nil {
+		// The rest of the redirect, passthrough and UTM tags included, builds on the variant
+		url.OriginalURL = variant.URL
+		url.CanonicalURL = variant.CanonicalURL
+	}
+	if err := s.checkVisit(url, visit.Path, now); err != nil {
+		return err
+	}
+
+	// Only the counters and the click are written so concurrent edits are never overwritten
+	click := &models.Click{
+		ShortCode: url.ShortCode,
+		At:        now,
+		Referrer:  referrerHost(visit.Referrer),
+		Visitor:   visitor,
+	}
+	if variant != nil {
+		click.Variant = variant.Name
+	}
+	if err := s.storage.RecordClick(click); err != nil {
+		return err
+	}
+	url.Clicks++
 	url.LastAccessed = &now
 
-	// Update in background (we don't want to slow down the redirect)
-	go s.storage.Update(url)
+	return nil
+}
 
-	return url, nil
+// checkVisit checks that url can be visited at now with the path suffix after
+// its short code
+func (s *URLService) checkVisit(url *models.URL, suffix string, now time.Time) error {
+	// A path below a link that does not take it names nothing
+	if !s.acceptsSuffix(url, suffix) {
+		return storage.ErrNotFound
+	}
+
+	if url.Deleted() {
+		return ErrLinkDeleted
+	}
+
+	if url.Expired(now) {
+		return ErrLinkExpired
+	}
+
+	// Blocklists reload while links live, so a destination accepted when it
+	// was shortened may have been listed since
+	if err := s.checkDestination(url.Destination()); err != nil {
+		var rejection *safety.Rejection
+		if errors.As(err, &rejection) {
+			return fmt.Errorf("%w: %w", ErrLinkDisabled, err)
+		}
+		return err
+	}
+	return nil
 }
 
 // GetStats retrieves URL statistics without incrementing click count
@@ -90,11 +300,6 @@ func (s *URLService) GetStats(shortCode string) (*models.URL, error) {
 	return s.storage.Get(shortCode)
 }
 
-// DeleteURL removes a shortened URL
-func (s *URLService) DeleteURL(shortCode string) error {
-	return s.storage.Delete(shortCode)
-}
-
 // ListURLs retrieves all URLs with pagination
 func (s *URLService) ListURLs(limit, offset int) ([]*models.URL, error) {
 	if limit <= 0 {
@@ -103,7 +308,55 @@ func (s *URLService) ListURLs(limit, offset int) ([]*models.URL, error) {
 	if offset < 0 {
 		offset = 0
 	}
-	return s.storage.List(limit, offset)
+	return s.storage.List(min(limit, MaxPageSize), offset)
+}
+
+// MaxPageSize caps the limit of a single page of links
+const MaxPageSize = 1000
+
+// QueryURLs returns a filtered, sorted page of links. Pass the NextCursor of
+// a page in opts.Cursor, with the same sort and filters, to get the next one.
+func (s *URLService) QueryURLs(opts storage.ListOptions) (*storage.ListPage, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	opts.Limit = min(opts.Limit, MaxPageSize)
+
+	tags, err := NormalizeTags(opts.Tags)
+	if err != nil {
+		return nil, err
+	}
+	opts.Tags = tags
+	return s.storage.Query(opts)
+}
+
+// canonicalDestination normalizes a destination, resolves it through
+// shorteners and runs the safety checks on the result
+func (s *URLService) canonicalDestination(raw string) (string, error) {
+	canonicalURL, err := s.normalizer.Normalize(raw)
+	if err != nil {
+		return "", err
+	}
+	if canonicalURL, err = s.resolveDestination(canonicalURL); err != nil {
+		return "", err
+	}
+	if err := s.checkDestination(canonicalURL); err != nil {
+		return "", err
+	}
+	return canonicalURL, nil
+}
+
+// checkDestination runs the configured safety checks on a canonical URL
+func (s *URLService) checkDestination(canonicalURL string) error {
+	if s.checker == nil {
+		return nil
+	}
+
+	u, err := url.Parse(canonicalURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	return s.checker.Check(u)
 }
 
 // generateShortCode creates a random URL-safe short code
@@ -1,7 +1,12 @@
 package service
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"url-shortener/models"
+	"url-shortener/safety"
 	"url-shortener/storage"
 )
 
@@ -122,21 +127,21 @@ func TestDeleteURL(t *testing.T) {
 	service.ShortenURL("https://example.com", "todelete")
 
 	t.Run("Delete existing URL", func(t *testing.T) {
-		err := service.DeleteURL("todelete")
+		err := service.DeleteURL("todelete", "")
 		
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
 		
-		// Verify it's deleted
-		_, err = service.GetStats("todelete")
-		if err != storage.ErrNotFound {
+		// Verify it's in the trash and no longer redirects
+		_, err = service.GetURL("todelete")
+		if !errors.Is(err, ErrLinkDeleted) {
 			t.Error("Expected URL to be deleted")
 		}
 	})
 
 	t.Run("Delete non-existent URL", func(t *testing.T) {
-		err := service.DeleteURL("nonexistent")
+		err := service.DeleteURL("nonexistent", "")
 		
 		if err != storage.ErrNotFound {
 			t.Errorf("Expected ErrNotFound, got %v", err)
@@ -218,3 +223,127 @@ func TestGenerateShortCode(t *testing.T) {
 	})
 }
 
+func TestShortenURLNormalization(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+
+	t.Run("Store original and canonical forms", func(t *testing.T) {
+		url, err := service.ShortenURL("HTTPS://Example.com:443/a/../b?utm_campaign=x", "canon")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if url.OriginalURL != "HTTPS://Example.com:443/a/../b?utm_campaign=x" {
+			t.Errorf("Expected original URL to be kept, got '%s'", url.OriginalURL)
+		}
+		if url.CanonicalURL != "https://example.com/b" {
+			t.Errorf("Expected canonical URL 'https://example.com/b', got '%s'", url.CanonicalURL)
+		}
+	})
+
+	t.Run("Reject disallowed scheme", func(t *testing.T) {
+		_, err := service.ShortenURL("javascript:alert(document.cookie)", "")
+		if !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("Expected ErrInvalidURL, got %v", err)
+		}
+	})
+}
+
+func TestShortenURLDestinationChecks(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6, WithDestinationChecker(safety.NewHeuristics(5, nil)))
+
+	_, err := service.ShortenURL("http://169.254.169.254/latest/meta-data", "")
+	var rejection *safety.Rejection
+	if !errors.As(err, &rejection) {
+		t.Fatalf("Expected rejection, got %v", err)
+	}
+	if rejection.Reason != safety.ReasonIPLiteral {
+		t.Errorf("Expected reason %q, got %q", safety.ReasonIPLiteral, rejection.Reason)
+	}
+
+	if _, err := service.ShortenURL("https://example.com", ""); err != nil {
+		t.Errorf("Expected safe destination to be accepted, got %v", err)
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6, WithRedirectDefaults(301, "public, max-age=3600"))
+
+	t.Run("Use server defaults", func(t *testing.T) {
+		url, _ := service.ShortenURL("https://example.com", "default")
+		status, cacheControl := service.RedirectPolicy(url)
+		if status != 301 || cacheControl != "public, max-age=3600" {
+			t.Errorf("Expected server defaults, got %d %q", status, cacheControl)
+		}
+	})
+
+	t.Run("Use per-link policy", func(t *testing.T) {
+		_, err := service.Shorten(&models.ShortenRequest{
+			URL:          "https://example.com",
+			CustomCode:   "temporary",
+			RedirectType: 307,
+			CacheControl: "no-store",
+		}, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		stored, _ := service.GetStats("temporary")
+		status, cacheControl := service.RedirectPolicy(stored)
+		if status != 307 || cacheControl != "no-store" {
+			t.Errorf("Expected 307 no-store, got %d %q", status, cacheControl)
+		}
+	})
+
+	t.Run("Reject invalid policies", func(t *testing.T) {
+		_, err := service.Shorten(&models.ShortenRequest{URL: "https://example.com", RedirectType: 303}, "")
+		if !errors.Is(err, ErrInvalidRedirectType) {
+			t.Errorf("Expected ErrInvalidRedirectType, got %v", err)
+		}
+
+		_, err = service.Shorten(&models.ShortenRequest{URL: "https://example.com", CacheControl: "no-store\r\nSet-Cookie: a=b"}, "")
+		if !errors.Is(err, ErrInvalidCacheControl) {
+			t.Errorf("Expected ErrInvalidCacheControl, got %v", err)
+		}
+	})
+}
+
+func TestResolveDisabledLink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	blocklist, err := safety.NewBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewURLService(storage.NewInMemoryStorage(), 6, WithDestinationChecker(blocklist))
+
+	if _, err := service.ShortenURL("https://evil.example/login", "later"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The domain is listed after the link was created
+	if err := os.WriteFile(path, []byte("evil.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := blocklist.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.Resolve("later", Visit{})
+	if !errors.Is(err, ErrLinkDisabled) {
+		t.Fatalf("Expected ErrLinkDisabled, got %v", err)
+	}
+	var rejection *safety.Rejection
+	if !errors.As(err, &rejection) || rejection.Reason != safety.ReasonBlocklisted {
+		t.Errorf("Expected the blocklist rejection to be kept, got %v", err)
+	}
+
+	url, _ := service.GetStats("later")
+	if url.Clicks != 0 {
+		t.Errorf("Expected disabled visit not to be counted, got %d clicks", url.Clicks)
+	}
+}
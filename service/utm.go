@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+var ErrInvalidUTM = errors.New("invalid UTM parameters")
+
+// normalizeUTM trims every UTM parameter and checks its length
+func normalizeUTM(utm models.UTMParams) (models.UTMParams, error) {
+	for name, value := range map[string]*string{
+		"utm_source":   &utm.Source,
+		"utm_medium":   &utm.Medium,
+		"utm_campaign": &utm.Campaign,
+		"utm_term":     &utm.Term,
+		"utm_content":  &utm.Content,
+	} {
+		*value = strings.TrimSpace(*value)
+		if utf8.RuneCountInString(*value) > MaxUTMLength {
+			return utm, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidUTM, name, MaxUTMLength)
+		}
+	}
+	return utm, nil
+}
+
+// linkUTM normalizes the UTM parameters of a link, returning nil when none is set
+func linkUTM(utm *models.UTMParams) (*models.UTMParams, error) {
+	if utm == nil {
+		return nil, nil
+	}
+	normalized, err := normalizeUTM(*utm)
+	if err != nil || normalized.IsZero() {
+		return nil, err
+	}
+	return &normalized, nil
+}
+
+// FinalURL returns the destination a visit of a link is redirected to. Go-link
+// templates are expanded with the path segments of the visit, and the path
+// and query of the visit are passed through when the link allows it; then its
+// UTM parameters, with the ones it leaves empty taken from its campaign, are
+// added to the query string. Parameters already in the destination are kept
+// unless the link overrides them. A nil visit, as in stats, leaves template
+// placeholders in place and passes nothing through.
+func (s *URLService) FinalURL(link *models.URL, visit *Visit) string {
+	var utm models.UTMParams
+	if link.UTM != nil {
+		utm = *link.UTM
+	}
+	if link.CampaignID != 0 {
+		campaign, err := s.storage.GetCampaign(link.CampaignID)
+		switch {
+		case err == nil:
+			utm = utm.Merge(campaign.UTM)
+		case err != storage.ErrCampaignNotFound:
+			log.Printf("campaign for %s: %v", link.ShortCode, err)
+		}
+	}
+	destination := link.Destination()
+	switch {
+	case visit == nil:
+	case s.goLinks && templateArity(destination) > 0:
+		destination = expandTemplate(destination, pathSegments(visit.Path))
+		if link.Passthrough {
+			destination = passThrough(destination, "", visit.Query)
+		}
+	case link.Passthrough:
+		destination = passThrough(destination, visit.Path, visit.Query)
+	}
+	return appendUTM(destination, utm, link.UTMOverride)
+}
+
+// appendUTM adds UTM parameters to the query string of destination, leaving
+// its other parameters and their order untouched. A parameter already present
+// is kept, or replaced when override is set.
+func appendUTM(destination string, utm models.UTMParams, override bool) string {
+	var params []string
+	for _, param := range utm.Params() {
+		params = append(params, param.Name+"="+url.QueryEscape(param.Value))
+	}
+	return mergeQuery(destination, params, override)
+}
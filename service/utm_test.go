@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestAppendUTM(t *testing.T) {
+	utm := models.UTMParams{Source: "mail", Campaign: "spring sale"}
+	tests := []struct {
+		name        string
+		destination string
+		override    bool
+		expected    string
+	}{
+		{"No query", "https://example.com/a", false, "https://example.com/a?utm_source=mail&utm_campaign=spring+sale"},
+		{"Existing query keeps its order", "https://example.com/a?b=2&a=1", false, "https://example.com/a?b=2&a=1&utm_source=mail&utm_campaign=spring+sale"},
+		{"Existing parameter wins", "https://example.com/a?utm_source=ads&x=1", false, "https://example.com/a?utm_source=ads&x=1&utm_campaign=spring+sale"},
+		{"Override replaces parameter", "https://example.com/a?utm_source=ads&x=1", true, "https://example.com/a?x=1&utm_source=mail&utm_campaign=spring+sale"},
+		{"Fragment stays last", "https://example.com/a#top", false, "https://example.com/a?utm_source=mail&utm_campaign=spring+sale#top"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := appendUTM(tt.destination, utm, tt.override); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if got := appendUTM("https://example.com/a?x=1", models.UTMParams{}, true); got != "https://example.com/a?x=1" {
+		t.Errorf("Expected the destination unchanged without UTM parameters, got %s", got)
+	}
+}
+
+func TestFinalURL(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	// UTM parameters are stripped from destinations by default
+	service := NewURLService(store, 6, WithNormalizer(NewNormalizer(nil, []string{"fbclid"})))
+
+	campaign, _ := service.CreateCampaign(&models.CampaignRequest{
+		Name: "Spring", UTM: models.UTMParams{Source: "newsletter", Medium: "email"},
+	})
+	url, err := service.Shorten(&models.ShortenRequest{
+		URL: "https://example.com/sale?utm_medium=social", CustomCode: "sale", CampaignID: campaign.ID,
+		UTM: &models.UTMParams{Campaign: " spring "},
+	}, "alice")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("Merge link and campaign parameters", func(t *testing.T) {
+		expected := "https://example.com/sale?utm_medium=social&utm_source=newsletter&utm_campaign=spring"
+		if got := service.FinalURL(url, nil); got != expected {
+			t.Errorf("Expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("Override and roll back", func(t *testing.T) {
+		override := true
+		updated, err := service.UpdateURL("sale", &models.UpdateRequest{UTMOverride: &override}, "bob")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := "https://example.com/sale?utm_source=newsletter&utm_medium=email&utm_campaign=spring"
+		if got := service.FinalURL(updated, nil); got != expected {
+			t.Errorf("Expected %s, got %s", expected, got)
+		}
+
+		restored, err := service.Rollback("sale", 1, "bob")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if restored.UTMOverride {
+			t.Error("Expected the override to be rolled back")
+		}
+	})
+
+	t.Run("Remove link parameters", func(t *testing.T) {
+		updated, err := service.UpdateURL("sale", &models.UpdateRequest{UTM: &models.UTMParams{}}, "bob")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if updated.UTM != nil {
+			t.Errorf("Expected no UTM parameters, got %v", updated.UTM)
+		}
+	})
+
+	t.Run("Reject long values", func(t *testing.T) {
+		utm := &models.UTMParams{Content: strings.Repeat("x", MaxUTMLength+1)}
+		if _, err := service.UpdateURL("sale", &models.UpdateRequest{UTM: utm}, "bob"); !errors.Is(err, ErrInvalidUTM) {
+			t.Errorf("Expected ErrInvalidUTM, got %v", err)
+		}
+	})
+}
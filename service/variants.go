@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"regexp"
+	"strings"
+	"url-shortener/models"
+)
+
+// Rotations decide which variant of a link a visit goes to
+const (
+	// RotationRandom picks a variant at random for every visit, weighted
+	RotationRandom = "random"
+	// RotationSticky sends each visitor to the same variant on every visit
+	RotationSticky = "sticky"
+)
+
+const (
+	MaxVariants      = 10
+	MaxVariantWeight = 1000
+
+	maxVariantNameLength = 32
+)
+
+var ErrInvalidVariants = errors.New("invalid variants")
+
+var variantName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// normalizeVariants validates the variants of a link and the rotation between
+// them. Variant destinations are normalized and checked like the link's own,
+// unnamed variants are named a, b, c and so on after their position, and the
+// rotation defaults to random. Links without variants have no rotation.
+func (s *URLService) normalizeVariants(variants []models.Variant, rotation string) ([]models.Variant, string, error) {
+	if len(variants) == 0 {
+		return nil, "", nil
+	}
+	if len(variants) > MaxVariants {
+		return nil, "", fmt.Errorf("%w: at most %d variants are allowed", ErrInvalidVariants, MaxVariants)
+	}
+
+	switch rotation {
+	case "":
+		rotation = RotationRandom
+	case RotationRandom, RotationSticky:
+	default:
+		return nil, "", fmt.Errorf("%w: rotation must be random or sticky", ErrInvalidVariants)
+	}
+
+	normalized := make([]models.Variant, len(variants))
+	seen := make(map[string]bool, len(variants))
+	for i, v := range variants {
+		name := strings.ToLower(strings.TrimSpace(v.Name))
+		if name == "" {
+			name = string(rune('a' + i))
+		}
+		if len(name) > maxVariantNameLength || !variantName.MatchString(name) {
+			return nil, "", fmt.Errorf("%w: name %q may only hold up to %d letters, digits, '-' and '_'", ErrInvalidVariants, v.Name, maxVariantNameLength)
+		}
+		if seen[name] {
+			return nil, "", fmt.Errorf("%w: name %q is used twice", ErrInvalidVariants, name)
+		}
+		seen[name] = true
+
+		if v.Weight < 0 || v.Weight > MaxVariantWeight {
+			return nil, "", fmt.Errorf("%w: weight of %q must be between 0 and %d", ErrInvalidVariants, name, MaxVariantWeight)
+		}
+
+		canonicalURL, err := s.canonicalDestination(v.URL)
+		if err != nil {
+			return nil, "", fmt.Errorf("variant %q: %w", name, err)
+		}
+
+		normalized[i] = models.Variant{Name: name, URL: v.URL, CanonicalURL: canonicalURL, Weight: v.Weight}
+	}
+	return normalized, rotation, nil
+}
+
+// chooseVariant picks the variant a visit by visitor goes to, or nil when
+// no variant has any weight and the link's own destination applies. Sticky
+// links keep sending a visitor to the same variant for as long as the
+// variants and their weights stay the same; visitors that cannot be told
+// apart are placed at random.
+func chooseVariant(link *models.URL, visitor string) *models.Variant {
+	total := 0
+	for _, v := range link.Variants {
+		total += v.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	var point int
+	if link.Rotation == RotationSticky && visitor != "" {
+		h := fnv.New64a()
+		h.Write([]byte(link.ShortCode + "\x00" + visitor))
+		point = int(h.Sum64() % uint64(total))
+	} else {
+		point = rand.Intn(total)
+	}
+
+	for i := range link.Variants {
+		point -= link.Variants[i].Weight
+		if point < 0 {
+			return &link.Variants[i]
+		}
+	}
+	return nil
+}
+
+// VariantStats returns the variants of a link with the clicks each received.
+// Clicks on variants that have since been removed are not reported.
+func (s *URLService) VariantStats(link *models.URL) ([]models.VariantStats, error) {
+	if len(link.Variants) == 0 {
+		return nil, nil
+	}
+
+	counts, err := s.storage.CountVariantClicks(link.ShortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]models.VariantStats, len(link.Variants))
+	for i, v := range link.Variants {
+		stats[i] = models.VariantStats{Variant: v, Clicks: counts[v.Name]}
+	}
+	return stats, nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"url-shortener/models"
+	"url-shortener/storage"
+)
+
+func TestNormalizeVariants(t *testing.T) {
+	service := NewURLService(storage.NewInMemoryStorage(), 6)
+
+	t.Run("Name and normalize variants", func(t *testing.T) {
+		url, err := service.Shorten(&models.ShortenRequest{
+			URL: "https://example.com",
+			Variants: []models.Variant{
+				{URL: "HTTPS://Example.com/a", Weight: 1},
+				{Name: " Blue ", URL: "https://example.com/b", Weight: 2},
+			},
+		}, "alice")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.Rotation != RotationRandom {
+			t.Errorf("Expected rotation %q, got %q", RotationRandom, url.Rotation)
+		}
+		if len(url.Variants) != 2 || url.Variants[0].Name != "a" || url.Variants[1].Name != "blue" {
+			t.Fatalf("Expected variants a and blue, got %v", url.Variants)
+		}
+		if url.Variants[0].CanonicalURL != "https://example.com/a" {
+			t.Errorf("Expected canonical URL https://example.com/a, got %s", url.Variants[0].CanonicalURL)
+		}
+	})
+
+	t.Run("Drop the rotation of links without variants", func(t *testing.T) {
+		url, err := service.Shorten(&models.ShortenRequest{URL: "https://example.com", Rotation: RotationSticky}, "alice")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.Rotation != "" {
+			t.Errorf("Expected no rotation, got %q", url.Rotation)
+		}
+	})
+
+	tooMany := make([]models.Variant, MaxVariants+1)
+	for i := range tooMany {
+		tooMany[i] = models.Variant{Name: fmt.Sprint("v", i), URL: "https://example.com", Weight: 1}
+	}
+	tests := []struct {
+		name     string
+		variants []models.Variant
+		rotation string
+	}{
+		{"Unknown rotation", []models.Variant{{URL: "https://example.com", Weight: 1}}, "round-robin"},
+		{"Duplicate name", []models.Variant{{Name: "a", URL: "https://example.com", Weight: 1}, {Name: "A", URL: "https://example.com", Weight: 1}}, ""},
+		{"Invalid name", []models.Variant{{Name: "a b", URL: "https://example.com", Weight: 1}}, ""},
+		{"Negative weight", []models.Variant{{URL: "https://example.com", Weight: -1}}, ""},
+		{"Weight too large", []models.Variant{{URL: "https://example.com", Weight: MaxVariantWeight + 1}}, ""},
+		{"Too many variants", tooMany, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.ShortenRequest{URL: "https://example.com", Variants: tt.variants, Rotation: tt.rotation}
+			if _, err := service.Shorten(req, "alice"); !errors.Is(err, ErrInvalidVariants) {
+				t.Errorf("Expected ErrInvalidVariants, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Reject invalid destinations", func(t *testing.T) {
+		req := &models.ShortenRequest{URL: "https://example.com", Variants: []models.Variant{{URL: "ftp://example.com", Weight: 1}}}
+		if _, err := service.Shorten(req, "alice"); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("Expected ErrInvalidURL, got %v", err)
+		}
+	})
+}
+
+func TestVariantRotation(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	service := NewURLService(store, 6)
+
+	variants := []models.Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: 3},
+		{Name: "b", URL: "https://example.com/b", Weight: 1},
+		{Name: "paused", URL: "https://example.com/paused", Weight: 0},
+	}
+	service.Shorten(&models.ShortenRequest{URL: "https://example.com", CustomCode: "split", Variants: variants}, "alice")
+
+	t.Run("Spread visits by weight", func(t *testing.T) {
+		counts := map[string]int{}
+		for i := 0; i < 400; i++ {
+			url, err := service.Resolve("split", Visit{})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			counts[url.OriginalURL]++
+		}
+		if counts["https://example.com/paused"] != 0 || counts["https://example.com"] != 0 {
+			t.Errorf("Expected only weighted variants to be visited, got %v", counts)
+		}
+		if a, b := counts["https://example.com/a"], counts["https://example.com/b"]; a < 2*b {
+			t.Errorf("Expected about three times as many visits to a as to b, got %d and %d", a, b)
+		}
+	})
+
+	t.Run("Report clicks per variant", func(t *testing.T) {
+		link, _ := service.GetStats("split")
+		stats, err := service.VariantStats(link)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(stats) != 3 {
+			t.Fatalf("Expected 3 variants, got %d", len(stats))
+		}
+		if stats[0].Clicks+stats[1].Clicks != 400 || stats[2].Clicks != 0 {
+			t.Errorf("Expected 400 clicks on a and b and none on paused, got %v", stats)
+		}
+	})
+
+	t.Run("Send a visitor to the same variant", func(t *testing.T) {
+		rotation := RotationSticky
+		if _, err := service.UpdateURL("split", &models.UpdateRequest{Rotation: &rotation}, "alice"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		destinations := map[string]bool{}
+		for i := 0; i < 20; i++ {
+			url, _ := service.Resolve("split", Visit{IP: "192.0.2.1", UserAgent: "test"})
+			destinations[url.OriginalURL] = true
+		}
+		if len(destinations) != 1 {
+			t.Errorf("Expected one destination for one visitor, got %v", destinations)
+		}
+
+		for i := 0; i < 50; i++ {
+			url, _ := service.Resolve("split", Visit{IP: fmt.Sprintf("192.0.2.%d", i), UserAgent: "test"})
+			destinations[url.OriginalURL] = true
+		}
+		if len(destinations) != 2 {
+			t.Errorf("Expected visitors to be spread over both variants, got %v", destinations)
+		}
+	})
+
+	t.Run("Fall back to the link destination", func(t *testing.T) {
+		paused := []models.Variant{{Name: "a", URL: "https://example.com/a", Weight: 0}}
+		if _, err := service.UpdateURL("split", &models.UpdateRequest{Variants: &paused}, "alice"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		url, err := service.Resolve("split", Visit{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if url.OriginalURL != "https://example.com" {
+			t.Errorf("Expected https://example.com, got %s", url.OriginalURL)
+		}
+	})
+}
@@ -8,5 +8,5 @@ echo ========================================
 echo.
 
 set USE_IN_MEMORY=true
-go run main.go
+go run -tags sqlite_fts5 .
 
@@ -7,5 +7,5 @@ echo "Using In-Memory Storage (No Database)"
 echo "========================================"
 echo ""
 
-USE_IN_MEMORY=true go run main.go
+USE_IN_MEMORY=true go run -tags sqlite_fts5 .
 
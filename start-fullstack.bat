@@ -29,7 +29,7 @@ echo Starting servers...
 echo.
 
 REM Start backend in new window
-start "URL Shortener - Backend" cmd /k "go run main.go"
+start "URL Shortener - Backend" cmd /k "go run -tags sqlite_fts5 ."
 
 REM Wait a bit for backend to start
 timeout /t 3 /nobreak >nul
@@ -23,7 +23,7 @@ echo ""
 # Start backend
 echo "📡 Starting Backend API on http://localhost:8080"
 cd "$(dirname "$0")"
-go run main.go &
+go run -tags sqlite_fts5 . &
 BACKEND_PID=$!
 
 # Wait for backend to start
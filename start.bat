@@ -15,7 +15,7 @@ if errorlevel 1 (
 
 REM Build the application
 echo Building application...
-go build -o bin\url-shortener.exe main.go
+go build -tags sqlite_fts5 -o bin\url-shortener.exe .
 if errorlevel 1 (
     echo Build failed!
     pause
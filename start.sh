@@ -13,7 +13,7 @@ fi
 
 # Build the application
 echo "Building application..."
-go build -o bin/url-shortener main.go
+go build -tags sqlite_fts5 -o bin/url-shortener .
 if [ $? -ne 0 ]; then
     echo "Build failed!"
     exit 1
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"testing"
+	"url-shortener/models"
+)
+
+func TestSaveBatch(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Save(&models.URL{ShortCode: "taken", OriginalURL: "https://example.com"})
+
+			batch := func(codes ...string) ([]*models.URL, []*models.URLRevision) {
+				urls := make([]*models.URL, len(codes))
+				revisions := make([]*models.URLRevision, len(codes))
+				for i, code := range codes {
+					urls[i] = &models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code}
+					revisions[i] = &models.URLRevision{Action: models.RevisionCreate, Actor: "tool", New: urls[i].State()}
+				}
+				return urls, revisions
+			}
+
+			t.Run("Items fail independently", func(t *testing.T) {
+				urls, revisions := batch("b1", "taken", "b2", "b1")
+				errs, err := store.SaveBatch(urls, revisions, false)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if errs[0] != nil || errs[2] != nil {
+					t.Errorf("Expected b1 and b2 to be saved, got %v", errs)
+				}
+				if errs[1] != ErrAlreadyExists || errs[3] != ErrAlreadyExists {
+					t.Errorf("Expected duplicates to fail, got %v", errs)
+				}
+				if urls[0].ID == 0 {
+					t.Error("Expected saved URL to get an ID")
+				}
+
+				stored, err := store.Get("b2")
+				if err != nil || stored.OriginalURL != "https://example.com/b2" {
+					t.Errorf("Expected b2 to be stored, got %v", err)
+				}
+				if revisions, _ := store.ListRevisions("b2"); len(revisions) != 1 || revisions[0].Actor != "tool" {
+					t.Errorf("Expected a create revision for b2, got %d", len(revisions))
+				}
+				if revisions, _ := store.ListRevisions("b1"); len(revisions) != 1 {
+					t.Errorf("Expected a single revision for b1, got %d", len(revisions))
+				}
+			})
+
+			t.Run("All or nothing", func(t *testing.T) {
+				urls, revisions := batch("a1", "a2", "taken")
+				errs, err := store.SaveBatch(urls, revisions, true)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if errs[2] != ErrAlreadyExists {
+					t.Errorf("Expected the duplicate to fail, got %v", errs)
+				}
+				for _, code := range []string{"a1", "a2"} {
+					if _, err := store.Get(code); err != ErrNotFound {
+						t.Errorf("Expected %s not to be saved, got %v", code, err)
+					}
+					if revisions, _ := store.ListRevisions(code); len(revisions) != 0 {
+						t.Errorf("Expected no revisions for %s, got %d", code, len(revisions))
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"url-shortener/models"
+)
+
+// campaignIndex holds the campaigns of the in-memory store and the links in
+// each one. Membership is kept up to date from reindex, like the tag index, so
+// link counts and campaign stats never scan the links.
+type campaignIndex struct {
+	mutex     sync.RWMutex
+	campaigns map[int64]*models.Campaign
+	links     map[int64]map[string]struct{}
+}
+
+func newCampaignIndex() *campaignIndex {
+	return &campaignIndex{
+		campaigns: make(map[int64]*models.Campaign),
+		links:     make(map[int64]map[string]struct{}),
+	}
+}
+
+// update moves a link between campaigns; either side may be nil. Both sides
+// are states of the same short code.
+func (x *campaignIndex) update(old, updated *models.URL) {
+	var before, after int64
+	if old != nil {
+		before = old.CampaignID
+	}
+	if updated != nil {
+		after = updated.CampaignID
+	}
+	if before == after {
+		return
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if before != 0 {
+		delete(x.links[before], old.ShortCode)
+		if len(x.links[before]) == 0 {
+			delete(x.links, before)
+		}
+	}
+	if after != 0 {
+		if x.links[after] == nil {
+			x.links[after] = make(map[string]struct{})
+		}
+		x.links[after][updated.ShortCode] = struct{}{}
+	}
+}
+
+func (x *campaignIndex) put(campaign *models.Campaign) {
+	c := *campaign
+	c.Links = 0
+
+	x.mutex.Lock()
+	x.campaigns[c.ID] = &c
+	x.mutex.Unlock()
+}
+
+func (x *campaignIndex) remove(id int64) {
+	x.mutex.Lock()
+	delete(x.campaigns, id)
+	x.mutex.Unlock()
+}
+
+// get returns a copy of a campaign with its link count
+func (x *campaignIndex) get(id int64) (*models.Campaign, bool) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	campaign, exists := x.campaigns[id]
+	if !exists {
+		return nil, false
+	}
+	c := *campaign
+	c.Links = int64(len(x.links[id]))
+	return &c, true
+}
+
+// list returns copies of every campaign, newest first
+func (x *campaignIndex) list() []*models.Campaign {
+	x.mutex.RLock()
+	campaigns := make([]*models.Campaign, 0, len(x.campaigns))
+	for id, campaign := range x.campaigns {
+		c := *campaign
+		c.Links = int64(len(x.links[id]))
+		campaigns = append(campaigns, &c)
+	}
+	x.mutex.RUnlock()
+
+	sort.Slice(campaigns, func(i, j int) bool { return campaigns[i].ID > campaigns[j].ID })
+	return campaigns
+}
+
+// members returns the short codes of the links in a campaign
+func (x *campaignIndex) members(id int64) []string {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	codes := make([]string, 0, len(x.links[id]))
+	for code := range x.links[id] {
+		codes = append(codes, code)
+	}
+	return codes
+}
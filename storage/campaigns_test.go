@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+func TestCampaigns(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, code := range []string{"launch", "docs", "promo"} {
+				if err := store.Save(&models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code}); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+
+			spring := &models.Campaign{Name: "Spring", UTM: models.UTMParams{Source: "newsletter", Medium: "email"}}
+			if err := store.SaveCampaign(spring); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			summer := &models.Campaign{Name: "Summer"}
+			if err := store.SaveCampaign(summer); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if spring.ID == 0 || summer.ID <= spring.ID {
+				t.Fatalf("Expected increasing campaign IDs, got %d and %d", spring.ID, summer.ID)
+			}
+
+			t.Run("Add links", func(t *testing.T) {
+				if err := store.SetCampaign([]string{"launch", "promo"}, spring.ID); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				campaign, err := store.GetCampaign(spring.ID)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if campaign.Links != 2 || campaign.UTM.Medium != "email" {
+					t.Errorf("Expected 2 links and the UTM parameters, got %+v", campaign)
+				}
+				url, _ := store.Get("launch")
+				if url.CampaignID != spring.ID {
+					t.Errorf("Expected link in campaign %d, got %d", spring.ID, url.CampaignID)
+				}
+			})
+
+			t.Run("Reject unknown links and campaigns without changes", func(t *testing.T) {
+				if err := store.SetCampaign([]string{"docs", "missing"}, summer.ID); err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound, got %v", err)
+				}
+				if err := store.SetCampaign([]string{"docs"}, 999); err != ErrCampaignNotFound {
+					t.Errorf("Expected ErrCampaignNotFound, got %v", err)
+				}
+				url, _ := store.Get("docs")
+				if url.CampaignID != 0 {
+					t.Errorf("Expected 'docs' outside any campaign, got %d", url.CampaignID)
+				}
+			})
+
+			t.Run("Keep membership across edits", func(t *testing.T) {
+				url, _ := store.Get("launch")
+				url.Notes = "edited"
+				url.CampaignID = 0
+				if err := store.Update(url); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				url, _ = store.Get("launch")
+				if url.CampaignID != spring.ID {
+					t.Errorf("Expected Update to leave the campaign alone, got %d", url.CampaignID)
+				}
+			})
+
+			t.Run("Filter the list by campaign", func(t *testing.T) {
+				page, err := store.Query(ListOptions{CampaignID: spring.ID, Sort: SortCreatedAt, Ascending: true})
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				codes := []string{}
+				for _, url := range page.URLs {
+					codes = append(codes, url.ShortCode)
+				}
+				if fmt.Sprint(codes) != "[launch promo]" {
+					t.Errorf("Expected [launch promo], got %v", codes)
+				}
+			})
+
+			t.Run("Scan clicks in range", func(t *testing.T) {
+				start := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+				clicks := []*models.Click{
+					{ShortCode: "launch", At: start, Referrer: "news.example.com", Visitor: "v1"},
+					{ShortCode: "promo", At: start.Add(time.Minute), Visitor: "v2"},
+					{ShortCode: "docs", At: start.Add(2 * time.Minute), Visitor: "v1"},
+					{ShortCode: "launch", At: start.Add(3 * time.Minute), Visitor: "v1"},
+				}
+				for _, click := range clicks {
+					if err := store.RecordClick(click); err != nil {
+						t.Fatalf("Expected no error, got %v", err)
+					}
+				}
+				if err := store.RecordClick(&models.Click{ShortCode: "missing", At: start}); err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound, got %v", err)
+				}
+
+				var scanned []string
+				err := store.ScanCampaignClicks(spring.ID, start, start.Add(3*time.Minute), func(click models.Click) error {
+					scanned = append(scanned, click.ShortCode+"/"+click.Referrer+"/"+click.Visitor)
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if fmt.Sprint(scanned) != "[launch/news.example.com/v1 promo//v2]" {
+					t.Errorf("Expected the two campaign clicks before the end, got %v", scanned)
+				}
+
+				url, _ := store.Get("launch")
+				if url.Clicks != 2 {
+					t.Errorf("Expected the click counter to include events, got %d", url.Clicks)
+				}
+
+				stop := errors.New("stop")
+				err = store.ScanCampaignClicks(spring.ID, start, start.Add(time.Hour), func(models.Click) error { return stop })
+				if err != stop {
+					t.Errorf("Expected the callback error, got %v", err)
+				}
+				if err := store.ScanCampaignClicks(999, start, start.Add(time.Hour), func(models.Click) error { return nil }); err != ErrCampaignNotFound {
+					t.Errorf("Expected ErrCampaignNotFound, got %v", err)
+				}
+			})
+
+			t.Run("Update and list campaigns", func(t *testing.T) {
+				spring.Name = "Spring launch"
+				spring.UTM = models.UTMParams{Source: "social"}
+				if err := store.UpdateCampaign(spring); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if err := store.UpdateCampaign(&models.Campaign{ID: 999, Name: "x"}); err != ErrCampaignNotFound {
+					t.Errorf("Expected ErrCampaignNotFound, got %v", err)
+				}
+
+				campaigns, err := store.ListCampaigns()
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if len(campaigns) != 2 || campaigns[0].Name != "Summer" || campaigns[1].Name != "Spring launch" {
+					t.Fatalf("Expected newest campaign first, got %+v", campaigns)
+				}
+				if campaigns[1].UTM != (models.UTMParams{Source: "social"}) || campaigns[1].Links != 2 {
+					t.Errorf("Expected updated UTM parameters and 2 links, got %+v", campaigns[1])
+				}
+			})
+
+			t.Run("Delete campaign detaches its links", func(t *testing.T) {
+				if err := store.DeleteCampaign(spring.ID); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if _, err := store.GetCampaign(spring.ID); err != ErrCampaignNotFound {
+					t.Errorf("Expected ErrCampaignNotFound, got %v", err)
+				}
+				if err := store.DeleteCampaign(spring.ID); err != ErrCampaignNotFound {
+					t.Errorf("Expected ErrCampaignNotFound, got %v", err)
+				}
+				url, _ := store.Get("promo")
+				if url.CampaignID != 0 {
+					t.Errorf("Expected 'promo' outside any campaign, got %d", url.CampaignID)
+				}
+			})
+		})
+	}
+}
+
+func TestClickEvents(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Save(&models.URL{ShortCode: "promo", OriginalURL: "https://example.com"})
+			at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+			store.RecordClick(&models.Click{ShortCode: "promo", At: at, Referrer: "news.example", Variant: "a"})
+
+			t.Run("Save clicks without counting them", func(t *testing.T) {
+				copied := []models.Click{
+					{At: at.Add(time.Minute), Visitor: "v1"},
+					{At: at.Add(-time.Hour), Referrer: "mail.example", Variant: "b"},
+				}
+				if err := store.SaveClicks("promo", copied); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if url, _ := store.Get("promo"); url.Clicks != 1 {
+					t.Errorf("Expected the counter to stay at 1, got %d", url.Clicks)
+				}
+				if err := store.SaveClicks("missing", copied); err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound, got %v", err)
+				}
+			})
+
+			t.Run("Scan clicks in recording order", func(t *testing.T) {
+				var clicks []models.Click
+				err := store.ScanClicks("promo", func(click models.Click) error {
+					clicks = append(clicks, click)
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if len(clicks) != 3 {
+					t.Fatalf("Expected 3 clicks, got %d", len(clicks))
+				}
+				if clicks[0].Referrer != "news.example" || clicks[0].Variant != "a" || clicks[1].Visitor != "v1" || clicks[2].Variant != "b" {
+					t.Errorf("Expected clicks in recording order, got %+v", clicks)
+				}
+				if clicks[2].ShortCode != "promo" || !clicks[2].At.Equal(at.Add(-time.Hour)) {
+					t.Errorf("Expected promo at %v, got %s at %v", at.Add(-time.Hour), clicks[2].ShortCode, clicks[2].At)
+				}
+			})
+		})
+	}
+}
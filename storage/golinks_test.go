@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"testing"
+	"url-shortener/models"
+)
+
+func TestGetLongestPrefix(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, code := range []string{"team", "team/oncall", "team/oncall/old", "jira"} {
+				if err := store.Save(&models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code}); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+
+			tests := []struct {
+				path     string
+				expected string
+			}{
+				{"team", "team"},
+				{"team/oncall", "team/oncall"},
+				{"team/oncall/today", "team/oncall"},
+				{"team/oncall/old/x", "team/oncall/old"},
+				{"team/docs", "team"},
+				{"jira/PROJ-12", "jira"},
+			}
+			for _, tt := range tests {
+				url, err := store.GetLongestPrefix(tt.path)
+				if err != nil {
+					t.Fatalf("Expected no error for %s, got %v", tt.path, err)
+				}
+				if url.ShortCode != tt.expected {
+					t.Errorf("Expected %s for %s, got %s", tt.expected, tt.path, url.ShortCode)
+				}
+			}
+
+			// Prefixes end at a slash, never inside a segment
+			for _, path := range []string{"teams", "te", "jirax/1", "other/team"} {
+				if _, err := store.GetLongestPrefix(path); err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound for %s, got %v", path, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,647 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/models"
+)
+
+// Fsync policies for the durable in-memory store's operation log
+const (
+	FsyncAlways   = "always"
+	FsyncPeriodic = "interval"
+	FsyncNever    = "never"
+)
+
+var (
+	ErrInvalidFsyncPolicy = errors.New("invalid fsync policy")
+	ErrCorruptLog         = errors.New("operation log is corrupt")
+)
+
+// DurabilityOptions configures NewDurableInMemoryStorage
+type DurabilityOptions struct {
+	// Fsync is one of FsyncAlways, FsyncPeriodic or FsyncNever
+	Fsync string
+	// FsyncEvery is how often the log is flushed to disk under FsyncPeriodic
+	FsyncEvery time.Duration
+	// SnapshotEvery is how often the log is compacted into a snapshot; 0 disables
+	// periodic snapshots, one is still written on Close
+	SnapshotEvery time.Duration
+}
+
+// DefaultDurabilityOptions returns the options used when none are configured
+func DefaultDurabilityOptions() DurabilityOptions {
+	return DurabilityOptions{
+		Fsync:         FsyncPeriodic,
+		FsyncEvery:    time.Second,
+		SnapshotEvery: 5 * time.Minute,
+	}
+}
+
+// Log operations. Each record holds one or more entries that are applied together.
+const (
+	opPut      = "put"
+	opClick    = "click"
+	opDelete   = "delete"
+	opRevision = "revision"
+	opCounters = "counters"
+	// opClicks restores the click events of a link from a snapshot or another
+	// store without counting them again
+	opClicks         = "clicks"
+	opCampaign       = "campaign"
+	opDeleteCampaign = "delete_campaign"
+)
+
+// logEntry is a single change to the in-memory maps
+type logEntry struct {
+	Op         string              `json:"op"`
+	URL        *models.URL         `json:"url,omitempty"`
+	Code       string              `json:"code,omitempty"`
+	At         *time.Time          `json:"at,omitempty"`
+	Revision   *models.URLRevision `json:"revision,omitempty"`
+	RevisionID int64               `json:"revision_id,omitempty"`
+	IDCounter  int64               `json:"id_counter,omitempty"`
+	RevCounter int64               `json:"rev_counter,omitempty"`
+	Click      *models.Click       `json:"click,omitempty"`
+	Clicks     []models.Click      `json:"clicks,omitempty"`
+	Campaign   *models.Campaign    `json:"campaign,omitempty"`
+	CampaignID int64               `json:"campaign_id,omitempty"`
+
+	CampaignCounter int64 `json:"campaign_counter,omitempty"`
+}
+
+func putEntry(url *models.URL) logEntry {
+	return logEntry{Op: opPut, URL: copyURL(url)}
+}
+
+func campaignEntry(campaign *models.Campaign) logEntry {
+	c := *campaign
+	return logEntry{Op: opCampaign, Campaign: &c}
+}
+
+// revisionEntry carries the ID separately since URLRevision does not serialize it
+func revisionEntry(revision *models.URLRevision) logEntry {
+	c := *revision
+	return logEntry{Op: opRevision, Revision: &c, RevisionID: revision.ID}
+}
+
+// commit logs entries as one record, if the store is durable, and then applies
+// them. Nothing is applied when the log write fails. The caller holds the shard
+// lock of every code involved, and campaignWrites for campaign changes, so
+// changes to one code or campaign reach the log in order.
+func (s *InMemoryStorage) commit(entries ...logEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if s.journal != nil {
+		if err := s.journal.append(entries); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		s.apply(entry)
+	}
+	return nil
+}
+
+// apply changes the maps and indexes; it is shared by live writes and log
+// replay. The caller holds the shard lock of every code involved.
+func (s *InMemoryStorage) apply(entry logEntry) {
+	switch entry.Op {
+	case opPut:
+		sh := s.shard(entry.URL.ShortCode)
+		updated := copyURL(entry.URL)
+		s.reindex(sh.urls[updated.ShortCode], updated)
+		sh.urls[updated.ShortCode] = updated
+		raise(&s.idCounter, updated.ID)
+
+	case opClick:
+		sh := s.shard(entry.Code)
+		if url, exists := sh.urls[entry.Code]; exists {
+			// Logs written before click events were kept only carry the time
+			if entry.Click == nil {
+				click(url, *entry.At)
+				break
+			}
+			click(url, entry.Click.At)
+			sh.clicks[entry.Code] = append(sh.clicks[entry.Code], *entry.Click)
+		}
+
+	case opClicks:
+		sh := s.shard(entry.Code)
+		sh.clicks[entry.Code] = append(sh.clicks[entry.Code], entry.Clicks...)
+
+	case opDelete:
+		sh := s.shard(entry.Code)
+		if url, exists := sh.urls[entry.Code]; exists {
+			s.reindex(url, nil)
+		}
+		delete(sh.urls, entry.Code)
+		delete(sh.revisions, entry.Code)
+		delete(sh.clicks, entry.Code)
+
+	case opRevision:
+		stored := *entry.Revision
+		stored.ID = entry.RevisionID
+		sh := s.shard(stored.ShortCode)
+		sh.revisions[stored.ShortCode] = append(sh.revisions[stored.ShortCode], &stored)
+		raise(&s.revCounter, stored.ID)
+
+	case opCounters:
+		raise(&s.idCounter, entry.IDCounter)
+		raise(&s.revCounter, entry.RevCounter)
+		raise(&s.campaignCounter, entry.CampaignCounter)
+
+	case opCampaign:
+		s.campaigns.put(entry.Campaign)
+		raise(&s.campaignCounter, entry.Campaign.ID)
+
+	case opDeleteCampaign:
+		s.campaigns.remove(entry.CampaignID)
+	}
+}
+
+// journal is the append-only operation log of a durable in-memory store.
+// Logs are numbered by generation; a snapshot of generation N replaces every
+// log before N, so recovery loads the newest snapshot and replays the logs from N on.
+type journal struct {
+	dir        string
+	options    DurabilityOptions
+	mutex      sync.Mutex
+	file       *os.File
+	generation int64
+	dirty      bool
+
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+const (
+	logPrefix      = "oplog-"
+	snapshotPrefix = "snapshot-"
+	fileSuffix     = ".log"
+	snapshotSuffix = ".snap"
+
+	// recordHeader is the length and CRC32 of the payload
+	recordHeader = 8
+	// maxRecordSize guards recovery against allocating for a garbage length
+	maxRecordSize = 64 << 20
+)
+
+func logName(generation int64) string {
+	return fmt.Sprintf("%s%020d%s", logPrefix, generation, fileSuffix)
+}
+
+func snapshotName(generation int64) string {
+	return fmt.Sprintf("%s%020d%s", snapshotPrefix, generation, snapshotSuffix)
+}
+
+// NewDurableInMemoryStorage returns an in-memory store whose changes survive
+// restarts. Every change is appended to an operation log in dir before it is
+// applied, and the log is periodically compacted into a snapshot. On startup
+// the newest snapshot is loaded and the logs written after it are replayed;
+// a torn record at the end of the last log (from a crash mid-write) is dropped.
+// Reads are served from the maps exactly as in NewInMemoryStorage.
+func NewDurableInMemoryStorage(dir string, options DurabilityOptions) (*InMemoryStorage, error) {
+	switch options.Fsync {
+	case FsyncAlways, FsyncNever:
+	case FsyncPeriodic:
+		if options.FsyncEvery <= 0 {
+			options.FsyncEvery = DefaultDurabilityOptions().FsyncEvery
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidFsyncPolicy, options.Fsync)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := NewInMemoryStorage()
+	generation, err := s.recover(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journal{dir: dir, options: options, generation: generation, done: make(chan struct{})}
+	if j.file, err = openLog(dir, generation); err != nil {
+		return nil, err
+	}
+	s.journal = j
+
+	if options.Fsync == FsyncPeriodic {
+		j.every(options.FsyncEvery, func() {
+			if err := j.sync(); err != nil {
+				log.Printf("Failed to sync operation log: %v", err)
+			}
+		})
+	}
+	if options.SnapshotEvery > 0 {
+		j.every(options.SnapshotEvery, func() {
+			if err := s.Snapshot(); err != nil {
+				log.Printf("Failed to snapshot in-memory store: %v", err)
+			}
+		})
+	}
+
+	return s, nil
+}
+
+// recover loads the newest snapshot and replays the logs after it, returning
+// the generation new writes should go to
+func (s *InMemoryStorage) recover(dir string) (int64, error) {
+	snapshots, logs, err := listGenerations(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var base int64 = 1
+	if len(snapshots) > 0 {
+		base = snapshots[len(snapshots)-1]
+		if _, err := s.replay(filepath.Join(dir, snapshotName(base)), false); err != nil {
+			return 0, fmt.Errorf("loading snapshot: %w", err)
+		}
+	}
+
+	generation := base
+	for i, g := range logs {
+		if g < base {
+			continue
+		}
+		last := i == len(logs)-1
+		if _, err := s.replay(filepath.Join(dir, logName(g)), last); err != nil {
+			return 0, fmt.Errorf("replaying %s: %w", logName(g), err)
+		}
+		generation = g
+	}
+
+	removeBefore(dir, base, snapshots, logs)
+	return generation, nil
+}
+
+// replay applies every record in path. When tolerateTail is set a truncated or
+// corrupt final record is cut off instead of failing recovery.
+func (s *InMemoryStorage) replay(path string, tolerateTail bool) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	records := 0
+	for {
+		entries, size, err := readRecord(reader)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			if !tolerateTail {
+				return records, err
+			}
+			log.Printf("Dropping torn record at offset %d of %s: %v", offset, filepath.Base(path), err)
+			return records, os.Truncate(path, offset)
+		}
+
+		for _, entry := range entries {
+			s.apply(entry)
+		}
+		offset += size
+		records++
+	}
+}
+
+func readRecord(reader io.Reader) ([]logEntry, int64, error) {
+	var header [recordHeader]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("%w: short header", ErrCorruptLog)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length > maxRecordSize {
+		return nil, 0, fmt.Errorf("%w: record length %d", ErrCorruptLog, length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, 0, fmt.Errorf("%w: short record", ErrCorruptLog)
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, 0, fmt.Errorf("%w: checksum mismatch", ErrCorruptLog)
+	}
+
+	var entries []logEntry
+	if err := json.Unmarshal(payload, &entries); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrCorruptLog, err)
+	}
+	return entries, int64(recordHeader + length), nil
+}
+
+func encodeRecord(entries []logEntry) ([]byte, error) {
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, recordHeader+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeader:], payload)
+	return record, nil
+}
+
+// append writes one record in a single write call so a crash leaves at most
+// one torn record at the end of the log
+func (j *journal) append(entries []logEntry) error {
+	record, err := encodeRecord(entries)
+	if err != nil {
+		return err
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		return os.ErrClosed
+	}
+	if _, err := j.file.Write(record); err != nil {
+		return err
+	}
+	if j.options.Fsync == FsyncAlways {
+		return j.file.Sync()
+	}
+	j.dirty = true
+	return nil
+}
+
+func (j *journal) sync() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil || !j.dirty {
+		return nil
+	}
+	j.dirty = false
+	return j.file.Sync()
+}
+
+// rotate syncs and closes the current log and starts the next generation
+func (j *journal) rotate() (int64, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	file, err := openLog(j.dir, j.generation+1)
+	if err != nil {
+		return 0, err
+	}
+	if err := j.file.Sync(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	j.file.Close()
+
+	j.file = file
+	j.generation++
+	j.dirty = false
+	return j.generation, nil
+}
+
+// every runs fn on a ticker until the journal is closed
+func (j *journal) every(interval time.Duration, fn func()) {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-j.done:
+				return
+			}
+		}
+	}()
+}
+
+// Snapshot compacts the operation log: it starts a new log generation and
+// writes the current state as the snapshot for that generation, after which
+// the older logs and snapshots are removed. It is a no-op for stores
+// without durability.
+func (s *InMemoryStorage) Snapshot() error {
+	if s.journal == nil {
+		return nil
+	}
+
+	// Rotating with every shard and campaign write locked makes the copied
+	// state match the log boundary
+	unlockShards := s.lockAll()
+	s.campaignWrites.Lock()
+	unlock := func() {
+		s.campaignWrites.Unlock()
+		unlockShards()
+	}
+	generation, err := s.journal.rotate()
+	if err != nil {
+		unlock()
+		return err
+	}
+	entries := s.snapshotEntries()
+	unlock()
+
+	dir := s.journal.dir
+	if err := writeSnapshot(dir, generation, entries); err != nil {
+		return err
+	}
+
+	snapshots, logs, err := listGenerations(dir)
+	if err != nil {
+		return err
+	}
+	removeBefore(dir, generation, snapshots, logs)
+	return nil
+}
+
+// snapshotClicks is the number of click events per snapshot entry
+const snapshotClicks = 1000
+
+// snapshotEntries describes the whole store as log entries; the caller holds every shard lock
+func (s *InMemoryStorage) snapshotEntries() []logEntry {
+	entries := []logEntry{{
+		Op:              opCounters,
+		IDCounter:       s.idCounter.Load(),
+		RevCounter:      s.revCounter.Load(),
+		CampaignCounter: s.campaignCounter.Load(),
+	}}
+
+	for _, campaign := range s.campaigns.list() {
+		entries = append(entries, campaignEntry(campaign))
+	}
+
+	for _, url := range s.sortedURLs() {
+		entries = append(entries, putEntry(url))
+		sh := s.shard(url.ShortCode)
+		for _, revision := range sh.revisions[url.ShortCode] {
+			entries = append(entries, revisionEntry(revision))
+		}
+		// Click events are chunked to keep snapshot records small
+		clicks := sh.clicks[url.ShortCode]
+		for start := 0; start < len(clicks); start += snapshotClicks {
+			chunk := clicks[start:min(start+snapshotClicks, len(clicks))]
+			entries = append(entries, logEntry{Op: opClicks, Code: url.ShortCode, Clicks: append([]models.Click(nil), chunk...)})
+		}
+	}
+	return entries
+}
+
+// writeSnapshot writes entries in batches to a temporary file and renames it
+// into place once it is on disk
+func writeSnapshot(dir string, generation int64, entries []logEntry) error {
+	path := filepath.Join(dir, snapshotName(generation))
+	tmp := path + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	writer := bufio.NewWriter(file)
+	const batch = 500
+	for start := 0; start < len(entries); start += batch {
+		record, err := encodeRecord(entries[start:min(start+batch, len(entries))])
+		if err == nil {
+			_, err = writer.Write(record)
+		}
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// closeJournal stops the background jobs, writes a final snapshot and closes the log
+func (s *InMemoryStorage) closeJournal() error {
+	j := s.journal
+	var err error
+	j.stopOnce.Do(func() {
+		close(j.done)
+		j.wg.Wait()
+
+		err = s.Snapshot()
+
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+		if syncErr := j.file.Sync(); err == nil {
+			err = syncErr
+		}
+		if closeErr := j.file.Close(); err == nil {
+			err = closeErr
+		}
+		j.file = nil
+	})
+	return err
+}
+
+func openLog(dir string, generation int64) (*os.File, error) {
+	file, err := os.OpenFile(filepath.Join(dir, logName(generation)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncDir(dir); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// syncDir makes created and renamed files in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// listGenerations returns the snapshot and log generations in dir, in ascending order
+func listGenerations(dir string) ([]int64, []int64, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var snapshots, logs []int64
+	for _, file := range files {
+		name := file.Name()
+		switch {
+		case strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix):
+			if g, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix), 10, 64); err == nil {
+				snapshots = append(snapshots, g)
+			}
+		case strings.HasPrefix(name, logPrefix) && strings.HasSuffix(name, fileSuffix):
+			if g, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, logPrefix), fileSuffix), 10, 64); err == nil {
+				logs = append(logs, g)
+			}
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i] < snapshots[j] })
+	sort.Slice(logs, func(i, j int) bool { return logs[i] < logs[j] })
+	return snapshots, logs, nil
+}
+
+// removeBefore deletes snapshots and logs made obsolete by the snapshot of generation
+func removeBefore(dir string, generation int64, snapshots, logs []int64) {
+	for _, g := range snapshots {
+		if g < generation {
+			os.Remove(filepath.Join(dir, snapshotName(g)))
+		}
+	}
+	for _, g := range logs {
+		if g < generation {
+			os.Remove(filepath.Join(dir, logName(g)))
+		}
+	}
+}
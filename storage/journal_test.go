@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+// seedDurable writes a mix of every logged operation
+func seedDurable(t *testing.T, store *InMemoryStorage) {
+	t.Helper()
+	for _, code := range []string{"a", "b", "c"} {
+		url := &models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code}
+		if err := store.Save(url); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		store.AddRevision(&models.URLRevision{ShortCode: code, Action: models.RevisionCreate, CreatedAt: time.Now(), New: url.State()})
+	}
+
+	edited, _ := store.Get("a")
+	edited.Notes = "edited"
+	store.UpdateWithRevision(edited, &models.URLRevision{ShortCode: "a", Action: models.RevisionUpdate, CreatedAt: time.Now(), New: edited.State()})
+	store.SaveCampaign(&models.Campaign{Name: "Launch", UTM: models.UTMParams{Source: "newsletter"}})
+	store.SetCampaign([]string{"a"}, 1)
+	store.RecordClick(&models.Click{ShortCode: "a", At: time.Now(), Referrer: "news.example.com", Visitor: "v1"})
+	store.RecordClick(&models.Click{ShortCode: "a", At: time.Now()})
+	store.SavePreview("b", &models.LinkPreview{Title: "B"})
+	store.SoftDelete("c", time.Now())
+	store.Delete("b")
+}
+
+func checkRecovered(t *testing.T, store *InMemoryStorage) {
+	t.Helper()
+
+	a, err := store.Get("a")
+	if err != nil {
+		t.Fatalf("Expected 'a' to be recovered, got %v", err)
+	}
+	if a.Clicks != 2 || a.LastAccessed == nil || a.Notes != "edited" {
+		t.Errorf("Expected edited link with 2 clicks, got %+v", a)
+	}
+	revisions, _ := store.ListRevisions("a")
+	if len(revisions) != 2 || revisions[1].Revision != 2 || revisions[1].Action != models.RevisionUpdate {
+		t.Errorf("Expected 2 revisions for 'a', got %d", len(revisions))
+	}
+
+	campaign, err := store.GetCampaign(1)
+	if err != nil || campaign.UTM.Source != "newsletter" || campaign.Links != 1 {
+		t.Errorf("Expected campaign with 1 link, got %+v %v", campaign, err)
+	}
+	var clicks []models.Click
+	store.ScanCampaignClicks(1, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(click models.Click) error {
+		clicks = append(clicks, click)
+		return nil
+	})
+	if len(clicks) != 2 || clicks[0].Referrer != "news.example.com" || clicks[0].Visitor != "v1" {
+		t.Errorf("Expected 2 click events for 'a', got %+v", clicks)
+	}
+
+	if _, err := store.Get("b"); err != ErrNotFound {
+		t.Errorf("Expected 'b' to stay deleted, got %v", err)
+	}
+	if c, err := store.Get("c"); err != nil || c.DeletedAt == nil {
+		t.Errorf("Expected 'c' in the trash, got %v %v", c, err)
+	}
+
+	// Counters continue instead of reusing IDs
+	d := &models.URL{ShortCode: "d", OriginalURL: "https://example.com/d"}
+	store.Save(d)
+	if d.ID != 4 {
+		t.Errorf("Expected next ID 4, got %d", d.ID)
+	}
+	revision := &models.URLRevision{ShortCode: "d", Action: models.RevisionCreate, CreatedAt: time.Now(), New: d.State()}
+	store.AddRevision(revision)
+	if revision.ID != 5 {
+		t.Errorf("Expected next revision ID 5, got %d", revision.ID)
+	}
+}
+
+func TestDurableMemory(t *testing.T) {
+	t.Run("Recover after clean shutdown", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newDurableForTest(t, dir)
+		seedDurable(t, store)
+		if err := store.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		checkRecovered(t, newDurableForTest(t, dir))
+	})
+
+	t.Run("Recover from the log after a crash", func(t *testing.T) {
+		dir := t.TempDir()
+		// The first store is never closed, as if the process died
+		seedDurable(t, newDurableForTest(t, dir))
+
+		checkRecovered(t, newDurableForTest(t, dir))
+	})
+
+	t.Run("Replay the log written after a snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newDurableForTest(t, dir)
+		store.Save(&models.URL{ShortCode: "a", OriginalURL: "https://example.com/a"})
+		if err := store.Snapshot(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		store.RecordClick(&models.Click{ShortCode: "a", At: time.Now()})
+
+		snapshots, logs, _ := listGenerations(dir)
+		if len(snapshots) != 1 || len(logs) != 1 || snapshots[0] != logs[0] {
+			t.Errorf("Expected old generations to be removed, got snapshots %v logs %v", snapshots, logs)
+		}
+
+		recovered := newDurableForTest(t, dir)
+		if a, err := recovered.Get("a"); err != nil || a.Clicks != 1 {
+			t.Errorf("Expected snapshot plus 1 replayed click, got %v %v", a, err)
+		}
+	})
+
+	t.Run("Drop a torn record at the end of the log", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newDurableForTest(t, dir)
+		store.Save(&models.URL{ShortCode: "a", OriginalURL: "https://example.com/a"})
+		store.Save(&models.URL{ShortCode: "b", OriginalURL: "https://example.com/b"})
+
+		_, logs, _ := listGenerations(dir)
+		path := filepath.Join(dir, logName(logs[len(logs)-1]))
+		info, _ := os.Stat(path)
+		if err := os.Truncate(path, info.Size()-5); err != nil {
+			t.Fatalf("Failed to truncate log: %v", err)
+		}
+
+		recovered := newDurableForTest(t, dir)
+		if _, err := recovered.Get("a"); err != nil {
+			t.Errorf("Expected complete record to be replayed, got %v", err)
+		}
+		if _, err := recovered.Get("b"); err != ErrNotFound {
+			t.Errorf("Expected torn record to be dropped, got %v", err)
+		}
+
+		// New writes land after the truncated tail and survive another restart
+		recovered.Save(&models.URL{ShortCode: "c", OriginalURL: "https://example.com/c"})
+		if _, err := newDurableForTest(t, dir).Get("c"); err != nil {
+			t.Errorf("Expected write after recovery to survive, got %v", err)
+		}
+	})
+
+	t.Run("Fail on corruption before the last log", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newDurableForTest(t, dir)
+		store.Save(&models.URL{ShortCode: "a", OriginalURL: "https://example.com/a"})
+		store.journal.rotate()
+		store.Save(&models.URL{ShortCode: "b", OriginalURL: "https://example.com/b"})
+
+		_, logs, _ := listGenerations(dir)
+		path := filepath.Join(dir, logName(logs[0]))
+		data, _ := os.ReadFile(path)
+		data[len(data)-2] ^= 0xff
+		os.WriteFile(path, data, 0o644)
+
+		if _, err := NewDurableInMemoryStorage(dir, DurabilityOptions{Fsync: FsyncNever}); err == nil {
+			t.Error("Expected recovery to fail on a corrupt earlier log")
+		}
+	})
+
+	t.Run("Reject unknown fsync policy", func(t *testing.T) {
+		if _, err := NewDurableInMemoryStorage(t.TempDir(), DurabilityOptions{Fsync: "sometimes"}); err == nil {
+			t.Error("Expected an error for an unknown fsync policy")
+		}
+	})
+}
@@ -1,101 +1,789 @@
 package storage
 
 import (
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 	"url-shortener/models"
+	"url-shortener/search"
 )
 
-// InMemoryStorage implements Storage interface using a map
+// shardCount is the number of independently locked partitions; a power of two
+const shardCount = 32
+
+// InMemoryStorage implements Storage interface using maps.
+// URLs are copied on the way in and out so callers never share state with the store.
+//
+// Links are spread over shards by a hash of their short code, each with its own
+// lock, so redirects and clicks on different codes never wait for each other.
+// Listing is served from ordered indexes kept alongside the shards, which makes
+// pages stable and costs O(log n + limit) instead of a scan of every link,
+// Search from an inverted index of the searchable text, ListTags from a map
+// of tags to links and campaign lookups from a map of campaigns to links.
+//
+// Every change goes through commit, which applies it to the maps and, for
+// stores opened with NewDurableInMemoryStorage, appends it to a log first.
 type InMemoryStorage struct {
-	urls      map[string]*models.URL
+	shards     [shardCount]shard
+	index      linkIndex
+	text       *textIndex
+	tags       *tagIndex
+	campaigns  *campaignIndex
+	idCounter  atomic.Int64
+	revCounter atomic.Int64
+
+	campaignCounter atomic.Int64
+	// campaignWrites orders campaign changes in the log; lock order is shard first
+	campaignWrites sync.Mutex
+
+	journal *journal
+}
+
+// shard holds the links and revisions of the codes hashing to it
+type shard struct {
 	mutex     sync.RWMutex
-	idCounter int64
+	urls      map[string]*models.URL
+	revisions map[string][]*models.URLRevision
+	// clicks holds the click events of each link, oldest first
+	clicks map[string][]models.Click
+	// pad to a cache line so neighbouring shard locks do not contend on multi-core machines
+	_ [24]byte
+}
+
+// linkIndex orders links for the List methods. Entries only change when a
+// link is created, deleted, moved to or from the trash, or re-dated, so clicks
+// and edits never touch it. Lock order is shard before index.
+type linkIndex struct {
+	mutex sync.RWMutex
+	// recent holds live links, newest first, for List
+	recent *skiplist[indexKey]
+	// byID holds every link in ID order for ListAfterID
+	byID *skiplist[indexKey]
+	// trash holds deleted links, most recently deleted first, for ListDeleted
+	trash *skiplist[indexKey]
+}
+
+type indexKey struct {
+	at   time.Time
+	id   int64
+	code string
+	// deleted marks trashed links in byID so ListAfterID can skip them
+	deleted bool
+}
+
+// newerFirst orders by time descending, breaking ties by descending ID
+func newerFirst(a, b indexKey) bool {
+	if !a.at.Equal(b.at) {
+		return a.at.After(b.at)
+	}
+	return a.id > b.id
+}
+
+func lowerID(a, b indexKey) bool {
+	return a.id < b.id
 }
 
 func NewInMemoryStorage() *InMemoryStorage {
-	return &InMemoryStorage{
-		urls:      make(map[string]*models.URL),
-		idCounter: 0,
+	s := &InMemoryStorage{
+		index: linkIndex{
+			recent: newSkiplist(newerFirst),
+			byID:   newSkiplist(lowerID),
+			trash:  newSkiplist(newerFirst),
+		},
+		text:      newTextIndex(),
+		tags:      newTagIndex(),
+		campaigns: newCampaignIndex(),
+	}
+	for i := range s.shards {
+		s.shards[i].urls = make(map[string]*models.URL)
+		s.shards[i].revisions = make(map[string][]*models.URLRevision)
+		s.shards[i].clicks = make(map[string][]models.Click)
+	}
+	return s
+}
+
+// shardIndex hashes shortCode with FNV-1a, inlined to keep redirects allocation free
+func shardIndex(shortCode string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(shortCode); i++ {
+		h ^= uint32(shortCode[i])
+		h *= 16777619
+	}
+	return int(h & (shardCount - 1))
+}
+
+func (s *InMemoryStorage) shard(shortCode string) *shard {
+	return &s.shards[shardIndex(shortCode)]
+}
+
+// lockShards write-locks the shards of codes in index order and returns the unlock func
+func (s *InMemoryStorage) lockShards(codes []string) func() {
+	var locked [shardCount]bool
+	for _, code := range codes {
+		locked[shardIndex(code)] = true
+	}
+	for i := range s.shards {
+		if locked[i] {
+			s.shards[i].mutex.Lock()
+		}
 	}
+	return func() {
+		for i := range s.shards {
+			if locked[i] {
+				s.shards[i].mutex.Unlock()
+			}
+		}
+	}
+}
+
+// lockAll write-locks every shard, giving a consistent view of the whole store
+func (s *InMemoryStorage) lockAll() func() {
+	for i := range s.shards {
+		s.shards[i].mutex.Lock()
+	}
+	return func() {
+		for i := range s.shards {
+			s.shards[i].mutex.Unlock()
+		}
+	}
+}
+
+// raise lifts counter to at least value
+func raise(counter *atomic.Int64, value int64) {
+	for {
+		current := counter.Load()
+		if current >= value || counter.CompareAndSwap(current, value) {
+			return
+		}
+	}
+}
+
+// copyURL returns a copy of url that shares no pointers with it
+func copyURL(url *models.URL) *models.URL {
+	c := *url
+	if url.LastAccessed != nil {
+		lastAccessed := *url.LastAccessed
+		c.LastAccessed = &lastAccessed
+	}
+	if url.ExpiresAt != nil {
+		expiresAt := *url.ExpiresAt
+		c.ExpiresAt = &expiresAt
+	}
+	if url.DeletedAt != nil {
+		deletedAt := *url.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+	if url.Preview != nil {
+		preview := *url.Preview
+		c.Preview = &preview
+	}
+	if url.Tags != nil {
+		c.Tags = append([]string(nil), url.Tags...)
+	}
+	if url.UTM != nil {
+		utm := *url.UTM
+		c.UTM = &utm
+	}
+	if url.Variants != nil {
+		c.Variants = append([]models.Variant(nil), url.Variants...)
+	}
+	return &c
 }
 
 func (s *InMemoryStorage) Save(url *models.URL) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	sh := s.shard(url.ShortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
 
-	if _, exists := s.urls[url.ShortCode]; exists {
+	if _, exists := sh.urls[url.ShortCode]; exists {
 		return ErrAlreadyExists
 	}
 
-	s.idCounter++
-	url.ID = s.idCounter
-	url.CreatedAt = time.Now()
-	url.Clicks = 0
+	url.ID = s.idCounter.Add(1)
+	// Imported links keep their original stats
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = time.Now()
+	}
 
-	s.urls[url.ShortCode] = url
-	return nil
+	return s.commit(putEntry(url))
+}
+
+func (s *InMemoryStorage) SaveBatch(urls []*models.URL, revisions []*models.URLRevision, atomic bool) ([]error, error) {
+	codes := make([]string, len(urls))
+	for i, url := range urls {
+		codes[i] = url.ShortCode
+	}
+	unlock := s.lockShards(codes)
+	defer unlock()
+
+	errs := make([]error, len(urls))
+	seen := make(map[string]bool, len(urls))
+	for i, url := range urls {
+		if _, exists := s.shard(url.ShortCode).urls[url.ShortCode]; exists || seen[url.ShortCode] {
+			errs[i] = ErrAlreadyExists
+			if atomic {
+				return errs, nil
+			}
+		}
+		seen[url.ShortCode] = true
+	}
+
+	// The whole batch is committed as one log record
+	now := time.Now()
+	var entries []logEntry
+	for i, url := range urls {
+		if errs[i] != nil {
+			continue
+		}
+
+		url.ID = s.idCounter.Add(1)
+		if url.CreatedAt.IsZero() {
+			url.CreatedAt = now
+		}
+		entries = append(entries, putEntry(url))
+
+		if revisions[i] != nil {
+			revisions[i].ShortCode = url.ShortCode
+			s.numberRevision(revisions[i])
+			entries = append(entries, revisionEntry(revisions[i]))
+		}
+	}
+
+	return errs, s.commit(entries...)
 }
 
 func (s *InMemoryStorage) Get(shortCode string) (*models.URL, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	sh := s.shard(shortCode)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
 
-	url, exists := s.urls[shortCode]
+	url, exists := sh.urls[shortCode]
 	if !exists {
 		return nil, ErrNotFound
 	}
 
-	return url, nil
+	return copyURL(url), nil
+}
+
+func (s *InMemoryStorage) GetLongestPrefix(path string) (*models.URL, error) {
+	for _, code := range codePrefixes(path) {
+		if url, err := s.Get(code); err != ErrNotFound {
+			return url, err
+		}
+	}
+	return nil, ErrNotFound
 }
 
 func (s *InMemoryStorage) Update(url *models.URL) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	sh := s.shard(url.ShortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
 
-	if _, exists := s.urls[url.ShortCode]; !exists {
+	stored, exists := sh.urls[url.ShortCode]
+	if !exists {
 		return ErrNotFound
 	}
 
-	s.urls[url.ShortCode] = url
-	return nil
+	updated := copyURL(url)
+	updated.ID = stored.ID
+	updated.CreatedAt = stored.CreatedAt
+	updated.Preview = stored.Preview
+	updated.DeletedAt = stored.DeletedAt
+	updated.Owner = stored.Owner
+	updated.CampaignID = stored.CampaignID
+	return s.commit(putEntry(updated))
+}
+
+func (s *InMemoryStorage) RecordClick(event *models.Click) error {
+	sh := s.shard(event.ShortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	url, exists := sh.urls[event.ShortCode]
+	if !exists {
+		return ErrNotFound
+	}
+
+	// Clicks are the hottest write, so skip building a log entry when there is no log
+	if s.journal == nil {
+		click(url, event.At)
+		sh.clicks[event.ShortCode] = append(sh.clicks[event.ShortCode], *event)
+		return nil
+	}
+	logged := *event
+	return s.commit(logEntry{Op: opClick, Code: event.ShortCode, Click: &logged})
+}
+
+func click(url *models.URL, at time.Time) {
+	url.Clicks++
+	url.LastAccessed = &at
+}
+
+func (s *InMemoryStorage) SavePreview(shortCode string, preview *models.LinkPreview) error {
+	sh := s.shard(shortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	stored, exists := sh.urls[shortCode]
+	if !exists {
+		return ErrNotFound
+	}
+
+	updated := copyURL(stored)
+	p := *preview
+	updated.Preview = &p
+	return s.commit(putEntry(updated))
+}
+
+func (s *InMemoryStorage) UpdateWithRevision(url *models.URL, revision *models.URLRevision) error {
+	sh := s.shard(url.ShortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	stored, exists := sh.urls[url.ShortCode]
+	if !exists {
+		return ErrNotFound
+	}
+	if revision.Revision != 0 && revision.Revision != len(sh.revisions[url.ShortCode])+1 {
+		return ErrConflict
+	}
+
+	// Only the editable state changes, so concurrent clicks are never lost
+	updated := copyURL(stored)
+	updated.ApplyState(copyURL(url).State())
+
+	s.numberRevision(revision)
+	return s.commit(putEntry(updated), revisionEntry(revision))
+}
+
+func (s *InMemoryStorage) AddRevision(revision *models.URLRevision) error {
+	sh := s.shard(revision.ShortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	s.numberRevision(revision)
+	return s.commit(revisionEntry(revision))
+}
+
+// numberRevision assigns the next ID and per-code number; the caller holds the shard lock
+func (s *InMemoryStorage) numberRevision(revision *models.URLRevision) {
+	revision.ID = s.revCounter.Add(1)
+	revision.Revision = len(s.shard(revision.ShortCode).revisions[revision.ShortCode]) + 1
+}
+
+func (s *InMemoryStorage) ListRevisions(shortCode string) ([]*models.URLRevision, error) {
+	sh := s.shard(shortCode)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+
+	revisions := make([]*models.URLRevision, 0, len(sh.revisions[shortCode]))
+	for _, revision := range sh.revisions[shortCode] {
+		c := *revision
+		revisions = append(revisions, &c)
+	}
+	return revisions, nil
+}
+
+func (s *InMemoryStorage) SoftDelete(shortCode string, at time.Time) error {
+	sh := s.shard(shortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	stored, exists := sh.urls[shortCode]
+	if !exists || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+
+	updated := copyURL(stored)
+	updated.DeletedAt = &at
+	return s.commit(putEntry(updated))
+}
+
+func (s *InMemoryStorage) Restore(shortCode string) error {
+	sh := s.shard(shortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	stored, exists := sh.urls[shortCode]
+	if !exists || stored.DeletedAt == nil {
+		return ErrNotFound
+	}
+
+	updated := copyURL(stored)
+	updated.DeletedAt = nil
+	return s.commit(putEntry(updated))
+}
+
+// PurgeDeleted works one shard at a time so redirects elsewhere keep flowing
+func (s *InMemoryStorage) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mutex.Lock()
+
+		var entries []logEntry
+		for shortCode, url := range sh.urls {
+			if url.DeletedAt != nil && url.DeletedAt.Before(before) {
+				entries = append(entries, logEntry{Op: opDelete, Code: shortCode})
+			}
+		}
+		err := s.commit(entries...)
+		sh.mutex.Unlock()
+
+		if err != nil {
+			return purged, err
+		}
+		purged += int64(len(entries))
+	}
+	return purged, nil
 }
 
 func (s *InMemoryStorage) Delete(shortCode string) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	sh := s.shard(shortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
 
-	if _, exists := s.urls[shortCode]; !exists {
+	if _, exists := sh.urls[shortCode]; !exists {
 		return ErrNotFound
 	}
 
-	delete(s.urls, shortCode)
-	return nil
+	return s.commit(logEntry{Op: opDelete, Code: shortCode})
 }
 
-func (s *InMemoryStorage) List(limit, offset int) ([]*models.URL, error) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+// reindex moves a link's index entries from its old to its new state; either
+// may be nil. The caller holds the link's shard lock.
+func (s *InMemoryStorage) reindex(old, updated *models.URL) {
+	s.text.update(old, updated)
+	s.tags.update(old, updated)
+	s.campaigns.update(old, updated)
+
+	if old != nil && updated != nil && old.ID == updated.ID &&
+		old.CreatedAt.Equal(updated.CreatedAt) && sameTime(old.DeletedAt, updated.DeletedAt) {
+		return
+	}
 
-	urls := make([]*models.URL, 0, len(s.urls))
-	for _, url := range s.urls {
-		urls = append(urls, url)
+	s.index.mutex.Lock()
+	defer s.index.mutex.Unlock()
+
+	if old != nil {
+		s.index.byID.Delete(indexKey{id: old.ID})
+		if old.DeletedAt == nil {
+			s.index.recent.Delete(indexKey{at: old.CreatedAt, id: old.ID})
+		} else {
+			s.index.trash.Delete(indexKey{at: *old.DeletedAt, id: old.ID})
+		}
+	}
+	if updated != nil {
+		s.index.byID.Insert(indexKey{id: updated.ID, code: updated.ShortCode, deleted: updated.DeletedAt != nil})
+		if updated.DeletedAt == nil {
+			s.index.recent.Insert(indexKey{at: updated.CreatedAt, id: updated.ID, code: updated.ShortCode})
+		} else {
+			s.index.trash.Insert(indexKey{at: *updated.DeletedAt, id: updated.ID, code: updated.ShortCode})
+		}
 	}
+}
 
-	// Apply offset and limit
-	start := offset
-	if start > len(urls) {
-		return []*models.URL{}, nil
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return a.Equal(*b)
+}
 
-	end := start + limit
-	if end > len(urls) {
-		end = len(urls)
+// collect reads up to limit codes from list starting at rank offset. The
+// capacity is bounded by the list so a huge limit allocates nothing extra.
+func (s *InMemoryStorage) collect(list *skiplist[indexKey], offset, limit int) []string {
+	codes := make([]string, 0, max(min(limit, list.Len()-offset), 0))
+	for node := list.At(offset); node != nil && len(codes) < limit; node = node.Next() {
+		codes = append(codes, node.key.code)
 	}
+	return codes
+}
 
-	return urls[start:end], nil
+// fetch copies the links for codes, skipping any that changed so they no
+// longer belong on the page since the index was read
+func (s *InMemoryStorage) fetch(codes []string, keep func(*models.URL) bool) []*models.URL {
+	urls := make([]*models.URL, 0, len(codes))
+	for _, code := range codes {
+		if url, err := s.Get(code); err == nil && keep(url) {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+func (s *InMemoryStorage) List(limit, offset int) ([]*models.URL, error) {
+	s.index.mutex.RLock()
+	codes := s.collect(s.index.recent, offset, limit)
+	s.index.mutex.RUnlock()
+
+	return s.fetch(codes, func(url *models.URL) bool { return url.DeletedAt == nil }), nil
+}
+
+// ListAfterID reads the index again when links change between reading it
+// and fetching them, so a page is only short when the index is exhausted
+func (s *InMemoryStorage) ListAfterID(afterID int64, limit int, includeDeleted bool) ([]*models.URL, error) {
+	var urls []*models.URL
+	for len(urls) < limit {
+		s.index.mutex.RLock()
+		codes := make([]string, 0, min(limit-len(urls), s.index.byID.Len()))
+		for node := s.index.byID.After(indexKey{id: afterID}); node != nil && len(codes) < limit-len(urls); node = node.Next() {
+			if includeDeleted || !node.key.deleted {
+				codes = append(codes, node.key.code)
+			}
+			afterID = node.key.id
+		}
+		s.index.mutex.RUnlock()
+
+		if len(codes) == 0 {
+			break
+		}
+		urls = append(urls, s.fetch(codes, func(url *models.URL) bool {
+			return includeDeleted || url.DeletedAt == nil
+		})...)
+	}
+	return urls, nil
+}
+
+func (s *InMemoryStorage) ListDeleted(limit, offset int) ([]*models.URL, error) {
+	s.index.mutex.RLock()
+	codes := s.collect(s.index.trash, offset, limit)
+	s.index.mutex.RUnlock()
+
+	return s.fetch(codes, func(url *models.URL) bool { return url.DeletedAt != nil }), nil
 }
 
 func (s *InMemoryStorage) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.closeJournal()
+}
+
+// sortedURLs returns every link ordered by ID; the caller holds all shard locks
+func (s *InMemoryStorage) sortedURLs() []*models.URL {
+	var urls []*models.URL
+	for i := range s.shards {
+		for _, url := range s.shards[i].urls {
+			urls = append(urls, url)
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+	return urls
+}
+
+// Query scans every shard, since the filters and sort orders are not indexed,
+// then copies only the links on the requested page
+func (s *InMemoryStorage) Query(opts ListOptions) (*ListPage, error) {
+	opts, after, err := opts.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []sortKey
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mutex.RLock()
+		for _, url := range sh.urls {
+			if opts.matches(url) {
+				keys = append(keys, opts.keyOf(url))
+			}
+		}
+		sh.mutex.RUnlock()
+	}
+	total := int64(len(keys))
+
+	keys = opts.sortKeys(keys, after)
+	codes := make([]string, 0, opts.Limit+1)
+	for _, key := range keys[:min(len(keys), opts.Limit+1)] {
+		codes = append(codes, key.code)
+	}
+
+	return opts.page(s.fetch(codes, func(url *models.URL) bool { return url.DeletedAt == nil }), total), nil
+}
+
+// Search looks terms up in the inverted index, then copies the best links
+func (s *InMemoryStorage) Search(query string, limit int) ([]SearchHit, error) {
+	hits := s.text.search(search.Terms(query), limit)
+
+	found := make([]SearchHit, 0, len(hits))
+	for _, hit := range hits {
+		// A link trashed since the index was read is dropped
+		if url, err := s.Get(hit.URL.ShortCode); err == nil && url.DeletedAt == nil {
+			found = append(found, SearchHit{URL: url, Score: hit.Score})
+		}
+	}
+	return found, nil
+}
+
+func (s *InMemoryStorage) ListTags() ([]models.TagCount, error) {
+	return s.tags.counts(), nil
+}
+
+func (s *InMemoryStorage) SaveCampaign(campaign *models.Campaign) error {
+	s.campaignWrites.Lock()
+	defer s.campaignWrites.Unlock()
+
+	campaign.ID = s.campaignCounter.Add(1)
+	if campaign.CreatedAt.IsZero() {
+		campaign.CreatedAt = time.Now()
+	}
+	if campaign.UpdatedAt.IsZero() {
+		campaign.UpdatedAt = campaign.CreatedAt
+	}
+	return s.commit(campaignEntry(campaign))
+}
+
+func (s *InMemoryStorage) GetCampaign(id int64) (*models.Campaign, error) {
+	campaign, exists := s.campaigns.get(id)
+	if !exists {
+		return nil, ErrCampaignNotFound
+	}
+	return campaign, nil
+}
+
+func (s *InMemoryStorage) UpdateCampaign(campaign *models.Campaign) error {
+	s.campaignWrites.Lock()
+	defer s.campaignWrites.Unlock()
+
+	stored, exists := s.campaigns.get(campaign.ID)
+	if !exists {
+		return ErrCampaignNotFound
+	}
+
+	updated := *campaign
+	updated.CreatedAt = stored.CreatedAt
+	if updated.UpdatedAt.IsZero() {
+		updated.UpdatedAt = time.Now()
+	}
+	return s.commit(campaignEntry(&updated))
+}
+
+// DeleteCampaign locks every shard so no link joins the campaign while its
+// members are taken out of it
+func (s *InMemoryStorage) DeleteCampaign(id int64) error {
+	unlock := s.lockAll()
+	defer unlock()
+	s.campaignWrites.Lock()
+	defer s.campaignWrites.Unlock()
+
+	if _, exists := s.campaigns.get(id); !exists {
+		return ErrCampaignNotFound
+	}
+
+	var entries []logEntry
+	for _, code := range s.campaigns.members(id) {
+		updated := copyURL(s.shard(code).urls[code])
+		updated.CampaignID = 0
+		entries = append(entries, putEntry(updated))
+	}
+	entries = append(entries, logEntry{Op: opDeleteCampaign, CampaignID: id})
+	return s.commit(entries...)
+}
+
+func (s *InMemoryStorage) ListCampaigns() ([]*models.Campaign, error) {
+	return s.campaigns.list(), nil
+}
+
+func (s *InMemoryStorage) SetCampaign(shortCodes []string, campaignID int64) error {
+	unlock := s.lockShards(shortCodes)
+	defer unlock()
+
+	if campaignID != 0 {
+		if _, exists := s.campaigns.get(campaignID); !exists {
+			return ErrCampaignNotFound
+		}
+	}
+
+	entries := make([]logEntry, 0, len(shortCodes))
+	for _, code := range shortCodes {
+		stored, exists := s.shard(code).urls[code]
+		if !exists {
+			return ErrNotFound
+		}
+		if stored.CampaignID == campaignID {
+			continue
+		}
+		updated := copyURL(stored)
+		updated.CampaignID = campaignID
+		entries = append(entries, putEntry(updated))
+	}
+	return s.commit(entries...)
+}
+
+// ScanCampaignClicks copies the matching clicks one link at a time, then
+// merges them into time order before calling fn
+func (s *InMemoryStorage) ScanCampaignClicks(campaignID int64, from, to time.Time, fn func(models.Click) error) error {
+	if _, exists := s.campaigns.get(campaignID); !exists {
+		return ErrCampaignNotFound
+	}
+
+	var clicks []models.Click
+	for _, code := range s.campaigns.members(campaignID) {
+		sh := s.shard(code)
+		sh.mutex.RLock()
+		for _, event := range sh.clicks[code] {
+			if !event.At.Before(from) && event.At.Before(to) {
+				clicks = append(clicks, event)
+			}
+		}
+		sh.mutex.RUnlock()
+	}
+
+	sort.SliceStable(clicks, func(i, j int) bool { return clicks[i].At.Before(clicks[j].At) })
+	for _, event := range clicks {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) ScanClicks(shortCode string, fn func(models.Click) error) error {
+	sh := s.shard(shortCode)
+	sh.mutex.RLock()
+	clicks := append([]models.Click(nil), sh.clicks[shortCode]...)
+	sh.mutex.RUnlock()
+
+	for _, event := range clicks {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func (s *InMemoryStorage) SaveClicks(shortCode string, clicks []models.Click) error {
+	sh := s.shard(shortCode)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	if _, exists := sh.urls[shortCode]; !exists {
+		return ErrNotFound
+	}
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	saved := make([]models.Click, len(clicks))
+	for i, event := range clicks {
+		event.ShortCode = shortCode
+		saved[i] = event
+	}
+	return s.commit(logEntry{Op: opClicks, Code: shortCode, Clicks: saved})
+}
+
+func (s *InMemoryStorage) CountVariantClicks(shortCode string) (map[string]int64, error) {
+	sh := s.shard(shortCode)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, event := range sh.clicks[shortCode] {
+		if event.Variant != "" {
+			counts[event.Variant]++
+		}
+	}
+	return counts, nil
+}
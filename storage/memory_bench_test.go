@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+// Run with -cpu to see throughput scale with GOMAXPROCS, for example:
+//
+//	go test ./storage -run '^$' -bench 'Redirect|Mixed' -cpu 1,2,4,8
+
+// singleLockStore is the previous design, one RWMutex around a map, kept as a baseline
+type singleLockStore struct {
+	mutex sync.RWMutex
+	urls  map[string]*models.URL
+}
+
+func (s *singleLockStore) Save(url *models.URL) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.urls[url.ShortCode]; exists {
+		return ErrAlreadyExists
+	}
+	s.urls[url.ShortCode] = copyURL(url)
+	return nil
+}
+
+func (s *singleLockStore) Get(shortCode string) (*models.URL, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	url, exists := s.urls[shortCode]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return copyURL(url), nil
+}
+
+func (s *singleLockStore) RecordClick(click *models.Click) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	url, exists := s.urls[click.ShortCode]
+	if !exists {
+		return ErrNotFound
+	}
+	url.Clicks++
+	url.LastAccessed = &click.At
+	return nil
+}
+
+// hotPath is the part of Storage exercised by redirects
+type hotPath interface {
+	Save(url *models.URL) error
+	Get(shortCode string) (*models.URL, error)
+	RecordClick(click *models.Click) error
+}
+
+const benchLinks = 10000
+
+func benchStores() map[string]func() hotPath {
+	return map[string]func() hotPath{
+		"single-lock": func() hotPath { return &singleLockStore{urls: map[string]*models.URL{}} },
+		"sharded":     func() hotPath { return NewInMemoryStorage() },
+	}
+}
+
+func seedBench(b *testing.B, store hotPath) []string {
+	b.Helper()
+	codes := make([]string, benchLinks)
+	for i := range codes {
+		codes[i] = fmt.Sprintf("c%06d", i)
+		if err := store.Save(&models.URL{ShortCode: codes[i], OriginalURL: "https://example.com"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return codes
+}
+
+// BenchmarkRedirect resolves a link and counts the click, as every redirect does
+func BenchmarkRedirect(b *testing.B) {
+	for name, newStore := range benchStores() {
+		b.Run(name, func(b *testing.B) {
+			store := newStore()
+			codes := seedBench(b, store)
+			var seed atomic.Int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(seed.Add(1)))
+				for pb.Next() {
+					code := codes[rng.Intn(len(codes))]
+					store.Get(code)
+					store.RecordClick(&models.Click{ShortCode: code, At: time.Now()})
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMixed is mostly reads with one new link in ten operations
+func BenchmarkMixed(b *testing.B) {
+	for name, newStore := range benchStores() {
+		b.Run(name, func(b *testing.B) {
+			store := newStore()
+			codes := seedBench(b, store)
+			var seed, created atomic.Int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(seed.Add(1)))
+				for pb.Next() {
+					switch n := rng.Intn(10); {
+					case n == 0:
+						store.Save(&models.URL{ShortCode: fmt.Sprintf("n%d", created.Add(1)), OriginalURL: "https://example.com"})
+					case n < 4:
+						store.RecordClick(&models.Click{ShortCode: codes[rng.Intn(len(codes))], At: time.Now()})
+					default:
+						store.Get(codes[rng.Intn(len(codes))])
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkList pages deep into the newest-first listing; cost should not grow with store size
+func BenchmarkList(b *testing.B) {
+	for _, size := range []int{1000, 100000} {
+		b.Run(fmt.Sprintf("links=%d", size), func(b *testing.B) {
+			store := NewInMemoryStorage()
+			created := time.Now()
+			for i := 0; i < size; i++ {
+				store.Save(&models.URL{ShortCode: fmt.Sprintf("c%07d", i), OriginalURL: "https://example.com", CreatedAt: created.Add(time.Duration(i) * time.Second)})
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.List(20, size/2)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 	"url-shortener/models"
 )
 
@@ -132,3 +135,53 @@ func TestInMemoryStorage(t *testing.T) {
 	})
 }
 
+
+func TestInMemoryConcurrency(t *testing.T) {
+	store := NewInMemoryStorage()
+	for i := 0; i < 50; i++ {
+		store.Save(&models.URL{ShortCode: fmt.Sprintf("seed%d", i), OriginalURL: "https://example.com"})
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				code := fmt.Sprintf("seed%d", i%50)
+				store.RecordClick(&models.Click{ShortCode: code, At: time.Now()})
+				store.Get(code)
+				store.Save(&models.URL{ShortCode: fmt.Sprintf("w%d-%d", w, i), OriginalURL: "https://example.com"})
+				store.List(10, i%20)
+				if i%10 == 0 {
+					store.SoftDelete(fmt.Sprintf("w%d-%d", w, i), time.Now())
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var clicks int64
+	for i := 0; i < 50; i++ {
+		url, _ := store.Get(fmt.Sprintf("seed%d", i))
+		clicks += url.Clicks
+	}
+	if clicks != 8*200 {
+		t.Errorf("Expected %d clicks, got %d", 8*200, clicks)
+	}
+
+	live, _ := store.List(10000, 0)
+	trash, _ := store.ListDeleted(10000, 0)
+	if len(live) != 50+8*180 || len(trash) != 8*20 {
+		t.Errorf("Expected %d live and %d trashed links, got %d and %d", 50+8*180, 8*20, len(live), len(trash))
+	}
+
+	seen := map[int64]bool{}
+	all, _ := store.ListAfterID(0, 10000, true)
+	for _, url := range all {
+		if seen[url.ID] {
+			t.Fatalf("Expected unique IDs, got %d twice", url.ID)
+		}
+		seen[url.ID] = true
+	}
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// Open creates a storage backend from a spec:
+//
+//	memory                          in-memory storage
+//	memory:<dir>                    in-memory storage persisted to dir
+//	sqlite:<path> or <path>.db      SQLite database file
+//	postgres://... or postgresql:// PostgreSQL connection string
+func Open(spec string) (Storage, error) {
+	switch {
+	case spec == "memory":
+		return NewInMemoryStorage(), nil
+	case strings.HasPrefix(spec, "memory:"):
+		return NewDurableInMemoryStorage(strings.TrimPrefix(spec, "memory:"), DefaultDurabilityOptions())
+	case strings.HasPrefix(spec, "sqlite:"):
+		return NewSQLiteStorage(strings.TrimPrefix(spec, "sqlite:"))
+	case strings.HasSuffix(spec, ".db"):
+		return NewSQLiteStorage(spec)
+	case strings.HasPrefix(spec, "postgres://"), strings.HasPrefix(spec, "postgresql://"):
+		return NewPostgresStorage(spec)
+	default:
+		return nil, ErrUnknownBackend
+	}
+}
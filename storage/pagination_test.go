@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+func TestListAfterID(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+			for i := 0; i < 5; i++ {
+				store.Save(&models.URL{ShortCode: fmt.Sprintf("code%d", i), OriginalURL: "https://example.com", Clicks: int64(i), CreatedAt: created})
+			}
+			store.SoftDelete("code2", time.Now())
+
+			var codes []string
+			var afterID int64
+			for {
+				page, err := store.ListAfterID(afterID, 2, false)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				for _, url := range page {
+					codes = append(codes, url.ShortCode)
+					afterID = url.ID
+				}
+				if len(page) < 2 {
+					break
+				}
+			}
+
+			if fmt.Sprint(codes) != "[code0 code1 code3 code4]" {
+				t.Errorf("Expected live codes in ID order, got %v", codes)
+			}
+
+			all, _ := store.ListAfterID(0, 10, true)
+			if len(all) != 5 {
+				t.Errorf("Expected trashed URLs to be included on request, got %d", len(all))
+			}
+
+			stored, _ := store.Get("code4")
+			if stored.Clicks != 4 || !stored.CreatedAt.Equal(created) {
+				t.Errorf("Expected provided stats to be kept, got %d clicks created %v", stored.Clicks, stored.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestListOrder(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+			// Saved out of order so the result cannot depend on insertion order
+			for _, i := range []int{3, 0, 4, 1, 2} {
+				store.Save(&models.URL{ShortCode: fmt.Sprintf("code%d", i), OriginalURL: "https://example.com", CreatedAt: created.Add(time.Duration(i) * time.Hour)})
+			}
+
+			list := func(limit, offset int) string {
+				page, err := store.List(limit, offset)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				codes := []string{}
+				for _, url := range page {
+					codes = append(codes, url.ShortCode)
+				}
+				return fmt.Sprint(codes)
+			}
+
+			if got := list(10, 0); got != "[code4 code3 code2 code1 code0]" {
+				t.Errorf("Expected newest first, got %v", got)
+			}
+			if got := list(2, 1); got != "[code3 code2]" {
+				t.Errorf("Expected page at offset 1, got %v", got)
+			}
+			if got := list(2, 5); got != "[]" {
+				t.Errorf("Expected empty page past the end, got %v", got)
+			}
+
+			store.SoftDelete("code3", time.Now())
+			if got := list(10, 0); got != "[code4 code2 code1 code0]" {
+				t.Errorf("Expected trashed link to leave the list, got %v", got)
+			}
+			store.Restore("code3")
+			if got := list(2, 0); got != "[code4 code3]" {
+				t.Errorf("Expected restored link back in place, got %v", got)
+			}
+		})
+	}
+}
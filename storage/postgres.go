@@ -2,8 +2,12 @@ package storage
 
 import (
 	"database/sql"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 	"url-shortener/models"
+	"url-shortener/search"
 
 	_ "github.com/lib/pq"
 )
@@ -44,16 +48,178 @@ func (s *PostgresStorage) createTable() error {
 		last_accessed TIMESTAMP
 	);
 	CREATE INDEX IF NOT EXISTS idx_short_code ON urls(short_code);
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS canonical_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS preview_title TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS preview_description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS preview_image TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS preview_site_name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS preview_twitter_card TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS preview_favicon TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS preview_fetched_at TIMESTAMP;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_type INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS cache_control TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+	CREATE TABLE IF NOT EXISTS url_revisions (
+		id BIGSERIAL PRIMARY KEY,
+		short_code VARCHAR(255) NOT NULL,
+		revision INTEGER NOT NULL,
+		action VARCHAR(32) NOT NULL,
+		actor TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		old_state TEXT,
+		new_state TEXT NOT NULL,
+		UNIQUE (short_code, revision)
+	);
+	CREATE TABLE IF NOT EXISTS tags (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(64) UNIQUE NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS url_tags (
+		url_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (url_id, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_url_tags_tag ON url_tags(tag_id);
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS campaign_id INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_source TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_medium TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_campaign TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_term TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_content TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_override BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS passthrough BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS interstitial BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS rotation TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS idx_urls_campaign ON urls(campaign_id);
+	CREATE TABLE IF NOT EXISTS campaigns (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		utm_source TEXT NOT NULL DEFAULT '',
+		utm_medium TEXT NOT NULL DEFAULT '',
+		utm_campaign TEXT NOT NULL DEFAULT '',
+		utm_term TEXT NOT NULL DEFAULT '',
+		utm_content TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS clicks (
+		id BIGSERIAL PRIMARY KEY,
+		url_id INTEGER NOT NULL,
+		clicked_at TIMESTAMP NOT NULL,
+		referrer TEXT NOT NULL DEFAULT '',
+		visitor TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_clicks_url ON clicks(url_id, clicked_at);
+	ALTER TABLE clicks ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
 	`
-	_, err := s.db.Exec(query)
+	if _, err := s.db.Exec(query); err != nil {
+		return err
+	}
+	return s.createSearchIndex()
+}
+
+// createSearchIndex adds the weighted tsvector behind Search and, where the
+// pg_trgm extension can be installed, a trigram index so fragments of short
+// codes are found without a scan. URLs are split on punctuation first so
+// hosts and path segments become words, as in the other backends. Generated
+// columns cannot be altered, so search_vector, which predates custom titles,
+// is replaced by search_document.
+func (s *PostgresStorage) createSearchIndex() error {
+	_, err := s.db.Exec(`
+	ALTER TABLE urls DROP COLUMN IF EXISTS search_vector;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS search_document tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', short_code), 'A') ||
+		setweight(to_tsvector('simple', CASE WHEN title <> '' THEN title ELSE preview_title END), 'B') ||
+		setweight(to_tsvector('simple', notes), 'C') ||
+		setweight(to_tsvector('simple', regexp_replace(original_url || ' ' || canonical_url, '[^[:alnum:]]+', ' ', 'g')), 'D')
+	) STORED;
+	CREATE INDEX IF NOT EXISTS idx_urls_search_document ON urls USING GIN (search_document);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Installing extensions needs privileges the application may not have
+	if _, err := s.db.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`); err != nil {
+		log.Printf("Extension pg_trgm unavailable, short code fragments will be searched without an index: %v", err)
+		return nil
+	}
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_urls_short_code_trgm ON urls USING GIN (short_code gin_trgm_ops)`)
 	return err
 }
 
 func (s *PostgresStorage) Save(url *models.URL) error {
-	query := `INSERT INTO urls (short_code, original_url, clicks, created_at) 
-	          VALUES ($1, $2, $3, $4) RETURNING id`
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.insertURL(tx, url); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
 
-	err := s.db.QueryRow(query, url.ShortCode, url.OriginalURL, 0, time.Now()).Scan(&url.ID)
+func (s *PostgresStorage) SaveBatch(urls []*models.URL, revisions []*models.URLRevision, atomic bool) ([]error, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	errs := make([]error, len(urls))
+	for i, url := range urls {
+		// A failed statement aborts the transaction unless it is rolled back to a savepoint
+		if _, err := tx.Exec(`SAVEPOINT batch_item`); err != nil {
+			return nil, err
+		}
+
+		err := s.insertURL(tx, url)
+		if err == nil && revisions[i] != nil {
+			revisions[i].ShortCode = url.ShortCode
+			err = s.insertRevision(tx, revisions[i])
+		}
+
+		if err != nil {
+			errs[i] = err
+			if atomic {
+				return errs, nil
+			}
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT batch_item`); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec(`RELEASE SAVEPOINT batch_item`); err != nil {
+			return nil, err
+		}
+	}
+
+	return errs, tx.Commit()
+}
+
+// insertURL inserts a new URL through db or a transaction
+func (s *PostgresStorage) insertURL(q queryer, url *models.URL) error {
+	query := `INSERT INTO urls (short_code, original_url, canonical_url, redirect_type, cache_control, expires_at, title, notes,
+	          utm_source, utm_medium, utm_campaign, utm_term, utm_content, utm_override, passthrough, interstitial, variants, rotation,
+	          clicks, created_at, last_accessed, owner, campaign_id) 
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23) RETURNING id`
+
+	// Imported links keep their original stats
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = time.Now()
+	}
+	utm := utmOf(url)
+	err := q.QueryRow(query, url.ShortCode, url.OriginalURL, url.CanonicalURL, url.RedirectType, url.CacheControl,
+		utcTime(url.ExpiresAt), url.Title, url.Notes, utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content, url.UTMOverride,
+		url.Passthrough, url.Interstitial, variantsOf(url), url.Rotation, url.Clicks, url.CreatedAt.UTC(), utcTime(url.LastAccessed), url.Owner, url.CampaignID).Scan(&url.ID)
 	if err != nil {
 		// Check if it's a unique constraint error
 		if err.Error() == "pq: duplicate key value violates unique constraint \"urls_short_code_key\"" {
@@ -62,25 +228,33 @@ func (s *PostgresStorage) Save(url *models.URL) error {
 		return err
 	}
 
-	return nil
+	return s.setTags(q, url.ShortCode, url.Tags)
 }
 
-func (s *PostgresStorage) Get(shortCode string) (*models.URL, error) {
-	query := `SELECT id, short_code, original_url, clicks, created_at, last_accessed 
-	          FROM urls WHERE short_code = $1`
+// setTags replaces the tags of a link, adding tag names not seen before
+func (s *PostgresStorage) setTags(q queryer, shortCode string, tags []string) error {
+	_, err := q.Exec(`DELETE FROM url_tags WHERE url_id = (SELECT id FROM urls WHERE short_code = $1)`, shortCode)
+	if err != nil {
+		return err
+	}
 
-	url := &models.URL{}
-	var lastAccessed sql.NullTime
+	for _, tag := range tags {
+		if _, err := q.Exec(`INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, tag); err != nil {
+			return err
+		}
+		_, err := q.Exec(`INSERT INTO url_tags (url_id, tag_id)
+		          SELECT urls.id, tags.id FROM urls, tags WHERE urls.short_code = $1 AND tags.name = $2`, shortCode, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	err := s.db.QueryRow(query, shortCode).Scan(
-		&url.ID,
-		&url.ShortCode,
-		&url.OriginalURL,
-		&url.Clicks,
-		&url.CreatedAt,
-		&lastAccessed,
-	)
+func (s *PostgresStorage) Get(shortCode string) (*models.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE short_code = $1`
 
+	url, err := scanURL(s.db.QueryRow(query, shortCode))
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	}
@@ -88,18 +262,220 @@ func (s *PostgresStorage) Get(shortCode string) (*models.URL, error) {
 		return nil, err
 	}
 
-	if lastAccessed.Valid {
-		url.LastAccessed = &lastAccessed.Time
+	return url, nil
+}
+
+func (s *PostgresStorage) GetLongestPrefix(path string) (*models.URL, error) {
+	args := prefixArgs(path)
+	url, err := scanURL(s.db.QueryRow(numberPlaceholders(longestPrefixQuery(len(args))), args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return url, nil
 }
 
 func (s *PostgresStorage) Update(url *models.URL) error {
-	query := `UPDATE urls SET original_url = $1, clicks = $2, last_accessed = $3 
-	          WHERE short_code = $4`
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE urls SET original_url = $1, canonical_url = $2, redirect_type = $3, cache_control = $4, expires_at = $5, title = $6, notes = $7,
+	          utm_source = $8, utm_medium = $9, utm_campaign = $10, utm_term = $11, utm_content = $12, utm_override = $13,
+	          passthrough = $14, interstitial = $15, variants = $16, rotation = $17, clicks = $18, last_accessed = $19 WHERE short_code = $20`
+
+	utm := utmOf(url)
+	result, err := tx.Exec(query, url.OriginalURL, url.CanonicalURL, url.RedirectType, url.CacheControl, utcTime(url.ExpiresAt), url.Title, url.Notes,
+		utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content, url.UTMOverride, url.Passthrough, url.Interstitial,
+		variantsOf(url), url.Rotation, url.Clicks, utcTime(url.LastAccessed), url.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	if err := s.setTags(tx, url.ShortCode, url.Tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) RecordClick(click *models.Click) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE urls SET clicks = clicks + 1, last_accessed = $1 WHERE short_code = $2`
+
+	result, err := tx.Exec(query, click.At.UTC(), click.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	_, err = tx.Exec(`INSERT INTO clicks (url_id, clicked_at, referrer, visitor, variant)
+	          SELECT id, $1, $2, $3, $4 FROM urls WHERE short_code = $5`, click.At.UTC(), click.Referrer, click.Visitor, click.Variant, click.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) UpdateWithRevision(url *models.URL, revision *models.URLRevision) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The row lock taken by the update also serializes revision numbering
+	query := `UPDATE urls SET original_url = $1, canonical_url = $2, redirect_type = $3, cache_control = $4, expires_at = $5, title = $6, notes = $7,
+	          utm_source = $8, utm_medium = $9, utm_campaign = $10, utm_term = $11, utm_content = $12, utm_override = $13,
+	          passthrough = $14, interstitial = $15, variants = $16, rotation = $17 WHERE short_code = $18`
+
+	utm := utmOf(url)
+	result, err := tx.Exec(query, url.OriginalURL, url.CanonicalURL, url.RedirectType, url.CacheControl, utcTime(url.ExpiresAt), url.Title, url.Notes,
+		utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content, url.UTMOverride, url.Passthrough, url.Interstitial,
+		variantsOf(url), url.Rotation, url.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	if err := s.setTags(tx, url.ShortCode, url.Tags); err != nil {
+		return err
+	}
+
+	expected := revision.Revision
+	if err := s.insertRevision(tx, revision); err != nil {
+		return err
+	}
+	if expected != 0 && revision.Revision != expected {
+		return ErrConflict
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) AddRevision(revision *models.URLRevision) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.insertRevision(tx, revision); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertRevision stores revision as the next revision of its short code
+func (s *PostgresStorage) insertRevision(tx *sql.Tx, revision *models.URLRevision) error {
+	old, state, err := encodeStates(revision)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO url_revisions (short_code, revision, action, actor, created_at, old_state, new_state)
+	          SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5, $6 FROM url_revisions WHERE short_code = $1
+	          RETURNING id, revision`
+
+	return tx.QueryRow(query, revision.ShortCode, revision.Action, revision.Actor, revision.CreatedAt.UTC(), old, state).
+		Scan(&revision.ID, &revision.Revision)
+}
+
+func (s *PostgresStorage) ListRevisions(shortCode string) ([]*models.URLRevision, error) {
+	query := `SELECT ` + revisionColumns + `
+	          FROM url_revisions WHERE short_code = $1 ORDER BY revision`
+
+	rows, err := s.db.Query(query, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRevisions(rows)
+}
+
+func (s *PostgresStorage) SavePreview(shortCode string, preview *models.LinkPreview) error {
+	query := `UPDATE urls SET preview_title = $1, preview_description = $2, preview_image = $3, preview_site_name = $4,
+	          preview_twitter_card = $5, preview_favicon = $6, preview_fetched_at = $7 WHERE short_code = $8`
+
+	result, err := s.db.Exec(query, preview.Title, preview.Description, preview.ImageURL, preview.SiteName,
+		preview.TwitterCard, preview.FaviconURL, preview.FetchedAt.UTC(), shortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) SoftDelete(shortCode string, at time.Time) error {
+	query := `UPDATE urls SET deleted_at = $1 WHERE short_code = $2 AND deleted_at IS NULL`
+
+	result, err := s.db.Exec(query, at.UTC(), shortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) Restore(shortCode string) error {
+	query := `UPDATE urls SET deleted_at = NULL WHERE short_code = $1 AND deleted_at IS NOT NULL`
 
-	result, err := s.db.Exec(query, url.OriginalURL, url.Clicks, url.LastAccessed, url.ShortCode)
+	result, err := s.db.Exec(query, shortCode)
 	if err != nil {
 		return err
 	}
@@ -116,7 +492,58 @@ func (s *PostgresStorage) Update(url *models.URL) error {
 	return nil
 }
 
+func (s *PostgresStorage) PurgeDeleted(before time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// deleted_at has no time zone and is stored in UTC
+	before = before.UTC()
+
+	_, err = tx.Exec(`DELETE FROM url_revisions WHERE short_code IN
+	          (SELECT short_code FROM urls WHERE deleted_at IS NOT NULL AND deleted_at < $1)`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM url_tags WHERE url_id IN
+	          (SELECT id FROM urls WHERE deleted_at IS NOT NULL AND deleted_at < $1)`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM clicks WHERE url_id IN
+	          (SELECT id FROM urls WHERE deleted_at IS NOT NULL AND deleted_at < $1)`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM urls WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
+
 func (s *PostgresStorage) Delete(shortCode string) error {
+	_, err := s.db.Exec(`DELETE FROM url_tags WHERE url_id = (SELECT id FROM urls WHERE short_code = $1)`, shortCode)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`DELETE FROM clicks WHERE url_id = (SELECT id FROM urls WHERE short_code = $1)`, shortCode)
+	if err != nil {
+		return err
+	}
+
 	query := `DELETE FROM urls WHERE short_code = $1`
 
 	result, err := s.db.Exec(query, shortCode)
@@ -133,44 +560,329 @@ func (s *PostgresStorage) Delete(shortCode string) error {
 		return ErrNotFound
 	}
 
-	return nil
+	_, err = s.db.Exec(`DELETE FROM url_revisions WHERE short_code = $1`, shortCode)
+	return err
 }
 
 func (s *PostgresStorage) List(limit, offset int) ([]*models.URL, error) {
-	query := `SELECT id, short_code, original_url, clicks, created_at, last_accessed 
-	          FROM urls ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+	query := `SELECT ` + urlColumns + `
+	          FROM urls WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+
+	rows, err := s.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanURLs(rows)
+}
+
+func (s *PostgresStorage) ListAfterID(afterID int64, limit int, includeDeleted bool) ([]*models.URL, error) {
+	filter := ` AND deleted_at IS NULL`
+	if includeDeleted {
+		filter = ``
+	}
+	query := `SELECT ` + urlColumns + `
+	          FROM urls WHERE id > $1` + filter + ` ORDER BY id LIMIT $2`
+
+	rows, err := s.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanURLs(rows)
+}
+
+func (s *PostgresStorage) ListDeleted(limit, offset int) ([]*models.URL, error) {
+	query := `SELECT ` + urlColumns + `
+	          FROM urls WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC LIMIT $1 OFFSET $2`
 
 	rows, err := s.db.Query(query, limit, offset)
 	if err != nil {
 		return nil, err
 	}
+
+	return scanURLs(rows)
+}
+
+func (s *PostgresStorage) Query(opts ListOptions) (*ListPage, error) {
+	opts, after, err := opts.prepare()
+	if err != nil {
+		return nil, err
+	}
+	query, args, countQuery, countArgs := opts.sqlQuery(after)
+	query, countQuery = numberPlaceholders(query), numberPlaceholders(countQuery)
+
+	var total int64
+	if err := s.db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := scanURLs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return opts.page(urls, total), nil
+}
+
+// tagDocument is the tsvector of a link's tags, weighted like its title.
+// Generated columns cannot read other tables, so it is built per query and
+// joined to search_document when ranking.
+const tagDocument = `COALESCE((SELECT setweight(to_tsvector('simple', regexp_replace(string_agg(tags.name, ' '), '[^[:alnum:]]+', ' ', 'g')), 'B')
+	FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE url_tags.url_id = urls.id), ''::tsvector)`
+
+// Search ranks matches with ts_rank, weighting the fields as search.Weights
+// does. Each term matches words it is a prefix of, or any part of a short
+// code. Tags are matched through url_tags and ranked through tagDocument.
+func (s *PostgresStorage) Search(query string, limit int) ([]SearchHit, error) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return []SearchHit{}, nil
+	}
+
+	// Terms hold only letters and digits, so they are safe inside tsquery syntax
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+		where = append(where, `(search_document @@ to_tsquery('simple', ?) OR short_code ILIKE ?
+			OR id IN (SELECT url_tags.url_id FROM url_tags JOIN tags ON tags.id = url_tags.tag_id
+				WHERE to_tsvector('simple', regexp_replace(tags.name, '[^[:alnum:]]+', ' ', 'g')) @@ to_tsquery('simple', ?)))`)
+		args = append(args, prefixes[i], "%"+term+"%", prefixes[i])
+	}
+
+	// Weights are listed from D (destination) up to A (short code)
+	rows, err := s.db.Query(numberPlaceholders(`SELECT `+urlColumns+`,
+		ts_rank('{0.25, 0.5, 0.75, 1}', search_document || `+tagDocument+`, to_tsquery('simple', ?)) AS rank
+		FROM urls WHERE `+strings.Join(where, " AND ")+` ORDER BY rank DESC, id DESC LIMIT ?`),
+		append(append([]any{strings.Join(prefixes, " | ")}, args...), limit)...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	var urls []*models.URL
+	hits := []SearchHit{}
 	for rows.Next() {
-		url := &models.URL{}
-		var lastAccessed sql.NullTime
-
-		err := rows.Scan(
-			&url.ID,
-			&url.ShortCode,
-			&url.OriginalURL,
-			&url.Clicks,
-			&url.CreatedAt,
-			&lastAccessed,
-		)
+		var rank float64
+		url, err := scanURL(scanWith{rows, []any{&rank}})
 		if err != nil {
 			return nil, err
 		}
+		hits = append(hits, SearchHit{URL: url, Score: rank})
+	}
+	return hits, rows.Err()
+}
+
+// numberPlaceholders rewrites ? placeholders into PostgreSQL's $1, $2, ...
+func numberPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *PostgresStorage) ListTags() ([]models.TagCount, error) {
+	rows, err := s.db.Query(listTagsQuery)
+	if err != nil {
+		return nil, err
+	}
+	return scanTagCounts(rows)
+}
+
+func (s *PostgresStorage) SaveCampaign(campaign *models.Campaign) error {
+	if campaign.CreatedAt.IsZero() {
+		campaign.CreatedAt = time.Now()
+	}
+	if campaign.UpdatedAt.IsZero() {
+		campaign.UpdatedAt = campaign.CreatedAt
+	}
+
+	query := `INSERT INTO campaigns (name, description, utm_source, utm_medium, utm_campaign, utm_term, utm_content, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+
+	utm := campaign.UTM
+	return s.db.QueryRow(query, campaign.Name, campaign.Description, utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content,
+		campaign.CreatedAt.UTC(), campaign.UpdatedAt.UTC()).Scan(&campaign.ID)
+}
+
+func (s *PostgresStorage) GetCampaign(id int64) (*models.Campaign, error) {
+	campaign, err := scanCampaign(s.db.QueryRow(`SELECT `+campaignColumns+` FROM campaigns WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrCampaignNotFound
+	}
+	return campaign, err
+}
+
+func (s *PostgresStorage) UpdateCampaign(campaign *models.Campaign) error {
+	if campaign.UpdatedAt.IsZero() {
+		campaign.UpdatedAt = time.Now()
+	}
+
+	query := `UPDATE campaigns SET name = $1, description = $2, utm_source = $3, utm_medium = $4, utm_campaign = $5, utm_term = $6, utm_content = $7,
+	          updated_at = $8 WHERE id = $9`
+
+	utm := campaign.UTM
+	result, err := s.db.Exec(query, campaign.Name, campaign.Description, utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content,
+		campaign.UpdatedAt.UTC(), campaign.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrCampaignNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresStorage) DeleteCampaign(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE urls SET campaign_id = 0 WHERE campaign_id = $1`, id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM campaigns WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrCampaignNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) ListCampaigns() ([]*models.Campaign, error) {
+	rows, err := s.db.Query(`SELECT ` + campaignColumns + ` FROM campaigns ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanCampaigns(rows)
+}
+
+func (s *PostgresStorage) SetCampaign(shortCodes []string, campaignID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if campaignID != 0 {
+		// Locking the campaign row keeps it from being deleted while links join it
+		var exists int
+		err := tx.QueryRow(`SELECT 1 FROM campaigns WHERE id = $1 FOR SHARE`, campaignID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return ErrCampaignNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, shortCode := range shortCodes {
+		result, err := tx.Exec(`UPDATE urls SET campaign_id = $1 WHERE short_code = $2`, campaignID, shortCode)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
 
-		if lastAccessed.Valid {
-			url.LastAccessed = &lastAccessed.Time
+		if rows == 0 {
+			return ErrNotFound
 		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) ScanCampaignClicks(campaignID int64, from, to time.Time, fn func(models.Click) error) error {
+	if _, err := s.GetCampaign(campaignID); err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(numberPlaceholders(campaignClicksQuery), campaignID, from.UTC(), to.UTC())
+	if err != nil {
+		return err
+	}
+	return scanClicks(rows, fn)
+}
+
+func (s *PostgresStorage) ScanClicks(shortCode string, fn func(models.Click) error) error {
+	rows, err := s.db.Query(numberPlaceholders(linkClicksQuery), shortCode)
+	if err != nil {
+		return err
+	}
+	return scanClicks(rows, fn)
+}
+
+func (s *PostgresStorage) SaveClicks(shortCode string, clicks []models.Click) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var urlID int64
+	err = tx.QueryRow(`SELECT id FROM urls WHERE short_code = $1`, shortCode).Scan(&urlID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO clicks (url_id, clicked_at, referrer, visitor, variant) VALUES ($1, $2, $3, $4, $5)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
 
-		urls = append(urls, url)
+	for _, click := range clicks {
+		if _, err := stmt.Exec(urlID, click.At.UTC(), click.Referrer, click.Visitor, click.Variant); err != nil {
+			return err
+		}
 	}
 
-	return urls, rows.Err()
+	return tx.Commit()
+}
+
+func (s *PostgresStorage) CountVariantClicks(shortCode string) (map[string]int64, error) {
+	rows, err := s.db.Query(numberPlaceholders(variantClicksQuery), shortCode)
+	if err != nil {
+		return nil, err
+	}
+	return scanVariantClicks(rows)
 }
 
 func (s *PostgresStorage) Close() error {
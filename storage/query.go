@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"url-shortener/models"
+)
+
+// Sort orders accepted by Query
+const (
+	SortCreatedAt    = "created_at"
+	SortClicks       = "clicks"
+	SortLastAccessed = "last_accessed"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// ListOptions selects, orders and pages the links returned by Query. Links in
+// the trash are never included. Ties are broken by ID so every backend returns
+// the same order.
+type ListOptions struct {
+	// Sort is one of the Sort constants; SortCreatedAt when empty
+	Sort string
+	// Ascending reverses the default order of newest, most clicked or most recently visited first
+	Ascending bool
+	Limit     int
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string
+
+	// CreatedAfter is inclusive and CreatedBefore exclusive
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MinClicks     *int64
+	MaxClicks     *int64
+	Owner         string
+	// Tags selects links carrying every one of the tags
+	Tags []string
+	// CampaignID selects the links of one campaign when not 0
+	CampaignID int64
+}
+
+// ListPage is one page of Query results
+type ListPage struct {
+	URLs []*models.URL
+	// Total counts the links matching the filters across all pages
+	Total int64
+	// NextCursor fetches the following page; empty on the last page
+	NextCursor string
+}
+
+// cursor is the position after the last link of a page. Links that never
+// had a visit sort as the zero time under SortLastAccessed.
+type cursor struct {
+	Sort      string    `json:"s"`
+	Ascending bool      `json:"a,omitempty"`
+	Time      time.Time `json:"t,omitempty"`
+	Clicks    int64     `json:"c,omitempty"`
+	ID        int64     `json:"i"`
+}
+
+// prepare validates the options, fills in defaults and decodes the cursor
+func (o ListOptions) prepare() (ListOptions, *cursor, error) {
+	switch o.Sort {
+	case "":
+		o.Sort = SortCreatedAt
+	case SortCreatedAt, SortClicks, SortLastAccessed:
+	default:
+		return o, nil, ErrInvalidSort
+	}
+	if o.Limit <= 0 {
+		o.Limit = 10
+	}
+
+	if o.Cursor == "" {
+		return o, nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return o, nil, ErrInvalidCursor
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return o, nil, ErrInvalidCursor
+	}
+	// A cursor only makes sense in the order it was issued for
+	if c.Sort != o.Sort || c.Ascending != o.Ascending {
+		return o, nil, ErrInvalidCursor
+	}
+	// The SQL backends compare times in UTC, see utcTime
+	c.Time = c.Time.UTC()
+	return o, c, nil
+}
+
+// cursorAfter encodes the position after url
+func (o ListOptions) cursorAfter(url *models.URL) string {
+	c := cursor{Sort: o.Sort, Ascending: o.Ascending, ID: url.ID}
+	switch o.Sort {
+	case SortCreatedAt:
+		c.Time = url.CreatedAt
+	case SortClicks:
+		c.Clicks = url.Clicks
+	case SortLastAccessed:
+		if url.LastAccessed != nil {
+			c.Time = *url.LastAccessed
+		}
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// page trims a result fetched with Limit+1 rows and sets the next cursor
+func (o ListOptions) page(urls []*models.URL, total int64) *ListPage {
+	page := &ListPage{URLs: urls, Total: total}
+	if page.URLs == nil {
+		page.URLs = []*models.URL{}
+	}
+	if len(urls) > o.Limit {
+		page.URLs = urls[:o.Limit]
+		page.NextCursor = o.cursorAfter(page.URLs[o.Limit-1])
+	}
+	return page
+}
+
+// matches applies the filters to a link in Go, for backends without SQL
+func (o ListOptions) matches(url *models.URL) bool {
+	switch {
+	case url.DeletedAt != nil:
+		return false
+	case o.CreatedAfter != nil && url.CreatedAt.Before(*o.CreatedAfter):
+		return false
+	case o.CreatedBefore != nil && !url.CreatedAt.Before(*o.CreatedBefore):
+		return false
+	case o.MinClicks != nil && url.Clicks < *o.MinClicks:
+		return false
+	case o.MaxClicks != nil && url.Clicks > *o.MaxClicks:
+		return false
+	case o.Owner != "" && url.Owner != o.Owner:
+		return false
+	case o.CampaignID != 0 && url.CampaignID != o.CampaignID:
+		return false
+	}
+	for _, tag := range o.Tags {
+		if !slices.Contains(url.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortKey is the value a link is ordered by, with its ID as tie breaker
+type sortKey struct {
+	time   time.Time
+	clicks int64
+	id     int64
+	code   string
+}
+
+func (o ListOptions) keyOf(url *models.URL) sortKey {
+	key := sortKey{id: url.ID, code: url.ShortCode}
+	switch o.Sort {
+	case SortCreatedAt:
+		key.time = url.CreatedAt
+	case SortClicks:
+		key.clicks = url.Clicks
+	case SortLastAccessed:
+		if url.LastAccessed != nil {
+			key.time = *url.LastAccessed
+		}
+	}
+	return key
+}
+
+// before reports whether a comes before b in the requested order
+func (o ListOptions) before(a, b sortKey) bool {
+	less, greater := a.id < b.id, a.id > b.id
+	if o.Sort == SortClicks {
+		if a.clicks != b.clicks {
+			less, greater = a.clicks < b.clicks, a.clicks > b.clicks
+		}
+	} else if !a.time.Equal(b.time) {
+		less, greater = a.time.Before(b.time), a.time.After(b.time)
+	}
+
+	if o.Ascending {
+		return less
+	}
+	return greater
+}
+
+// sortKeys orders keys and drops those at or before the cursor
+func (o ListOptions) sortKeys(keys []sortKey, after *cursor) []sortKey {
+	sort.Slice(keys, func(i, j int) bool { return o.before(keys[i], keys[j]) })
+	if after == nil {
+		return keys
+	}
+
+	position := sortKey{time: after.Time, clicks: after.Clicks, id: after.ID}
+	start := sort.Search(len(keys), func(i int) bool { return o.before(position, keys[i]) })
+	return keys[start:]
+}
+
+// sqlQuery builds the page and count queries for the SQL backends, with ?
+// placeholders. The page query selects urlColumns and asks for one row more
+// than the limit so the caller can tell whether another page follows.
+func (o ListOptions) sqlQuery(after *cursor) (string, []any, string, []any) {
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+	if o.CreatedAfter != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, o.CreatedAfter.UTC())
+	}
+	if o.CreatedBefore != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, o.CreatedBefore.UTC())
+	}
+	if o.MinClicks != nil {
+		where = append(where, "clicks >= ?")
+		args = append(args, *o.MinClicks)
+	}
+	if o.MaxClicks != nil {
+		where = append(where, "clicks <= ?")
+		args = append(args, *o.MaxClicks)
+	}
+	if o.Owner != "" {
+		where = append(where, "owner = ?")
+		args = append(args, o.Owner)
+	}
+	if o.CampaignID != 0 {
+		where = append(where, "campaign_id = ?")
+		args = append(args, o.CampaignID)
+	}
+	for _, tag := range o.Tags {
+		where = append(where, "id IN (SELECT url_tags.url_id FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE tags.name = ?)")
+		args = append(args, tag)
+	}
+
+	countQuery := `SELECT COUNT(*) FROM urls WHERE ` + strings.Join(where, " AND ")
+	countArgs := append([]any(nil), args...)
+
+	// Links never visited sort as the zero time, matching the cursor
+	column, value := "created_at", any(nil)
+	var sortArgs []any
+	switch o.Sort {
+	case SortClicks:
+		column = "clicks"
+		if after != nil {
+			value = after.Clicks
+		}
+	case SortLastAccessed:
+		column = "COALESCE(last_accessed, ?)"
+		sortArgs = []any{time.Time{}}
+		if after != nil {
+			value = after.Time
+		}
+	default:
+		if after != nil {
+			value = after.Time
+		}
+	}
+
+	direction, compare := "DESC", "<"
+	if o.Ascending {
+		direction, compare = "ASC", ">"
+	}
+
+	if after != nil {
+		where = append(where, "("+column+" "+compare+" ? OR ("+column+" = ? AND id "+compare+" ?))")
+		args = append(args, sortArgs...)
+		args = append(args, value)
+		args = append(args, sortArgs...)
+		args = append(args, value, after.ID)
+	}
+
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE ` + strings.Join(where, " AND ") +
+		` ORDER BY ` + column + ` ` + direction + `, id ` + direction + ` LIMIT ?`
+	args = append(args, sortArgs...)
+	args = append(args, o.Limit+1)
+
+	return query, args, countQuery, countArgs
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+func TestQuery(t *testing.T) {
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(hours int) *time.Time {
+		t := base.Add(time.Duration(hours) * time.Hour)
+		return &t
+	}
+
+	seed := []struct {
+		created  int
+		clicks   int64
+		accessed *time.Time
+		owner    string
+	}{
+		{0, 5, nil, "alice"},
+		{1, 2, at(3), "bob"},
+		{2, 5, at(1), "alice"},
+		{3, 0, nil, ""},
+		{4, 9, at(2), "alice"},
+		{5, 2, at(5), "bob"},
+		{6, 7, at(6), "alice"},
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, link := range seed {
+				store.Save(&models.URL{
+					ShortCode:    fmt.Sprintf("l%d", i),
+					OriginalURL:  "https://example.com",
+					Clicks:       link.clicks,
+					CreatedAt:    *at(link.created),
+					LastAccessed: link.accessed,
+					Owner:        link.owner,
+				})
+			}
+			store.SoftDelete("l6", time.Now())
+
+			// walk collects every page of a query, two links at a time
+			walk := func(opts ListOptions) (string, int64) {
+				opts.Limit = 2
+				codes := []string{}
+				var total int64
+				for pages := 0; pages < 10; pages++ {
+					page, err := store.Query(opts)
+					if err != nil {
+						t.Fatalf("Expected no error, got %v", err)
+					}
+					total = page.Total
+					for _, url := range page.URLs {
+						codes = append(codes, url.ShortCode)
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					opts.Cursor = page.NextCursor
+				}
+				return fmt.Sprint(codes), total
+			}
+
+			orders := []struct {
+				sort      string
+				ascending bool
+				expected  string
+			}{
+				{"", false, "[l5 l4 l3 l2 l1 l0]"},
+				{SortCreatedAt, true, "[l0 l1 l2 l3 l4 l5]"},
+				{SortClicks, false, "[l4 l2 l0 l5 l1 l3]"},
+				{SortClicks, true, "[l3 l1 l5 l0 l2 l4]"},
+				{SortLastAccessed, false, "[l5 l1 l4 l2 l3 l0]"},
+				{SortLastAccessed, true, "[l0 l3 l2 l4 l1 l5]"},
+			}
+			for _, order := range orders {
+				codes, total := walk(ListOptions{Sort: order.sort, Ascending: order.ascending})
+				if codes != order.expected || total != 6 {
+					t.Errorf("Expected %s (total 6) for sort %q ascending=%v, got %s (total %d)",
+						order.expected, order.sort, order.ascending, codes, total)
+				}
+			}
+
+			t.Run("Filters", func(t *testing.T) {
+				two, five := int64(2), int64(5)
+				filters := []struct {
+					opts     ListOptions
+					expected string
+					total    int64
+				}{
+					{ListOptions{Owner: "alice"}, "[l4 l2 l0]", 3},
+					{ListOptions{MinClicks: &two, MaxClicks: &five, Sort: SortClicks}, "[l2 l0 l5 l1]", 4},
+					{ListOptions{CreatedAfter: at(2), CreatedBefore: at(5)}, "[l4 l3 l2]", 3},
+				}
+				for _, filter := range filters {
+					codes, total := walk(filter.opts)
+					if codes != filter.expected || total != filter.total {
+						t.Errorf("Expected %s (total %d), got %s (total %d)", filter.expected, filter.total, codes, total)
+					}
+				}
+			})
+
+			t.Run("Reject bad options", func(t *testing.T) {
+				if _, err := store.Query(ListOptions{Sort: "title"}); err != ErrInvalidSort {
+					t.Errorf("Expected ErrInvalidSort, got %v", err)
+				}
+				if _, err := store.Query(ListOptions{Cursor: "not a cursor"}); err != ErrInvalidCursor {
+					t.Errorf("Expected ErrInvalidCursor, got %v", err)
+				}
+
+				page, _ := store.Query(ListOptions{Limit: 2})
+				if _, err := store.Query(ListOptions{Limit: 2, Sort: SortClicks, Cursor: page.NextCursor}); err != ErrInvalidCursor {
+					t.Errorf("Expected ErrInvalidCursor for a cursor of another sort, got %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestQueryLocalTime(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("PDT", -7*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			store.Save(&models.URL{ShortCode: "early", OriginalURL: "https://example.com", CreatedAt: now.Add(-30 * time.Minute)})
+			store.Save(&models.URL{ShortCode: "late", OriginalURL: "https://example.com", CreatedAt: now.Add(-20 * time.Minute)})
+			store.RecordClick(&models.Click{ShortCode: "late", At: now.Add(-10 * time.Minute)})
+			store.RecordClick(&models.Click{ShortCode: "early", At: now.Add(-5 * time.Minute)})
+
+			after := now.Add(-time.Hour).UTC()
+			page, err := store.Query(ListOptions{CreatedAfter: &after})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if page.Total != 2 {
+				t.Errorf("Expected 2 links created in the last hour, got %d", page.Total)
+			}
+
+			before := now.Add(-25 * time.Minute).UTC()
+			page, _ = store.Query(ListOptions{CreatedBefore: &before})
+			if len(page.URLs) != 1 || page.URLs[0].ShortCode != "early" {
+				t.Errorf("Expected only 'early' before the bound, got %d links", len(page.URLs))
+			}
+
+			var codes []string
+			opts := ListOptions{Sort: SortLastAccessed, Limit: 1}
+			for pages := 0; pages < 3; pages++ {
+				page, err := store.Query(opts)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				for _, url := range page.URLs {
+					codes = append(codes, url.ShortCode)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				opts.Cursor = page.NextCursor
+			}
+			if fmt.Sprint(codes) != "[early late]" {
+				t.Errorf("Expected [early late] by last visit, got %v", codes)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+func TestRedirectOptions(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			url := &models.URL{
+				ShortCode: "promo", OriginalURL: "https://example.com/a",
+				UTM: &models.UTMParams{Source: "mail", Campaign: "spring"}, UTMOverride: true, Passthrough: true,
+				Interstitial: true,
+			}
+			if err := store.Save(url); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			store.Save(&models.URL{ShortCode: "plain", OriginalURL: "https://example.com/b"})
+
+			t.Run("Store UTM parameters and passthrough", func(t *testing.T) {
+				got, err := store.Get("promo")
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if got.UTM == nil || *got.UTM != *url.UTM || !got.UTMOverride {
+					t.Errorf("Expected UTM parameters to round trip, got %v (override %t)", got.UTM, got.UTMOverride)
+				}
+				if !got.Passthrough || !got.Interstitial {
+					t.Errorf("Expected flags to round trip, got passthrough %t and interstitial %t", got.Passthrough, got.Interstitial)
+				}
+
+				plain, _ := store.Get("plain")
+				if plain.UTM != nil || plain.UTMOverride || plain.Passthrough || plain.Interstitial {
+					t.Errorf("Expected no redirect options, got %v (override %t, passthrough %t, interstitial %t)",
+						plain.UTM, plain.UTMOverride, plain.Passthrough, plain.Interstitial)
+				}
+			})
+
+			t.Run("Replace redirect options on update", func(t *testing.T) {
+				got, _ := store.Get("promo")
+				got.UTM.Medium = "email"
+				got.UTMOverride = false
+				got.Passthrough = false
+				got.Interstitial = false
+				revision := &models.URLRevision{ShortCode: "promo", Action: models.RevisionUpdate, CreatedAt: time.Now(), New: got.State()}
+				if err := store.UpdateWithRevision(got, revision); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+
+				updated, _ := store.Get("promo")
+				expected := models.UTMParams{Source: "mail", Medium: "email", Campaign: "spring"}
+				if updated.UTM == nil || *updated.UTM != expected || updated.UTMOverride || updated.Passthrough || updated.Interstitial {
+					t.Errorf("Expected %v without flags, got %v (override %t, passthrough %t, interstitial %t)",
+						expected, updated.UTM, updated.UTMOverride, updated.Passthrough, updated.Interstitial)
+				}
+
+				updated.UTM = nil
+				if err := store.Update(updated); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if cleared, _ := store.Get("promo"); cleared.UTM != nil {
+					t.Errorf("Expected UTM parameters to be removed, got %v", cleared.UTM)
+				}
+			})
+		})
+	}
+}
+
+func TestVariants(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			variants := []models.Variant{
+				{Name: "a", URL: "https://example.com/a", CanonicalURL: "https://example.com/a", Weight: 3},
+				{Name: "b", URL: "https://example.com/b", CanonicalURL: "https://example.com/b", Weight: 1},
+			}
+			url := &models.URL{ShortCode: "split", OriginalURL: "https://example.com", Variants: variants, Rotation: "sticky"}
+			if err := store.Save(url); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			store.Save(&models.URL{ShortCode: "plain", OriginalURL: "https://example.com/c"})
+
+			t.Run("Store variants and rotation", func(t *testing.T) {
+				got, err := store.Get("split")
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if len(got.Variants) != 2 || got.Variants[0] != variants[0] || got.Variants[1] != variants[1] || got.Rotation != "sticky" {
+					t.Errorf("Expected %v (sticky), got %v (%s)", variants, got.Variants, got.Rotation)
+				}
+
+				plain, _ := store.Get("plain")
+				if plain.Variants != nil || plain.Rotation != "" {
+					t.Errorf("Expected no variants, got %v (%s)", plain.Variants, plain.Rotation)
+				}
+			})
+
+			t.Run("Replace variants on update", func(t *testing.T) {
+				got, _ := store.Get("split")
+				got.Variants = got.Variants[:1]
+				got.Rotation = "random"
+				revision := &models.URLRevision{ShortCode: "split", Action: models.RevisionUpdate, CreatedAt: time.Now(), New: got.State()}
+				if err := store.UpdateWithRevision(got, revision); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if updated, _ := store.Get("split"); len(updated.Variants) != 1 || updated.Rotation != "random" {
+					t.Errorf("Expected 1 variant (random), got %v (%s)", updated.Variants, updated.Rotation)
+				}
+
+				got.Variants, got.Rotation = nil, ""
+				if err := store.Update(got); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if cleared, _ := store.Get("split"); cleared.Variants != nil || cleared.Rotation != "" {
+					t.Errorf("Expected variants to be removed, got %v (%s)", cleared.Variants, cleared.Rotation)
+				}
+			})
+
+			t.Run("Count clicks per variant", func(t *testing.T) {
+				now := time.Now()
+				for _, variant := range []string{"a", "b", "a", ""} {
+					if err := store.RecordClick(&models.Click{ShortCode: "split", At: now, Variant: variant}); err != nil {
+						t.Fatalf("Expected no error, got %v", err)
+					}
+				}
+				store.RecordClick(&models.Click{ShortCode: "plain", At: now, Variant: "a"})
+
+				counts, err := store.CountVariantClicks("split")
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if len(counts) != 2 || counts["a"] != 2 || counts["b"] != 1 {
+					t.Errorf("Expected a=2 and b=1, got %v", counts)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+func newSQLiteForTest(t *testing.T) *SQLiteStorage {
+	t.Helper()
+	store, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func newDurableForTest(t *testing.T, dir string) *InMemoryStorage {
+	t.Helper()
+	store, err := NewDurableInMemoryStorage(dir, DurabilityOptions{Fsync: FsyncNever})
+	if err != nil {
+		t.Fatalf("Failed to open durable memory store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// newPostgresForTest opens the database at databaseURL in a schema of its own,
+// dropped when the test ends, so tests never see each other's links
+func newPostgresForTest(t *testing.T, databaseURL string) *PostgresStorage {
+	t.Helper()
+	admin, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to open postgres: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	// lib/pq passes unknown settings on to the server; public keeps pg_trgm visible
+	searchPath := schema + ",public"
+	if u, err := url.Parse(databaseURL); err == nil && strings.HasPrefix(u.Scheme, "postgres") {
+		query := u.Query()
+		query.Set("search_path", searchPath)
+		u.RawQuery = query.Encode()
+		databaseURL = u.String()
+	} else {
+		databaseURL += " search_path=" + searchPath
+	}
+
+	store, err := NewPostgresStorage(databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to open postgres: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testStores returns a fresh instance of every backend that runs without a
+// server, and of PostgreSQL when DATABASE_URL points at a test database
+func testStores(t *testing.T) map[string]Storage {
+	stores := map[string]Storage{
+		"memory":         NewInMemoryStorage(),
+		"durable memory": newDurableForTest(t, t.TempDir()),
+		"sqlite":         newSQLiteForTest(t),
+	}
+	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
+		stores["postgres"] = newPostgresForTest(t, databaseURL)
+	}
+	return stores
+}
+
+func TestRevisions(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			url := &models.URL{ShortCode: "edit", OriginalURL: "https://example.com/a"}
+			if err := store.Save(url); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			create := &models.URLRevision{ShortCode: "edit", Action: models.RevisionCreate, Actor: "alice", CreatedAt: time.Now(), New: url.State()}
+			if err := store.AddRevision(create); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			t.Run("Update state without losing clicks", func(t *testing.T) {
+				stale, _ := store.Get("edit")
+				store.RecordClick(&models.Click{ShortCode: "edit", At: time.Now()})
+
+				old := stale.State()
+				expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+				stale.OriginalURL = "https://example.com/b"
+				stale.ExpiresAt = &expires
+				stale.Notes = "moved"
+				revision := &models.URLRevision{ShortCode: "edit", Action: models.RevisionUpdate, Actor: "bob", CreatedAt: time.Now(), Old: &old, New: stale.State()}
+				if err := store.UpdateWithRevision(stale, revision); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if revision.Revision != 2 {
+					t.Errorf("Expected revision 2, got %d", revision.Revision)
+				}
+
+				stored, _ := store.Get("edit")
+				if stored.Clicks != 1 {
+					t.Errorf("Expected 1 click, got %d", stored.Clicks)
+				}
+				if stored.OriginalURL != "https://example.com/b" || stored.Notes != "moved" {
+					t.Errorf("Expected updated state, got %s %q", stored.OriginalURL, stored.Notes)
+				}
+				if stored.ExpiresAt == nil || !stored.ExpiresAt.Equal(expires) {
+					t.Errorf("Expected expiry %v, got %v", expires, stored.ExpiresAt)
+				}
+			})
+
+			t.Run("List revisions in order", func(t *testing.T) {
+				revisions, err := store.ListRevisions("edit")
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if len(revisions) != 2 {
+					t.Fatalf("Expected 2 revisions, got %d", len(revisions))
+				}
+				if revisions[0].Action != models.RevisionCreate || revisions[0].Old != nil {
+					t.Errorf("Expected create revision first, got %+v", revisions[0])
+				}
+				if revisions[1].Actor != "bob" || revisions[1].Old.OriginalURL != "https://example.com/a" || revisions[1].New.OriginalURL != "https://example.com/b" {
+					t.Errorf("Unexpected update revision %+v", revisions[1])
+				}
+			})
+
+			t.Run("Refuse a revision taken by a concurrent change", func(t *testing.T) {
+				stale, _ := store.Get("edit")
+				stale.Notes = "overwritten"
+				revision := &models.URLRevision{ShortCode: "edit", Revision: 2, Action: models.RevisionUpdate, Actor: "carol", CreatedAt: time.Now(), New: stale.State()}
+				if err := store.UpdateWithRevision(stale, revision); err != ErrConflict {
+					t.Errorf("Expected ErrConflict, got %v", err)
+				}
+
+				stored, _ := store.Get("edit")
+				if stored.Notes != "moved" {
+					t.Errorf("Expected notes to stay 'moved', got %q", stored.Notes)
+				}
+				if revisions, _ := store.ListRevisions("edit"); len(revisions) != 2 {
+					t.Errorf("Expected 2 revisions, got %d", len(revisions))
+				}
+			})
+
+			t.Run("Update missing URL", func(t *testing.T) {
+				missing := &models.URL{ShortCode: "missing"}
+				err := store.UpdateWithRevision(missing, &models.URLRevision{ShortCode: "missing", Action: models.RevisionUpdate})
+				if err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound, got %v", err)
+				}
+				if revisions, _ := store.ListRevisions("missing"); len(revisions) != 0 {
+					t.Errorf("Expected no revisions, got %d", len(revisions))
+				}
+			})
+
+			t.Run("Delete removes history", func(t *testing.T) {
+				store.Delete("edit")
+				if revisions, _ := store.ListRevisions("edit"); len(revisions) != 0 {
+					t.Errorf("Expected no revisions, got %d", len(revisions))
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package storage
+
+import "url-shortener/models"
+
+// SearchHit is a link matching a search with its relevance. Scores only
+// compare hits of the same search on the same backend.
+type SearchHit struct {
+	URL   *models.URL
+	Score float64
+}
+
+// scanWith appends extra destinations to every Scan, so queries can select
+// values after urlColumns and still read the link with scanURL
+type scanWith struct {
+	rowScanner
+	extra []any
+}
+
+func (s scanWith) Scan(dest ...any) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+func TestSearch(t *testing.T) {
+	seed := []struct{ code, url, notes string }{
+		{"docs", "https://golang.org/doc/effective_go", "Style guide for Go"},
+		{"gofmt1", "https://pkg.go.dev/cmd/gofmt", ""},
+		{"rust", "https://www.rust-lang.org/learn", "The book"},
+		{"python", "https://example.com/snake", ""},
+		{"snake", "https://example.com/python", ""},
+		{"old", "https://golang.org/old", ""},
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, link := range seed {
+				store.Save(&models.URL{ShortCode: link.code, OriginalURL: link.url, Notes: link.notes})
+			}
+			store.SavePreview("rust", &models.LinkPreview{Title: "Learn Rust", FetchedAt: time.Now()})
+			store.SoftDelete("old", time.Now())
+
+			// codes returns the short codes found, sorted unless ranked is set
+			codes := func(query string, ranked bool) string {
+				hits, err := store.Search(query, 10)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				found := []string{}
+				for _, hit := range hits {
+					found = append(found, hit.URL.ShortCode)
+				}
+				if !ranked {
+					sort.Strings(found)
+				}
+				return fmt.Sprint(found)
+			}
+
+			t.Run("Match every term as a word prefix", func(t *testing.T) {
+				searches := []struct{ query, expected string }{
+					{"golang", "[docs]"},
+					{"go", "[docs gofmt1]"},
+					{"learn RUST", "[rust]"},
+					{"style guide", "[docs]"},
+					{"style rust", "[]"},
+					{"olang", "[]"},
+					{"  ", "[]"},
+				}
+				for _, s := range searches {
+					if found := codes(s.query, false); found != s.expected {
+						t.Errorf("Expected %s for %q, got %s", s.expected, s.query, found)
+					}
+				}
+			})
+
+			t.Run("Rank short codes above destinations", func(t *testing.T) {
+				if found := codes("python", true); found != "[python snake]" {
+					t.Errorf("Expected [python snake], got %s", found)
+				}
+			})
+
+			t.Run("Follow edits and deletes", func(t *testing.T) {
+				url, _ := store.Get("rust")
+				url.Notes = "crab"
+				store.Update(url)
+				store.Delete("gofmt1")
+				store.Restore("old")
+
+				searches := []struct{ query, expected string }{
+					{"crab", "[rust]"},
+					{"book", "[]"},
+					{"gofmt", "[]"},
+					{"golang", "[docs old]"},
+				}
+				for _, s := range searches {
+					if found := codes(s.query, false); found != s.expected {
+						t.Errorf("Expected %s for %q, got %s", s.expected, s.query, found)
+					}
+				}
+			})
+
+			t.Run("Rank tags above destinations", func(t *testing.T) {
+				store.Save(&models.URL{ShortCode: "launch", OriginalURL: "https://example.com/rocket"})
+				store.Save(&models.URL{ShortCode: "tagged", OriginalURL: "https://example.com/x", Tags: []string{"rocket"}})
+
+				if found := codes("rocket", true); found != "[tagged launch]" {
+					t.Errorf("Expected [tagged launch], got %s", found)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package storage
+
+// skiplistMaxLevel supports well over a billion keys at p = 1/4
+const skiplistMaxLevel = 16
+
+// skiplist is an ordered set of keys that also supports lookup by rank.
+// Every link records how many bottom-level nodes it skips, so seeking to the
+// n-th key is O(log n) like seeking to a key. It is not safe for concurrent use.
+type skiplist[K any] struct {
+	less   func(a, b K) bool
+	head   *skipNode[K]
+	level  int
+	length int
+	seed   uint64
+}
+
+type skipNode[K any] struct {
+	key  K
+	next []*skipNode[K]
+	// span[i] is the number of bottom-level steps next[i] advances
+	span []int
+}
+
+func newSkiplist[K any](less func(a, b K) bool) *skiplist[K] {
+	return &skiplist[K]{
+		less:  less,
+		head:  &skipNode[K]{next: make([]*skipNode[K], skiplistMaxLevel), span: make([]int, skiplistMaxLevel)},
+		level: 1,
+		seed:  0x9E3779B97F4A7C15,
+	}
+}
+
+// Len returns the number of keys
+func (l *skiplist[K]) Len() int {
+	return l.length
+}
+
+// randomLevel draws a level with P(level > n) = 4^-n
+func (l *skiplist[K]) randomLevel() int {
+	// xorshift64 keeps levels deterministic and avoids contention on math/rand
+	l.seed ^= l.seed << 13
+	l.seed ^= l.seed >> 7
+	l.seed ^= l.seed << 17
+
+	level := 1
+	for bits := l.seed; level < skiplistMaxLevel && bits&3 == 0; bits >>= 2 {
+		level++
+	}
+	return level
+}
+
+// Insert adds key; keys comparing equal to an existing key are kept side by side
+func (l *skiplist[K]) Insert(key K) {
+	var update [skiplistMaxLevel]*skipNode[K]
+	var rank [skiplistMaxLevel]int
+
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for node.next[i] != nil && l.less(node.next[i].key, key) {
+			rank[i] += node.span[i]
+			node = node.next[i]
+		}
+		update[i] = node
+	}
+
+	level := l.randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+			l.head.span[i] = l.length
+		}
+		l.level = level
+	}
+
+	created := &skipNode[K]{key: key, next: make([]*skipNode[K], level), span: make([]int, level)}
+	for i := 0; i < level; i++ {
+		created.next[i] = update[i].next[i]
+		update[i].next[i] = created
+
+		created.span[i] = update[i].span[i] - (rank[0] - rank[i])
+		update[i].span[i] = rank[0] - rank[i] + 1
+	}
+	for i := level; i < l.level; i++ {
+		update[i].span[i]++
+	}
+	l.length++
+}
+
+// Delete removes one key equal to key and reports whether it was present
+func (l *skiplist[K]) Delete(key K) bool {
+	var update [skiplistMaxLevel]*skipNode[K]
+
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && l.less(node.next[i].key, key) {
+			node = node.next[i]
+		}
+		update[i] = node
+	}
+
+	target := node.next[0]
+	if target == nil || l.less(key, target.key) {
+		return false
+	}
+
+	for i := 0; i < l.level; i++ {
+		if update[i].next[i] == target {
+			update[i].span[i] += target.span[i] - 1
+			update[i].next[i] = target.next[i]
+		} else {
+			update[i].span[i]--
+		}
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+	l.length--
+	return true
+}
+
+// At returns the node holding the key with the given zero-based rank, or nil
+func (l *skiplist[K]) At(rank int) *skipNode[K] {
+	if rank < 0 || rank >= l.length {
+		return nil
+	}
+
+	node := l.head
+	traversed := -1
+	for i := l.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && traversed+node.span[i] <= rank {
+			traversed += node.span[i]
+			node = node.next[i]
+		}
+		if traversed == rank {
+			return node
+		}
+	}
+	return nil
+}
+
+// After returns the node holding the first key greater than key, or nil
+func (l *skiplist[K]) After(key K) *skipNode[K] {
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && !l.less(key, node.next[i].key) {
+			node = node.next[i]
+		}
+	}
+	return node.next[0]
+}
+
+// Seek returns the node holding the first key not less than key, or nil
+func (l *skiplist[K]) Seek(key K) *skipNode[K] {
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && l.less(node.next[i].key, key) {
+			node = node.next[i]
+		}
+	}
+	return node.next[0]
+}
+
+// Next returns the node holding the following key, or nil at the end
+func (n *skipNode[K]) Next() *skipNode[K] {
+	return n.next[0]
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSkiplist(t *testing.T) {
+	list := newSkiplist(func(a, b int) bool { return a < b })
+	rng := rand.New(rand.NewSource(1))
+
+	var expected []int
+	for i := 0; i < 2000; i++ {
+		key := rng.Intn(500)
+		list.Insert(key)
+		expected = append(expected, key)
+	}
+
+	// Delete about half, including keys that were never inserted
+	for i := 0; i < 1500; i++ {
+		key := rng.Intn(600)
+		deleted := list.Delete(key)
+
+		found := -1
+		for j, k := range expected {
+			if k == key {
+				found = j
+				break
+			}
+		}
+		if deleted != (found >= 0) {
+			t.Fatalf("Expected Delete(%d) to return %v", key, found >= 0)
+		}
+		if found >= 0 {
+			expected = append(expected[:found], expected[found+1:]...)
+		}
+	}
+	sort.Ints(expected)
+
+	t.Run("Keep keys in order", func(t *testing.T) {
+		if list.Len() != len(expected) {
+			t.Fatalf("Expected %d keys, got %d", len(expected), list.Len())
+		}
+		i := 0
+		for node := list.At(0); node != nil; node = node.Next() {
+			if node.key != expected[i] {
+				t.Fatalf("Expected key %d at %d, got %d", expected[i], i, node.key)
+			}
+			i++
+		}
+	})
+
+	t.Run("Seek by rank", func(t *testing.T) {
+		for rank, key := range expected {
+			if node := list.At(rank); node == nil || node.key != key {
+				t.Fatalf("Expected key %d at rank %d, got %v", key, rank, node)
+			}
+		}
+		if list.At(len(expected)) != nil || list.At(-1) != nil {
+			t.Error("Expected nil outside the list")
+		}
+	})
+
+	t.Run("Seek after key", func(t *testing.T) {
+		for _, key := range []int{-1, 0, 250, 499, 600} {
+			want := sort.SearchInts(expected, key+1)
+			node := list.After(key)
+			if want == len(expected) {
+				if node != nil {
+					t.Errorf("Expected nil after %d, got %d", key, node.key)
+				}
+				continue
+			}
+			if node == nil || node.key != expected[want] {
+				t.Errorf("Expected %d after %d, got %v", expected[want], key, node)
+			}
+		}
+	})
+
+	t.Run("Seek to key", func(t *testing.T) {
+		for _, key := range []int{-1, 0, 250, 499, 600} {
+			want := sort.SearchInts(expected, key)
+			node := list.Seek(key)
+			if want == len(expected) {
+				if node != nil {
+					t.Errorf("Expected nil at %d, got %d", key, node.key)
+				}
+				continue
+			}
+			if node == nil || node.key != expected[want] {
+				t.Errorf("Expected %d at %d, got %v", expected[want], key, node)
+			}
+		}
+	})
+}
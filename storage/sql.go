@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+	"url-shortener/models"
+)
+
+// urlColumns lists the columns selected for every URL query, in scanURL order.
+// Tags come from the url_tags join table as one comma separated string; tag
+// names never contain commas. string_agg needs SQLite 3.44 or later.
+const urlColumns = `id, short_code, original_url, canonical_url, clicks, created_at, last_accessed,
+	preview_title, preview_description, preview_image, preview_site_name, preview_twitter_card, preview_favicon, preview_fetched_at,
+	redirect_type, cache_control, expires_at, notes, deleted_at, owner, title, campaign_id,
+	utm_source, utm_medium, utm_campaign, utm_term, utm_content, utm_override, passthrough, interstitial, variants, rotation,
+	(SELECT string_agg(tags.name, ',') FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE url_tags.url_id = urls.id)`
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanURL reads a single URL row selected with urlColumns
+func scanURL(row rowScanner) (*models.URL, error) {
+	url := &models.URL{}
+	preview := &models.LinkPreview{}
+	var lastAccessed, previewFetchedAt, expiresAt, deletedAt sql.NullTime
+	var tags sql.NullString
+	var utm models.UTMParams
+	var variants string
+
+	err := row.Scan(
+		&url.ID,
+		&url.ShortCode,
+		&url.OriginalURL,
+		&url.CanonicalURL,
+		&url.Clicks,
+		&url.CreatedAt,
+		&lastAccessed,
+		&preview.Title,
+		&preview.Description,
+		&preview.ImageURL,
+		&preview.SiteName,
+		&preview.TwitterCard,
+		&preview.FaviconURL,
+		&previewFetchedAt,
+		&url.RedirectType,
+		&url.CacheControl,
+		&expiresAt,
+		&url.Notes,
+		&deletedAt,
+		&url.Owner,
+		&url.Title,
+		&url.CampaignID,
+		&utm.Source,
+		&utm.Medium,
+		&utm.Campaign,
+		&utm.Term,
+		&utm.Content,
+		&url.UTMOverride,
+		&url.Passthrough,
+		&url.Interstitial,
+		&variants,
+		&url.Rotation,
+		&tags,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastAccessed.Valid {
+		url.LastAccessed = &lastAccessed.Time
+	}
+	if expiresAt.Valid {
+		url.ExpiresAt = &expiresAt.Time
+	}
+	if deletedAt.Valid {
+		url.DeletedAt = &deletedAt.Time
+	}
+	if !utm.IsZero() {
+		url.UTM = &utm
+	}
+	if variants != "" {
+		if err := json.Unmarshal([]byte(variants), &url.Variants); err != nil {
+			return nil, err
+		}
+	}
+	if tags.String != "" {
+		url.Tags = strings.Split(tags.String, ",")
+		sort.Strings(url.Tags)
+	}
+	if previewFetchedAt.Valid {
+		preview.FetchedAt = previewFetchedAt.Time
+		url.Preview = preview
+	}
+
+	return url, nil
+}
+
+// longestPrefixQuery selects the URL with the longest of n candidate short
+// codes, as listed by codePrefixes
+func longestPrefixQuery(n int) string {
+	return `SELECT ` + urlColumns + ` FROM urls WHERE short_code IN (?` + strings.Repeat(`, ?`, n-1) + `)
+	ORDER BY LENGTH(short_code) DESC LIMIT 1`
+}
+
+// prefixArgs converts the candidate short codes of path into query arguments
+func prefixArgs(path string) []any {
+	var args []any
+	for _, code := range codePrefixes(path) {
+		args = append(args, code)
+	}
+	return args
+}
+
+// utmOf returns the UTM parameters of a link, all empty when it has none
+func utmOf(url *models.URL) models.UTMParams {
+	if url.UTM == nil {
+		return models.UTMParams{}
+	}
+	return *url.UTM
+}
+
+// utcTime converts an optional time to UTC. Both SQL backends keep times
+// without their zone, and SQLite compares them as text, so every time is
+// written and compared in UTC.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// variantsOf encodes the variants of a link for the variants column, empty
+// when it has none
+func variantsOf(url *models.URL) string {
+	if len(url.Variants) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(url.Variants)
+	return string(data)
+}
+
+// variantClicksQuery counts the clicks on each variant of a link
+const variantClicksQuery = `SELECT clicks.variant, COUNT(*)
+	FROM clicks JOIN urls ON urls.id = clicks.url_id
+	WHERE urls.short_code = ? AND clicks.variant != ''
+	GROUP BY clicks.variant`
+
+// scanVariantClicks reads the rows of variantClicksQuery
+func scanVariantClicks(rows *sql.Rows) (map[string]int64, error) {
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var variant string
+		var clicks int64
+		if err := rows.Scan(&variant, &clicks); err != nil {
+			return nil, err
+		}
+		counts[variant] = clicks
+	}
+	return counts, rows.Err()
+}
+
+// scanURLs reads every row selected with urlColumns
+func scanURLs(rows *sql.Rows) ([]*models.URL, error) {
+	defer rows.Close()
+
+	var urls []*models.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
+
+// revisionColumns lists the columns selected for revision queries, in scanRevisions order
+const revisionColumns = `id, short_code, revision, action, actor, created_at, old_state, new_state`
+
+// encodeStates serializes the before and after states of a revision
+func encodeStates(revision *models.URLRevision) (sql.NullString, string, error) {
+	var old sql.NullString
+	if revision.Old != nil {
+		data, err := json.Marshal(revision.Old)
+		if err != nil {
+			return old, "", err
+		}
+		old = sql.NullString{String: string(data), Valid: true}
+	}
+
+	data, err := json.Marshal(revision.New)
+	if err != nil {
+		return old, "", err
+	}
+	return old, string(data), nil
+}
+
+// scanRevisions reads every row selected with revisionColumns
+func scanRevisions(rows *sql.Rows) ([]*models.URLRevision, error) {
+	defer rows.Close()
+
+	revisions := []*models.URLRevision{}
+	for rows.Next() {
+		revision := &models.URLRevision{}
+		var old sql.NullString
+		var state string
+
+		err := rows.Scan(
+			&revision.ID,
+			&revision.ShortCode,
+			&revision.Revision,
+			&revision.Action,
+			&revision.Actor,
+			&revision.CreatedAt,
+			&old,
+			&state,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if old.Valid {
+			revision.Old = &models.LinkState{}
+			if err := json.Unmarshal([]byte(old.String), revision.Old); err != nil {
+				return nil, err
+			}
+		}
+		if err := json.Unmarshal([]byte(state), &revision.New); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// listTagsQuery counts the links outside the trash carrying each tag
+const listTagsQuery = `SELECT tags.name, COUNT(*) FROM tags
+	JOIN url_tags ON url_tags.tag_id = tags.id
+	JOIN urls ON urls.id = url_tags.url_id
+	WHERE urls.deleted_at IS NULL
+	GROUP BY tags.name ORDER BY COUNT(*) DESC, tags.name`
+
+// scanTagCounts reads the rows of listTagsQuery
+func scanTagCounts(rows *sql.Rows) ([]models.TagCount, error) {
+	defer rows.Close()
+
+	counts := []models.TagCount{}
+	for rows.Next() {
+		var count models.TagCount
+		if err := rows.Scan(&count.Name, &count.Links); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// campaignColumns lists the columns selected for campaign queries, in scanCampaign order
+const campaignColumns = `id, name, description, utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+	created_at, updated_at, (SELECT COUNT(*) FROM urls WHERE urls.campaign_id = campaigns.id)`
+
+// scanCampaign reads a single campaign row selected with campaignColumns
+func scanCampaign(row rowScanner) (*models.Campaign, error) {
+	campaign := &models.Campaign{}
+	err := row.Scan(
+		&campaign.ID,
+		&campaign.Name,
+		&campaign.Description,
+		&campaign.UTM.Source,
+		&campaign.UTM.Medium,
+		&campaign.UTM.Campaign,
+		&campaign.UTM.Term,
+		&campaign.UTM.Content,
+		&campaign.CreatedAt,
+		&campaign.UpdatedAt,
+		&campaign.Links,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+// scanCampaigns reads every row selected with campaignColumns
+func scanCampaigns(rows *sql.Rows) ([]*models.Campaign, error) {
+	defer rows.Close()
+
+	campaigns := []*models.Campaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+// campaignClicksQuery selects the clicks on the links of a campaign in a time
+// range, oldest first. Click times are stored in UTC.
+const campaignClicksQuery = `SELECT urls.short_code, clicks.clicked_at, clicks.referrer, clicks.visitor, clicks.variant
+	FROM clicks JOIN urls ON urls.id = clicks.url_id
+	WHERE urls.campaign_id = ? AND clicks.clicked_at >= ? AND clicks.clicked_at < ?
+	ORDER BY clicks.clicked_at, clicks.id`
+
+// linkClicksQuery selects the clicks on one link in the order they were recorded
+const linkClicksQuery = `SELECT urls.short_code, clicks.clicked_at, clicks.referrer, clicks.visitor, clicks.variant
+	FROM clicks JOIN urls ON urls.id = clicks.url_id
+	WHERE urls.short_code = ?
+	ORDER BY clicks.id`
+
+// scanClicks calls fn with every row of campaignClicksQuery or linkClicksQuery
+func scanClicks(rows *sql.Rows, fn func(models.Click) error) error {
+	defer rows.Close()
+
+	for rows.Next() {
+		var click models.Click
+		if err := rows.Scan(&click.ShortCode, &click.At, &click.Referrer, &click.Visitor, &click.Variant); err != nil {
+			return err
+		}
+		if err := fn(click); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -2,8 +2,12 @@ package storage
 
 import (
 	"database/sql"
+	"log"
+	"sort"
+	"strings"
 	"time"
 	"url-shortener/models"
+	"url-shortener/search"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -11,6 +15,8 @@ import (
 // SQLiteStorage implements Storage interface using SQLite
 type SQLiteStorage struct {
 	db *sql.DB
+	// fts is set when SQLite was built with FTS5 and urls_fts is kept up to date
+	fts bool
 }
 
 func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
@@ -39,15 +45,293 @@ func (s *SQLiteStorage) createTable() error {
 		last_accessed DATETIME
 	);
 	CREATE INDEX IF NOT EXISTS idx_short_code ON urls(short_code);
+	CREATE TABLE IF NOT EXISTS url_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_code TEXT NOT NULL,
+		revision INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		old_state TEXT,
+		new_state TEXT NOT NULL,
+		UNIQUE (short_code, revision)
+	);
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS url_tags (
+		url_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (url_id, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_url_tags_tag ON url_tags(tag_id);
+	CREATE TABLE IF NOT EXISTS campaigns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		utm_source TEXT NOT NULL DEFAULT '',
+		utm_medium TEXT NOT NULL DEFAULT '',
+		utm_campaign TEXT NOT NULL DEFAULT '',
+		utm_term TEXT NOT NULL DEFAULT '',
+		utm_content TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS clicks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url_id INTEGER NOT NULL,
+		clicked_at DATETIME NOT NULL,
+		referrer TEXT NOT NULL DEFAULT '',
+		visitor TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_clicks_url ON clicks(url_id, clicked_at);
 	`
-	_, err := s.db.Exec(query)
+	if _, err := s.db.Exec(query); err != nil {
+		return err
+	}
+
+	// Columns added after the original schema
+	columns := []struct{ name, definition string }{
+		{"canonical_url", "TEXT NOT NULL DEFAULT ''"},
+		{"preview_title", "TEXT NOT NULL DEFAULT ''"},
+		{"preview_description", "TEXT NOT NULL DEFAULT ''"},
+		{"preview_image", "TEXT NOT NULL DEFAULT ''"},
+		{"preview_site_name", "TEXT NOT NULL DEFAULT ''"},
+		{"preview_twitter_card", "TEXT NOT NULL DEFAULT ''"},
+		{"preview_favicon", "TEXT NOT NULL DEFAULT ''"},
+		{"preview_fetched_at", "DATETIME"},
+		{"redirect_type", "INTEGER NOT NULL DEFAULT 0"},
+		{"cache_control", "TEXT NOT NULL DEFAULT ''"},
+		{"expires_at", "DATETIME"},
+		{"notes", "TEXT NOT NULL DEFAULT ''"},
+		{"deleted_at", "DATETIME"},
+		{"owner", "TEXT NOT NULL DEFAULT ''"},
+		{"title", "TEXT NOT NULL DEFAULT ''"},
+		{"campaign_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"utm_source", "TEXT NOT NULL DEFAULT ''"},
+		{"utm_medium", "TEXT NOT NULL DEFAULT ''"},
+		{"utm_campaign", "TEXT NOT NULL DEFAULT ''"},
+		{"utm_term", "TEXT NOT NULL DEFAULT ''"},
+		{"utm_content", "TEXT NOT NULL DEFAULT ''"},
+		{"utm_override", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"passthrough", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"interstitial", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"variants", "TEXT NOT NULL DEFAULT ''"},
+		{"rotation", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, column := range columns {
+		if err := s.addColumnIfMissing("urls", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	if err := s.addColumnIfMissing("clicks", "variant", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_urls_campaign ON urls(campaign_id)`); err != nil {
+		return err
+	}
+
+	return s.createSearchIndex()
+}
+
+// searchTable is the FTS5 index used by Search. SQLite keeps the statement
+// as written, so an index created by an older version is recognized by its
+// definition and rebuilt.
+const searchTable = `CREATE VIRTUAL TABLE urls_fts USING fts5(short_code, destination, title, notes, tags, tokenize = 'unicode61 remove_diacritics 0')`
+
+// searchRow indexes the links selected by where; a custom title hides the
+// one found on the destination page
+func searchRow(where string) string {
+	return `INSERT INTO urls_fts (rowid, short_code, destination, title, notes, tags)
+		SELECT id, short_code, original_url || ' ' || canonical_url, CASE WHEN title <> '' THEN title ELSE preview_title END, notes,
+		COALESCE((SELECT string_agg(tags.name, ' ') FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE url_tags.url_id = urls.id), '')
+		FROM urls WHERE ` + where + `;`
+}
+
+// searchTriggers keep urls_fts in step with urls and url_tags
+var searchTriggers = []struct{ name, definition string }{
+	{"urls_fts_insert", `AFTER INSERT ON urls BEGIN ` + searchRow("id = new.id") + ` END`},
+	{"urls_fts_update", `AFTER UPDATE OF original_url, canonical_url, preview_title, title, notes ON urls BEGIN
+		DELETE FROM urls_fts WHERE rowid = old.id; ` + searchRow("id = new.id") + ` END`},
+	{"urls_fts_delete", `AFTER DELETE ON urls BEGIN DELETE FROM urls_fts WHERE rowid = old.id; END`},
+	{"urls_fts_tag_insert", `AFTER INSERT ON url_tags BEGIN
+		DELETE FROM urls_fts WHERE rowid = new.url_id; ` + searchRow("id = new.url_id") + ` END`},
+	{"urls_fts_tag_delete", `AFTER DELETE ON url_tags BEGIN
+		DELETE FROM urls_fts WHERE rowid = old.url_id; ` + searchRow("id = old.url_id") + ` END`},
+}
+
+// dropSearchTriggers removes the triggers of any version of the index
+func (s *SQLiteStorage) dropSearchTriggers() error {
+	rows, err := s.db.Query(`SELECT name FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'urls_fts%'`)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, err := s.db.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSearchIndex sets up the FTS5 index used by Search. go-sqlite3 only
+// includes FTS5 when built with the sqlite_fts5 tag; without it Search falls
+// back to LIKE. A database opened by a build without FTS5 loses its triggers,
+// so the index is rebuilt the next time a build with FTS5 opens it.
+func (s *SQLiteStorage) createSearchIndex() error {
+	var definition string
+	var triggers int
+	err := s.db.QueryRow(`SELECT
+		COALESCE(MAX(CASE WHEN type = 'table' AND name = 'urls_fts' THEN sql END), ''),
+		COUNT(CASE WHEN type = 'trigger' AND name LIKE 'urls_fts%' THEN 1 END)
+		FROM sqlite_master`).Scan(&definition, &triggers)
+	if err != nil {
+		return err
+	}
+
+	current := definition == searchTable
+	switch {
+	case current:
+		_, err = s.db.Exec(`SELECT 1 FROM urls_fts LIMIT 0`)
+	case definition != "":
+		if _, err = s.db.Exec(`DROP TABLE urls_fts`); err == nil {
+			_, err = s.db.Exec(searchTable)
+		}
+	default:
+		_, err = s.db.Exec(searchTable)
+	}
+	if err != nil {
+		if !strings.Contains(err.Error(), "no such module") {
+			return err
+		}
+		log.Printf("SQLite was built without FTS5, links will be searched with LIKE and ranked in Go; build with -tags sqlite_fts5")
+		// Triggers writing to a table this build cannot open would fail every write
+		return s.dropSearchTriggers()
+	}
+
+	if !current || triggers != len(searchTriggers) {
+		if err := s.dropSearchTriggers(); err != nil {
+			return err
+		}
+		if _, err := s.db.Exec(`DELETE FROM urls_fts; ` + searchRow("1")); err != nil {
+			return err
+		}
+		for _, trigger := range searchTriggers {
+			if _, err := s.db.Exec(`CREATE TRIGGER ` + trigger.name + ` ` + trigger.definition); err != nil {
+				return err
+			}
+		}
+	}
+	s.fts = true
+	return nil
+}
+
+// addColumnIfMissing upgrades tables created by older versions of the schema
+func (s *SQLiteStorage) addColumnIfMissing(table, column, definition string) error {
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
 	return err
 }
 
 func (s *SQLiteStorage) Save(url *models.URL) error {
-	query := `INSERT INTO urls (short_code, original_url, clicks, created_at) VALUES (?, ?, ?, ?)`
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.insertURL(tx, url); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) SaveBatch(urls []*models.URL, revisions []*models.URLRevision, atomic bool) ([]error, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	errs := make([]error, len(urls))
+	for i, url := range urls {
+		// A savepoint per item lets the rest of the batch survive a failed insert
+		if _, err := tx.Exec(`SAVEPOINT batch_item`); err != nil {
+			return nil, err
+		}
+
+		err := s.insertURL(tx, url)
+		if err == nil && revisions[i] != nil {
+			revisions[i].ShortCode = url.ShortCode
+			err = s.insertRevision(tx, revisions[i])
+		}
 
-	result, err := s.db.Exec(query, url.ShortCode, url.OriginalURL, 0, time.Now())
+		if err != nil {
+			errs[i] = err
+			if atomic {
+				return errs, nil
+			}
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT batch_item`); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec(`RELEASE SAVEPOINT batch_item`); err != nil {
+			return nil, err
+		}
+	}
+
+	return errs, tx.Commit()
+}
+
+// insertURL inserts a new URL through db or a transaction
+func (s *SQLiteStorage) insertURL(q queryer, url *models.URL) error {
+	query := `INSERT INTO urls (short_code, original_url, canonical_url, redirect_type, cache_control, expires_at, title, notes,
+	          utm_source, utm_medium, utm_campaign, utm_term, utm_content, utm_override, passthrough, interstitial, variants, rotation,
+	          clicks, created_at, last_accessed, owner, campaign_id)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	// Imported links keep their original stats
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = time.Now()
+	}
+	utm := utmOf(url)
+	result, err := q.Exec(query, url.ShortCode, url.OriginalURL, url.CanonicalURL, url.RedirectType, url.CacheControl,
+		utcTime(url.ExpiresAt), url.Title, url.Notes, utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content, url.UTMOverride,
+		url.Passthrough, url.Interstitial, variantsOf(url), url.Rotation, url.Clicks, url.CreatedAt.UTC(), utcTime(url.LastAccessed), url.Owner, url.CampaignID)
 	if err != nil {
 		// Check if it's a unique constraint error
 		if err.Error() == "UNIQUE constraint failed: urls.short_code" {
@@ -62,24 +346,33 @@ func (s *SQLiteStorage) Save(url *models.URL) error {
 	}
 
 	url.ID = id
-	return nil
+	return s.setTags(q, url.ShortCode, url.Tags)
 }
 
-func (s *SQLiteStorage) Get(shortCode string) (*models.URL, error) {
-	query := `SELECT id, short_code, original_url, clicks, created_at, last_accessed FROM urls WHERE short_code = ?`
+// setTags replaces the tags of a link, adding tag names not seen before
+func (s *SQLiteStorage) setTags(q queryer, shortCode string, tags []string) error {
+	_, err := q.Exec(`DELETE FROM url_tags WHERE url_id = (SELECT id FROM urls WHERE short_code = ?)`, shortCode)
+	if err != nil {
+		return err
+	}
 
-	url := &models.URL{}
-	var lastAccessed sql.NullTime
+	for _, tag := range tags {
+		if _, err := q.Exec(`INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING`, tag); err != nil {
+			return err
+		}
+		_, err := q.Exec(`INSERT INTO url_tags (url_id, tag_id)
+		          SELECT urls.id, tags.id FROM urls, tags WHERE urls.short_code = ? AND tags.name = ?`, shortCode, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	err := s.db.QueryRow(query, shortCode).Scan(
-		&url.ID,
-		&url.ShortCode,
-		&url.OriginalURL,
-		&url.Clicks,
-		&url.CreatedAt,
-		&lastAccessed,
-	)
+func (s *SQLiteStorage) Get(shortCode string) (*models.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE short_code = ?`
 
+	url, err := scanURL(s.db.QueryRow(query, shortCode))
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	}
@@ -87,17 +380,208 @@ func (s *SQLiteStorage) Get(shortCode string) (*models.URL, error) {
 		return nil, err
 	}
 
-	if lastAccessed.Valid {
-		url.LastAccessed = &lastAccessed.Time
+	return url, nil
+}
+
+func (s *SQLiteStorage) GetLongestPrefix(path string) (*models.URL, error) {
+	args := prefixArgs(path)
+	url, err := scanURL(s.db.QueryRow(longestPrefixQuery(len(args)), args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return url, nil
 }
 
 func (s *SQLiteStorage) Update(url *models.URL) error {
-	query := `UPDATE urls SET original_url = ?, clicks = ?, last_accessed = ? WHERE short_code = ?`
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE urls SET original_url = ?, canonical_url = ?, redirect_type = ?, cache_control = ?, expires_at = ?, title = ?, notes = ?,
+	          utm_source = ?, utm_medium = ?, utm_campaign = ?, utm_term = ?, utm_content = ?, utm_override = ?, passthrough = ?, interstitial = ?,
+	          variants = ?, rotation = ?,
+	          clicks = ?, last_accessed = ? WHERE short_code = ?`
+
+	utm := utmOf(url)
+	result, err := tx.Exec(query, url.OriginalURL, url.CanonicalURL, url.RedirectType, url.CacheControl, utcTime(url.ExpiresAt), url.Title, url.Notes,
+		utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content, url.UTMOverride, url.Passthrough, url.Interstitial,
+		variantsOf(url), url.Rotation, url.Clicks, utcTime(url.LastAccessed), url.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	if err := s.setTags(tx, url.ShortCode, url.Tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) RecordClick(click *models.Click) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE urls SET clicks = clicks + 1, last_accessed = ? WHERE short_code = ?`
+
+	result, err := tx.Exec(query, click.At.UTC(), click.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	_, err = tx.Exec(`INSERT INTO clicks (url_id, clicked_at, referrer, visitor, variant)
+	          SELECT id, ?, ?, ?, ? FROM urls WHERE short_code = ?`, click.At.UTC(), click.Referrer, click.Visitor, click.Variant, click.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) UpdateWithRevision(url *models.URL, revision *models.URLRevision) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE urls SET original_url = ?, canonical_url = ?, redirect_type = ?, cache_control = ?, expires_at = ?, title = ?, notes = ?,
+	          utm_source = ?, utm_medium = ?, utm_campaign = ?, utm_term = ?, utm_content = ?, utm_override = ?, passthrough = ?, interstitial = ?,
+	          variants = ?, rotation = ?
+	          WHERE short_code = ?`
+
+	utm := utmOf(url)
+	result, err := tx.Exec(query, url.OriginalURL, url.CanonicalURL, url.RedirectType, url.CacheControl, utcTime(url.ExpiresAt), url.Title, url.Notes,
+		utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content, url.UTMOverride, url.Passthrough, url.Interstitial,
+		variantsOf(url), url.Rotation, url.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	if err := s.setTags(tx, url.ShortCode, url.Tags); err != nil {
+		return err
+	}
+
+	expected := revision.Revision
+	if err := s.insertRevision(tx, revision); err != nil {
+		return err
+	}
+	if expected != 0 && revision.Revision != expected {
+		return ErrConflict
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) AddRevision(revision *models.URLRevision) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.insertRevision(tx, revision); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertRevision stores revision as the next revision of its short code
+func (s *SQLiteStorage) insertRevision(tx *sql.Tx, revision *models.URLRevision) error {
+	old, state, err := encodeStates(revision)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO url_revisions (short_code, revision, action, actor, created_at, old_state, new_state)
+	          SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ?, ? FROM url_revisions WHERE short_code = ?`
+
+	result, err := tx.Exec(query, revision.ShortCode, revision.Action, revision.Actor, revision.CreatedAt.UTC(), old, state, revision.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	if revision.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	return tx.QueryRow(`SELECT revision FROM url_revisions WHERE id = ?`, revision.ID).Scan(&revision.Revision)
+}
+
+func (s *SQLiteStorage) ListRevisions(shortCode string) ([]*models.URLRevision, error) {
+	query := `SELECT ` + revisionColumns + `
+	          FROM url_revisions WHERE short_code = ? ORDER BY revision`
+
+	rows, err := s.db.Query(query, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRevisions(rows)
+}
+
+func (s *SQLiteStorage) SavePreview(shortCode string, preview *models.LinkPreview) error {
+	query := `UPDATE urls SET preview_title = ?, preview_description = ?, preview_image = ?, preview_site_name = ?,
+	          preview_twitter_card = ?, preview_favicon = ?, preview_fetched_at = ? WHERE short_code = ?`
+
+	result, err := s.db.Exec(query, preview.Title, preview.Description, preview.ImageURL, preview.SiteName,
+		preview.TwitterCard, preview.FaviconURL, preview.FetchedAt.UTC(), shortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
 
-	result, err := s.db.Exec(query, url.OriginalURL, url.Clicks, url.LastAccessed, url.ShortCode)
+func (s *SQLiteStorage) SoftDelete(shortCode string, at time.Time) error {
+	query := `UPDATE urls SET deleted_at = ? WHERE short_code = ? AND deleted_at IS NULL`
+
+	result, err := s.db.Exec(query, at.UTC(), shortCode)
 	if err != nil {
 		return err
 	}
@@ -114,7 +598,78 @@ func (s *SQLiteStorage) Update(url *models.URL) error {
 	return nil
 }
 
+func (s *SQLiteStorage) Restore(shortCode string) error {
+	query := `UPDATE urls SET deleted_at = NULL WHERE short_code = ? AND deleted_at IS NOT NULL`
+
+	result, err := s.db.Exec(query, shortCode)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) PurgeDeleted(before time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// deleted_at is stored in UTC and compared as text
+	before = before.UTC()
+
+	_, err = tx.Exec(`DELETE FROM url_revisions WHERE short_code IN
+	          (SELECT short_code FROM urls WHERE deleted_at IS NOT NULL AND deleted_at < ?)`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM url_tags WHERE url_id IN
+	          (SELECT id FROM urls WHERE deleted_at IS NOT NULL AND deleted_at < ?)`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM clicks WHERE url_id IN
+	          (SELECT id FROM urls WHERE deleted_at IS NOT NULL AND deleted_at < ?)`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM urls WHERE deleted_at IS NOT NULL AND deleted_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
+
 func (s *SQLiteStorage) Delete(shortCode string) error {
+	_, err := s.db.Exec(`DELETE FROM url_tags WHERE url_id = (SELECT id FROM urls WHERE short_code = ?)`, shortCode)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`DELETE FROM clicks WHERE url_id = (SELECT id FROM urls WHERE short_code = ?)`, shortCode)
+	if err != nil {
+		return err
+	}
+
 	query := `DELETE FROM urls WHERE short_code = ?`
 
 	result, err := s.db.Exec(query, shortCode)
@@ -131,44 +686,344 @@ func (s *SQLiteStorage) Delete(shortCode string) error {
 		return ErrNotFound
 	}
 
-	return nil
+	_, err = s.db.Exec(`DELETE FROM url_revisions WHERE short_code = ?`, shortCode)
+	return err
 }
 
 func (s *SQLiteStorage) List(limit, offset int) ([]*models.URL, error) {
-	query := `SELECT id, short_code, original_url, clicks, created_at, last_accessed 
-	          FROM urls ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	query := `SELECT ` + urlColumns + `
+	          FROM urls WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT ? OFFSET ?`
+
+	rows, err := s.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanURLs(rows)
+}
+
+func (s *SQLiteStorage) ListAfterID(afterID int64, limit int, includeDeleted bool) ([]*models.URL, error) {
+	filter := ` AND deleted_at IS NULL`
+	if includeDeleted {
+		filter = ``
+	}
+	query := `SELECT ` + urlColumns + `
+	          FROM urls WHERE id > ?` + filter + ` ORDER BY id LIMIT ?`
+
+	rows, err := s.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanURLs(rows)
+}
+
+func (s *SQLiteStorage) ListDeleted(limit, offset int) ([]*models.URL, error) {
+	query := `SELECT ` + urlColumns + `
+	          FROM urls WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC LIMIT ? OFFSET ?`
 
 	rows, err := s.db.Query(query, limit, offset)
 	if err != nil {
 		return nil, err
 	}
+
+	return scanURLs(rows)
+}
+
+func (s *SQLiteStorage) Query(opts ListOptions) (*ListPage, error) {
+	opts, after, err := opts.prepare()
+	if err != nil {
+		return nil, err
+	}
+	query, args, countQuery, countArgs := opts.sqlQuery(after)
+
+	var total int64
+	if err := s.db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := scanURLs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return opts.page(urls, total), nil
+}
+
+// Search ranks matches with bm25, weighting the columns as search.Weights
+// does. Each term matches words it is a prefix of.
+func (s *SQLiteStorage) Search(query string, limit int) ([]SearchHit, error) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return []SearchHit{}, nil
+	}
+	if !s.fts {
+		return s.likeSearch(terms, limit)
+	}
+
+	// Terms hold only letters and digits, so quoting them is enough
+	match := make([]string, len(terms))
+	for i, term := range terms {
+		match[i] = `"` + term + `"*`
+	}
+
+	rows, err := s.db.Query(`SELECT `+urlColumns+`, fts_rank FROM urls
+		JOIN (SELECT rowid AS fts_id, bm25(urls_fts, 4, 1, 3, 2, 3) AS fts_rank FROM urls_fts WHERE urls_fts MATCH ?) ON fts_id = id
+		WHERE deleted_at IS NULL ORDER BY fts_rank, id DESC LIMIT ?`, strings.Join(match, " AND "), limit)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	var urls []*models.URL
+	hits := []SearchHit{}
 	for rows.Next() {
-		url := &models.URL{}
-		var lastAccessed sql.NullTime
-
-		err := rows.Scan(
-			&url.ID,
-			&url.ShortCode,
-			&url.OriginalURL,
-			&url.Clicks,
-			&url.CreatedAt,
-			&lastAccessed,
-		)
+		var rank float64
+		url, err := scanURL(scanWith{rows, []any{&rank}})
 		if err != nil {
 			return nil, err
 		}
+		// bm25 is negative, lower meaning more relevant
+		hits = append(hits, SearchHit{URL: url, Score: -rank})
+	}
+	return hits, rows.Err()
+}
+
+// searchCandidates caps the links likeSearch reads and scores in Go
+const searchCandidates = 1000
 
-		if lastAccessed.Valid {
-			url.LastAccessed = &lastAccessed.Time
+// likeSearch finds links containing every term in any searchable field and
+// ranks them with search.Score, for builds without FTS5
+func (s *SQLiteStorage) likeSearch(terms []string, limit int) ([]SearchHit, error) {
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+	for _, term := range terms {
+		where = append(where, `(short_code LIKE ? OR original_url LIKE ? OR canonical_url LIKE ? OR title LIKE ? OR preview_title LIKE ? OR notes LIKE ?
+			OR id IN (SELECT url_tags.url_id FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE tags.name LIKE ?))`)
+		pattern := "%" + term + "%"
+		args = append(args, pattern, pattern, pattern, pattern, pattern, pattern, pattern)
+	}
+	args = append(args, searchCandidates)
+
+	rows, err := s.db.Query(`SELECT `+urlColumns+` FROM urls WHERE `+strings.Join(where, " AND ")+
+		` ORDER BY id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := scanURLs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// LIKE also matches inside words, which search.Score does not
+	hits := []SearchHit{}
+	for _, url := range urls {
+		if score, ok := search.Score(search.DocumentOf(url), terms); ok {
+			hits = append(hits, SearchHit{URL: url, Score: score})
 		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits[:min(len(hits), limit)], nil
+}
 
-		urls = append(urls, url)
+func (s *SQLiteStorage) ListTags() ([]models.TagCount, error) {
+	rows, err := s.db.Query(listTagsQuery)
+	if err != nil {
+		return nil, err
 	}
+	return scanTagCounts(rows)
+}
 
-	return urls, rows.Err()
+func (s *SQLiteStorage) SaveCampaign(campaign *models.Campaign) error {
+	if campaign.CreatedAt.IsZero() {
+		campaign.CreatedAt = time.Now()
+	}
+	if campaign.UpdatedAt.IsZero() {
+		campaign.UpdatedAt = campaign.CreatedAt
+	}
+
+	query := `INSERT INTO campaigns (name, description, utm_source, utm_medium, utm_campaign, utm_term, utm_content, created_at, updated_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	utm := campaign.UTM
+	result, err := s.db.Exec(query, campaign.Name, campaign.Description, utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content,
+		campaign.CreatedAt.UTC(), campaign.UpdatedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	campaign.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *SQLiteStorage) GetCampaign(id int64) (*models.Campaign, error) {
+	campaign, err := scanCampaign(s.db.QueryRow(`SELECT `+campaignColumns+` FROM campaigns WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrCampaignNotFound
+	}
+	return campaign, err
+}
+
+func (s *SQLiteStorage) UpdateCampaign(campaign *models.Campaign) error {
+	if campaign.UpdatedAt.IsZero() {
+		campaign.UpdatedAt = time.Now()
+	}
+
+	query := `UPDATE campaigns SET name = ?, description = ?, utm_source = ?, utm_medium = ?, utm_campaign = ?, utm_term = ?, utm_content = ?,
+	          updated_at = ? WHERE id = ?`
+
+	utm := campaign.UTM
+	result, err := s.db.Exec(query, campaign.Name, campaign.Description, utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content,
+		campaign.UpdatedAt.UTC(), campaign.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrCampaignNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) DeleteCampaign(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE urls SET campaign_id = 0 WHERE campaign_id = ?`, id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM campaigns WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrCampaignNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) ListCampaigns() ([]*models.Campaign, error) {
+	rows, err := s.db.Query(`SELECT ` + campaignColumns + ` FROM campaigns ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanCampaigns(rows)
+}
+
+func (s *SQLiteStorage) SetCampaign(shortCodes []string, campaignID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if campaignID != 0 {
+		var exists int
+		err := tx.QueryRow(`SELECT 1 FROM campaigns WHERE id = ?`, campaignID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return ErrCampaignNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, shortCode := range shortCodes {
+		result, err := tx.Exec(`UPDATE urls SET campaign_id = ? WHERE short_code = ?`, campaignID, shortCode)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) ScanCampaignClicks(campaignID int64, from, to time.Time, fn func(models.Click) error) error {
+	if _, err := s.GetCampaign(campaignID); err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(campaignClicksQuery, campaignID, from.UTC(), to.UTC())
+	if err != nil {
+		return err
+	}
+	return scanClicks(rows, fn)
+}
+
+func (s *SQLiteStorage) ScanClicks(shortCode string, fn func(models.Click) error) error {
+	rows, err := s.db.Query(linkClicksQuery, shortCode)
+	if err != nil {
+		return err
+	}
+	return scanClicks(rows, fn)
+}
+
+func (s *SQLiteStorage) SaveClicks(shortCode string, clicks []models.Click) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var urlID int64
+	err = tx.QueryRow(`SELECT id FROM urls WHERE short_code = ?`, shortCode).Scan(&urlID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO clicks (url_id, clicked_at, referrer, visitor, variant) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, click := range clicks {
+		if _, err := stmt.Exec(urlID, click.At.UTC(), click.Referrer, click.Visitor, click.Variant); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) CountVariantClicks(shortCode string) (map[string]int64, error) {
+	rows, err := s.db.Query(variantClicksQuery, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	return scanVariantClicks(rows)
 }
 
 func (s *SQLiteStorage) Close() error {
@@ -2,12 +2,16 @@ package storage
 
 import (
 	"errors"
+	"time"
 	"url-shortener/models"
 )
 
 var (
 	ErrNotFound      = errors.New("URL not found")
 	ErrAlreadyExists = errors.New("short code already exists")
+	ErrConflict      = errors.New("URL was changed concurrently")
+
+	ErrCampaignNotFound = errors.New("campaign not found")
 )
 
 // Storage defines the interface for URL storage operations
@@ -15,18 +19,133 @@ type Storage interface {
 	// Save stores a new URL mapping
 	Save(url *models.URL) error
 
+	// SaveBatch stores many new URL mappings in one transaction where the
+	// backend supports it. revisions[i], when not nil, is recorded as the
+	// first revision of urls[i]. The returned slice holds the error of each
+	// item; when atomic is set the first failure aborts the whole batch and
+	// only that item's error is reported. The error is for failures of the
+	// batch as a whole.
+	SaveBatch(urls []*models.URL, revisions []*models.URLRevision, atomic bool) ([]error, error)
+
 	// Get retrieves a URL by short code
 	Get(shortCode string) (*models.URL, error)
 
+	// GetLongestPrefix retrieves the URL whose short code is the longest
+	// prefix of path that ends at a "/" or at the end of path, so go-links
+	// with slashes in their codes resolve to the most specific one
+	GetLongestPrefix(path string) (*models.URL, error)
+
 	// Update updates an existing URL
 	Update(url *models.URL) error
 
-	// Delete removes a URL by short code
+	// RecordClick counts a visit of click.ShortCode and keeps the click for
+	// analytics, without touching the rest of the URL
+	RecordClick(click *models.Click) error
+
+	// UpdateWithRevision changes the editable state of a URL and records the
+	// revision atomically. The revision number is assigned by the store; when
+	// revision.Revision is already set, it is the number the change expects
+	// to get, and ErrConflict is returned if another revision took it first.
+	UpdateWithRevision(url *models.URL, revision *models.URLRevision) error
+
+	// AddRevision records a revision without changing the URL
+	AddRevision(revision *models.URLRevision) error
+
+	// ListRevisions returns the revisions of a URL, oldest first
+	ListRevisions(shortCode string) ([]*models.URLRevision, error)
+
+	// SavePreview stores the destination metadata of a URL
+	SavePreview(shortCode string, preview *models.LinkPreview) error
+
+	// SoftDelete moves a URL to the trash. Trashed URLs keep their short code
+	// reserved and are still returned by Get, but not by List.
+	SoftDelete(shortCode string, at time.Time) error
+
+	// Restore takes a URL out of the trash
+	Restore(shortCode string) error
+
+	// Delete permanently removes a URL and its history by short code
 	Delete(shortCode string) error
 
-	// List returns all URLs (for admin purposes)
+	// PurgeDeleted permanently removes URLs trashed before the given time
+	PurgeDeleted(before time.Time) (int64, error)
+
+	// List returns all URLs that are not in the trash (for admin purposes)
 	List(limit, offset int) ([]*models.URL, error)
 
+	// ListAfterID returns up to limit URLs with an ID greater than afterID, in
+	// ID order. It is used to walk every URL in pages. URLs in the trash are
+	// only included when includeDeleted is set.
+	ListAfterID(afterID int64, limit int, includeDeleted bool) ([]*models.URL, error)
+
+	// ListDeleted returns the URLs in the trash, most recently deleted first
+	ListDeleted(limit, offset int) ([]*models.URL, error)
+
+	// Query returns one page of the URLs outside the trash that match the
+	// filters in opts, in the requested order, with the total number of matches.
+	// It returns ErrInvalidSort or ErrInvalidCursor for bad options.
+	Query(opts ListOptions) (*ListPage, error)
+
+	// Search returns up to limit URLs outside the trash whose short code,
+	// destination, title, tags or notes contain every term of query, best match
+	// first. Terms are split as search.Terms does and match words they are a
+	// prefix of. A query without terms matches nothing.
+	Search(query string, limit int) ([]SearchHit, error)
+
+	// ListTags returns every tag carried by a URL outside the trash with the
+	// number of such URLs, most used first and then by name
+	ListTags() ([]models.TagCount, error)
+
+	// SaveCampaign stores a new campaign and assigns its ID
+	SaveCampaign(campaign *models.Campaign) error
+
+	// GetCampaign retrieves a campaign with its link count
+	GetCampaign(id int64) (*models.Campaign, error)
+
+	// UpdateCampaign changes the name, description and UTM parameters of a campaign
+	UpdateCampaign(campaign *models.Campaign) error
+
+	// DeleteCampaign removes a campaign; its links stay but leave the campaign
+	DeleteCampaign(id int64) error
+
+	// ListCampaigns returns every campaign with its link count, newest first
+	ListCampaigns() ([]*models.Campaign, error)
+
+	// SetCampaign moves the given URLs into a campaign, or out of theirs when
+	// campaignID is 0. Nothing changes if a short code does not exist
+	// (ErrNotFound) or the campaign does not (ErrCampaignNotFound).
+	SetCampaign(shortCodes []string, campaignID int64) error
+
+	// ScanCampaignClicks calls fn with every click on a URL of the campaign
+	// at or after from and before to, oldest first. It stops at the first
+	// error fn returns and returns it.
+	ScanCampaignClicks(campaignID int64, from, to time.Time, fn func(models.Click) error) error
+
+	// ScanClicks calls fn with every click on a URL, in the order they were
+	// recorded. It stops at the first error fn returns and returns it.
+	ScanClicks(shortCode string, fn func(models.Click) error) error
+
+	// SaveClicks stores click events of an existing URL as they are, without
+	// counting them again, such as when the URL is copied between stores
+	SaveClicks(shortCode string, clicks []models.Click) error
+
+	// CountVariantClicks returns the number of clicks recorded for each
+	// variant of a link, by variant name. Variants without clicks and clicks
+	// without a variant are left out.
+	CountVariantClicks(shortCode string) (map[string]int64, error)
+
 	// Close closes any database connections
 	Close() error
 }
+
+// codePrefixes lists the short codes GetLongestPrefix tries for path,
+// longest first
+func codePrefixes(path string) []string {
+	prefixes := []string{path}
+	for i := len(path) - 1; i > 0; i-- {
+		if path[i] == '/' {
+			prefixes = append(prefixes, path[:i])
+		}
+	}
+	return prefixes
+}
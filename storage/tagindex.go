@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"url-shortener/models"
+)
+
+// tagIndex maps each tag to the links outside the trash carrying it, so
+// ListTags on the in-memory store never scans the links
+type tagIndex struct {
+	mutex sync.RWMutex
+	links map[string]map[string]struct{}
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{links: make(map[string]map[string]struct{})}
+}
+
+// liveTags returns the tags a link contributes to the index
+func liveTags(url *models.URL) []string {
+	if url == nil || url.DeletedAt != nil {
+		return nil
+	}
+	return url.Tags
+}
+
+// update moves a link's entries from its old to its new state; either may be nil
+func (x *tagIndex) update(old, updated *models.URL) {
+	before, after := liveTags(old), liveTags(updated)
+	if len(before) == 0 && len(after) == 0 {
+		return
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	for _, tag := range before {
+		delete(x.links[tag], old.ShortCode)
+		if len(x.links[tag]) == 0 {
+			delete(x.links, tag)
+		}
+	}
+	for _, tag := range after {
+		if x.links[tag] == nil {
+			x.links[tag] = make(map[string]struct{})
+		}
+		x.links[tag][updated.ShortCode] = struct{}{}
+	}
+}
+
+// counts lists every tag with its number of links, most used first
+func (x *tagIndex) counts() []models.TagCount {
+	x.mutex.RLock()
+	counts := make([]models.TagCount, 0, len(x.links))
+	for tag, links := range x.links {
+		counts = append(counts, models.TagCount{Name: tag, Links: int64(len(links))})
+	}
+	x.mutex.RUnlock()
+
+	sortTagCounts(counts)
+	return counts
+}
+
+// sortTagCounts orders tags by descending link count, then by name
+func sortTagCounts(counts []models.TagCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Links != counts[j].Links {
+			return counts[i].Links > counts[j].Links
+		}
+		return counts[i].Name < counts[j].Name
+	})
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+func TestTags(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			links := []*models.URL{
+				{ShortCode: "launch", OriginalURL: "https://example.com/a", Title: "Spring launch", Tags: []string{"marketing", "q2"}},
+				{ShortCode: "docs", OriginalURL: "https://example.com/b", Tags: []string{"docs"}},
+				{ShortCode: "promo", OriginalURL: "https://example.com/c", Tags: []string{"marketing"}},
+				{ShortCode: "old", OriginalURL: "https://example.com/d", Tags: []string{"marketing", "q1"}},
+			}
+			for _, link := range links {
+				if err := store.Save(link); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+			store.SoftDelete("old", time.Now())
+
+			t.Run("Store title and tags", func(t *testing.T) {
+				url, err := store.Get("launch")
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if url.Title != "Spring launch" || fmt.Sprint(url.Tags) != "[marketing q2]" {
+					t.Errorf("Expected title and tags to round trip, got %q and %v", url.Title, url.Tags)
+				}
+			})
+
+			t.Run("Count links per tag outside the trash", func(t *testing.T) {
+				counts, err := store.ListTags()
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if fmt.Sprint(counts) != "[{marketing 2} {docs 1} {q2 1}]" {
+					t.Errorf("Expected marketing 2, docs 1, q2 1, got %v", counts)
+				}
+			})
+
+			t.Run("Filter by every tag", func(t *testing.T) {
+				filters := []struct {
+					tags     []string
+					expected string
+				}{
+					{[]string{"marketing"}, "[promo launch]"},
+					{[]string{"marketing", "q2"}, "[launch]"},
+					{[]string{"q1"}, "[]"},
+				}
+				for _, filter := range filters {
+					page, err := store.Query(ListOptions{Tags: filter.tags, Sort: SortCreatedAt})
+					if err != nil {
+						t.Fatalf("Expected no error, got %v", err)
+					}
+					codes := []string{}
+					for _, url := range page.URLs {
+						codes = append(codes, url.ShortCode)
+					}
+					if fmt.Sprint(codes) != filter.expected {
+						t.Errorf("Expected %s for %v, got %v", filter.expected, filter.tags, codes)
+					}
+				}
+			})
+
+			t.Run("Replace tags on update", func(t *testing.T) {
+				url, _ := store.Get("docs")
+				url.Tags = []string{"reference"}
+				url.Title = "API reference"
+				revision := &models.URLRevision{ShortCode: "docs", Action: models.RevisionUpdate, CreatedAt: time.Now(), New: url.State()}
+				if err := store.UpdateWithRevision(url, revision); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				store.Delete("promo")
+
+				counts, _ := store.ListTags()
+				if fmt.Sprint(counts) != "[{marketing 1} {q2 1} {reference 1}]" {
+					t.Errorf("Expected marketing, q2 and reference once each, got %v", counts)
+				}
+
+				hits, _ := store.Search("reference api", 10)
+				if len(hits) != 1 || hits[0].URL.ShortCode != "docs" {
+					t.Errorf("Expected to find docs by its new title and tag, got %v", hits)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"url-shortener/models"
+	"url-shortener/search"
+)
+
+// textIndex is the inverted index behind InMemoryStorage.Search. Each word
+// maps to the links containing it, weighted by the fields it occurs in, and
+// the words themselves are kept sorted so a query term finds every word it is
+// a prefix of with one seek. Only links outside the trash are indexed.
+type textIndex struct {
+	mutex sync.RWMutex
+	words *skiplist[string]
+	// postings maps a word to the weight of each link containing it
+	postings map[string]map[string]float64
+	// documents remembers what was indexed for each link so it can be removed
+	documents map[string]textEntry
+}
+
+type textEntry struct {
+	id  int64
+	doc search.Document
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		words:     newSkiplist(func(a, b string) bool { return a < b }),
+		postings:  make(map[string]map[string]float64),
+		documents: make(map[string]textEntry),
+	}
+}
+
+// update replaces the entry of a link after a change; either side may be nil.
+// Clicks and other changes outside the searchable text are skipped cheaply.
+func (x *textIndex) update(old, updated *models.URL) {
+	var before, after search.Document
+	if old != nil && old.DeletedAt == nil {
+		before = search.DocumentOf(old)
+	}
+	if updated != nil && updated.DeletedAt == nil {
+		after = search.DocumentOf(updated)
+	}
+	if sameDocument(before, after) {
+		return
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if old != nil {
+		x.remove(old.ShortCode)
+	}
+	if after != nil {
+		x.add(updated, after)
+	}
+}
+
+func sameDocument(a, b search.Document) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	for field, text := range a {
+		if b[field] != text {
+			return false
+		}
+	}
+	return true
+}
+
+func (x *textIndex) add(url *models.URL, doc search.Document) {
+	code := url.ShortCode
+	for field, text := range doc {
+		for _, word := range search.Tokenize(text) {
+			links, exists := x.postings[word]
+			if !exists {
+				links = make(map[string]float64)
+				x.postings[word] = links
+				x.words.Insert(word)
+			}
+			links[code] += search.Weights[field]
+		}
+	}
+	x.documents[code] = textEntry{id: url.ID, doc: doc}
+}
+
+func (x *textIndex) remove(code string) {
+	entry, exists := x.documents[code]
+	if !exists {
+		return
+	}
+	for _, text := range entry.doc {
+		for _, word := range search.Tokenize(text) {
+			links := x.postings[word]
+			delete(links, code)
+			if len(links) == 0 {
+				delete(x.postings, word)
+				x.words.Delete(word)
+			}
+		}
+	}
+	delete(x.documents, code)
+}
+
+// search returns the links matching every term, best first. A link scores
+// the tf-idf of each word a term is a prefix of, so rare words and words in
+// heavily weighted fields count most, and whole words outrank prefixes. Ties
+// go to the newest link, as in the SQL backends.
+func (x *textIndex) search(terms []string, limit int) []SearchHit {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	documents := float64(len(x.documents))
+	var scores map[string]float64
+	for _, term := range terms {
+		matched := make(map[string]float64)
+		for node := x.words.Seek(term); node != nil && strings.HasPrefix(node.key, term); node = node.Next() {
+			links := x.postings[node.key]
+			idf := math.Log(1 + documents/float64(len(links)))
+			if node.key != term {
+				idf /= 2
+			}
+			for code, weight := range links {
+				if scores == nil || scores[code] > 0 {
+					matched[code] += weight * idf
+				}
+			}
+		}
+
+		// Links missing a term drop out
+		for code := range matched {
+			matched[code] += scores[code]
+		}
+		scores = matched
+		if len(scores) == 0 {
+			return nil
+		}
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for code, score := range scores {
+		hits = append(hits, SearchHit{URL: &models.URL{ID: x.documents[code].id, ShortCode: code}, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].URL.ID > hits[j].URL.ID
+	})
+	return hits[:min(len(hits), limit)]
+}
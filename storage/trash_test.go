@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"math"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+func TestTrash(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, code := range []string{"keep", "old", "recent"} {
+				store.Save(&models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code})
+			}
+			now := time.Now()
+
+			t.Run("Soft delete keeps the code reserved", func(t *testing.T) {
+				if err := store.SoftDelete("old", now.Add(-48*time.Hour)); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				store.SoftDelete("recent", now)
+
+				if err := store.SoftDelete("old", now); err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound for a second delete, got %v", err)
+				}
+				if err := store.Save(&models.URL{ShortCode: "old", OriginalURL: "https://example.com"}); err != ErrAlreadyExists {
+					t.Errorf("Expected ErrAlreadyExists, got %v", err)
+				}
+
+				url, err := store.Get("old")
+				if err != nil || url.DeletedAt == nil {
+					t.Errorf("Expected deleted URL to be returned with deleted_at, got %v %v", url, err)
+				}
+			})
+
+			t.Run("List excludes the trash", func(t *testing.T) {
+				urls, _ := store.List(10, 0)
+				if len(urls) != 1 || urls[0].ShortCode != "keep" {
+					t.Errorf("Expected only 'keep', got %d URLs", len(urls))
+				}
+
+				trash, _ := store.ListDeleted(10, 0)
+				if len(trash) != 2 || trash[0].ShortCode != "recent" {
+					t.Errorf("Expected 2 trashed URLs, most recent first, got %d", len(trash))
+				}
+			})
+
+			t.Run("Accept huge limits", func(t *testing.T) {
+				if deleted, err := store.ListDeleted(math.MaxInt, 0); err != nil || len(deleted) != 2 {
+					t.Errorf("Expected 2 deleted URLs, got %d (%v)", len(deleted), err)
+				}
+				if urls, err := store.ListAfterID(0, 1<<40, true); err != nil || len(urls) != 3 {
+					t.Errorf("Expected 3 URLs, got %d (%v)", len(urls), err)
+				}
+			})
+
+			t.Run("Purge only expired trash", func(t *testing.T) {
+				purged, err := store.PurgeDeleted(now.Add(-24 * time.Hour))
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if purged != 1 {
+					t.Errorf("Expected 1 purged URL, got %d", purged)
+				}
+				if _, err := store.Get("old"); err != ErrNotFound {
+					t.Errorf("Expected purged URL to be gone, got %v", err)
+				}
+			})
+
+			t.Run("Restore", func(t *testing.T) {
+				if err := store.Restore("recent"); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if err := store.Restore("keep"); err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound for a live URL, got %v", err)
+				}
+
+				url, _ := store.Get("recent")
+				if url.DeletedAt != nil {
+					t.Error("Expected restored URL to have no deleted_at")
+				}
+			})
+
+			t.Run("Purge compares instants across time zones", func(t *testing.T) {
+				east := time.FixedZone("east", 14*60*60)
+				west := time.FixedZone("west", -12*60*60)
+				store.Save(&models.URL{ShortCode: "east", OriginalURL: "https://example.com/east"})
+				store.Save(&models.URL{ShortCode: "west", OriginalURL: "https://example.com/west"})
+				store.SoftDelete("east", now.Add(-2*time.Hour).In(east))
+				store.SoftDelete("west", now.Add(-30*time.Minute).In(west))
+
+				purged, err := store.PurgeDeleted(now.Add(-time.Hour).In(west))
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if purged != 1 {
+					t.Errorf("Expected 1 purged URL, got %d", purged)
+				}
+				if _, err := store.Get("east"); err != ErrNotFound {
+					t.Errorf("Expected 'east' to be purged, got %v", err)
+				}
+				if _, err := store.Get("west"); err != nil {
+					t.Errorf("Expected 'west' to stay in the trash, got %v", err)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Package suggest finds the known words closest to a misspelt one, to offer
+// "did you mean" suggestions for unknown short codes.
+package suggest
+
+import (
+	"sort"
+	"sync"
+)
+
+// Match is a word of the tree with its edit distance from the query
+type Match struct {
+	Word     string
+	Distance int
+}
+
+// BKTree indexes words by Levenshtein distance so the words near a query are
+// found without comparing it to every word. It is safe for concurrent use.
+// Removed words stay in place as tombstones, since the words below them were
+// placed by their distance to it, and come back when they are added again.
+type BKTree struct {
+	mutex sync.RWMutex
+	root  *node
+	size  int
+}
+
+type node struct {
+	word     string
+	removed  bool
+	children map[int]*node
+}
+
+// New returns an empty tree
+func New() *BKTree {
+	return &BKTree{}
+}
+
+// Add inserts a word; adding a word twice has no effect
+func (t *BKTree) Add(word string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.root == nil {
+		t.root = &node{word: word}
+		t.size++
+		return
+	}
+
+	current := t.root
+	for {
+		d := Distance(word, current.word)
+		if d == 0 {
+			if current.removed {
+				current.removed = false
+				t.size++
+			}
+			return
+		}
+		child, exists := current.children[d]
+		if !exists {
+			if current.children == nil {
+				current.children = make(map[int]*node)
+			}
+			current.children[d] = &node{word: word}
+			t.size++
+			return
+		}
+		current = child
+	}
+}
+
+// Remove takes a word out of the results; removing an unknown word has no effect
+func (t *BKTree) Remove(word string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	current := t.root
+	for current != nil {
+		d := Distance(word, current.word)
+		if d == 0 {
+			if !current.removed {
+				current.removed = true
+				t.size--
+			}
+			return
+		}
+		current = current.children[d]
+	}
+}
+
+// Len returns the number of words in the tree
+func (t *BKTree) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.size
+}
+
+// Search returns the words at most maxDistance edits away from word, closest
+// first and alphabetically among equals
+func (t *BKTree) Search(word string, maxDistance int) []Match {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var matches []Match
+	if t.root == nil {
+		return matches
+	}
+
+	// By the triangle inequality only children whose edge is within
+	// maxDistance of the word's distance to their parent can hold matches
+	pending := []*node{t.root}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		d := Distance(word, current.word)
+		if d <= maxDistance && !current.removed {
+			matches = append(matches, Match{Word: current.word, Distance: d})
+		}
+		for edge, child := range current.children {
+			if edge >= d-maxDistance && edge <= d+maxDistance {
+				pending = append(pending, child)
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].Word < matches[j].Word
+	})
+	return matches
+}
+
+// Distance is the Levenshtein distance between a and b: the number of single
+// character insertions, deletions and substitutions turning one into the other
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
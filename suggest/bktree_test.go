@@ -0,0 +1,97 @@
+package suggest
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"promo", "promo", 0},
+		{"promo", "prmo", 1},
+		{"promo", "pormo", 2},
+		{"café", "cafe", 1},
+	}
+
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Expected distance %d between %q and %q, got %d", tt.expected, tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestBKTree(t *testing.T) {
+	tree := New()
+	for _, word := range []string{"promo", "promo2", "docs", "doc", "launch", "lunch", "promo"} {
+		tree.Add(word)
+	}
+
+	if tree.Len() != 6 {
+		t.Errorf("Expected 6 words without the duplicate, got %d", tree.Len())
+	}
+
+	tests := []struct {
+		query    string
+		max      int
+		expected string
+	}{
+		{"prmo", 1, "[{promo 1}]"},
+		{"prmo", 2, "[{promo 1} {promo2 2}]"},
+		{"docz", 1, "[{doc 1} {docs 1}]"},
+		{"lanch", 1, "[{launch 1} {lunch 1}]"},
+		{"zzzzzz", 2, "[]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(tree.Search(tt.query, tt.max)); got != tt.expected {
+			t.Errorf("Expected %s for %q within %d, got %s", tt.expected, tt.query, tt.max, got)
+		}
+	}
+
+	if got := New().Search("promo", 2); len(got) != 0 {
+		t.Errorf("Expected no matches in an empty tree, got %v", got)
+	}
+
+	t.Run("Remove and add again", func(t *testing.T) {
+		tree.Remove("promo")
+		tree.Remove("unknown")
+		if tree.Len() != 5 {
+			t.Errorf("Expected 5 words after removing one, got %d", tree.Len())
+		}
+		if got := fmt.Sprint(tree.Search("prmo", 2)); got != "[{promo2 2}]" {
+			t.Errorf("Expected only promo2, got %s", got)
+		}
+
+		tree.Add("promo")
+		if got := fmt.Sprint(tree.Search("prmo", 2)); got != "[{promo 1} {promo2 2}]" {
+			t.Errorf("Expected promo to be found again, got %s", got)
+		}
+	})
+}
+
+func TestBKTreeMatchesLinearScan(t *testing.T) {
+	tree := New()
+	var words []string
+	for i := 0; i < 500; i++ {
+		word := fmt.Sprintf("%x", i*7919)
+		words = append(words, word)
+		tree.Add(word)
+	}
+
+	for _, query := range []string{"1f0", "abcd", "7", "f00d"} {
+		expected := 0
+		for _, word := range words {
+			if Distance(query, word) <= 2 {
+				expected++
+			}
+		}
+		if got := len(tree.Search(query, 2)); got != expected {
+			t.Errorf("Expected %d matches for %q, got %d", expected, query, got)
+		}
+	}
+}
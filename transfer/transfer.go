@@ -0,0 +1,407 @@
+// Package transfer encodes and decodes link sets as CSV or NDJSON so they can
+// be moved between environments.
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/models"
+)
+
+// Supported formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var ErrUnknownFormat = errors.New("unknown format, expected csv or ndjson")
+
+// Record is one exported link with its stats
+type Record struct {
+	ShortCode    string            `json:"short_code"`
+	OriginalURL  string            `json:"original_url"`
+	CanonicalURL string            `json:"canonical_url,omitempty"`
+	RedirectType int               `json:"redirect_type,omitempty"`
+	CacheControl string            `json:"cache_control,omitempty"`
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"`
+	Title        string            `json:"title,omitempty"`
+	Notes        string            `json:"notes,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	UTM          *models.UTMParams `json:"utm,omitempty"`
+	UTMOverride  bool              `json:"utm_override,omitempty"`
+	Passthrough  bool              `json:"passthrough,omitempty"`
+	Interstitial bool              `json:"interstitial,omitempty"`
+	Variants     []models.Variant  `json:"variants,omitempty"`
+	Rotation     string            `json:"rotation,omitempty"`
+	Clicks       int64             `json:"clicks"`
+	CreatedAt    time.Time         `json:"created_at"`
+	LastAccessed *time.Time        `json:"last_accessed,omitempty"`
+}
+
+// columns is the CSV header, in the order fields are written. Tags are
+// separated by spaces within their cell and UTM parameters are written as a
+// query string, such as utm_source=mail&utm_medium=email. Variants are
+// written as a JSON array.
+var columns = []string{
+	"short_code", "original_url", "canonical_url", "redirect_type", "cache_control",
+	"expires_at", "title", "notes", "tags", "utm", "utm_override", "passthrough", "interstitial", "variants", "rotation", "clicks", "created_at", "last_accessed",
+}
+
+// FromURL builds the exported record of a link
+func FromURL(url *models.URL) Record {
+	return Record{
+		ShortCode:    url.ShortCode,
+		OriginalURL:  url.OriginalURL,
+		CanonicalURL: url.Destination(),
+		RedirectType: url.RedirectType,
+		CacheControl: url.CacheControl,
+		ExpiresAt:    url.ExpiresAt,
+		Title:        url.Title,
+		Notes:        url.Notes,
+		Tags:         url.Tags,
+		UTM:          url.UTM,
+		UTMOverride:  url.UTMOverride,
+		Passthrough:  url.Passthrough,
+		Interstitial: url.Interstitial,
+		Variants:     url.Variants,
+		Rotation:     url.Rotation,
+		Clicks:       url.Clicks,
+		CreatedAt:    url.CreatedAt,
+		LastAccessed: url.LastAccessed,
+	}
+}
+
+// Request returns the shorten request that recreates the record's link.
+// The canonical URL is derived again on import, so it is not carried over.
+func (r Record) Request() *models.ShortenRequest {
+	return &models.ShortenRequest{
+		URL:          r.OriginalURL,
+		CustomCode:   r.ShortCode,
+		RedirectType: r.RedirectType,
+		CacheControl: r.CacheControl,
+		ExpiresAt:    r.ExpiresAt,
+		Title:        r.Title,
+		Notes:        r.Notes,
+		Tags:         r.Tags,
+		UTM:          r.UTM,
+		UTMOverride:  r.UTMOverride,
+		Passthrough:  r.Passthrough,
+		Interstitial: r.Interstitial,
+		Variants:     r.Variants,
+		Rotation:     r.Rotation,
+	}
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Encoder writes records in one of the supported formats
+type Encoder interface {
+	Encode(record Record) error
+	// Flush writes any buffered data to the underlying writer
+	Flush() error
+}
+
+// NewEncoder returns an encoder writing format to w
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(columns); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{writer: writer}, nil
+	case FormatNDJSON:
+		buffered := bufio.NewWriter(w)
+		return &ndjsonEncoder{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+type csvEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvEncoder) Encode(r Record) error {
+	redirectType := ""
+	if r.RedirectType != 0 {
+		redirectType = strconv.Itoa(r.RedirectType)
+	}
+
+	var utm string
+	if r.UTM != nil {
+		utm = r.UTM.Encode()
+	}
+
+	var variants string
+	if len(r.Variants) > 0 {
+		data, err := json.Marshal(r.Variants)
+		if err != nil {
+			return err
+		}
+		variants = string(data)
+	}
+
+	row := []string{
+		r.ShortCode, r.OriginalURL, r.CanonicalURL, redirectType, r.CacheControl,
+		formatTime(r.ExpiresAt), r.Title, r.Notes, strings.Join(r.Tags, " "), utm, formatBool(r.UTMOverride), formatBool(r.Passthrough), formatBool(r.Interstitial),
+		variants, r.Rotation,
+		strconv.FormatInt(r.Clicks, 10), r.CreatedAt.Format(time.RFC3339Nano), formatTime(r.LastAccessed),
+	}
+	for i := range row {
+		row[i] = escapeCell(row[i])
+	}
+	return e.writer.Write(row)
+}
+
+func (e *csvEncoder) Flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type ndjsonEncoder struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(r Record) error {
+	return e.encoder.Encode(r)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return e.buffered.Flush()
+}
+
+// RowError reports a record that could not be decoded. Decoding can continue
+// with the next record.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Decoder reads records in one of the supported formats
+type Decoder interface {
+	// Decode returns the next record and the line it started on. It returns
+	// io.EOF after the last record and a *RowError for malformed records.
+	Decode() (Record, int, error)
+}
+
+// NewDecoder returns a decoder reading format from r
+func NewDecoder(r io.Reader, format string) (Decoder, error) {
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		return &csvDecoder{reader: reader}, nil
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		return &ndjsonDecoder{scanner: scanner}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+type csvDecoder struct {
+	reader *csv.Reader
+	header map[string]int
+}
+
+func (d *csvDecoder) Decode() (Record, int, error) {
+	if d.header == nil {
+		names, err := d.reader.Read()
+		if err != nil {
+			return Record{}, 0, err
+		}
+		d.header = make(map[string]int, len(names))
+		for i, name := range names {
+			d.header[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		// "url" is accepted so hand-written files can use the API field name
+		if _, ok := d.header["original_url"]; !ok {
+			if i, ok := d.header["url"]; ok {
+				d.header["original_url"] = i
+			} else {
+				return Record{}, 1, errors.New("csv header has no original_url column")
+			}
+		}
+	}
+
+	fields, err := d.reader.Read()
+	if err != nil {
+		return Record{}, 0, err
+	}
+	line, _ := d.reader.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := d.header[name]; ok && i < len(fields) {
+			return unescapeCell(strings.TrimSpace(fields[i]))
+		}
+		return ""
+	}
+
+	record := Record{
+		ShortCode:    field("short_code"),
+		OriginalURL:  field("original_url"),
+		CanonicalURL: field("canonical_url"),
+		CacheControl: field("cache_control"),
+		Title:        field("title"),
+		Notes:        field("notes"),
+		Tags:         strings.Fields(field("tags")),
+		Rotation:     field("rotation"),
+	}
+	if value := field("redirect_type"); value != "" {
+		if record.RedirectType, err = strconv.Atoi(value); err != nil {
+			return Record{}, line, &RowError{Line: line, Err: fmt.Errorf("invalid redirect_type %q", value)}
+		}
+	}
+	if value := field("utm"); value != "" {
+		utm, err := models.ParseUTM(value)
+		if err != nil {
+			return Record{}, line, &RowError{Line: line, Err: fmt.Errorf("invalid utm: %v", err)}
+		}
+		record.UTM = &utm
+	}
+	if value := field("variants"); value != "" {
+		if err := json.Unmarshal([]byte(value), &record.Variants); err != nil {
+			return Record{}, line, &RowError{Line: line, Err: fmt.Errorf("invalid variants: %v", err)}
+		}
+	}
+	flags := []struct {
+		name   string
+		target *bool
+	}{
+		{"utm_override", &record.UTMOverride},
+		{"passthrough", &record.Passthrough},
+		{"interstitial", &record.Interstitial},
+	}
+	for _, f := range flags {
+		if value := field(f.name); value != "" {
+			if *f.target, err = strconv.ParseBool(value); err != nil {
+				return Record{}, line, &RowError{Line: line, Err: fmt.Errorf("invalid %s %q", f.name, value)}
+			}
+		}
+	}
+	if value := field("clicks"); value != "" {
+		if record.Clicks, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return Record{}, line, &RowError{Line: line, Err: fmt.Errorf("invalid clicks %q", value)}
+		}
+	}
+
+	times := []struct {
+		name   string
+		target **time.Time
+	}{
+		{"expires_at", &record.ExpiresAt},
+		{"last_accessed", &record.LastAccessed},
+	}
+	for _, t := range times {
+		if *t.target, err = parseTime(field(t.name)); err != nil {
+			return Record{}, line, &RowError{Line: line, Err: fmt.Errorf("invalid %s: %v", t.name, err)}
+		}
+	}
+	createdAt, err := parseTime(field("created_at"))
+	if err != nil {
+		return Record{}, line, &RowError{Line: line, Err: fmt.Errorf("invalid created_at: %v", err)}
+	}
+	if createdAt != nil {
+		record.CreatedAt = *createdAt
+	}
+
+	return record, line, nil
+}
+
+type ndjsonDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (d *ndjsonDecoder) Decode() (Record, int, error) {
+	for d.scanner.Scan() {
+		d.line++
+		data := strings.TrimSpace(d.scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return Record{}, d.line, &RowError{Line: d.line, Err: err}
+		}
+		return record, d.line, nil
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return Record{}, d.line, err
+	}
+	return Record{}, d.line, io.EOF
+}
+
+// formulaPrefixes start cells that spreadsheets run as formulas
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeCell prefixes cells a spreadsheet would run as a formula with a
+// quote, so opening an export cannot execute a title or note. Cells already
+// starting with a quote get one too, so unescapeCell restores them exactly.
+func escapeCell(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes+"'", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCell drops the quote escapeCell added. A quote before anything
+// else is kept, as hand-written files may start a cell with one.
+func unescapeCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes+"'", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// formatBool leaves false cells empty so hand-edited files stay readable
+func formatBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return ""
+}
+
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
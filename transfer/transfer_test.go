@@ -0,0 +1,158 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/models"
+)
+
+func TestRoundTrip(t *testing.T) {
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	accessed := time.Date(2026, 2, 3, 4, 5, 6, 7, time.UTC)
+	records := []Record{
+		{
+			ShortCode: "spring", OriginalURL: "https://example.com/a?x=1,2", CanonicalURL: "https://example.com/a?x=1,2",
+			RedirectType: 301, CacheControl: "no-store", ExpiresAt: &expires, Notes: "line one\nline \"two\"",
+			Title: "Spring, 2026", Tags: []string{"launch", "q2"},
+			UTM: &models.UTMParams{Source: "mail", Campaign: "spring & summer"}, UTMOverride: true, Passthrough: true, Interstitial: true,
+			Variants: []models.Variant{{Name: "a", URL: "https://example.com/a", Weight: 3}, {Name: "b", URL: "https://example.com/b,c", Weight: 1}},
+			Rotation: "sticky",
+			Clicks:   42, CreatedAt: time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC), LastAccessed: &accessed,
+		},
+		{ShortCode: "plain", OriginalURL: "https://example.com", CreatedAt: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder, err := NewEncoder(&buf, format)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for _, record := range records {
+				if err := encoder.Encode(record); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+			encoder.Flush()
+
+			decoder, _ := NewDecoder(&buf, format)
+			for i, want := range records {
+				got, _, err := decoder.Decode()
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if got.ShortCode != want.ShortCode || got.OriginalURL != want.OriginalURL || got.Notes != want.Notes ||
+					got.RedirectType != want.RedirectType || got.Clicks != want.Clicks || !got.CreatedAt.Equal(want.CreatedAt) {
+					t.Errorf("Record %d: expected %+v, got %+v", i, want, got)
+				}
+				if (got.ExpiresAt == nil) != (want.ExpiresAt == nil) || (got.ExpiresAt != nil && !got.ExpiresAt.Equal(*want.ExpiresAt)) {
+					t.Errorf("Record %d: expected expiry %v, got %v", i, want.ExpiresAt, got.ExpiresAt)
+				}
+				if got.Title != want.Title || strings.Join(got.Tags, " ") != strings.Join(want.Tags, " ") {
+					t.Errorf("Record %d: expected title %q and tags %v, got %q and %v", i, want.Title, want.Tags, got.Title, got.Tags)
+				}
+				if got.Passthrough != want.Passthrough || got.Interstitial != want.Interstitial {
+					t.Errorf("Record %d: expected passthrough %t and interstitial %t, got %t and %t",
+						i, want.Passthrough, want.Interstitial, got.Passthrough, got.Interstitial)
+				}
+				if fmt.Sprint(got.UTM) != fmt.Sprint(want.UTM) || got.UTMOverride != want.UTMOverride {
+					t.Errorf("Record %d: expected UTM %v (override %t), got %v (override %t)", i, want.UTM, want.UTMOverride, got.UTM, got.UTMOverride)
+				}
+				if fmt.Sprint(got.Variants) != fmt.Sprint(want.Variants) || got.Rotation != want.Rotation {
+					t.Errorf("Record %d: expected variants %v (%s), got %v (%s)", i, want.Variants, want.Rotation, got.Variants, got.Rotation)
+				}
+				if (got.LastAccessed == nil) != (want.LastAccessed == nil) {
+					t.Errorf("Record %d: expected last accessed %v, got %v", i, want.LastAccessed, got.LastAccessed)
+				}
+			}
+			if _, _, err := decoder.Decode(); err != io.EOF {
+				t.Errorf("Expected io.EOF, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFormulaCells(t *testing.T) {
+	record := Record{
+		ShortCode: "sheet", OriginalURL: "https://example.com", Title: `=HYPERLINK("https://evil.example","x")`,
+		Notes: "-2+3", Tags: []string{"@home", "ok"}, Rotation: "'quoted", CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	var buf bytes.Buffer
+	encoder, _ := NewEncoder(&buf, FormatCSV)
+	encoder.Encode(record)
+	encoder.Flush()
+
+	for _, cell := range []string{`"'=HYPERLINK(`, ",'-2+3,", ",'@home ok,", ",''quoted,"} {
+		if !strings.Contains(buf.String(), cell) {
+			t.Errorf("Expected the export to hold %s, got %s", cell, buf.String())
+		}
+	}
+
+	decoder, _ := NewDecoder(&buf, FormatCSV)
+	got, _, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got.Title != record.Title || got.Notes != record.Notes || strings.Join(got.Tags, " ") != "@home ok" || got.Rotation != record.Rotation {
+		t.Errorf("Expected %+v, got %+v", record, got)
+	}
+
+	t.Run("Keep quotes of hand-written files", func(t *testing.T) {
+		decoder, _ := NewDecoder(strings.NewReader("url,notes\nhttps://example.com,'tis the season\n"), FormatCSV)
+		got, _, _ := decoder.Decode()
+		if got.Notes != "'tis the season" {
+			t.Errorf("Expected the quote to be kept, got %q", got.Notes)
+		}
+	})
+}
+
+func TestDecodeErrors(t *testing.T) {
+	t.Run("CSV rows fail independently", func(t *testing.T) {
+		input := "url,short_code,clicks\nhttps://example.com,a,many\nhttps://example.org,b,3\n"
+		decoder, _ := NewDecoder(strings.NewReader(input), FormatCSV)
+
+		_, line, err := decoder.Decode()
+		var rowErr *RowError
+		if !errors.As(err, &rowErr) || line != 2 {
+			t.Errorf("Expected row error on line 2, got %v on line %d", err, line)
+		}
+
+		record, line, err := decoder.Decode()
+		if err != nil || record.ShortCode != "b" || record.Clicks != 3 || line != 3 {
+			t.Errorf("Expected row b on line 3, got %+v on line %d (%v)", record, line, err)
+		}
+	})
+
+	t.Run("CSV requires a URL column", func(t *testing.T) {
+		decoder, _ := NewDecoder(strings.NewReader("short_code\na\n"), FormatCSV)
+		if _, _, err := decoder.Decode(); err == nil {
+			t.Error("Expected error for missing original_url column")
+		}
+	})
+
+	t.Run("NDJSON skips blank lines", func(t *testing.T) {
+		input := "{\"original_url\":\"https://example.com\"}\n\n{bad json}\n"
+		decoder, _ := NewDecoder(strings.NewReader(input), FormatNDJSON)
+
+		if _, line, err := decoder.Decode(); err != nil || line != 1 {
+			t.Errorf("Expected record on line 1, got %v on line %d", err, line)
+		}
+		var rowErr *RowError
+		if _, line, err := decoder.Decode(); !errors.As(err, &rowErr) || line != 3 {
+			t.Errorf("Expected row error on line 3, got %v on line %d", err, line)
+		}
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		if _, err := NewDecoder(strings.NewReader(""), "xml"); err != ErrUnknownFormat {
+			t.Errorf("Expected ErrUnknownFormat, got %v", err)
+		}
+	})
+}
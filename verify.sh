@@ -46,7 +46,7 @@ fi
 # Run tests
 echo ""
 echo "Running tests..."
-if go test ./service/... ./storage/... -v; then
+if go test -tags sqlite_fts5 ./service/... ./storage/... -v; then
     echo -e "${GREEN}✓${NC} All tests passed"
 else
     echo -e "${RED}✗${NC} Some tests failed"
@@ -55,7 +55,7 @@ fi
 # Try to build
 echo ""
 echo -n "Building application... "
-if go build -o bin/url-shortener main.go; then
+if go build -tags sqlite_fts5 -o bin/url-shortener .; then
     echo -e "${GREEN}✓${NC}"
 else
     echo -e "${RED}✗${NC} Build failed"